@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alanfran/gameprofile/profile"
+	"github.com/gin-gonic/gin"
+)
+
+// adminKey is the context key of the name of the admin who made a request.
+const adminKey = "gameprofile.admin"
+
+// adminName returns the name of the admin whose key is in the request's Authorization header.
+func (a *App) adminName(c *gin.Context) (string, bool) {
+	key := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if key == "" {
+		return "", false
+	}
+
+	name, ok := a.AdminKeys[key]
+	return name, ok
+}
+
+// requireAdmin rejects requests that do not carry a key from the admin key file, reads included, since the admin
+// routes hand out whole databases and webhook secrets. The admin is recorded as the caller.
+func (a *App) requireAdmin(c *gin.Context) {
+	name, ok := a.adminName(c)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "Please supply a valid admin key.",
+		})
+		return
+	}
+	c.Set(adminKey, name)
+	c.Next()
+}
+
+// GetExport streams every profile and punishment as a JSON Lines archive, read from the underlying store.
+func (a *App) GetExport(c *gin.Context) {
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", `attachment; filename="gameprofile.jsonl"`)
+	c.Status(http.StatusOK)
+
+	err := profile.Export(profile.Underlying(a.profiles), c.Writer)
+	if err != nil {
+		// The status line has already been sent, so all we can do is cut the archive short.
+		c.Error(err)
+	}
+}
+
+// PostImport reads a JSON Lines archive from the request body and stores its records.
+// Existing records are skipped unless the overwrite query parameter is "true". Records go straight to the underlying
+// store, so that a restore is not escalated and does not publish an event, and a webhook delivery, per record.
+func (a *App) PostImport(c *gin.Context) {
+	opts := profile.ImportOptions{
+		Overwrite: c.Query("overwrite") == "true",
+	}
+
+	stats, err := profile.Import(profile.Underlying(a.profiles), c.Request.Body, opts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+			"stats": stats,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// GetBackup streams a consistent snapshot of the database while the service keeps running.
+// It responds with 501 Not Implemented when the store does not support hot backups.
+func (a *App) GetBackup(c *gin.Context) {
+	b, ok := profile.Underlying(a.profiles).(profile.Backuper)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{
+			"error": "This store does not support backups.",
+		})
+		return
+	}
+
+	name := fmt.Sprintf("gameprofile-%s.db", time.Now().UTC().Format("20060102T150405Z"))
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Disposition", `attachment; filename="`+name+`"`)
+	c.Status(http.StatusOK)
+
+	_, err := b.Backup(c.Writer)
+	if err != nil {
+		c.Error(err)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"github.com/alanfran/gameprofile/profile"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Admin endpoints", func() {
+	var app *App
+	var resp *httptest.ResponseRecorder
+	var testProfile profile.Profile
+
+	BeforeEach(func() {
+		app = NewApp(profile.NewMockStore())
+		app.AdminKeys = map[string]string{"admin_secret": "some_admin"}
+		resp = httptest.NewRecorder()
+		testProfile = profile.Profile{
+			ID:        "test_profile",
+			Coins:     1234,
+			Inventory: map[string]string{},
+			Equipment: map[string]string{},
+		}
+	})
+
+	It("returns 401 Unauthorized without an admin key, reads included", func() {
+		for _, key := range []string{"", "wrong"} {
+			req, err := http.NewRequest("GET", "/v1/admin/export", nil)
+			Expect(err).ToNot(HaveOccurred())
+			if key != "" {
+				req.Header.Set("Authorization", "Bearer "+key)
+			}
+			resp = httptest.NewRecorder()
+			app.engine.ServeHTTP(resp, req)
+			Expect(resp.Code).To(Equal(http.StatusUnauthorized))
+		}
+
+		app.AdminKeys = nil
+		req, err := http.NewRequest("GET", "/v1/admin/backup", nil)
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Set("Authorization", "Bearer admin_secret")
+		resp = httptest.NewRecorder()
+		app.engine.ServeHTTP(resp, req)
+		Expect(resp.Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	Context("/v1/admin/export", func() {
+		BeforeEach(func() {
+			Expect(app.profiles.PutProfile(testProfile)).To(Succeed())
+		})
+
+		It("returns 200 Success and a JSON Lines archive", func() {
+			req, err := http.NewRequest("GET", "/v1/admin/export", nil)
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Set("Authorization", "Bearer admin_secret")
+			app.engine.ServeHTTP(resp, req)
+
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(resp.Header().Get("Content-Type")).To(Equal("application/x-ndjson"))
+
+			ar, err := profile.NewArchiveReader(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+
+			// The built-in punishment types come first.
+			rec, err := ar.Next()
+			for err == nil && rec.Kind == profile.KindPunishmentType {
+				rec, err = ar.Next()
+			}
+			Expect(err).ToNot(HaveOccurred())
+			Expect(*rec.Profile).To(Equal(testProfile))
+		})
+	})
+
+	Context("/v1/admin/import", func() {
+		var archive bytes.Buffer
+
+		BeforeEach(func() {
+			archive.Reset()
+			src := profile.NewMockStore()
+			Expect(src.PutProfile(testProfile)).To(Succeed())
+			Expect(profile.Export(src, &archive)).To(Succeed())
+		})
+
+		It("returns 200 Success and stores the archived records", func() {
+			req, err := http.NewRequest("POST", "/v1/admin/import", &archive)
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Set("Authorization", "Bearer admin_secret")
+			app.engine.ServeHTTP(resp, req)
+
+			Expect(resp.Code).To(Equal(http.StatusOK))
+
+			body, err := ioutil.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+
+			var stats profile.ImportStats
+			Expect(json.Unmarshal(body, &stats)).To(Succeed())
+			Expect(stats.Profiles).To(Equal(1))
+
+			p, err := app.profiles.GetProfile(testProfile.ID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).To(Equal(testProfile))
+		})
+
+		It("does not publish the imported records", func() {
+			sub := app.events.Subscribe(profile.EventFilter{}, 0)
+			defer sub.Close()
+
+			req, err := http.NewRequest("POST", "/v1/admin/import", &archive)
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Set("Authorization", "Bearer admin_secret")
+			app.engine.ServeHTTP(resp, req)
+			Expect(resp.Code).To(Equal(http.StatusOK))
+
+			Consistently(sub.C).ShouldNot(Receive())
+		})
+
+		It("returns 400 Bad Request for a malformed archive", func() {
+			req, err := http.NewRequest("POST", "/v1/admin/import", bytes.NewBufferString("not an archive"))
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Set("Authorization", "Bearer admin_secret")
+			app.engine.ServeHTTP(resp, req)
+
+			Expect(resp.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	Context("/v1/admin/backup", func() {
+		It("returns 501 Not Implemented when the store cannot take backups", func() {
+			req, err := http.NewRequest("GET", "/v1/admin/backup", nil)
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Set("Authorization", "Bearer admin_secret")
+			app.engine.ServeHTTP(resp, req)
+
+			Expect(resp.Code).To(Equal(http.StatusNotImplemented))
+		})
+
+		Context("Using a Bolt store", func() {
+			var dir string
+			var store *profile.BoltStore
+
+			BeforeEach(func() {
+				var err error
+				dir, err = ioutil.TempDir("", "test-backup")
+				Expect(err).ToNot(HaveOccurred())
+
+				store, err = profile.NewBoltStore(filepath.Join(dir, "bolt.db"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(store.PutProfile(testProfile)).To(Succeed())
+				app = NewApp(store)
+				app.AdminKeys = map[string]string{"admin_secret": "some_admin"}
+			})
+
+			AfterEach(func() {
+				store.Close()
+				os.RemoveAll(dir)
+			})
+
+			It("returns 200 Success and a snapshot of the database", func() {
+				req, err := http.NewRequest("GET", "/v1/admin/backup", nil)
+				Expect(err).ToNot(HaveOccurred())
+				req.Header.Set("Authorization", "Bearer admin_secret")
+				app.engine.ServeHTTP(resp, req)
+
+				Expect(resp.Code).To(Equal(http.StatusOK))
+
+				snapshot := filepath.Join(dir, "snapshot.db")
+				Expect(ioutil.WriteFile(snapshot, resp.Body.Bytes(), 0600)).To(Succeed())
+				Expect(profile.VerifyBoltSnapshot(snapshot)).To(Succeed())
+			})
+		})
+	})
+})
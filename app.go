@@ -1,12 +1,16 @@
 package main
 
 import (
+	"time"
+
 	"github.com/alanfran/gameprofile/profile"
 	"github.com/gin-gonic/gin"
 )
 
 type App struct {
 	profiles profile.Storer
+	events   *profile.Bus
+	webhooks *profile.Dispatcher
 	Config
 	engine *gin.Engine
 }
@@ -16,19 +20,62 @@ type Config struct {
 	dbUser     string
 	dbPassword string
 	dbDatabase string
+
+	// ServerKeys maps the keys game servers authenticate with to their names.
+	ServerKeys map[string]string
+
+	// AdminKeys maps the keys admins authenticate with to their names. Without any, the /admin routes are closed.
+	AdminKeys map[string]string
+
+	// IdempotencyWindow is how long responses to requests with an Idempotency-Key are replayed.
+	IdempotencyWindow time.Duration
+	// IdempotencyCacheSize is the most responses kept for replay. The oldest are dropped first.
+	IdempotencyCacheSize int
+
+	// RequireSignatures rejects writes that are not signed with one of the ServerKeys.
+	RequireSignatures bool
+	// RequireSignedReads rejects reads that are not signed, or made with a server or admin key.
+	RequireSignedReads bool
+
+	// Escalation raises the punishments issued to players with a record, through every API.
+	Escalation profile.EscalationPolicy
 }
 
 // NewApp initializes a new App with a profile.Storer, registers application routes, then returns a reference to the App.
+// Changes made through the App are published on its event bus, and sent to webhooks while the App runs.
 func NewApp(store profile.Storer) *App {
-	a := &App{profiles: store}
+	bus := profile.NewBus(profile.DefaultBusBacklog)
+	a := &App{
+		events:   bus,
+		webhooks: profile.NewDispatcher(store, bus),
+	}
+	escalating := profile.NewEscalatingStore(store, func() profile.EscalationPolicy { return a.Escalation })
+	a.profiles = profile.NewEventStore(escalating, bus)
 
 	a.initRoutes()
 
 	return a
 }
 
+// caller names whoever made a request, for the records the service keeps.
+// Game servers that sign their requests and admins are named by their key. Otherwise game servers and tools identify
+// themselves with the X-Caller header, or the client's address is used.
+func caller(c *gin.Context) string {
+	if name := c.GetString(signedServerKey); name != "" {
+		return name
+	}
+	if name := c.GetString(adminKey); name != "" {
+		return name
+	}
+	if name := c.GetHeader("X-Caller"); name != "" {
+		return name
+	}
+	return c.ClientIP()
+}
+
 // Run runs the application on the given interface/port.
 // Example: app.Run(":80")
 func (a *App) Run(port string) {
+	go a.webhooks.Run(nil)
 	a.engine.Run(port)
 }
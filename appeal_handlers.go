@@ -0,0 +1,198 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alanfran/gameprofile/profile"
+	"github.com/gin-gonic/gin"
+)
+
+// appealError answers a failed appeal write.
+func appealError(c *gin.Context, err error) {
+	if verr, ok := err.(*profile.ValidationError); ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Invalid appeal.",
+			"problems": verr.Problems,
+		})
+		return
+	}
+
+	switch err {
+	case profile.ErrAppealNotFound, profile.ErrPunishmentNotFound:
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+	case profile.ErrAppealExists, profile.ErrAppealDecided, profile.ErrPunishmentNotActive:
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "An error occurred while saving the appeal. Please try again later.",
+		})
+	}
+}
+
+// appealAuthor returns who an authenticated request acts as: the game server that signed it, or the admin whose key
+// it carries.
+func (a *App) appealAuthor(c *gin.Context) (string, bool) {
+	if name := c.GetString(signedServerKey); name != "" {
+		return name, true
+	}
+	return a.adminName(c)
+}
+
+// appealBy settles who makes a change to an appeal. Authenticated requests are made by whoever authenticated them,
+// and a By that names someone else is refused with 400 Bad Request. Otherwise by is kept, or the caller is used when
+// defaultCaller is set.
+func (a *App) appealBy(c *gin.Context, by string, defaultCaller bool) (string, bool) {
+	author, ok := a.appealAuthor(c)
+	if !ok {
+		if by == "" && defaultCaller {
+			by = caller(c)
+		}
+		return by, true
+	}
+
+	if by != "" && by != author {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "By does not match the server or admin that authenticated the request.",
+		})
+		return "", false
+	}
+	return author, true
+}
+
+// GetAppeals lists appeals, newest first.
+// Query parameters: status ("open", "accepted" or "rejected"), player, punishment and limit.
+func (a *App) GetAppeals(c *gin.Context) {
+	q := profile.AppealQuery{Status: c.Query("status"), PlayerID: c.Query("player")}
+
+	var err error
+	if pid := c.Query("punishment"); pid != "" {
+		q.PunishmentID, err = strconv.ParseInt(pid, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid punishment ID.",
+			})
+			return
+		}
+	}
+	if l := c.Query("limit"); l != "" {
+		q.Limit, err = strconv.Atoi(l)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "The limit must be a number.",
+			})
+			return
+		}
+	}
+
+	as, err := a.profiles.QueryAppeals(q)
+	if err == profile.ErrInvalidAppealStatus {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "An error occurred while reading the appeals. Please try again later.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, as)
+}
+
+// GetAppeal returns a single appeal with its history.
+func (a *App) GetAppeal(c *gin.Context) {
+	id, ok := idParam(c, "appeal")
+	if !ok {
+		return
+	}
+
+	ap, err := a.profiles.GetAppeal(id)
+	if err == profile.ErrAppealNotFound {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "An error occurred while reading the appeal. Please try again later.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ap)
+}
+
+// PostAppeal files a player's appeal against a punishment in force.
+func (a *App) PostAppeal(c *gin.Context) {
+	var req AppealRequest
+	err := bindJSON(c, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "There was an error processing your request. Please make sure your JSON is well-formed.",
+		})
+		return
+	}
+
+	by, ok := a.appealBy(c, req.By, false)
+	if !ok {
+		return
+	}
+
+	ap, err := a.profiles.FileAppeal(req.PunishmentID, profile.AppealEvent{By: by, Date: time.Now(), Comment: req.Comment})
+	if err != nil {
+		appealError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, ap)
+}
+
+// PostAppealEvent records a comment on an appeal, or the decision to accept or reject it. The change is dated by the
+// service. Only admins and game servers that sign their requests can decide appeals, and their changes are made by
+// them; other changes are made by the caller unless the body names someone.
+func (a *App) PostAppealEvent(c *gin.Context) {
+	id, ok := idParam(c, "appeal")
+	if !ok {
+		return
+	}
+
+	var e profile.AppealEvent
+	err := bindJSON(c, &e)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "There was an error processing your request. Please make sure your JSON is well-formed.",
+		})
+		return
+	}
+
+	if _, ok := a.appealAuthor(c); !ok && (e.Action == profile.AppealAccept || e.Action == profile.AppealReject) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Please sign your request or supply an admin key to decide appeals.",
+		})
+		return
+	}
+
+	e.Date = time.Now()
+	e.PreviousExpires = time.Time{}
+	e.By, ok = a.appealBy(c, e.By, true)
+	if !ok {
+		return
+	}
+
+	ap, p, err := a.profiles.RecordAppealEvent(id, e)
+	if err != nil {
+		appealError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, AppealResult{Appeal: ap, Punishment: p})
+}
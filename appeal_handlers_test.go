@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	"github.com/alanfran/gameprofile/profile"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Appeals", func() {
+	var app *App
+
+	BeforeEach(func() {
+		app = NewApp(profile.NewMockStore())
+		app.AdminKeys = map[string]string{"admin_secret": "some_admin"}
+		app.ServerKeys = map[string]string{"secret": "server_1"}
+		_, err := app.profiles.ImportPunishment(profile.Punishment{ID: 1, PlayerID: "some_user", By: "some_admin", Type: profile.TypeBan})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = app.profiles.ImportPunishment(profile.Punishment{ID: 2, PlayerID: "some_user", By: "some_admin", Type: profile.TypeChatGag,
+			Expires: time.Now().Add(-time.Minute)})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	// send makes a request, with an admin key or signed by server_1 when auth is "admin" or "server".
+	nonces := 0
+	send := func(auth, method, url string, v interface{}) *httptest.ResponseRecorder {
+		var body []byte
+		if v != nil {
+			body, _ = json.Marshal(v)
+		}
+		req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Caller", "some_moderator")
+		switch auth {
+		case "admin":
+			req.Header.Set("Authorization", "Bearer admin_secret")
+		case "server":
+			ts := strconv.FormatInt(time.Now().Unix(), 10)
+			nonces++
+			nonce := strconv.Itoa(nonces)
+			req.Header.Set(ServerHeader, "server_1")
+			req.Header.Set(profile.TimestampHeader, ts)
+			req.Header.Set(NonceHeader, nonce)
+			req.Header.Set(profile.SignatureHeader, SignRequest("secret", ts, nonce, method, url, body))
+		}
+
+		resp := httptest.NewRecorder()
+		app.engine.ServeHTTP(resp, req)
+		return resp
+	}
+
+	request := func(method, url string, v interface{}) *httptest.ResponseRecorder {
+		return send("", method, url, v)
+	}
+
+	file := func(punishmentID int64) profile.Appeal {
+		resp := request("POST", "/v1/appeals", AppealRequest{PunishmentID: punishmentID, Comment: "I was not cheating."})
+		Expect(resp.Code).To(Equal(http.StatusCreated), resp.Body.String())
+
+		var a profile.Appeal
+		Expect(json.Unmarshal(resp.Body.Bytes(), &a)).To(Succeed())
+		return a
+	}
+
+	It("files appeals against punishments in force", func() {
+		resp := request("POST", "/v1/appeals", AppealRequest{PunishmentID: 1})
+		Expect(resp.Code).To(Equal(http.StatusBadRequest))
+		Expect(resp.Body.String()).To(ContainSubstring("problems"))
+
+		a := file(1)
+		Expect(a.Status).To(Equal(profile.AppealOpen))
+		Expect(a.History[0].By).To(Equal("some_user"))
+
+		Expect(request("POST", "/v1/appeals", AppealRequest{PunishmentID: 1, Comment: "Again."}).Code).To(Equal(http.StatusConflict))
+		Expect(request("POST", "/v1/appeals", AppealRequest{PunishmentID: 2, Comment: "I was not spamming."}).Code).To(Equal(http.StatusConflict))
+		Expect(request("POST", "/v1/appeals", AppealRequest{PunishmentID: 3, Comment: "Who?"}).Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("records comments and decisions by the caller, and lifts accepted punishments", func() {
+		a := file(1)
+		url := "/v1/appeals/" + strconv.FormatInt(a.ID, 10)
+
+		resp := request("POST", url+"/events", profile.AppealEvent{Action: profile.AppealComment, Comment: "Checking the demo."})
+		Expect(resp.Code).To(Equal(http.StatusOK), resp.Body.String())
+
+		resp = send("admin", "POST", url+"/events", profile.AppealEvent{Action: profile.AppealAccept})
+		Expect(resp.Code).To(Equal(http.StatusOK), resp.Body.String())
+		var res AppealResult
+		Expect(json.Unmarshal(resp.Body.Bytes(), &res)).To(Succeed())
+		Expect(res.Appeal.Status).To(Equal(profile.AppealAccepted))
+		Expect(res.Appeal.History).To(HaveLen(3))
+		Expect(res.Appeal.History[1].By).To(Equal("some_moderator"))
+		Expect(res.Appeal.History[2].By).To(Equal("some_admin"))
+		Expect(res.Punishment.Active(time.Now())).To(BeFalse())
+
+		Expect(send("admin", "POST", url+"/events", profile.AppealEvent{Action: profile.AppealReject}).Code).To(Equal(http.StatusConflict))
+		Expect(request("POST", url+"/events", profile.AppealEvent{Action: "escalate"}).Code).To(Equal(http.StatusBadRequest))
+		Expect(request("POST", "/v1/appeals/99/events", profile.AppealEvent{Action: profile.AppealComment, Comment: "Hello?"}).Code).To(Equal(http.StatusNotFound))
+
+		resp = request("GET", url, nil)
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(request("GET", "/v1/appeals/99", nil).Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("lets only admins and signed servers decide appeals, as themselves", func() {
+		a := file(1)
+		url := "/v1/appeals/" + strconv.FormatInt(a.ID, 10) + "/events"
+
+		Expect(request("POST", url, profile.AppealEvent{Action: profile.AppealAccept}).Code).To(Equal(http.StatusUnauthorized))
+		Expect(request("POST", url, profile.AppealEvent{Action: profile.AppealReject, By: "some_admin"}).Code).To(Equal(http.StatusUnauthorized))
+		Expect(send("admin", "POST", url, profile.AppealEvent{Action: profile.AppealAccept, By: "someone_else"}).Code).To(Equal(http.StatusBadRequest))
+		Expect(send("server", "POST", url, profile.AppealEvent{Action: profile.AppealComment, Comment: "Hm.", By: "some_admin"}).Code).To(Equal(http.StatusBadRequest))
+
+		resp := send("server", "POST", url, profile.AppealEvent{Action: profile.AppealReject, Comment: "The demo shows an aimbot."})
+		Expect(resp.Code).To(Equal(http.StatusOK), resp.Body.String())
+		var res AppealResult
+		Expect(json.Unmarshal(resp.Body.Bytes(), &res)).To(Succeed())
+		Expect(res.Appeal.Status).To(Equal(profile.AppealRejected))
+		Expect(res.Appeal.History[1].By).To(Equal("server_1"))
+	})
+
+	It("lists appeals by status", func() {
+		file(1)
+
+		resp := request("GET", "/v1/appeals?status=open", nil)
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		var as []profile.Appeal
+		Expect(json.Unmarshal(resp.Body.Bytes(), &as)).To(Succeed())
+		Expect(as).To(HaveLen(1))
+
+		resp = request("GET", "/v1/appeals?status=rejected&player=some_user", nil)
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(resp.Body.String()).To(MatchJSON(`[]`))
+
+		Expect(request("GET", "/v1/appeals?status=lost", nil).Code).To(Equal(http.StatusBadRequest))
+		Expect(request("GET", "/v1/appeals?punishment=one", nil).Code).To(Equal(http.StatusBadRequest))
+	})
+})
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/alanfran/gameprofile/profile"
+	"github.com/gin-gonic/gin"
+)
+
+// maxBulkWrites is the most writes a bulk request may hold.
+const maxBulkWrites = 1000
+
+// bulkItemResult describes the outcome of one write of a bulk request with an HTTP status.
+func bulkItemResult(op profile.BulkOp, r profile.BulkResult) BulkItemResult {
+	if r.Err == nil {
+		res := BulkItemResult{Status: http.StatusOK, ID: r.ID, Escalation: r.Escalation}
+		if op.Profile != nil {
+			res.Hash = NewProfileWithHash(*op.Profile).Hash
+		}
+		return res
+	}
+
+	if verr, ok := r.Err.(*profile.ValidationError); ok {
+		return BulkItemResult{Status: http.StatusBadRequest, Error: "Invalid write.", Problems: verr.Problems}
+	}
+	if r.Err == profile.ErrBulkRolledBack {
+		return BulkItemResult{Status: http.StatusFailedDependency, Error: r.Err.Error()}
+	}
+	return BulkItemResult{Status: http.StatusInternalServerError, Error: "An error occurred while storing this write."}
+}
+
+// PostBulk stores many profiles and punishments in one request, either all or nothing, or each on its own.
+// It answers 200 OK when every write was stored, and 207 Multi-Status with the status of each write otherwise.
+// Profiles are written as given, without the hash check of updates.
+func (a *App) PostBulk(c *gin.Context) {
+	var req BulkRequest
+	err := bindJSON(c, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "There was an error processing your request. Please make sure your JSON is well-formed.",
+		})
+		return
+	}
+
+	if len(req.Writes) > maxBulkWrites {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Please send at most " + strconv.Itoa(maxBulkWrites) + " writes at once.",
+		})
+		return
+	}
+
+	results, err := a.profiles.BulkWrite(req.Writes, req.Atomic, caller(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "An error occurred while storing the writes. Please try again later.",
+		})
+		return
+	}
+
+	resp := BulkResponse{Results: make([]BulkItemResult, len(results))}
+	status := http.StatusOK
+	for i, r := range results {
+		resp.Results[i] = bulkItemResult(req.Writes[i], r)
+		if r.Err != nil {
+			status = http.StatusMultiStatus
+		} else {
+			resp.Stored++
+		}
+	}
+
+	c.JSON(status, resp)
+}
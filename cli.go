@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/alanfran/gameprofile/profile"
+)
+
+// runExport implements the export command. The archive is written to stdout unless -o is given.
+func runExport(s profile.Storer, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	out := fs.String("o", "", "file to write the archive to (default stdout)")
+	fs.Parse(args)
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	return profile.Export(s, w)
+}
+
+// runImport implements the import command. The archive is read from stdin when the file is "-".
+func runImport(s profile.Storer, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	overwrite := fs.Bool("overwrite", false, "replace records that already exist instead of skipping them")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return errors.New("import needs exactly one archive file")
+	}
+
+	var r io.Reader = os.Stdin
+	if fs.Arg(0) != "-" {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	stats, err := profile.Import(s, r, profile.ImportOptions{Overwrite: *overwrite})
+	fmt.Fprintf(os.Stderr, "imported %d profiles and %d punishments, skipped %d existing records\n",
+		stats.Profiles, stats.Punishments, stats.Skipped)
+	return err
+}
+
+// runRestore implements the restore command.
+func runRestore(dbPath string, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return errors.New("restore needs exactly one snapshot file")
+	}
+
+	err := profile.RestoreBolt(fs.Arg(0), dbPath)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "restored %s from %s, the previous database was kept as %s.pre-restore\n",
+		dbPath, fs.Arg(0), dbPath)
+	return nil
+}
+
+// loadKeys reads the keys game servers or admins authenticate with. Each line of the file holds a name and its key,
+// separated by whitespace. Empty lines and lines starting with # are skipped.
+func loadKeys(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	keys := map[string]string{}
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected a name and a key", path, line)
+		}
+		keys[fields[1]] = fields[0]
+	}
+
+	return keys, sc.Err()
+}
+
+// loadEscalationPolicy reads the escalation rules from a JSON file, eg. {"Rules": [{"Name": "...", ...}]}.
+func loadEscalationPolicy(path string) (profile.EscalationPolicy, error) {
+	var pol profile.EscalationPolicy
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return pol, err
+	}
+
+	err = json.Unmarshal(data, &pol)
+	if err != nil {
+		return pol, fmt.Errorf("%s: %v", path, err)
+	}
+
+	if verr, ok := pol.Validate().(*profile.ValidationError); ok {
+		return pol, fmt.Errorf("%s: %s", path, strings.Join(verr.Problems, " "))
+	}
+	return pol, nil
+}
@@ -0,0 +1,126 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"strconv"
+
+	"github.com/alanfran/gameprofile/profile"
+)
+
+// Export downloads every record as a JSON Lines archive. The caller closes the archive.
+func (c *Client) Export(ctx context.Context) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, "GET", path("admin", "export"), nil, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Import loads a JSON Lines archive. With overwrite, records that exist are replaced instead of skipped.
+func (c *Client) Import(ctx context.Context, archive io.Reader, overwrite bool) (profile.ImportStats, error) {
+	q := url.Values{}
+	if overwrite {
+		q.Set("overwrite", "true")
+	}
+
+	var stats profile.ImportStats
+	resp, err := c.send(ctx, "POST", path("admin", "import"), q, archive, "application/x-ndjson")
+	if err != nil {
+		return stats, err
+	}
+	defer resp.Body.Close()
+	return stats, decode(resp, &stats)
+}
+
+// Backup downloads a snapshot of the database. The caller closes the snapshot.
+func (c *Client) Backup(ctx context.Context) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, "GET", path("admin", "backup"), nil, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// GetInventoryEvents reads a player's inventory log, newest first. A non-empty item restricts it to that item.
+func (c *Client) GetInventoryEvents(ctx context.Context, id, item string) ([]profile.InventoryEvent, error) {
+	q := url.Values{}
+	if item != "" {
+		q.Set("item", item)
+	}
+
+	var es []profile.InventoryEvent
+	err := c.do(ctx, "GET", path("admin", "inventory", id), q, nil, &es)
+	return es, err
+}
+
+// RestoreVersion puts an earlier version of a profile back. hash is the hash of the profile's current state.
+func (c *Client) RestoreVersion(ctx context.Context, id string, version int64, hash string) (ProfileWithHash, error) {
+	var p ProfileWithHash
+	err := c.do(ctx, "POST", path("admin", "history", id, "restore"), nil, struct {
+		Version int64
+		Hash    string
+	}{version, hash}, &p)
+	return p, err
+}
+
+// GetWebhooks lists the webhooks.
+func (c *Client) GetWebhooks(ctx context.Context) ([]profile.Webhook, error) {
+	var ws []profile.Webhook
+	err := c.do(ctx, "GET", path("admin", "webhooks"), nil, nil, &ws)
+	return ws, err
+}
+
+// GetWebhook reads a webhook.
+func (c *Client) GetWebhook(ctx context.Context, id int64) (profile.Webhook, error) {
+	var w profile.Webhook
+	err := c.do(ctx, "GET", path("admin", "webhooks", strconv.FormatInt(id, 10)), nil, nil, &w)
+	return w, err
+}
+
+// CreateWebhook adds a webhook. The answer has its ID.
+func (c *Client) CreateWebhook(ctx context.Context, w profile.Webhook) (profile.Webhook, error) {
+	var created profile.Webhook
+	err := c.do(ctx, "POST", path("admin", "webhooks"), nil, w, &created)
+	return created, err
+}
+
+// PutWebhook replaces the webhook with the ID of w.
+func (c *Client) PutWebhook(ctx context.Context, w profile.Webhook) (profile.Webhook, error) {
+	var stored profile.Webhook
+	err := c.do(ctx, "PUT", path("admin", "webhooks", strconv.FormatInt(w.ID, 10)), nil, w, &stored)
+	return stored, err
+}
+
+// DelWebhook deletes a webhook.
+func (c *Client) DelWebhook(ctx context.Context, id int64) error {
+	return c.do(ctx, "DELETE", path("admin", "webhooks", strconv.FormatInt(id, 10)), nil, nil, nil)
+}
+
+// GetDeliveries reads the delivery log, newest first. A non-zero q.WebhookID restricts it to that webhook.
+func (c *Client) GetDeliveries(ctx context.Context, q profile.DeliveryQuery) ([]profile.Delivery, error) {
+	p := path("admin", "deliveries")
+	if q.WebhookID != 0 {
+		p = path("admin", "webhooks", strconv.FormatInt(q.WebhookID, 10), "deliveries")
+	}
+
+	v := url.Values{}
+	if q.Status != "" {
+		v.Set("status", q.Status)
+	}
+	if q.Limit > 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+
+	var ds []profile.Delivery
+	err := c.do(ctx, "GET", p, v, nil, &ds)
+	return ds, err
+}
+
+// Redeliver sends a delivery again.
+func (c *Client) Redeliver(ctx context.Context, id int64) (profile.Delivery, error) {
+	var d profile.Delivery
+	err := c.do(ctx, "POST", path("admin", "deliveries", strconv.FormatInt(id, 10), "redeliver"), nil, nil, &d)
+	return d, err
+}
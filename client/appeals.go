@@ -0,0 +1,54 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+
+	"github.com/alanfran/gameprofile/profile"
+)
+
+// FileAppeal appeals a punishment in force with the player's statement. It fails with a conflict when the punishment
+// already has an open appeal, or has expired.
+func (c *Client) FileAppeal(ctx context.Context, punishmentID int64, statement string) (profile.Appeal, error) {
+	var a profile.Appeal
+	err := c.do(ctx, "POST", path("appeals"), nil, AppealRequest{PunishmentID: punishmentID, Comment: statement}, &a)
+	return a, err
+}
+
+// GetAppeal reads an appeal and its history.
+func (c *Client) GetAppeal(ctx context.Context, id int64) (profile.Appeal, error) {
+	var a profile.Appeal
+	err := c.do(ctx, "GET", path("appeals", strconv.FormatInt(id, 10)), nil, nil, &a)
+	return a, err
+}
+
+// QueryAppeals lists the appeals matching q, newest first.
+func (c *Client) QueryAppeals(ctx context.Context, q profile.AppealQuery) ([]profile.Appeal, error) {
+	v := url.Values{}
+	if q.Status != "" {
+		v.Set("status", q.Status)
+	}
+	if q.PlayerID != "" {
+		v.Set("player", q.PlayerID)
+	}
+	if q.PunishmentID != 0 {
+		v.Set("punishment", strconv.FormatInt(q.PunishmentID, 10))
+	}
+	if q.Limit > 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+
+	var as []profile.Appeal
+	err := c.do(ctx, "GET", path("appeals"), v, nil, &as)
+	return as, err
+}
+
+// RecordAppealEvent comments on an appeal, or accepts or rejects it, as e.Action says. An accepted appeal lifts the
+// punishment, or shortens it to e.Expires. The event is dated by the service. Decisions need an admin key in the
+// client's Auth, eg. BearerToken, and are made by that admin.
+func (c *Client) RecordAppealEvent(ctx context.Context, id int64, e profile.AppealEvent) (AppealResult, error) {
+	var res AppealResult
+	err := c.do(ctx, "POST", path("appeals", strconv.FormatInt(id, 10), "events"), nil, e, &res)
+	return res, err
+}
@@ -0,0 +1,214 @@
+// Package client calls the HTTP API of the profile service.
+//
+// Every route of the API has a typed method. Methods return an *Error when the service answers with an error status.
+// UpdateProfile reads, changes and writes a profile, and retries when another writer got there first.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// APIPrefix is the path of the API version the client speaks.
+const APIPrefix = "/v1"
+
+// DefaultConflictRetries is how many times UpdateProfile retries when Client.ConflictRetries is not set.
+const DefaultConflictRetries = 5
+
+// Auth adds credentials to the requests of a Client.
+type Auth interface {
+	Authorize(req *http.Request) error
+}
+
+// AuthFunc turns a function into an Auth.
+type AuthFunc func(req *http.Request) error
+
+// Authorize calls f.
+func (f AuthFunc) Authorize(req *http.Request) error {
+	return f(req)
+}
+
+// BearerToken sends token in the Authorization header, as game servers do on the push channel.
+func BearerToken(token string) Auth {
+	return AuthFunc(func(req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	})
+}
+
+// BasicAuth sends a user name and password, for services behind a proxy that asks for them.
+func BasicAuth(user, password string) Auth {
+	return AuthFunc(func(req *http.Request) error {
+		req.SetBasicAuth(user, password)
+		return nil
+	})
+}
+
+// Client calls the service at BaseURL, the address of the service without the API prefix, eg. http://localhost:80.
+type Client struct {
+	BaseURL string
+	// HTTPClient makes the requests. http.DefaultClient is used when it is nil.
+	HTTPClient *http.Client
+	// Auth adds credentials to every request, if set.
+	Auth Auth
+	// Caller names the client in the records the service keeps, such as profile histories.
+	Caller string
+	// ConflictRetries is how many times UpdateProfile retries after a conflict.
+	ConflictRetries int
+}
+
+// New returns a client for the service at baseURL.
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimRight(baseURL, "/")}
+}
+
+// Error is returned when the service answers with an error status.
+type Error struct {
+	StatusCode int
+	Message    string
+	// Problems lists what is wrong with an invalid record.
+	Problems []string
+	// Body is the body of the response.
+	Body []byte
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("gameprofile: %d %s", e.StatusCode, e.Message)
+	if len(e.Problems) > 0 {
+		msg += " " + strings.Join(e.Problems, " ")
+	}
+	return msg
+}
+
+// IsNotFound reports whether err is a 404 Not Found answer.
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsConflict reports whether err is a 409 Conflict answer, such as an update with a stale hash.
+func IsConflict(err error) bool {
+	return hasStatus(err, http.StatusConflict)
+}
+
+// IsInvalid reports whether err is a 400 Bad Request answer. Its Problems say what was wrong, if known.
+func IsInvalid(err error) bool {
+	return hasStatus(err, http.StatusBadRequest)
+}
+
+func hasStatus(err error, status int) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == status
+}
+
+// newError reads an error answer. The service describes errors as {"error": "...", "problems": [...]}.
+func newError(resp *http.Response) *Error {
+	body, _ := ioutil.ReadAll(resp.Body)
+	e := &Error{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode), Body: body}
+
+	var msg struct {
+		Error    interface{} `json:"error"`
+		Problems []string    `json:"problems"`
+	}
+	if json.Unmarshal(body, &msg) == nil {
+		if s, ok := msg.Error.(string); ok && s != "" {
+			e.Message = s
+		}
+		e.Problems = msg.Problems
+	}
+	return e
+}
+
+// path joins the API prefix and escaped path segments.
+func path(segments ...string) string {
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return APIPrefix + "/" + strings.Join(segments, "/")
+}
+
+// newRequest makes a request with the client's credentials.
+func (c *Client) newRequest(ctx context.Context, method, p string, query url.Values, body io.Reader) (*http.Request, error) {
+	u := c.BaseURL + p
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	if c.Caller != "" {
+		req.Header.Set("X-Caller", c.Caller)
+	}
+	if c.Auth != nil {
+		if err := c.Auth.Authorize(req); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+// send makes a request, and returns the response if its status is not an error.
+// The caller closes the body of the response.
+func (c *Client) send(ctx context.Context, method, p string, query url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	req, err := c.newRequest(ctx, method, p, query, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		return nil, newError(resp)
+	}
+	return resp, nil
+}
+
+// do sends in as JSON, if it is not nil, and decodes the answer into out, if it is not nil.
+func (c *Client) do(ctx context.Context, method, p string, query url.Values, in, out interface{}) error {
+	var body io.Reader
+	var contentType string
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+		contentType = "application/json"
+	}
+
+	resp, err := c.send(ctx, method, p, query, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decode(resp, out)
+}
+
+// decode reads a JSON answer into out, if it is not nil.
+func decode(resp *http.Response, out interface{}) error {
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
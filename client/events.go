@@ -0,0 +1,112 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/alanfran/gameprofile/profile"
+	"github.com/gorilla/websocket"
+)
+
+// EventGap is the type of the event an EventStream returns when some of the events after the requested one
+// are no longer kept by the service.
+const EventGap = "gap"
+
+// maxEventSize is the largest event an EventStream reads.
+const maxEventSize = 1 << 20
+
+// EventStream reads the changes streamed by the service. Close it when done.
+type EventStream struct {
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+}
+
+// Events opens the stream of changes to profiles and punishments. Events after the one with ID after are sent,
+// starting with the next change when after is 0. The stream ends when ctx is canceled.
+func (c *Client) Events(ctx context.Context, f profile.EventFilter, after int64) (*EventStream, error) {
+	q := url.Values{}
+	if f.PlayerID != "" {
+		q.Set("steamid", f.PlayerID)
+	}
+	if len(f.Types) > 0 {
+		q.Set("type", strings.Join(f.Types, ","))
+	}
+	if after > 0 {
+		q.Set("last_event_id", strconv.FormatInt(after, 10))
+	}
+
+	resp, err := c.send(ctx, "GET", path("events"), q, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, maxEventSize)
+	return &EventStream{body: resp.Body, scanner: scanner}, nil
+}
+
+// Next waits for the next event. It returns io.EOF when the service closed the stream, after which the client
+// can open a new one from the ID of the last event it got.
+func (s *EventStream) Next() (profile.Event, error) {
+	var typ string
+	var data []byte
+
+	for s.scanner.Scan() {
+		line := s.scanner.Text()
+		switch {
+		case line == "" && typ != "":
+			if typ == EventGap {
+				return profile.Event{Type: EventGap}, nil
+			}
+			var e profile.Event
+			err := json.Unmarshal(data, &e)
+			return e, err
+
+		case strings.HasPrefix(line, "event: "):
+			typ = strings.TrimPrefix(line, "event: ")
+
+		case strings.HasPrefix(line, "data: "):
+			data = append(data, strings.TrimPrefix(line, "data: ")...)
+		}
+	}
+
+	if err := s.scanner.Err(); err != nil {
+		return profile.Event{}, err
+	}
+	return profile.Event{}, io.EOF
+}
+
+// Close ends the stream.
+func (s *EventStream) Close() error {
+	return s.body.Close()
+}
+
+// Push opens the push channel of game servers. The client's Auth should carry a server key, eg. BearerToken;
+// without one, the first message written has to be an auth message with the key as Token.
+// Messages after the event with ID after are replayed. Read and write PushMessages on the connection.
+func (c *Client) Push(ctx context.Context, after int64) (*websocket.Conn, error) {
+	q := url.Values{}
+	if after > 0 {
+		q.Set("last_event_id", strconv.FormatInt(after, 10))
+	}
+
+	req, err := c.newRequest(ctx, "GET", path("push"), q, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	u := *req.URL
+	u.Scheme = strings.Replace(u.Scheme, "http", "ws", 1)
+
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, u.String(), req.Header)
+	if resp != nil && resp.StatusCode != http.StatusSwitchingProtocols {
+		defer resp.Body.Close()
+		return nil, newError(resp)
+	}
+	return conn, err
+}
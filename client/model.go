@@ -0,0 +1,101 @@
+package client
+
+import "github.com/alanfran/gameprofile/profile"
+
+// ProfileWithHash is a profile with the hash of its state. Updates must carry the hash of the state they replace.
+type ProfileWithHash struct {
+	profile.Profile
+	Hash string
+}
+
+// ProfileList is a page of profiles. NextCursor is empty on the last page.
+type ProfileList struct {
+	Profiles   []ProfileWithHash
+	NextCursor string
+}
+
+// ProfileBatchResult holds the profiles found by a batch read, and the IDs that have no profile.
+type ProfileBatchResult struct {
+	Profiles []ProfileWithHash
+	Missing  []string
+}
+
+// BulkRequest is a bulk write. When Atomic is true, nothing is stored unless every write succeeds.
+type BulkRequest struct {
+	Atomic bool
+	Writes []profile.BulkOp
+}
+
+// BulkItemResult is the outcome of one write of a bulk request. ID is set for stored punishments,
+// and Hash for stored profiles.
+type BulkItemResult struct {
+	Status     int
+	Error      string              `json:",omitempty"`
+	Problems   []string            `json:",omitempty"`
+	ID         int64               `json:",omitempty"`
+	Hash       string              `json:",omitempty"`
+	Escalation *profile.Escalation `json:",omitempty"`
+}
+
+// BulkResponse lists the outcome of every write of a bulk request, in order.
+type BulkResponse struct {
+	Stored  int
+	Results []BulkItemResult
+}
+
+// PunishmentResult is the answer to issuing a punishment: the punishment as it was stored, and the escalation rule
+// that changed it, if one fired.
+type PunishmentResult struct {
+	Punishment profile.Punishment
+	Escalation *profile.Escalation `json:",omitempty"`
+}
+
+// AppealRequest is the body of a player's appeal against a punishment.
+type AppealRequest struct {
+	PunishmentID int64
+	By           string `json:",omitempty"`
+	Comment      string
+}
+
+// AppealResult is the answer to a change to an appeal: the appeal, and its punishment as the change left it.
+type AppealResult struct {
+	Appeal     profile.Appeal
+	Punishment profile.Punishment
+}
+
+// PlayerStatus is the answer to a status check: the punishments of a player in force on a server, by type.
+type PlayerStatus struct {
+	PlayerID    string
+	Server      string `json:",omitempty"`
+	GameMode    string `json:",omitempty"`
+	Punishments map[string]profile.Punishment
+}
+
+// PurchaseResult is the answer to purchases and refunds: the receipt and the profile it changed.
+type PurchaseResult struct {
+	Receipt profile.Receipt
+	Profile ProfileWithHash
+}
+
+// InventoryChange describes a change to a single inventory item. By names who made it, for the inventory log.
+type InventoryChange struct {
+	Item     string
+	Settings string
+	By       string
+}
+
+// InventoryResult is the answer to inventory changes: the logged event and the profile it changed.
+type InventoryResult struct {
+	Event   profile.InventoryEvent
+	Profile ProfileWithHash
+}
+
+// PushMessage is a message of the push channel. See Client.Push.
+type PushMessage struct {
+	Type   string
+	Topics []string       `json:",omitempty"`
+	Topic  string         `json:",omitempty"`
+	Event  *profile.Event `json:",omitempty"`
+	Error  string         `json:",omitempty"`
+	Token  string         `json:",omitempty"`
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+
+	"github.com/alanfran/gameprofile/profile"
+)
+
+// GetProfile reads a profile.
+func (c *Client) GetProfile(ctx context.Context, id string) (ProfileWithHash, error) {
+	var p ProfileWithHash
+	err := c.do(ctx, "GET", path(id), nil, nil, &p)
+	return p, err
+}
+
+// GetProfiles reads many profiles at once.
+func (c *Client) GetProfiles(ctx context.Context, ids []string) (ProfileBatchResult, error) {
+	var r ProfileBatchResult
+	err := c.do(ctx, "POST", path("profiles", "batch"), nil, struct{ IDs []string }{ids}, &r)
+	return r, err
+}
+
+// ListProfiles reads a page of profiles.
+func (c *Client) ListProfiles(ctx context.Context, opts profile.ListOptions) (ProfileList, error) {
+	q := url.Values{}
+	if opts.Cursor != "" {
+		q.Set("cursor", opts.Cursor)
+	}
+	if opts.Limit > 0 {
+		q.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.SortBy != "" {
+		q.Set("sort", opts.SortBy)
+	}
+	if opts.Desc {
+		q.Set("order", "desc")
+	}
+
+	var l ProfileList
+	err := c.do(ctx, "GET", path("profiles"), q, nil, &l)
+	return l, err
+}
+
+// CreateProfile stores a new profile. It fails with a conflict if the profile exists.
+func (c *Client) CreateProfile(ctx context.Context, p profile.Profile) (ProfileWithHash, error) {
+	var created ProfileWithHash
+	err := c.do(ctx, "POST", APIPrefix+"/", nil, p, &created)
+	return created, err
+}
+
+// PutProfile replaces a profile. The hash must be the one of the stored profile, or it fails with a conflict.
+// Most callers want UpdateProfile instead.
+func (c *Client) PutProfile(ctx context.Context, p ProfileWithHash) (ProfileWithHash, error) {
+	var updated ProfileWithHash
+	err := c.do(ctx, "PUT", path(p.ID), nil, p, &updated)
+	return updated, err
+}
+
+// UpdateProfile reads a profile, lets change modify it and writes it back. If the profile changed in the meantime,
+// change is called again on the new state, up to ConflictRetries times. An error from change stops the update.
+func (c *Client) UpdateProfile(ctx context.Context, id string, change func(*profile.Profile) error) (ProfileWithHash, error) {
+	current, err := c.GetProfile(ctx, id)
+	if err != nil {
+		return ProfileWithHash{}, err
+	}
+
+	retries := c.ConflictRetries
+	if retries <= 0 {
+		retries = DefaultConflictRetries
+	}
+
+	for i := 0; ; i++ {
+		p := current.Profile
+		err = change(&p)
+		if err != nil {
+			return ProfileWithHash{}, err
+		}
+
+		var updated ProfileWithHash
+		err = c.do(ctx, "PUT", path(id), nil, ProfileWithHash{Profile: p, Hash: current.Hash}, &updated)
+		if !IsConflict(err) || i == retries {
+			return updated, err
+		}
+
+		// The answer to a conflict is the profile as it is now.
+		current = ProfileWithHash{}
+		if json.Unmarshal(err.(*Error).Body, &current) != nil || current.Hash == "" {
+			current, err = c.GetProfile(ctx, id)
+			if err != nil {
+				return ProfileWithHash{}, err
+			}
+		}
+	}
+}
+
+// Bulk stores many profiles and punishments in one request. The answer says what happened to each of them.
+func (c *Client) Bulk(ctx context.Context, r BulkRequest) (BulkResponse, error) {
+	var resp BulkResponse
+	err := c.do(ctx, "POST", path("bulk"), nil, r, &resp)
+	return resp, err
+}
+
+// GetHistory lists the versions of a profile, newest first.
+func (c *Client) GetHistory(ctx context.Context, id string) ([]profile.ProfileVersion, error) {
+	var vs []profile.ProfileVersion
+	err := c.do(ctx, "GET", path(id, "history"), nil, nil, &vs)
+	return vs, err
+}
+
+// GetLeaderboard lists the richest players. A limit of 0 asks for the default number.
+func (c *Client) GetLeaderboard(ctx context.Context, limit int) ([]profile.Ranking, error) {
+	q := url.Values{}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+
+	var rs []profile.Ranking
+	err := c.do(ctx, "GET", path("leaderboard"), q, nil, &rs)
+	return rs, err
+}
+
+// GetStanding reads a player's rank, with around players above and below them.
+func (c *Client) GetStanding(ctx context.Context, id string, around int) (profile.Standing, error) {
+	q := url.Values{}
+	if around > 0 {
+		q.Set("around", strconv.Itoa(around))
+	}
+
+	var st profile.Standing
+	err := c.do(ctx, "GET", path(id, "rank"), q, nil, &st)
+	return st, err
+}
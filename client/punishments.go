@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/alanfran/gameprofile/profile"
+)
+
+// GetPunishments reads a player's current punishments by type, with the server or game mode of scoped ones.
+func (c *Client) GetPunishments(ctx context.Context, id string) (map[string]profile.Punishment, error) {
+	var ps map[string]profile.Punishment
+	err := c.do(ctx, "GET", path(id, "punishments"), nil, nil, &ps)
+	return ps, err
+}
+
+// Punish issues a punishment. The result holds the punishment as it was stored, which the escalation policy of the
+// service may have changed, and the rule that did it.
+func (c *Client) Punish(ctx context.Context, p profile.Punishment) (PunishmentResult, error) {
+	var res PunishmentResult
+	err := c.do(ctx, "POST", path(p.PlayerID, "punishments"), nil, p, &res)
+	return res, err
+}
+
+// PutPunishments stores several punishments of a player at once. Either all of them or none are stored.
+func (c *Client) PutPunishments(ctx context.Context, id string, ps map[string]profile.Punishment) error {
+	return c.do(ctx, "PUT", path(id, "punishments"), nil, ps, nil)
+}
+
+// QueryPunishments searches punishments across all players, newest first. q.Now is set by the service.
+func (c *Client) QueryPunishments(ctx context.Context, q profile.PunishmentQuery) ([]profile.Punishment, error) {
+	v := url.Values{}
+	for param, value := range map[string]string{
+		"player": q.PlayerID,
+		"by":     q.By,
+		"type":   q.Type,
+		"status": q.Status,
+		"reason": q.Reason,
+	} {
+		if value != "" {
+			v.Set(param, value)
+		}
+	}
+	if !q.Since.IsZero() {
+		v.Set("since", q.Since.Format(time.RFC3339))
+	}
+	if !q.Until.IsZero() {
+		v.Set("until", q.Until.Format(time.RFC3339))
+	}
+	if q.Limit > 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+
+	var ps []profile.Punishment
+	err := c.do(ctx, "GET", path("punishments"), v, nil, &ps)
+	return ps, err
+}
+
+// Status reads the punishments of a player in force on a server running a game mode. An empty server stands for
+// the server that signed the request.
+func (c *Client) Status(ctx context.Context, id, server, gameMode string) (PlayerStatus, error) {
+	v := url.Values{}
+	if server != "" {
+		v.Set("server", server)
+	}
+	if gameMode != "" {
+		v.Set("gamemode", gameMode)
+	}
+
+	var st PlayerStatus
+	err := c.do(ctx, "GET", path(id, "status"), v, nil, &st)
+	return st, err
+}
+
+// GetPunishmentTypes lists the punishment types.
+func (c *Client) GetPunishmentTypes(ctx context.Context) ([]profile.PunishmentType, error) {
+	var ts []profile.PunishmentType
+	err := c.do(ctx, "GET", path("punishment-types"), nil, nil, &ts)
+	return ts, err
+}
+
+// GetPunishmentType reads a punishment type.
+func (c *Client) GetPunishmentType(ctx context.Context, name string) (profile.PunishmentType, error) {
+	var t profile.PunishmentType
+	err := c.do(ctx, "GET", path("punishment-types", name), nil, nil, &t)
+	return t, err
+}
+
+// PutPunishmentType registers a punishment type, or changes its scope and default duration.
+func (c *Client) PutPunishmentType(ctx context.Context, t profile.PunishmentType) (profile.PunishmentType, error) {
+	var stored profile.PunishmentType
+	err := c.do(ctx, "PUT", path("punishment-types", t.Name), nil, t, &stored)
+	return stored, err
+}
+
+// DelPunishmentType removes a custom punishment type. It fails with a conflict for built-in types, and while
+// punishments of the type are stored.
+func (c *Client) DelPunishmentType(ctx context.Context, name string) error {
+	return c.do(ctx, "DELETE", path("punishment-types", name), nil, nil, nil)
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+
+	"github.com/alanfran/gameprofile/profile"
+)
+
+// GetItems lists the item catalog.
+func (c *Client) GetItems(ctx context.Context) ([]profile.Item, error) {
+	var items []profile.Item
+	err := c.do(ctx, "GET", path("items"), nil, nil, &items)
+	return items, err
+}
+
+// GetItem reads a catalog item.
+func (c *Client) GetItem(ctx context.Context, name string) (profile.Item, error) {
+	var it profile.Item
+	err := c.do(ctx, "GET", path("items", name), nil, nil, &it)
+	return it, err
+}
+
+// PutItem adds an item to the catalog, or replaces it.
+func (c *Client) PutItem(ctx context.Context, it profile.Item) (profile.Item, error) {
+	var stored profile.Item
+	err := c.do(ctx, "PUT", path("items", it.Name), nil, it, &stored)
+	return stored, err
+}
+
+// DelItem removes an item from the catalog. It fails with a conflict while players own it.
+func (c *Client) DelItem(ctx context.Context, name string) error {
+	return c.do(ctx, "DELETE", path("items", name), nil, nil, nil)
+}
+
+// GetPurchases lists a player's receipts.
+func (c *Client) GetPurchases(ctx context.Context, id string) ([]profile.Receipt, error) {
+	var rs []profile.Receipt
+	err := c.do(ctx, "GET", path(id, "purchases"), nil, nil, &rs)
+	return rs, err
+}
+
+// Purchase buys a catalog item for a player at its catalog price.
+func (c *Client) Purchase(ctx context.Context, id, item string) (PurchaseResult, error) {
+	var r PurchaseResult
+	err := c.do(ctx, "POST", path(id, "purchases"), nil, struct{ Item string }{item}, &r)
+	return r, err
+}
+
+// Refund refunds one of a player's purchases.
+func (c *Client) Refund(ctx context.Context, id string, receipt int64) (PurchaseResult, error) {
+	var r PurchaseResult
+	err := c.do(ctx, "POST", path(id, "purchases", strconv.FormatInt(receipt, 10), "refund"), nil, nil, &r)
+	return r, err
+}
+
+// GrantItem gives an item to a player for free.
+func (c *Client) GrantItem(ctx context.Context, id string, ch InventoryChange) (InventoryResult, error) {
+	var r InventoryResult
+	err := c.do(ctx, "POST", path(id, "inventory"), nil, ch, &r)
+	return r, err
+}
+
+// ChangeItem replaces the settings of an item a player owns.
+func (c *Client) ChangeItem(ctx context.Context, id string, ch InventoryChange) (InventoryResult, error) {
+	var r InventoryResult
+	err := c.do(ctx, "PUT", path(id, "inventory", ch.Item), nil, ch, &r)
+	return r, err
+}
+
+// TakeItem takes an item away from a player. by names who took it, for the inventory log.
+func (c *Client) TakeItem(ctx context.Context, id, item, by string) (InventoryResult, error) {
+	q := url.Values{}
+	if by != "" {
+		q.Set("by", by)
+	}
+
+	var r InventoryResult
+	err := c.do(ctx, "DELETE", path(id, "inventory", item), q, nil, &r)
+	return r, err
+}
+
+// SellItem sells an item back to the shop for part of its catalog price.
+func (c *Client) SellItem(ctx context.Context, id string, ch InventoryChange) (InventoryResult, error) {
+	var r InventoryResult
+	err := c.do(ctx, "POST", path(id, "inventory", ch.Item, "sell"), nil, ch, &r)
+	return r, err
+}
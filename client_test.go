@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/alanfran/gameprofile/client"
+	"github.com/alanfran/gameprofile/profile"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Go client", func() {
+	var app *App
+	var server *httptest.Server
+	var c *client.Client
+	var ctx context.Context
+	var cancel context.CancelFunc
+
+	BeforeEach(func() {
+		app = NewApp(profile.NewMockStore())
+		app.ServerKeys = map[string]string{"secret": "server_1"}
+		app.AdminKeys = map[string]string{"admin_secret": "some_admin"}
+		server = httptest.NewServer(app.engine)
+		c = client.New(server.URL)
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	})
+
+	AfterEach(func() {
+		cancel()
+		server.CloseClientConnections()
+		server.Close()
+	})
+
+	Context("Profiles", func() {
+		It("creates and reads profiles", func() {
+			created, err := c.CreateProfile(ctx, profile.Profile{ID: "STEAM_0:1:1234", Coins: 10})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(created.Hash).To(Equal(NewProfileWithHash(created.Profile).Hash))
+
+			read, err := c.GetProfile(ctx, "STEAM_0:1:1234")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(read.Hash).To(Equal(created.Hash))
+
+			_, err = c.CreateProfile(ctx, profile.Profile{ID: "STEAM_0:1:1234"})
+			Expect(client.IsConflict(err)).To(BeTrue())
+
+			batch, err := c.GetProfiles(ctx, []string{"STEAM_0:1:1234", "nobody"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(batch.Profiles).To(HaveLen(1))
+			Expect(batch.Missing).To(Equal([]string{"nobody"}))
+		})
+
+		It("returns typed errors", func() {
+			_, err := c.GetProfile(ctx, "nobody")
+			Expect(client.IsNotFound(err)).To(BeTrue())
+
+			_, err = c.CreateProfile(ctx, profile.Profile{ID: "some_user", Inventory: map[string]string{"hat": ""}})
+			Expect(client.IsInvalid(err)).To(BeTrue())
+			Expect(err.(*client.Error).Problems).ToNot(BeEmpty())
+		})
+
+		It("retries an update when the profile changed in the meantime", func() {
+			Expect(app.profiles.PutProfile(profile.Profile{ID: "some_user", Coins: 100})).To(Succeed())
+
+			calls := 0
+			updated, err := c.UpdateProfile(ctx, "some_user", func(p *profile.Profile) error {
+				calls++
+				if calls == 1 {
+					// Another writer gets there first.
+					Expect(app.profiles.PutProfile(profile.Profile{ID: "some_user", Coins: 200})).To(Succeed())
+				}
+				p.Coins += 5
+				return nil
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(calls).To(Equal(2))
+			Expect(updated.Coins).To(Equal(int64(205)))
+
+			p, err := app.profiles.GetProfile("some_user")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Coins).To(Equal(int64(205)))
+		})
+
+		It("gives up after ConflictRetries conflicts", func() {
+			Expect(app.profiles.PutProfile(profile.Profile{ID: "some_user"})).To(Succeed())
+			c.ConflictRetries = 2
+
+			calls := 0
+			_, err := c.UpdateProfile(ctx, "some_user", func(p *profile.Profile) error {
+				calls++
+				Expect(app.profiles.PutProfile(profile.Profile{ID: "some_user", Coins: int64(calls)})).To(Succeed())
+				p.Coins = 1000
+				return nil
+			})
+			Expect(client.IsConflict(err)).To(BeTrue())
+			Expect(calls).To(Equal(3))
+		})
+
+		It("stops an update when the change fails", func() {
+			Expect(app.profiles.PutProfile(profile.Profile{ID: "some_user"})).To(Succeed())
+			errBroke := errors.New("broke")
+
+			_, err := c.UpdateProfile(ctx, "some_user", func(p *profile.Profile) error {
+				return errBroke
+			})
+			Expect(err).To(Equal(errBroke))
+		})
+
+		It("names the caller in the profile history", func() {
+			c.Caller = "discord_bot"
+			_, err := c.CreateProfile(ctx, profile.Profile{ID: "some_user"})
+			Expect(err).ToNot(HaveOccurred())
+
+			vs, err := c.GetHistory(ctx, "some_user")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(vs).To(HaveLen(1))
+			Expect(vs[0].By).To(Equal("discord_bot"))
+		})
+
+		It("reports partial bulk writes without failing", func() {
+			resp, err := c.Bulk(ctx, client.BulkRequest{Writes: []profile.BulkOp{
+				{Profile: &profile.Profile{ID: "some_user"}},
+				{Punishment: &profile.Punishment{PlayerID: "some_user"}},
+			}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.Stored).To(Equal(1))
+			Expect(resp.Results[1].Status).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	Context("Shop", func() {
+		It("buys, refunds, grants and takes items", func() {
+			_, err := c.PutItem(ctx, profile.Item{Name: "hat", Slot: "head", Price: 100})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(app.profiles.PutProfile(profile.Profile{ID: "some_user", Coins: 500})).To(Succeed())
+
+			bought, err := c.Purchase(ctx, "some_user", "hat")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bought.Profile.Coins).To(Equal(int64(400)))
+
+			refunded, err := c.Refund(ctx, "some_user", bought.Receipt.ID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(refunded.Profile.Coins).To(Equal(int64(500)))
+
+			granted, err := c.GrantItem(ctx, "some_user", client.InventoryChange{Item: "hat", By: "some_admin"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(granted.Profile.Inventory).To(HaveKey("hat"))
+
+			_, err = c.TakeItem(ctx, "some_user", "hat", "some_admin")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.DelItem(ctx, "hat")).To(Succeed())
+		})
+	})
+
+	Context("Punishments", func() {
+		It("stores and searches punishments", func() {
+			res, err := c.Punish(ctx, profile.Punishment{PlayerID: "some_user", By: "some_admin", Type: "ban", Reason: "cheating", Date: time.Now()})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res.Punishment.ID).ToNot(BeZero())
+			Expect(res.Escalation).To(BeNil())
+
+			ps, err := c.QueryPunishments(ctx, profile.PunishmentQuery{Reason: "cheat", Since: time.Now().Add(-time.Hour)})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ps).To(HaveLen(1))
+			Expect(ps[0].PlayerID).To(Equal("some_user"))
+		})
+
+		It("registers punishment types and reads the status of a player on a server", func() {
+			_, err := c.PutPunishmentType(ctx, profile.PunishmentType{Name: "spawn_ban", Scope: profile.ScopeServer})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = c.Punish(ctx, profile.Punishment{PlayerID: "some_user", By: "some_admin", Type: "spawn_ban", Server: "server_1"})
+			Expect(err).ToNot(HaveOccurred())
+
+			st, err := c.Status(ctx, "some_user", "server_1", "sandbox")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(st.Punishments).To(HaveKey("spawn_ban"))
+
+			st, err = c.Status(ctx, "some_user", "server_2", "sandbox")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(st.Punishments).To(BeEmpty())
+
+			err = c.DelPunishmentType(ctx, profile.TypeBan)
+			Expect(client.IsConflict(err)).To(BeTrue())
+		})
+
+		It("files appeals and lifts punishments when they are accepted", func() {
+			res, err := c.Punish(ctx, profile.Punishment{PlayerID: "some_user", By: "some_admin", Type: profile.TypeBan})
+			Expect(err).ToNot(HaveOccurred())
+
+			a, err := c.FileAppeal(ctx, res.Punishment.ID, "I was not cheating.")
+			Expect(err).ToNot(HaveOccurred())
+			_, err = c.FileAppeal(ctx, res.Punishment.ID, "Please.")
+			Expect(client.IsConflict(err)).To(BeTrue())
+
+			as, err := c.QueryAppeals(ctx, profile.AppealQuery{Status: profile.AppealOpen})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(as).To(HaveLen(1))
+
+			c.Auth = client.BearerToken("admin_secret")
+			ar, err := c.RecordAppealEvent(ctx, a.ID, profile.AppealEvent{Action: profile.AppealAccept, Comment: "Cleared."})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ar.Appeal.Status).To(Equal(profile.AppealAccepted))
+			Expect(ar.Punishment.Active(time.Now())).To(BeFalse())
+
+			a, err = c.GetAppeal(ctx, a.ID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(a.History).To(HaveLen(2))
+		})
+	})
+
+	Context("Admin", func() {
+		It("exports and imports archives", func() {
+			Expect(app.profiles.PutProfile(profile.Profile{ID: "some_user", Coins: 10})).To(Succeed())
+
+			_, err := c.Export(ctx)
+			Expect(err.(*client.Error).StatusCode).To(Equal(http.StatusUnauthorized))
+
+			c.Auth = client.BearerToken("admin_secret")
+			archive, err := c.Export(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			data, err := ioutil.ReadAll(archive)
+			archive.Close()
+			Expect(err).ToNot(HaveOccurred())
+
+			stats, err := c.Import(ctx, bytes.NewReader(data), false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stats.Skipped).To(Equal(1))
+		})
+	})
+
+	Context("Streams", func() {
+		It("reads the event stream", func() {
+			Expect(app.profiles.PutProfile(profile.Profile{ID: "some_user", Coins: 1})).To(Succeed())
+			last := app.events.LastID()
+			Expect(app.profiles.PutProfile(profile.Profile{ID: "some_user", Coins: 2})).To(Succeed())
+
+			c.Auth = client.BearerToken("secret")
+			stream, err := c.Events(ctx, profile.EventFilter{PlayerID: "some_user"}, last)
+			Expect(err).ToNot(HaveOccurred())
+			defer stream.Close()
+
+			e, err := stream.Next()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(e.Type).To(Equal(profile.EventProfilePut))
+			Expect(e.Profile.Coins).To(Equal(int64(2)))
+		})
+
+		It("authenticates on the push channel", func() {
+			c.Auth = client.BearerToken("wrong")
+			_, err := c.Push(ctx, 0)
+			Expect(err).To(HaveOccurred())
+			Expect(err.(*client.Error).StatusCode).To(Equal(http.StatusUnauthorized))
+
+			c.Auth = client.BearerToken("secret")
+			conn, err := c.Push(ctx, 0)
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+
+			Expect(conn.WriteJSON(client.PushMessage{Type: "ping"})).To(Succeed())
+			var m client.PushMessage
+			Expect(conn.ReadJSON(&m)).To(Succeed())
+			Expect(m.Type).To(Equal("pong"))
+		})
+	})
+})
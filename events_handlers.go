@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alanfran/gameprofile/profile"
+	"github.com/gin-gonic/gin"
+)
+
+// eventsHeartbeat is how often an idle event stream sends a comment, to keep proxies from closing it.
+const eventsHeartbeat = 15 * time.Second
+
+// GetEvents streams changes to profiles and punishments as Server-Sent Events.
+// Query parameters: steamid and type (a comma separated list of event types) filter the events.
+// A client that reconnects with the Last-Event-ID header, or the last_event_id query parameter, gets the events
+// it missed first. If some of them are no longer kept, a "gap" event is sent before them.
+func (a *App) GetEvents(c *gin.Context) {
+	f := profile.EventFilter{PlayerID: c.Query("steamid")}
+	if t := c.Query("type"); t != "" {
+		f.Types = strings.Split(t, ",")
+	}
+
+	last := c.GetHeader("Last-Event-ID")
+	if last == "" {
+		last = c.Query("last_event_id")
+	}
+	var after int64
+	if last != "" {
+		var err error
+		after, err = strconv.ParseInt(last, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "The last event ID must be a number.",
+			})
+			return
+		}
+	}
+
+	sub := a.events.Subscribe(f, after)
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	if sub.Gap {
+		fmt.Fprint(w, "event: gap\ndata: {}\n\n")
+	}
+	w.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				// The client fell too far behind. It can reconnect and resume from the last ID it got.
+				return
+			}
+
+			j, err := jsonFor(c, e)
+			if err != nil {
+				c.Error(err)
+				return
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, j)
+			w.Flush()
+
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			w.Flush()
+
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+
+	"github.com/alanfran/gameprofile/profile"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Event stream", func() {
+	var app *App
+	var server *httptest.Server
+
+	BeforeEach(func() {
+		app = NewApp(profile.NewMockStore())
+		app.ServerKeys = map[string]string{"secret": "server_1"}
+		server = httptest.NewServer(app.engine)
+	})
+
+	AfterEach(func() {
+		server.CloseClientConnections()
+		server.Close()
+	})
+
+	// stream opens the event stream and returns a function that reads the next event's lines.
+	stream := func(query, lastID string) (func() []string, func()) {
+		req, err := http.NewRequest("GET", server.URL+"/v1/events"+query, nil)
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Set("Authorization", "Bearer secret")
+		if lastID != "" {
+			req.Header.Set("Last-Event-ID", lastID)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+
+		r := bufio.NewReader(resp.Body)
+		next := func() []string {
+			var lines []string
+			for {
+				line, err := r.ReadString('\n')
+				Expect(err).ToNot(HaveOccurred())
+				line = strings.TrimSuffix(line, "\n")
+				if line == "" {
+					return lines
+				}
+				lines = append(lines, line)
+			}
+		}
+		return next, func() { resp.Body.Close() }
+	}
+
+	It("streams changes for the requested player", func() {
+		next, done := stream("?steamid=some_user", "")
+		defer done()
+
+		Expect(app.profiles.PutProfile(profile.Profile{ID: "other_user"})).To(Succeed())
+		_, err := app.profiles.PutPunishment(profile.Punishment{PlayerID: "some_user", By: "some_admin", Type: "ban"})
+		Expect(err).ToNot(HaveOccurred())
+
+		lines := next()
+		Expect(lines).To(HaveLen(3))
+		Expect(lines[0]).To(Equal("id: 2"))
+		Expect(lines[1]).To(Equal("event: " + profile.EventPunishmentPut))
+		Expect(lines[2]).To(ContainSubstring(`"PlayerID":"some_user"`))
+	})
+
+	It("resumes after the last event ID", func() {
+		for _, id := range []string{"a", "b", "c"} {
+			Expect(app.profiles.PutProfile(profile.Profile{ID: id})).To(Succeed())
+		}
+
+		next, done := stream("?type="+profile.EventProfilePut, "1")
+		defer done()
+
+		Expect(next()[0]).To(Equal("id: 2"))
+		Expect(next()[0]).To(Equal("id: 3"))
+	})
+
+	It("sends punishments with the ID they were stored under", func() {
+		next, done := stream("?type="+profile.EventPunishmentPut+","+profile.EventPunishmentDel, "")
+		defer done()
+
+		p, err := app.profiles.PutPunishment(profile.Punishment{PlayerID: "some_user", By: "some_admin", Type: "ban"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(app.profiles.DelPunishment(p.ID)).To(Succeed())
+
+		id := `"ID":` + strconv.FormatInt(p.ID, 10) + `,`
+		Expect(next()[2]).To(ContainSubstring(id))
+		Expect(next()[2]).To(ContainSubstring(id))
+	})
+
+	It("returns 400 Bad Request for an invalid event ID", func() {
+		req, err := http.NewRequest("GET", server.URL+"/v1/events?last_event_id=x", nil)
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+
+	It("returns 401 Unauthorized without a server key", func() {
+		resp, err := http.Get(server.URL + "/v1/events")
+		Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+	})
+})
@@ -3,12 +3,14 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"time"
 
 	"github.com/alanfran/gameprofile/profile"
+	"github.com/cnf/structhash"
 	"github.com/gin-gonic/gin"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -167,6 +169,29 @@ var _ = Describe("Game profile microservice", func() {
 					})
 				})
 
+				Context("When the hash was made with structhash", func() {
+					It("returns 200 OK and returns the profile with its current hash", func() {
+						legacy, err := structhash.Hash(testProfile, 1)
+						Expect(err).ToNot(HaveOccurred())
+						pwh := ProfileWithHash{Profile: testProfile, Hash: legacy}
+						pwh.Coins = 9999
+
+						postJSON, err := json.Marshal(pwh)
+						Expect(err).ToNot(HaveOccurred())
+
+						req, err := http.NewRequest("PUT", "/"+testProfile.ID, bytes.NewBuffer(postJSON))
+						Expect(err).ToNot(HaveOccurred())
+						req.Header.Set("Content-Type", "application/json")
+						app.engine.ServeHTTP(resp, req)
+
+						Expect(resp.Code).To(Equal(http.StatusOK))
+
+						var profileWithHash ProfileWithHash
+						Expect(json.Unmarshal(resp.Body.Bytes(), &profileWithHash)).To(Succeed())
+						Expect(profileWithHash.Hash).To(Equal(profile.Hash(pwh.Profile)))
+					})
+				})
+
 				Context("When the hash is invalid", func() {
 					It("returns 409 Conflict along with the new ProfileWithHash", func() {
 						postJSON, err := json.Marshal(testProfile)
@@ -193,29 +218,490 @@ var _ = Describe("Game profile microservice", func() {
 			})
 		})
 
+		Context(APIPrefix+"/profiles", func() {
+			Context("GET", func() {
+				BeforeEach(func() {
+					for _, id := range []string{"player_a", "player_b", "player_c"} {
+						p := testProfile
+						p.ID = id
+						Expect(app.profiles.PutProfile(p)).To(Succeed())
+					}
+				})
+
+				It("returns 200 Success and pages through the profiles", func() {
+					req, err := http.NewRequest("GET", APIPrefix+"/profiles?limit=2", nil)
+					Expect(err).ToNot(HaveOccurred())
+					app.engine.ServeHTTP(resp, req)
+
+					Expect(resp.Code).To(Equal(http.StatusOK))
+
+					var list ProfileList
+					Expect(json.Unmarshal(resp.Body.Bytes(), &list)).To(Succeed())
+					Expect(list.Profiles).To(HaveLen(2))
+					Expect(list.Profiles[0].ID).To(Equal("player_a"))
+					Expect(list.Profiles[0].Hash).ToNot(BeZero())
+					Expect(list.NextCursor).ToNot(BeEmpty())
+
+					resp = httptest.NewRecorder()
+					req, err = http.NewRequest("GET", APIPrefix+"/profiles?limit=2&cursor="+list.NextCursor, nil)
+					Expect(err).ToNot(HaveOccurred())
+					app.engine.ServeHTTP(resp, req)
+
+					Expect(resp.Code).To(Equal(http.StatusOK))
+					Expect(json.Unmarshal(resp.Body.Bytes(), &list)).To(Succeed())
+					Expect(list.Profiles).To(HaveLen(1))
+					Expect(list.Profiles[0].ID).To(Equal("player_c"))
+					Expect(list.NextCursor).To(BeEmpty())
+				})
+
+				It("returns 400 Bad Request for an unknown sort order", func() {
+					req, err := http.NewRequest("GET", APIPrefix+"/profiles?sort=name", nil)
+					Expect(err).ToNot(HaveOccurred())
+					app.engine.ServeHTTP(resp, req)
+
+					Expect(resp.Code).To(Equal(http.StatusBadRequest))
+				})
+			})
+
+			Context("POST /profiles/batch", func() {
+				It("returns 200 Success with the profiles found and the missing IDs", func() {
+					for _, id := range []string{"player_a", "player_b"} {
+						p := testProfile
+						p.ID = id
+						Expect(app.profiles.PutProfile(p)).To(Succeed())
+					}
+
+					body, _ := json.Marshal(ProfileBatch{IDs: []string{"player_b", "nobody", "player_a", "player_b"}})
+					req, err := http.NewRequest("POST", APIPrefix+"/profiles/batch", bytes.NewBuffer(body))
+					Expect(err).ToNot(HaveOccurred())
+					req.Header.Set("Content-Type", "application/json")
+					app.engine.ServeHTTP(resp, req)
+
+					Expect(resp.Code).To(Equal(http.StatusOK))
+
+					var result ProfileBatchResult
+					Expect(json.Unmarshal(resp.Body.Bytes(), &result)).To(Succeed())
+					Expect(result.Profiles).To(HaveLen(2))
+					Expect(result.Profiles[0].ID).To(Equal("player_b"))
+					Expect(result.Profiles[1].ID).To(Equal("player_a"))
+					Expect(result.Profiles[1].Hash).To(Equal(NewProfileWithHash(result.Profiles[1].Profile).Hash))
+					Expect(result.Missing).To(Equal([]string{"nobody"}))
+				})
+
+				It("returns 400 Bad Request for too many IDs", func() {
+					body, _ := json.Marshal(ProfileBatch{IDs: make([]string, maxBatchProfiles+1)})
+					req, err := http.NewRequest("POST", APIPrefix+"/profiles/batch", bytes.NewBuffer(body))
+					Expect(err).ToNot(HaveOccurred())
+					req.Header.Set("Content-Type", "application/json")
+					app.engine.ServeHTTP(resp, req)
+
+					Expect(resp.Code).To(Equal(http.StatusBadRequest))
+				})
+			})
+		})
+
+		Context(APIPrefix+"/bulk", func() {
+			bulk := func(req BulkRequest) BulkResponse {
+				body, _ := json.Marshal(req)
+				r, err := http.NewRequest("POST", APIPrefix+"/bulk", bytes.NewBuffer(body))
+				Expect(err).ToNot(HaveOccurred())
+				r.Header.Set("Content-Type", "application/json")
+				app.engine.ServeHTTP(resp, r)
+
+				var result BulkResponse
+				Expect(json.Unmarshal(resp.Body.Bytes(), &result)).To(Succeed())
+				return result
+			}
+
+			It("returns 200 Success when every write is stored", func() {
+				result := bulk(BulkRequest{Atomic: true, Writes: []profile.BulkOp{
+					{Profile: &testProfile},
+					{Punishment: &profile.Punishment{PlayerID: testProfile.ID, By: "some_admin", Type: "ban"}},
+				}})
+
+				Expect(resp.Code).To(Equal(http.StatusOK))
+				Expect(result.Stored).To(Equal(2))
+				Expect(result.Results[0].Hash).To(Equal(NewProfileWithHash(testProfile).Hash))
+				Expect(result.Results[1].ID).ToNot(BeZero())
+			})
+
+			It("returns 207 Multi-Status with the status of each write when some fail", func() {
+				writes := []profile.BulkOp{
+					{Profile: &testProfile},
+					{Punishment: &profile.Punishment{PlayerID: testProfile.ID}},
+				}
+
+				result := bulk(BulkRequest{Atomic: true, Writes: writes})
+				Expect(resp.Code).To(Equal(http.StatusMultiStatus))
+				Expect(result.Stored).To(Equal(0))
+				Expect(result.Results[0].Status).To(Equal(http.StatusFailedDependency))
+				Expect(result.Results[1].Status).To(Equal(http.StatusBadRequest))
+				Expect(result.Results[1].Problems).ToNot(BeEmpty())
+				_, err := app.profiles.GetProfile(testProfile.ID)
+				Expect(err).To(HaveOccurred())
+
+				resp = httptest.NewRecorder()
+				result = bulk(BulkRequest{Writes: writes})
+				Expect(resp.Code).To(Equal(http.StatusMultiStatus))
+				Expect(result.Stored).To(Equal(1))
+				Expect(result.Results[0].Status).To(Equal(http.StatusOK))
+				_, err = app.profiles.GetProfile(testProfile.ID)
+				Expect(err).ToNot(HaveOccurred())
+			})
+		})
+
+		Context(APIPrefix+"/leaderboard", func() {
+			BeforeEach(func() {
+				for id, coins := range map[string]int64{"player_a": 300, "player_b": 200, "player_c": 100} {
+					Expect(app.profiles.PutProfile(profile.Profile{ID: id, Coins: coins})).To(Succeed())
+				}
+			})
+
+			It("returns 200 Success and the richest players", func() {
+				req, err := http.NewRequest("GET", APIPrefix+"/leaderboard?limit=2", nil)
+				Expect(err).ToNot(HaveOccurred())
+				app.engine.ServeHTTP(resp, req)
+
+				Expect(resp.Code).To(Equal(http.StatusOK))
+
+				var rs []profile.Ranking
+				Expect(json.Unmarshal(resp.Body.Bytes(), &rs)).To(Succeed())
+				Expect(rs).To(Equal([]profile.Ranking{
+					{Rank: 1, ID: "player_a", Coins: 300},
+					{Rank: 2, ID: "player_b", Coins: 200},
+				}))
+			})
+
+			Context("/:steamid/rank", func() {
+				It("returns 200 Success and the player's standing", func() {
+					req, err := http.NewRequest("GET", APIPrefix+"/player_b/rank?around=1", nil)
+					Expect(err).ToNot(HaveOccurred())
+					app.engine.ServeHTTP(resp, req)
+
+					Expect(resp.Code).To(Equal(http.StatusOK))
+
+					var st profile.Standing
+					Expect(json.Unmarshal(resp.Body.Bytes(), &st)).To(Succeed())
+					Expect(st.Rank).To(Equal(int64(2)))
+					Expect(st.Above).To(HaveLen(1))
+					Expect(st.Below).To(HaveLen(1))
+				})
+
+				It("returns 404 Not Found for an unknown player", func() {
+					req, err := http.NewRequest("GET", APIPrefix+"/nobody/rank", nil)
+					Expect(err).ToNot(HaveOccurred())
+					app.engine.ServeHTTP(resp, req)
+
+					Expect(resp.Code).To(Equal(http.StatusNotFound))
+				})
+			})
+		})
+
+		Context(APIPrefix+"/items", func() {
+			var hat profile.Item
+
+			BeforeEach(func() {
+				hat = profile.Item{Name: "hat", Slot: "head", Price: 100, Settings: map[string]string{}}
+			})
+
+			It("stores and lists catalog items", func() {
+				body, _ := json.Marshal(hat)
+				req, err := http.NewRequest("PUT", APIPrefix+"/items/hat", bytes.NewBuffer(body))
+				Expect(err).ToNot(HaveOccurred())
+				req.Header.Set("Content-Type", "application/json")
+				app.engine.ServeHTTP(resp, req)
+				Expect(resp.Code).To(Equal(http.StatusOK))
+
+				resp = httptest.NewRecorder()
+				req, err = http.NewRequest("GET", APIPrefix+"/items", nil)
+				Expect(err).ToNot(HaveOccurred())
+				app.engine.ServeHTTP(resp, req)
+				Expect(resp.Code).To(Equal(http.StatusOK))
+
+				var items []profile.Item
+				Expect(json.Unmarshal(resp.Body.Bytes(), &items)).To(Succeed())
+				Expect(items).To(Equal([]profile.Item{hat}))
+			})
+
+			It("returns 400 Bad Request for an invalid item", func() {
+				hat.Price = -1
+				body, _ := json.Marshal(hat)
+				req, err := http.NewRequest("PUT", APIPrefix+"/items/hat", bytes.NewBuffer(body))
+				Expect(err).ToNot(HaveOccurred())
+				req.Header.Set("Content-Type", "application/json")
+				app.engine.ServeHTTP(resp, req)
+				Expect(resp.Code).To(Equal(http.StatusBadRequest))
+			})
+
+			It("returns 409 Conflict when deleting an item that players own", func() {
+				Expect(app.profiles.PutItem(hat)).To(Succeed())
+				testProfile.Inventory["hat"] = ""
+				Expect(app.profiles.PutProfile(testProfile)).To(Succeed())
+
+				req, err := http.NewRequest("DELETE", APIPrefix+"/items/hat", nil)
+				Expect(err).ToNot(HaveOccurred())
+				app.engine.ServeHTTP(resp, req)
+				Expect(resp.Code).To(Equal(http.StatusConflict))
+			})
+
+			It("returns 400 Bad Request for a profile that equips an item it does not own", func() {
+				Expect(app.profiles.PutItem(hat)).To(Succeed())
+				testProfile.Equipment["head"] = "hat"
+				body, _ := json.Marshal(testProfile)
+				req, err := http.NewRequest("POST", "/", bytes.NewBuffer(body))
+				Expect(err).ToNot(HaveOccurred())
+				req.Header.Set("Content-Type", "application/json")
+				app.engine.ServeHTTP(resp, req)
+				Expect(resp.Code).To(Equal(http.StatusBadRequest))
+				Expect(resp.Body.String()).To(ContainSubstring("problems"))
+			})
+		})
+
+		Context("/:steamid/purchases", func() {
+			BeforeEach(func() {
+				Expect(app.profiles.PutItem(profile.Item{Name: "hat", Slot: "head", Price: 1000})).To(Succeed())
+				Expect(app.profiles.PutProfile(testProfile)).To(Succeed())
+			})
+
+			purchase := func(item string) {
+				req, err := http.NewRequest("POST", APIPrefix+"/"+testProfile.ID+"/purchases", bytes.NewBufferString(`{"Item":"`+item+`"}`))
+				Expect(err).ToNot(HaveOccurred())
+				req.Header.Set("Content-Type", "application/json")
+				app.engine.ServeHTTP(resp, req)
+			}
+
+			It("returns 201 Created with the receipt and the updated ProfileWithHash", func() {
+				purchase("hat")
+				Expect(resp.Code).To(Equal(http.StatusCreated))
+
+				var result PurchaseResult
+				Expect(json.Unmarshal(resp.Body.Bytes(), &result)).To(Succeed())
+				Expect(result.Receipt.Item).To(Equal("hat"))
+				Expect(result.Profile.Coins).To(Equal(int64(234)))
+				Expect(result.Profile.Inventory).To(HaveKey("hat"))
+				Expect(result.Profile.Hash).To(Equal(NewProfileWithHash(result.Profile.Profile).Hash))
+
+				resp = httptest.NewRecorder()
+				req, err := http.NewRequest("GET", APIPrefix+"/"+testProfile.ID+"/purchases", nil)
+				Expect(err).ToNot(HaveOccurred())
+				app.engine.ServeHTTP(resp, req)
+				Expect(resp.Code).To(Equal(http.StatusOK))
+
+				var rs []profile.Receipt
+				Expect(json.Unmarshal(resp.Body.Bytes(), &rs)).To(Succeed())
+				Expect(rs).To(HaveLen(1))
+			})
+
+			It("returns 409 Conflict when the player cannot afford the item", func() {
+				purchase("hat")
+				resp = httptest.NewRecorder()
+				Expect(app.profiles.PutItem(profile.Item{Name: "crown", Slot: "head", Price: 1000})).To(Succeed())
+				purchase("crown")
+				Expect(resp.Code).To(Equal(http.StatusConflict))
+			})
+
+			It("returns 404 Not Found for an unknown item", func() {
+				purchase("sword")
+				Expect(resp.Code).To(Equal(http.StatusNotFound))
+			})
+
+			It("refunds a purchase", func() {
+				purchase("hat")
+				var result PurchaseResult
+				Expect(json.Unmarshal(resp.Body.Bytes(), &result)).To(Succeed())
+
+				refund := func(steamid string) {
+					resp = httptest.NewRecorder()
+					url := fmt.Sprintf(APIPrefix+"/%s/purchases/%d/refund", steamid, result.Receipt.ID)
+					req, err := http.NewRequest("POST", url, nil)
+					Expect(err).ToNot(HaveOccurred())
+					app.engine.ServeHTTP(resp, req)
+				}
+
+				refund("someone_else")
+				Expect(resp.Code).To(Equal(http.StatusNotFound))
+
+				refund(testProfile.ID)
+				Expect(resp.Code).To(Equal(http.StatusOK))
+				Expect(json.Unmarshal(resp.Body.Bytes(), &result)).To(Succeed())
+				Expect(result.Profile.Coins).To(Equal(testProfile.Coins))
+				Expect(result.Receipt.Refunded).ToNot(BeZero())
+
+				refund(testProfile.ID)
+				Expect(resp.Code).To(Equal(http.StatusConflict))
+			})
+		})
+
+		Context("/:steamid/inventory", func() {
+			BeforeEach(func() {
+				Expect(app.profiles.PutItem(profile.Item{Name: "hat", Slot: "head", Price: 100})).To(Succeed())
+				Expect(app.profiles.PutProfile(testProfile)).To(Succeed())
+			})
+
+			serve := func(method, url, body string) {
+				resp = httptest.NewRecorder()
+				req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+				Expect(err).ToNot(HaveOccurred())
+				if body != "" {
+					req.Header.Set("Content-Type", "application/json")
+				}
+				req.Header.Set("Authorization", "Bearer admin_secret")
+				app.engine.ServeHTTP(resp, req)
+			}
+
+			It("grants, sells and logs items", func() {
+				serve("POST", APIPrefix+"/"+testProfile.ID+"/inventory", `{"Item":"hat","By":"some_admin"}`)
+				Expect(resp.Code).To(Equal(http.StatusCreated))
+
+				var result InventoryResult
+				Expect(json.Unmarshal(resp.Body.Bytes(), &result)).To(Succeed())
+				Expect(result.Profile.Inventory).To(HaveKey("hat"))
+				Expect(result.Event.By).To(Equal("some_admin"))
+
+				serve("POST", APIPrefix+"/"+testProfile.ID+"/inventory/hat/sell", "")
+				Expect(resp.Code).To(Equal(http.StatusOK))
+				Expect(json.Unmarshal(resp.Body.Bytes(), &result)).To(Succeed())
+				Expect(result.Profile.Coins).To(Equal(testProfile.Coins + 50))
+
+				app.AdminKeys = map[string]string{"admin_secret": "support"}
+				serve("GET", APIPrefix+"/admin/inventory/"+testProfile.ID+"?item=hat", "")
+				Expect(resp.Code).To(Equal(http.StatusOK))
+
+				var es []profile.InventoryEvent
+				Expect(json.Unmarshal(resp.Body.Bytes(), &es)).To(Succeed())
+				Expect(es).To(HaveLen(2))
+				Expect(es[0].Kind).To(Equal(profile.InventorySell))
+			})
+
+			It("returns 409 Conflict when removing an item the player does not own", func() {
+				serve("DELETE", APIPrefix+"/"+testProfile.ID+"/inventory/hat?by=some_admin", "")
+				Expect(resp.Code).To(Equal(http.StatusConflict))
+			})
+
+			It("returns 400 Bad Request for invalid settings", func() {
+				serve("POST", APIPrefix+"/"+testProfile.ID+"/inventory", `{"Item":"hat","Settings":"red"}`)
+				Expect(resp.Code).To(Equal(http.StatusBadRequest))
+			})
+		})
+
+		Context("/:steamid/history", func() {
+			var current ProfileWithHash
+
+			BeforeEach(func() {
+				Expect(app.profiles.PutProfileBy(testProfile, "server_1")).To(Succeed())
+				wiped := testProfile
+				wiped.Coins = 0
+				Expect(app.profiles.PutProfileBy(wiped, "buggy_addon")).To(Succeed())
+				current = NewProfileWithHash(wiped)
+				app.AdminKeys = map[string]string{"admin_secret": "support"}
+			})
+
+			restore := func(body string) {
+				resp = httptest.NewRecorder()
+				req, err := http.NewRequest("POST", APIPrefix+"/admin/history/"+testProfile.ID+"/restore", bytes.NewBufferString(body))
+				Expect(err).ToNot(HaveOccurred())
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authorization", "Bearer admin_secret")
+				app.engine.ServeHTTP(resp, req)
+			}
+
+			It("returns 200 Success and the versions, newest first", func() {
+				req, err := http.NewRequest("GET", APIPrefix+"/"+testProfile.ID+"/history", nil)
+				Expect(err).ToNot(HaveOccurred())
+				app.engine.ServeHTTP(resp, req)
+				Expect(resp.Code).To(Equal(http.StatusOK))
+
+				var vs []profile.ProfileVersion
+				Expect(json.Unmarshal(resp.Body.Bytes(), &vs)).To(Succeed())
+				Expect(vs).To(HaveLen(2))
+				Expect(vs[0].By).To(Equal("buggy_addon"))
+				Expect(vs[0].Old.Coins).To(Equal(testProfile.Coins))
+			})
+
+			It("restores a version when the hash matches", func() {
+				restore(fmt.Sprintf(`{"Version":1,"Hash":%q}`, current.Hash))
+				Expect(resp.Code).To(Equal(http.StatusOK))
+
+				p, err := app.profiles.GetProfile(testProfile.ID)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(p.Coins).To(Equal(testProfile.Coins))
+
+				vs, err := app.profiles.GetHistory(testProfile.ID)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(vs[0].By).To(Equal("support"))
+			})
+
+			It("returns 409 Conflict when the hash is stale", func() {
+				restore(`{"Version":1,"Hash":"stale"}`)
+				Expect(resp.Code).To(Equal(http.StatusConflict))
+			})
+
+			It("returns 404 Not Found for an unknown version", func() {
+				restore(fmt.Sprintf(`{"Version":9,"Hash":%q}`, current.Hash))
+				Expect(resp.Code).To(Equal(http.StatusNotFound))
+			})
+		})
+
+		Context("/punishments", func() {
+			Context("GET", func() {
+				BeforeEach(func() {
+					_, err := app.profiles.PutPunishment(profile.Punishment{
+						PlayerID: "player_a", By: "admin_x", Type: "ban", Reason: "aimbot",
+						Date: time.Now().Add(-time.Hour),
+					})
+					Expect(err).ToNot(HaveOccurred())
+					_, err = app.profiles.PutPunishment(profile.Punishment{
+						PlayerID: "player_b", By: "admin_y", Type: "ban", Reason: "spam",
+						Date: time.Now().Add(-time.Hour), Expires: time.Now().Add(-time.Minute),
+					})
+					Expect(err).ToNot(HaveOccurred())
+				})
+
+				It("returns 200 Success and the matching punishments", func() {
+					since := time.Now().Add(-24 * time.Hour).Format(time.RFC3339)
+					req, err := http.NewRequest("GET", APIPrefix+"/punishments?by=admin_x&status=active&since="+since, nil)
+					Expect(err).ToNot(HaveOccurred())
+					app.engine.ServeHTTP(resp, req)
+
+					Expect(resp.Code).To(Equal(http.StatusOK))
+
+					var ps []profile.Punishment
+					Expect(json.Unmarshal(resp.Body.Bytes(), &ps)).To(Succeed())
+					Expect(ps).To(HaveLen(1))
+					Expect(ps[0].PlayerID).To(Equal("player_a"))
+				})
+
+				It("returns 400 Bad Request for a malformed date", func() {
+					req, err := http.NewRequest("GET", APIPrefix+"/punishments?since=yesterday", nil)
+					Expect(err).ToNot(HaveOccurred())
+					app.engine.ServeHTTP(resp, req)
+
+					Expect(resp.Code).To(Equal(http.StatusBadRequest))
+				})
+			})
+		})
+
 		Context("/:steamid/punishments", func() {
 			var testPunishment, testPunishment2 profile.Punishment
 			var testPunishments map[string]profile.Punishment
 
 			BeforeEach(func() {
 				testPunishment = profile.Punishment{
-					ID:       12345,
 					PlayerID: testProfile.ID,
 					By:       "an_admin",
 					Type:     "ban",
 					Reason:   "testing",
-					Date:     time.Now(),
-					Expires:  time.Now().Add(time.Minute * 10),
+					Date:     time.Now().UTC(),
+					Expires:  time.Now().UTC().Add(time.Minute * 10),
 				}
 
 				testPunishment2 = profile.Punishment{
-					ID:       123456,
 					PlayerID: testProfile.ID,
 					By:       "an_admin",
-					Type:     "mute",
+					Type:     profile.TypeVoiceMute,
 					Reason:   "spamming",
-					Date:     time.Now(),
-					Expires:  time.Now().Add(time.Hour * 24),
+					Date:     time.Now().UTC(),
+					Expires:  time.Now().UTC().Add(time.Hour * 24),
 				}
 
 				testPunishments = map[string]profile.Punishment{
@@ -239,9 +725,16 @@ var _ = Describe("Game profile microservice", func() {
 				Context("there are punishments for that steam id", func() {
 
 					BeforeEach(func() {
-						Expect(app.profiles.PutPunishment(testPunishment)).To(Succeed())
-						Expect(app.profiles.PutPunishment(testPunishment2)).To(Succeed())
+						var err error
+						testPunishment, err = app.profiles.PutPunishment(testPunishment)
+						Expect(err).ToNot(HaveOccurred())
+						testPunishment2, err = app.profiles.PutPunishment(testPunishment2)
+						Expect(err).ToNot(HaveOccurred())
 
+						testPunishments = map[string]profile.Punishment{
+							testPunishment.Type:  testPunishment,
+							testPunishment2.Type: testPunishment2,
+						}
 					})
 
 					It("returns 200 Success along with the Punishments", func() {
@@ -280,10 +773,54 @@ var _ = Describe("Game profile microservice", func() {
 					p, err := app.profiles.GetPunishments(testPunishment.PlayerID)
 					Expect(err).ToNot(HaveOccurred())
 
+					Expect(p).To(HaveKey(testPunishment.Type))
+					Expect(p[testPunishment.Type].ID).ToNot(BeZero())
+					testPunishment.ID = p[testPunishment.Type].ID
 					Expect(p).To(Equal(map[string]profile.Punishment{
 						testPunishment.Type: testPunishment,
 					}))
 				})
+
+				It("returns 201 Created and the stored punishment under "+APIPrefix, func() {
+					postJSON, err := json.Marshal(testPunishment)
+					Expect(err).ToNot(HaveOccurred())
+
+					req, err := http.NewRequest("POST", APIPrefix+"/"+testProfile.ID+"/punishments", bytes.NewBuffer(postJSON))
+					Expect(err).ToNot(HaveOccurred())
+					req.Header.Set("Content-Type", "application/json")
+					app.engine.ServeHTTP(resp, req)
+
+					result := resp.Result()
+					Expect(result.StatusCode).To(Equal(http.StatusCreated))
+
+					var created PunishmentResult
+					Expect(json.Unmarshal(resp.Body.Bytes(), &created)).To(Succeed())
+					Expect(created.Escalation).To(BeNil())
+
+					p, err := app.profiles.GetPunishments(testPunishment.PlayerID)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(p).To(Equal(map[string]profile.Punishment{
+						testPunishment.Type: created.Punishment,
+					}))
+					Expect(created.Punishment.ID).ToNot(BeZero())
+					testPunishment.ID = created.Punishment.ID
+					Expect(created.Punishment).To(Equal(testPunishment))
+				})
+
+				It("returns 400 Bad Request for a punishment that already has an ID", func() {
+					testPunishment.ID = 12345
+					postJSON, err := json.Marshal(testPunishment)
+					Expect(err).ToNot(HaveOccurred())
+
+					req, err := http.NewRequest("POST", APIPrefix+"/"+testProfile.ID+"/punishments", bytes.NewBuffer(postJSON))
+					Expect(err).ToNot(HaveOccurred())
+					req.Header.Set("Content-Type", "application/json")
+					app.engine.ServeHTTP(resp, req)
+
+					Expect(resp.Code).To(Equal(http.StatusBadRequest))
+					_, err = app.profiles.GetPunishment(12345)
+					Expect(err).To(Equal(profile.ErrPunishmentNotFound))
+				})
 			})
 
 			Context("PUT", func() {
@@ -303,7 +840,12 @@ var _ = Describe("Game profile microservice", func() {
 					p, err := app.profiles.GetPunishments(testPunishment.PlayerID)
 					Expect(err).ToNot(HaveOccurred())
 
-					Expect(p).To(Equal(testPunishments))
+					Expect(p).To(HaveLen(len(testPunishments)))
+					for k, v := range p {
+						Expect(v.ID).ToNot(BeZero())
+						v.ID = 0
+						Expect(v).To(Equal(testPunishments[k]))
+					}
 				})
 			})
 		})
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/alanfran/gameprofile/profile"
+	"github.com/alanfran/gameprofile/profilerpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// rpcServer serves the gRPC interface from the same store and event bus as the HTTP API.
+type rpcServer struct {
+	a *App
+}
+
+// NewGRPCServer returns a gRPC server with the profile service registered on it.
+func (a *App) NewGRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	s := grpc.NewServer(opts...)
+	profilerpc.RegisterProfilesServer(s, rpcServer{a})
+	return s
+}
+
+// RunGRPC serves the gRPC interface on the given interface/port, next to the HTTP API.
+// Example: app.RunGRPC(":9090")
+func (a *App) RunGRPC(port string) error {
+	lis, err := net.Listen("tcp", port)
+	if err != nil {
+		return err
+	}
+	return a.NewGRPCServer().Serve(lis)
+}
+
+// rpcCaller names whoever made a call, like caller does for HTTP requests.
+func rpcCaller(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if names := md.Get("x-caller"); len(names) > 0 && names[0] != "" {
+			return names[0]
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			return host
+		}
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// invalid turns a validation error into an InvalidArgument status that lists its problems.
+func invalid(msg string, verr *profile.ValidationError) error {
+	return status.Error(codes.InvalidArgument, msg+" "+strings.Join(verr.Problems, " "))
+}
+
+func withHash(p profile.Profile) *profilerpc.ProfileWithHash {
+	pwh := profilerpc.ProfileWithHash(NewProfileWithHash(p))
+	return &pwh
+}
+
+func (s rpcServer) GetProfile(ctx context.Context, in *profilerpc.PlayerRequest) (*profilerpc.ProfileWithHash, error) {
+	p, err := s.a.profiles.GetProfile(in.ID)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "Could not find a profile with that SteamID.")
+	}
+	return withHash(p), nil
+}
+
+func (s rpcServer) GetProfiles(ctx context.Context, in *profilerpc.ProfilesRequest) (*profilerpc.ProfilesReply, error) {
+	if len(in.IDs) > maxBatchProfiles {
+		return nil, status.Error(codes.InvalidArgument, "Please ask for at most "+strconv.Itoa(maxBatchProfiles)+" profiles at once.")
+	}
+
+	ps, err := s.a.profiles.GetProfiles(in.IDs)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "An error occurred while reading the profiles. Please try again later.")
+	}
+
+	reply := &profilerpc.ProfilesReply{Profiles: []profilerpc.ProfileWithHash{}, Missing: []string{}}
+	seen := map[string]bool{}
+	for _, id := range in.IDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		if p, ok := ps[id]; ok {
+			reply.Profiles = append(reply.Profiles, *withHash(p))
+		} else {
+			reply.Missing = append(reply.Missing, id)
+		}
+	}
+	return reply, nil
+}
+
+func (s rpcServer) CreateProfile(ctx context.Context, in *profile.Profile) (*profilerpc.ProfileWithHash, error) {
+	if in.ID == "" {
+		return nil, status.Error(codes.InvalidArgument, "Please supply a profile with an ID.")
+	}
+
+	if _, err := s.a.profiles.GetProfile(in.ID); err == nil {
+		return nil, status.Error(codes.AlreadyExists, "A profile with that SteamID already exists.")
+	}
+
+	err := s.a.profiles.PutProfileBy(*in, rpcCaller(ctx))
+	if verr, ok := err.(*profile.ValidationError); ok {
+		return nil, invalid("The profile does not match the item catalog.", verr)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "An error occurred while storing your profile. Please try again later.")
+	}
+	return withHash(*in), nil
+}
+
+func (s rpcServer) UpdateProfile(ctx context.Context, in *profilerpc.ProfileWithHash) (*profilerpc.ProfileWithHash, error) {
+	p, err := s.a.profiles.GetProfile(in.ID)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "Could not find a profile with that SteamID.")
+	}
+
+	if !hashMatches(in.Hash, p) {
+		return nil, status.Error(codes.Aborted, "The profile has changed since it was read. Please read it again and retry.")
+	}
+
+	err = s.a.profiles.PutProfileBy(in.Profile, rpcCaller(ctx))
+	if verr, ok := err.(*profile.ValidationError); ok {
+		return nil, invalid("The profile does not match the item catalog.", verr)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "An error occurred while storing the profile. Please try again later.")
+	}
+	return withHash(in.Profile), nil
+}
+
+func (s rpcServer) ListProfiles(ctx context.Context, in *profile.ListOptions) (*profilerpc.ProfileList, error) {
+	page, err := s.a.profiles.ListProfiles(*in)
+	if err == profile.ErrInvalidCursor || err == profile.ErrInvalidSort {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "An error occurred while listing profiles. Please try again later.")
+	}
+
+	list := &profilerpc.ProfileList{
+		Profiles:   make([]profilerpc.ProfileWithHash, len(page.Profiles)),
+		NextCursor: page.NextCursor,
+	}
+	for i, p := range page.Profiles {
+		list.Profiles[i] = *withHash(p)
+	}
+	return list, nil
+}
+
+func (s rpcServer) TopProfiles(ctx context.Context, in *profilerpc.LeaderboardRequest) (*profilerpc.Leaderboard, error) {
+	rs, err := s.a.profiles.TopProfiles(in.Limit)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "An error occurred while reading the leaderboard. Please try again later.")
+	}
+	return &profilerpc.Leaderboard{Rankings: rs}, nil
+}
+
+func (s rpcServer) GetStanding(ctx context.Context, in *profilerpc.StandingRequest) (*profile.Standing, error) {
+	st, err := s.a.profiles.GetStanding(in.ID, in.Around)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "Could not find a profile with that SteamID.")
+	}
+	return &st, nil
+}
+
+func (s rpcServer) GetPunishments(ctx context.Context, in *profilerpc.PlayerRequest) (*profilerpc.PunishmentMap, error) {
+	ps, err := s.a.profiles.GetPunishments(in.ID)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "No punishments found for that player.")
+	}
+	return &profilerpc.PunishmentMap{PlayerID: in.ID, Punishments: ps}, nil
+}
+
+func (s rpcServer) PutPunishment(ctx context.Context, in *profile.Punishment) (*profilerpc.Empty, error) {
+	_, err := s.a.profiles.PutPunishment(*in)
+	if verr, ok := err.(*profile.ValidationError); ok {
+		return nil, invalid("Invalid punishment.", verr)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Error storing the punishment. Please try again later.")
+	}
+	return &profilerpc.Empty{}, nil
+}
+
+func (s rpcServer) PutPunishments(ctx context.Context, in *profilerpc.PunishmentMap) (*profilerpc.Empty, error) {
+	for _, p := range in.Punishments {
+		if p.PlayerID != in.PlayerID {
+			return nil, status.Error(codes.InvalidArgument, "PlayerID does not match the ID of the request.")
+		}
+	}
+
+	err := s.a.putPunishments(in.Punishments, rpcCaller(ctx))
+	if verr, ok := err.(*profile.ValidationError); ok {
+		return nil, invalid("Invalid punishment.", verr)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Error storing punishments. Please try again later.")
+	}
+	return &profilerpc.Empty{}, nil
+}
+
+func (s rpcServer) QueryPunishments(ctx context.Context, in *profile.PunishmentQuery) (*profilerpc.PunishmentList, error) {
+	ps, err := s.a.profiles.QueryPunishments(*in)
+	if err == profile.ErrInvalidStatus {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Error searching punishments. Please try again later.")
+	}
+	return &profilerpc.PunishmentList{Punishments: ps}, nil
+}
+
+// Watch streams events from the App's bus, like GetEvents. If some of the events the client missed are no longer
+// kept, an event of type profilerpc.EventGap is sent first.
+func (s rpcServer) Watch(in *profilerpc.WatchRequest, stream profilerpc.Profiles_WatchServer) error {
+	sub := s.a.events.Subscribe(in.EventFilter, in.After)
+	defer sub.Close()
+
+	if sub.Gap {
+		if err := stream.Send(&profile.Event{Type: profilerpc.EventGap}); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				return status.Error(codes.Unavailable, "The stream fell too far behind. Please resume from the last event ID.")
+			}
+			if err := stream.Send(&e); err != nil {
+				return err
+			}
+
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
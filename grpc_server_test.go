@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/alanfran/gameprofile/profile"
+	"github.com/alanfran/gameprofile/profilerpc"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+var _ = Describe("gRPC interface", func() {
+	var app *App
+	var server *grpc.Server
+	var conn *grpc.ClientConn
+	var client *profilerpc.Client
+	var ctx context.Context
+	var cancel context.CancelFunc
+
+	BeforeEach(func() {
+		app = NewApp(profile.NewMockStore())
+
+		lis := bufconn.Listen(1 << 20)
+		server = app.NewGRPCServer()
+		go server.Serve(lis)
+
+		var err error
+		conn, err = grpc.NewClient("passthrough:///bufconn",
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return lis.DialContext(ctx)
+			}),
+			grpc.WithTransportCredentials(insecure.NewCredentials()))
+		Expect(err).ToNot(HaveOccurred())
+		client = profilerpc.NewClient(conn)
+
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	})
+
+	AfterEach(func() {
+		cancel()
+		conn.Close()
+		server.Stop()
+	})
+
+	code := func(err error) codes.Code {
+		return status.Code(err)
+	}
+
+	Context("Profiles", func() {
+		It("creates, reads and updates a profile with its hash", func() {
+			created, err := client.CreateProfile(ctx, profile.Profile{ID: "some_user", Coins: 10})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(created.Hash).To(Equal(NewProfileWithHash(profile.Profile{ID: "some_user", Coins: 10}).Hash))
+
+			_, err = client.CreateProfile(ctx, profile.Profile{ID: "some_user"})
+			Expect(code(err)).To(Equal(codes.AlreadyExists))
+
+			read, err := client.GetProfile(ctx, "some_user")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(read).To(Equal(created))
+
+			read.Coins = 20
+			updated, err := client.UpdateProfile(ctx, *read)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(updated.Coins).To(Equal(int64(20)))
+			Expect(updated.Hash).ToNot(Equal(created.Hash))
+
+			p, err := app.profiles.GetProfile("some_user")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Coins).To(Equal(int64(20)))
+		})
+
+		It("rejects updates with a stale hash", func() {
+			created, err := client.CreateProfile(ctx, profile.Profile{ID: "some_user", Coins: 10})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = client.UpdateProfile(ctx, profilerpc.ProfileWithHash{Profile: profile.Profile{ID: "some_user", Coins: 20}, Hash: created.Hash})
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = client.UpdateProfile(ctx, profilerpc.ProfileWithHash{Profile: profile.Profile{ID: "some_user", Coins: 30}, Hash: created.Hash})
+			Expect(code(err)).To(Equal(codes.Aborted))
+		})
+
+		It("reports missing profiles", func() {
+			_, err := client.GetProfile(ctx, "nobody")
+			Expect(code(err)).To(Equal(codes.NotFound))
+
+			Expect(app.profiles.PutProfile(profile.Profile{ID: "some_user"})).To(Succeed())
+			reply, err := client.GetProfiles(ctx, []string{"nobody", "some_user"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reply.Profiles).To(HaveLen(1))
+			Expect(reply.Missing).To(Equal([]string{"nobody"}))
+		})
+
+		It("records the caller in the profile history", func() {
+			ctx := metadata.AppendToOutgoingContext(ctx, "x-caller", "matchmaker")
+			_, err := client.CreateProfile(ctx, profile.Profile{ID: "some_user"})
+			Expect(err).ToNot(HaveOccurred())
+
+			vs, err := app.profiles.GetHistory("some_user")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(vs).To(HaveLen(1))
+			Expect(vs[0].By).To(Equal("matchmaker"))
+		})
+	})
+
+	Context("Punishments", func() {
+		It("stores and reads punishments", func() {
+			ban := profile.Punishment{PlayerID: "some_user", By: "some_admin", Type: "ban", Reason: "cheating"}
+			Expect(client.PutPunishment(ctx, ban)).To(Succeed())
+
+			ps, err := client.QueryPunishments(ctx, profile.PunishmentQuery{PlayerID: "some_user"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ps).To(HaveLen(1))
+			Expect(ps[0].Reason).To(Equal("cheating"))
+		})
+
+		It("rejects punishments of another player", func() {
+			err := client.PutPunishments(ctx, "some_user", map[string]profile.Punishment{
+				"ban": {PlayerID: "other_user", By: "some_admin", Type: "ban"},
+			})
+			Expect(code(err)).To(Equal(codes.InvalidArgument))
+		})
+	})
+
+	Context("Watch", func() {
+		It("streams changes made through either interface", func() {
+			stream, err := client.Watch(ctx, profilerpc.WatchRequest{EventFilter: profile.EventFilter{PlayerID: "some_user"}})
+			Expect(err).ToNot(HaveOccurred())
+
+			// The subscription is made when the server gets the request, so keep writing until the first event arrives.
+			events := make(chan *profile.Event, 10)
+			go func() {
+				defer GinkgoRecover()
+				for {
+					e, err := stream.Recv()
+					if err != nil {
+						close(events)
+						return
+					}
+					events <- e
+				}
+			}()
+
+			Eventually(func() int {
+				Expect(app.profiles.PutProfile(profile.Profile{ID: "other_user"})).To(Succeed())
+				Expect(app.profiles.PutProfile(profile.Profile{ID: "some_user"})).To(Succeed())
+				return len(events)
+			}).ShouldNot(BeZero())
+
+			e := <-events
+			Expect(e.Type).To(Equal(profile.EventProfilePut))
+			Expect(e.PlayerID).To(Equal("some_user"))
+		})
+
+		It("resumes after the last event the client got", func() {
+			Expect(app.profiles.PutProfile(profile.Profile{ID: "some_user", Coins: 1})).To(Succeed())
+			last := app.events.LastID()
+			Expect(app.profiles.PutProfile(profile.Profile{ID: "some_user", Coins: 2})).To(Succeed())
+
+			stream, err := client.Watch(ctx, profilerpc.WatchRequest{After: last})
+			Expect(err).ToNot(HaveOccurred())
+			e, err := stream.Recv()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(e.ID).To(Equal(last + 1))
+			Expect(e.Profile.Coins).To(Equal(int64(2)))
+		})
+	})
+})
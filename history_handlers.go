@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/alanfran/gameprofile/profile"
+	"github.com/gin-gonic/gin"
+)
+
+// GetHistory returns every version of a player's profile, newest first.
+func (a *App) GetHistory(c *gin.Context) {
+	vs, err := a.profiles.GetHistory(c.Param("steamid"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "An error occurred while reading the profile history. Please try again later.",
+		})
+		return
+	}
+
+	if len(vs) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "No history found for that player.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, vs)
+}
+
+// PostRestoreVersion puts an earlier version of a profile back in place.
+// Like an update, it is rejected with 409 Conflict if the hash does not match the profile's current state.
+func (a *App) PostRestoreVersion(c *gin.Context) {
+	steamid := c.Param("steamid")
+
+	var req Restore
+	err := bindJSON(c, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "There was an error processing your request. Please make sure your JSON is well-formed.",
+		})
+		return
+	}
+
+	p, err := a.profiles.GetProfile(steamid)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Could not find a profile with that SteamID.",
+		})
+		return
+	}
+
+	if !hashMatches(req.Hash, p) {
+		c.JSON(http.StatusConflict, NewProfileWithHash(p))
+		return
+	}
+
+	v, err := a.profiles.GetVersion(steamid, req.Version)
+	if err == profile.ErrVersionNotFound {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "An error occurred while reading the profile history. Please try again later.",
+		})
+		return
+	}
+
+	err = a.profiles.PutProfileBy(v.New, caller(c))
+	if verr, ok := err.(*profile.ValidationError); ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "The version does not match the current item catalog.",
+			"problems": verr.Problems,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "An error occurred while storing the profile. Please try again later.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, NewProfileWithHash(v.New))
+}
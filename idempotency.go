@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultIdempotencyWindow is how long responses are kept for replay when Config.IdempotencyWindow is not set.
+const DefaultIdempotencyWindow = 24 * time.Hour
+
+// DefaultIdempotencyCacheSize is how many responses are kept for replay when Config.IdempotencyCacheSize is not set.
+const DefaultIdempotencyCacheSize = 10000
+
+// maxIdempotencyKey is the longest Idempotency-Key accepted.
+const maxIdempotencyKey = 255
+
+// idempotentResponse is the first response to a request with an Idempotency-Key.
+type idempotentResponse struct {
+	request [sha256.Size]byte
+	pending bool
+	expires time.Time
+
+	status int
+	header http.Header
+	body   []byte
+}
+
+// idempotencyCache keeps responses in memory until their window ends, or until it holds too many.
+// Responses expire in the order they were stored, so expired keys are pruned from the front of order. Keys of requests
+// that are still running are not in order; they are removed when the request ends, however it ends.
+type idempotencyCache struct {
+	mu        sync.Mutex
+	responses map[string]*idempotentResponse
+	order     []string
+}
+
+func newIdempotencyCache() *idempotencyCache {
+	return &idempotencyCache{responses: map[string]*idempotentResponse{}}
+}
+
+// prune removes expired responses, and the oldest ones while more than max are kept. The caller holds the lock.
+func (c *idempotencyCache) prune(now time.Time, max int) {
+	for len(c.order) > 0 {
+		if now.Before(c.responses[c.order[0]].expires) && len(c.order) <= max {
+			return
+		}
+		delete(c.responses, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// recordingWriter keeps a copy of the response body as it is written.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// idempotencyScope names who made a request, for the keys of idempotency: the game server or admin it was
+// authenticated as, or the client's address. X-Caller is not used, as anyone can send it.
+func (a *App) idempotencyScope(c *gin.Context) string {
+	if name := c.GetString(signedServerKey); name != "" {
+		return "server " + name
+	}
+	if name, ok := a.serverName(c); ok {
+		return "server " + name
+	}
+	if name, ok := a.adminName(c); ok {
+		return "admin " + name
+	}
+	return "client " + c.ClientIP()
+}
+
+// idempotency replays the first response to POST, PUT and PATCH requests that repeat an Idempotency-Key,
+// so that clients can safely retry requests that timed out. Keys are scoped to the caller, method and path, and are
+// kept for the App's IdempotencyWindow, up to its IdempotencyCacheSize. Server errors and panics are not kept, so
+// those requests can be retried for real. It runs after the route's Auth, so that only callers who may make a
+// request get its answer.
+func (a *App) idempotency() gin.HandlerFunc {
+	cache := newIdempotencyCache()
+
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		method := c.Request.Method
+		if key == "" || (method != "POST" && method != "PUT" && method != "PATCH") {
+			c.Next()
+			return
+		}
+
+		if len(key) > maxIdempotencyKey {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "The Idempotency-Key must be at most 255 characters long.",
+			})
+			return
+		}
+
+		body, err := ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "There was an error reading your request.",
+			})
+			return
+		}
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		// A path and its deprecated alias are the same endpoint.
+		path := c.Request.URL.Path
+		if strings.HasPrefix(path, APIPrefix+"/") {
+			path = strings.TrimPrefix(path, APIPrefix)
+		}
+		id := a.idempotencyScope(c) + "\n" + method + " " + path + "\n" + key
+		request := sha256.Sum256(body)
+		now := time.Now()
+
+		window := a.IdempotencyWindow
+		if window <= 0 {
+			window = DefaultIdempotencyWindow
+		}
+		size := a.IdempotencyCacheSize
+		if size <= 0 {
+			size = DefaultIdempotencyCacheSize
+		}
+
+		cache.mu.Lock()
+		cache.prune(now, size)
+		r, ok := cache.responses[id]
+		switch {
+		case ok && r.request != request:
+			cache.mu.Unlock()
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+				"error": "This Idempotency-Key was already used with a different request.",
+			})
+			return
+
+		case ok && r.pending:
+			cache.mu.Unlock()
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"error": "A request with this Idempotency-Key is still being processed. Please retry later.",
+			})
+			return
+
+		case ok:
+			cache.mu.Unlock()
+			for k, v := range r.header {
+				c.Writer.Header()[k] = v
+			}
+			c.Header("Idempotent-Replayed", "true")
+			c.Writer.WriteHeader(r.status)
+			c.Writer.Write(r.body)
+			c.Abort()
+			return
+		}
+
+		r = &idempotentResponse{request: request, pending: true}
+		cache.responses[id] = r
+		cache.mu.Unlock()
+
+		w := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		stored := false
+		defer func() {
+			c.Writer = w.ResponseWriter
+			if stored {
+				return
+			}
+			// The request failed or panicked, so the key is released for a real retry.
+			cache.mu.Lock()
+			delete(cache.responses, id)
+			cache.mu.Unlock()
+		}()
+
+		c.Next()
+
+		if w.Status() >= http.StatusInternalServerError {
+			return
+		}
+
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+		r.pending = false
+		r.expires = time.Now().Add(window)
+		r.status = w.Status()
+		r.header = w.Header().Clone()
+		r.body = w.body.Bytes()
+		cache.order = append(cache.order, id)
+		cache.prune(time.Now(), size)
+		stored = true
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/alanfran/gameprofile/profile"
+	"github.com/gin-gonic/gin"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Idempotency keys", func() {
+	var app *App
+
+	BeforeEach(func() {
+		app = NewApp(profile.NewMockStore())
+		Expect(app.profiles.PutItem(profile.Item{Name: "hat", Slot: "head", Price: 100})).To(Succeed())
+		Expect(app.profiles.PutProfile(profile.Profile{ID: "some_user", Coins: 500})).To(Succeed())
+	})
+
+	// sendWith makes a request with the given headers, and an Idempotency-Key unless key is empty.
+	sendWith := func(header http.Header, method, url, key string, v interface{}) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(v)
+		req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+
+		resp := httptest.NewRecorder()
+		app.engine.ServeHTTP(resp, req)
+		return resp
+	}
+
+	send := func(method, url, key string, v interface{}) *httptest.ResponseRecorder {
+		return sendWith(nil, method, url, key, v)
+	}
+
+	coins := func() int64 {
+		p, err := app.profiles.GetProfile("some_user")
+		Expect(err).ToNot(HaveOccurred())
+		return p.Coins
+	}
+
+	It("replays the first response instead of running the request again", func() {
+		first := send("POST", "/v1/some_user/purchases", "key-1", Purchase{Item: "hat"})
+		Expect(first.Code).To(Equal(http.StatusCreated))
+
+		retry := send("POST", "/v1/some_user/purchases", "key-1", Purchase{Item: "hat"})
+		Expect(retry.Code).To(Equal(http.StatusCreated))
+		Expect(retry.Body.String()).To(Equal(first.Body.String()))
+		Expect(retry.Header().Get("Idempotent-Replayed")).To(Equal("true"))
+		Expect(retry.Header().Get("Content-Type")).To(Equal(first.Header().Get("Content-Type")))
+
+		Expect(coins()).To(Equal(int64(400)))
+	})
+
+	It("stores a retried punishment once", func() {
+		p := profile.Punishment{PlayerID: "some_user", By: "some_admin", Type: "ban", Reason: "cheating"}
+		Expect(send("POST", "/v1/some_user/punishments", "key-1", p).Code).To(Equal(http.StatusCreated))
+		Expect(send("POST", "/v1/some_user/punishments", "key-1", p).Code).To(Equal(http.StatusCreated))
+
+		ps, err := app.profiles.QueryPunishments(profile.PunishmentQuery{PlayerID: "some_user"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ps).To(HaveLen(1))
+	})
+
+	It("runs requests without a key or with different keys", func() {
+		send("POST", "/v1/some_user/purchases", "", Purchase{Item: "hat"})
+		send("DELETE", "/v1/some_user/inventory/hat", "", nil)
+		send("POST", "/v1/some_user/purchases", "", Purchase{Item: "hat"})
+		Expect(coins()).To(Equal(int64(300)))
+
+		send("DELETE", "/v1/some_user/inventory/hat", "", nil)
+		send("POST", "/v1/some_user/purchases", "key-1", Purchase{Item: "hat"})
+		send("DELETE", "/v1/some_user/inventory/hat", "", nil)
+		send("POST", "/v1/some_user/purchases", "key-2", Purchase{Item: "hat"})
+		Expect(coins()).To(Equal(int64(100)))
+	})
+
+	It("rejects a key reused with a different request", func() {
+		send("POST", "/v1/some_user/purchases", "key-1", Purchase{Item: "hat"})
+		resp := send("POST", "/v1/some_user/purchases", "key-1", Purchase{Item: "scarf"})
+		Expect(resp.Code).To(Equal(http.StatusUnprocessableEntity))
+	})
+
+	It("forgets keys after the window", func() {
+		app.IdempotencyWindow = 10 * time.Millisecond
+
+		send("POST", "/v1/some_user/purchases", "key-1", Purchase{Item: "hat"})
+		send("DELETE", "/v1/some_user/inventory/hat", "", nil)
+		time.Sleep(20 * time.Millisecond)
+
+		resp := send("POST", "/v1/some_user/purchases", "key-1", Purchase{Item: "hat"})
+		Expect(resp.Code).To(Equal(http.StatusCreated))
+		Expect(resp.Header().Get("Idempotent-Replayed")).To(BeEmpty())
+		Expect(coins()).To(Equal(int64(300)))
+	})
+
+	It("drops the oldest responses when the cache is full", func() {
+		app.IdempotencyCacheSize = 1
+
+		send("POST", "/v1/some_user/purchases", "key-1", Purchase{Item: "hat"})
+		send("DELETE", "/v1/some_user/inventory/hat", "", nil)
+		send("POST", "/v1/some_user/purchases", "key-2", Purchase{Item: "hat"})
+		send("DELETE", "/v1/some_user/inventory/hat", "", nil)
+
+		Expect(send("POST", "/v1/some_user/purchases", "key-2", Purchase{Item: "hat"}).Header().Get("Idempotent-Replayed")).To(Equal("true"))
+		Expect(send("POST", "/v1/some_user/purchases", "key-1", Purchase{Item: "hat"}).Header().Get("Idempotent-Replayed")).To(BeEmpty())
+		Expect(coins()).To(Equal(int64(200)))
+	})
+
+	It("releases the key of a request that panicked", func() {
+		calls := 0
+		app.engine.POST("/panics", app.idempotency(), func(c *gin.Context) {
+			calls++
+			if calls == 1 {
+				panic("boom")
+			}
+			c.String(http.StatusOK, "fine")
+		})
+
+		Expect(send("POST", "/panics", "key-1", nil).Code).To(Equal(http.StatusInternalServerError))
+		resp := send("POST", "/panics", "key-1", nil)
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(resp.Body.String()).To(Equal("fine"))
+		Expect(calls).To(Equal(2))
+	})
+
+	It("does not replay answers to callers the route does not let in", func() {
+		app.AdminKeys = map[string]string{"admin_secret": "some_admin"}
+		w := profile.Webhook{URL: "https://example.com/hook", Secret: "secret"}
+		admin := http.Header{"Authorization": {"Bearer admin_secret"}}
+		Expect(sendWith(admin, "POST", "/v1/admin/webhooks", "key-1", w).Code).To(Equal(http.StatusCreated))
+
+		resp := send("POST", "/v1/admin/webhooks", "key-1", w)
+		Expect(resp.Code).To(Equal(http.StatusUnauthorized))
+		Expect(resp.Header().Get("Idempotent-Replayed")).To(BeEmpty())
+	})
+
+	It("keeps the keys of different callers apart", func() {
+		app.ServerKeys = map[string]string{"secret": "server_1"}
+		server := http.Header{"Authorization": {"Bearer secret"}}
+		Expect(sendWith(server, "POST", "/v1/some_user/purchases", "key-1", Purchase{Item: "hat"}).Code).To(Equal(http.StatusCreated))
+
+		resp := send("POST", "/v1/some_user/purchases", "key-1", Purchase{Item: "hat"})
+		Expect(resp.Header().Get("Idempotent-Replayed")).To(BeEmpty())
+		Expect(resp.Body.String()).ToNot(ContainSubstring("Receipt"))
+
+		resp = sendWith(server, "POST", "/v1/some_user/purchases", "key-1", Purchase{Item: "hat"})
+		Expect(resp.Header().Get("Idempotent-Replayed")).To(Equal("true"))
+	})
+})
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Int64Header asks for 64-bit integers to be sent as strings when set to Int64Strings.
+// The int64 query parameter does the same for clients that cannot set headers, eg. WebSockets.
+const Int64Header = "X-Gameprofile-Int64"
+
+// Int64Strings is the value of Int64Header and of the int64 query parameter that selects strings.
+const Int64Strings = "string"
+
+// int64StringsKey is the context key set on requests that asked for 64-bit integers as strings.
+const int64StringsKey = "gameprofile.int64strings"
+
+// wantsInt64Strings reports whether the client asked for 64-bit integers as strings.
+// Game servers like Garry's Mod parse JSON numbers as doubles, which lose the precision of large coin balances,
+// punishment IDs and SteamID64s.
+func wantsInt64Strings(c *gin.Context) bool {
+	return c.GetHeader(Int64Header) == Int64Strings || c.Query("int64") == Int64Strings
+}
+
+// jsonWriter holds back JSON responses so that they can be rewritten once the handlers are done.
+// Other responses, such as event streams and archives, are written through.
+type jsonWriter struct {
+	gin.ResponseWriter
+	body      bytes.Buffer
+	buffering bool
+	decided   bool
+}
+
+func (w *jsonWriter) decide() {
+	if !w.decided {
+		w.decided = true
+		w.buffering = strings.HasPrefix(w.Header().Get("Content-Type"), "application/json")
+	}
+}
+
+func (w *jsonWriter) Write(b []byte) (int, error) {
+	w.decide()
+	if w.buffering {
+		return w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *jsonWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// flush writes the held back response, rewritten by rewrite. Responses that rewrite fails on are sent as they are.
+func (w *jsonWriter) flush(rewrite func([]byte) ([]byte, error)) error {
+	if !w.buffering {
+		return nil
+	}
+	out, err := rewrite(w.body.Bytes())
+	if err != nil {
+		out = w.body.Bytes()
+	}
+	_, err = w.ResponseWriter.Write(out)
+	return err
+}
+
+// int64Format sends the 64-bit integers of JSON responses as strings to clients that ask for it with Int64Header
+// or the int64 query parameter, going by the type of the route's Response. Handlers accept strings for integers
+// from those clients with bindJSON. Nothing changes for other clients.
+func (a *App) int64Format() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !wantsInt64Strings(c) {
+			c.Next()
+			return
+		}
+
+		c.Set(int64StringsKey, true)
+		w := &jsonWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		v, _ := c.Get(responseTypeKey)
+		t, _ := v.(reflect.Type)
+		rewrite := func(data []byte) ([]byte, error) {
+			return int64sToStrings(data, t)
+		}
+		if err := w.flush(rewrite); err != nil {
+			c.Error(err)
+		}
+	}
+}
+
+// responseTypeKey is the context key that holds the type of the JSON a route answers with.
+const responseTypeKey = "gameprofile.responsetype"
+
+// respondsWith records the type of v as the type of the JSON the route answers with, for int64Format.
+func respondsWith(v interface{}) gin.HandlerFunc {
+	t := reflect.TypeOf(v)
+	return func(c *gin.Context) {
+		c.Set(responseTypeKey, t)
+	}
+}
+
+// int64Kind reports whether t holds 64-bit integers, which doubles cannot hold exactly.
+func int64Kind(t reflect.Type) bool {
+	return t != nil && (t.Kind() == reflect.Int64 || t.Kind() == reflect.Uint64)
+}
+
+// int64sToStrings rewrites the integers of a JSON document that sit where t has a 64-bit integer as strings.
+// Other integers, such as status codes, other numbers, key order and the rest of the document are kept.
+// Nothing is rewritten where t, or a part of it, is nil or an interface.
+func int64sToStrings(data []byte, t reflect.Type) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var out bytes.Buffer
+	// Whether a comma or a colon has to be written before the next token, per open object or array,
+	// the Go type of the object or array, and the key of the value being written.
+	type level struct {
+		object bool
+		count  int
+		t      reflect.Type
+		fields map[string]reflect.Type
+		key    string
+	}
+	var levels []level
+
+	// typeOf returns the Go type of the next value, or nil if it is not known.
+	typeOf := func() reflect.Type {
+		var vt reflect.Type
+		if len(levels) == 0 {
+			vt = t
+		} else if l := levels[len(levels)-1]; l.t != nil {
+			switch {
+			case l.fields != nil:
+				vt = l.fields[strings.ToLower(l.key)]
+			case l.t.Kind() == reflect.Map, l.t.Kind() == reflect.Slice, l.t.Kind() == reflect.Array:
+				vt = l.t.Elem()
+			}
+		}
+		for vt != nil && vt.Kind() == reflect.Ptr {
+			vt = vt.Elem()
+		}
+		return vt
+	}
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if d, ok := tok.(json.Delim); ok && (d == '}' || d == ']') {
+			levels = levels[:len(levels)-1]
+			out.WriteByte(byte(d))
+			continue
+		}
+
+		isKey := false
+		if n := len(levels); n > 0 {
+			l := &levels[n-1]
+			switch {
+			case l.object && l.count%2 == 1:
+				out.WriteByte(':')
+			case l.count > 0:
+				out.WriteByte(',')
+			}
+			if l.object && l.count%2 == 0 {
+				isKey = true
+				l.key, _ = tok.(string)
+			}
+			l.count++
+		}
+
+		var vt reflect.Type
+		if !isKey {
+			vt = typeOf()
+		}
+
+		switch tok := tok.(type) {
+		case json.Delim:
+			out.WriteByte(byte(tok))
+			l := level{object: tok == '{', t: vt}
+			if vt != nil && vt.Kind() == reflect.Struct && vt != timeType {
+				l.fields = jsonFields(vt)
+			}
+			levels = append(levels, l)
+		case json.Number:
+			if int64Kind(vt) {
+				out.WriteByte('"')
+				out.WriteString(string(tok))
+				out.WriteByte('"')
+			} else {
+				out.WriteString(string(tok))
+			}
+		default:
+			j, err := json.Marshal(tok)
+			if err != nil {
+				return nil, err
+			}
+			out.Write(j)
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// jsonFor encodes v for the client of c, with its 64-bit integers as strings when the client asked for them.
+func jsonFor(c *gin.Context, v interface{}) ([]byte, error) {
+	j, err := json.Marshal(v)
+	if err != nil || !c.GetBool(int64StringsKey) {
+		return j, err
+	}
+	return int64sToStrings(j, reflect.TypeOf(v))
+}
+
+// bindJSON decodes the JSON body of a request into obj, like c.Bind. Clients that asked for 64-bit integers as
+// strings may send strings for the integer fields of obj too.
+func bindJSON(c *gin.Context, obj interface{}) error {
+	if !c.GetBool(int64StringsKey) {
+		return c.Bind(obj)
+	}
+
+	data, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		return err
+	}
+	return unmarshalInt64Strings(data, obj)
+}
+
+// unmarshalInt64Strings decodes data into v, accepting strings that hold integers for the integer fields of v.
+func unmarshalInt64Strings(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var raw interface{}
+	if err := dec.Decode(&raw); err != nil {
+		return err
+	}
+
+	j, err := json.Marshal(stringsToInt64s(raw, reflect.TypeOf(v)))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(j, v)
+}
+
+// stringsToInt64s replaces the strings of a decoded JSON value that sit where t has an integer with numbers,
+// and the integers that sit where t has a string with strings.
+// Strings that do not hold an integer are left for json.Unmarshal to reject.
+func stringsToInt64s(v interface{}, t reflect.Type) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if s, ok := v.(string); ok {
+			if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return json.Number(s)
+			}
+			if _, err := strconv.ParseUint(s, 10, 64); err == nil {
+				return json.Number(s)
+			}
+		}
+
+	case reflect.String:
+		// SteamID64s sent as numbers keep every digit this way.
+		if n, ok := v.(json.Number); ok {
+			if _, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+				return string(n)
+			}
+		}
+
+	case reflect.Slice, reflect.Array:
+		if vs, ok := v.([]interface{}); ok {
+			for i := range vs {
+				vs[i] = stringsToInt64s(vs[i], t.Elem())
+			}
+		}
+
+	case reflect.Map:
+		if m, ok := v.(map[string]interface{}); ok {
+			for k := range m {
+				m[k] = stringsToInt64s(m[k], t.Elem())
+			}
+		}
+
+	case reflect.Struct:
+		if t == timeType {
+			break
+		}
+		if m, ok := v.(map[string]interface{}); ok {
+			fields := jsonFields(t)
+			for k := range m {
+				// encoding/json matches keys to fields without regard to case.
+				if ft, ok := fields[strings.ToLower(k)]; ok {
+					m[k] = stringsToInt64s(m[k], ft)
+				}
+			}
+		}
+	}
+	return v
+}
+
+// jsonFields returns the types of the fields of a struct by their lowercased JSON name, including the fields of
+// embedded structs.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			for k, v := range jsonFields(ft) {
+				if _, ok := fields[k]; !ok {
+					fields[k] = v
+				}
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+		fields[strings.ToLower(name)] = f.Type
+	}
+	return fields
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+
+	"github.com/alanfran/gameprofile/profile"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("64-bit integers as strings", func() {
+	var app *App
+
+	BeforeEach(func() {
+		app = NewApp(profile.NewMockStore())
+		Expect(app.profiles.PutProfile(profile.Profile{ID: "some_user", Coins: 9007199254740993})).To(Succeed())
+	})
+
+	send := func(method, url string, header http.Header, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range header {
+			req.Header[k] = v
+		}
+
+		resp := httptest.NewRecorder()
+		app.engine.ServeHTTP(resp, req)
+		return resp
+	}
+
+	decode := func(resp *httptest.ResponseRecorder) map[string]interface{} {
+		var m map[string]interface{}
+		Expect(json.Unmarshal(resp.Body.Bytes(), &m)).To(Succeed())
+		return m
+	}
+
+	It("keeps numbers for clients that do not ask", func() {
+		resp := send("GET", "/v1/some_user", nil, "")
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(resp.Body.String()).To(ContainSubstring(`"Coins":9007199254740993`))
+	})
+
+	It("sends integers as strings when asked with the header or the query parameter", func() {
+		resp := send("GET", "/v1/some_user", http.Header{Int64Header: {Int64Strings}}, "")
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(decode(resp)["Coins"]).To(Equal("9007199254740993"))
+
+		resp = send("GET", "/v1/some_user?int64=string", nil, "")
+		Expect(decode(resp)["Coins"]).To(Equal("9007199254740993"))
+		Expect(decode(resp)["ID"]).To(Equal("some_user"))
+	})
+
+	It("accepts strings for integers when asked", func() {
+		resp := send("POST", "/v1/?int64=string", nil, `{"ID": "another_user", "Coins": "9007199254740995"}`)
+		Expect(resp.Code).To(Equal(http.StatusCreated), resp.Body.String())
+		Expect(decode(resp)["Coins"]).To(Equal("9007199254740995"))
+
+		p, err := app.profiles.GetProfile("another_user")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p.Coins).To(Equal(int64(9007199254740995)))
+	})
+
+	It("updates a profile with the hash it was sent", func() {
+		read := decode(send("GET", "/v1/some_user?int64=string", nil, ""))
+		read["Coins"] = "9007199254740999"
+		body, _ := json.Marshal(read)
+
+		resp := send("PUT", "/v1/some_user?int64=string", nil, string(body))
+		Expect(resp.Code).To(Equal(http.StatusOK), resp.Body.String())
+
+		p, err := app.profiles.GetProfile("some_user")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p.Coins).To(Equal(int64(9007199254740999)))
+	})
+
+	It("keeps every digit of SteamID64s sent as numbers", func() {
+		resp := send("POST", "/v1/76561197960287930/punishments?int64=string", nil,
+			`{"PlayerID": 76561197960287930, "By": "some_admin", "Type": "ban", "Reason": "cheating"}`)
+		Expect(resp.Code).To(Equal(http.StatusCreated), resp.Body.String())
+
+		ps, err := app.profiles.GetPunishments("76561197960287930")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ps).To(HaveLen(1))
+		for _, p := range ps {
+			Expect(p.PlayerID).To(Equal("76561197960287930"))
+		}
+	})
+
+	It("rejects strings that are not integers", func() {
+		resp := send("POST", "/v1/?int64=string", nil, `{"ID": "another_user", "Coins": "lots"}`)
+		Expect(resp.Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("rewrites only 64-bit integers", func() {
+		type inner struct {
+			N int64
+			M int
+		}
+		type doc struct {
+			A []int64
+			B map[string]*inner
+			C int
+			D float64
+			E interface{}
+		}
+		out, err := int64sToStrings([]byte(`{"E":{"N":7},"A":[1,-2],"B":{"x":{"M":3,"N":4},"y":null},"C":5,"D":1.5}`),
+			reflect.TypeOf(doc{}))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(out)).To(Equal(`{"E":{"N":7},"A":["1","-2"],"B":{"x":{"M":3,"N":"4"},"y":null},"C":5,"D":1.5}`))
+
+		out, err = int64sToStrings([]byte(`{"a":[1]}`), nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(out)).To(Equal(`{"a":[1]}`))
+	})
+
+	It("keeps the statuses of bulk writes as numbers", func() {
+		resp := send("POST", "/v1/bulk?int64=string", nil,
+			`{"Writes": [{"Punishment": {"PlayerID": "some_user", "By": "some_admin", "Type": "ban"}}]}`)
+		Expect(resp.Code).To(Equal(http.StatusOK), resp.Body.String())
+		Expect(resp.Body.String()).To(MatchRegexp(`"Status":\d+`))
+		Expect(resp.Body.String()).To(MatchRegexp(`"ID":"\d+"`))
+	})
+})
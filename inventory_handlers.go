@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/alanfran/gameprofile/profile"
+	"github.com/gin-gonic/gin"
+)
+
+// changeInventory applies an inventory event and responds with the result.
+func (a *App) changeInventory(c *gin.Context, status int, e profile.InventoryEvent) {
+	e.PlayerID = c.Param("steamid")
+	e.Date = time.Now()
+
+	e, p, err := a.profiles.ChangeInventory(e)
+	if err != nil {
+		shopError(c, err)
+		return
+	}
+
+	c.JSON(status, InventoryResult{
+		Event:   e,
+		Profile: NewProfileWithHash(p),
+	})
+}
+
+// bindInventoryChange reads an optional InventoryChange from the request body.
+func bindInventoryChange(c *gin.Context) (InventoryChange, bool) {
+	var ch InventoryChange
+	if c.Request.ContentLength == 0 {
+		return ch, true
+	}
+
+	err := bindJSON(c, &ch)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "There was an error processing your request. Please make sure your JSON is well-formed.",
+		})
+		return ch, false
+	}
+	return ch, true
+}
+
+// PostInventoryItem grants an item to a player for free.
+func (a *App) PostInventoryItem(c *gin.Context) {
+	ch, ok := bindInventoryChange(c)
+	if !ok {
+		return
+	}
+	if ch.Item == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Please supply the name of the Item to grant.",
+		})
+		return
+	}
+
+	a.changeInventory(c, http.StatusCreated, profile.InventoryEvent{
+		Kind:     profile.InventoryGrant,
+		Item:     ch.Item,
+		Settings: ch.Settings,
+		By:       ch.By,
+	})
+}
+
+// PutInventoryItem replaces the settings of an item a player owns.
+func (a *App) PutInventoryItem(c *gin.Context) {
+	ch, ok := bindInventoryChange(c)
+	if !ok {
+		return
+	}
+
+	a.changeInventory(c, http.StatusOK, profile.InventoryEvent{
+		Kind:     profile.InventorySettings,
+		Item:     c.Param("item"),
+		Settings: ch.Settings,
+		By:       ch.By,
+	})
+}
+
+// DelInventoryItem takes an item away from a player. The by query parameter names who removed it.
+func (a *App) DelInventoryItem(c *gin.Context) {
+	a.changeInventory(c, http.StatusOK, profile.InventoryEvent{
+		Kind: profile.InventoryRemove,
+		Item: c.Param("item"),
+		By:   c.Query("by"),
+	})
+}
+
+// SellInventoryItem sells an item back to the shop for part of its catalog price.
+func (a *App) SellInventoryItem(c *gin.Context) {
+	ch, ok := bindInventoryChange(c)
+	if !ok {
+		return
+	}
+
+	a.changeInventory(c, http.StatusOK, profile.InventoryEvent{
+		Kind: profile.InventorySell,
+		Item: c.Param("item"),
+		By:   ch.By,
+	})
+}
+
+// GetInventoryEvents returns a player's inventory log, newest first.
+// The item query parameter restricts it to a single item.
+func (a *App) GetInventoryEvents(c *gin.Context) {
+	es, err := a.profiles.GetInventoryEvents(c.Param("steamid"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "An error occurred while reading the inventory log. Please try again later.",
+		})
+		return
+	}
+
+	if item := c.Query("item"); item != "" {
+		filtered := []profile.InventoryEvent{}
+		for _, e := range es {
+			if e.Item == item {
+				filtered = append(filtered, e)
+			}
+		}
+		es = filtered
+	}
+
+	c.JSON(http.StatusOK, es)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/alanfran/gameprofile/profile"
+	"github.com/gin-gonic/gin"
+)
+
+// GetItems returns the whole item catalog, ordered by name.
+func (a *App) GetItems(c *gin.Context) {
+	items, err := a.profiles.GetItems()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "An error occurred while reading the item catalog. Please try again later.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, items)
+}
+
+// GetItem returns a single catalog item.
+func (a *App) GetItem(c *gin.Context) {
+	it, err := a.profiles.GetItem(c.Param("name"))
+	if err == profile.ErrItemNotFound {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "An error occurred while reading the item catalog. Please try again later.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, it)
+}
+
+// PutItem adds an item to the catalog or replaces it.
+func (a *App) PutItem(c *gin.Context) {
+	var it profile.Item
+	err := bindJSON(c, &it)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "There was an error processing your request. Please make sure your JSON is well-formed.",
+		})
+		return
+	}
+
+	if it.Name != c.Param("name") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "The name in the request body does not match the one in the URL.",
+		})
+		return
+	}
+
+	err = a.profiles.PutItem(it)
+	if verr, ok := err.(*profile.ValidationError); ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "The item is invalid.",
+			"problems": verr.Problems,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "An error occurred while storing the item. Please try again later.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, it)
+}
+
+// DelItem removes an item from the catalog. Items that players still own cannot be removed.
+func (a *App) DelItem(c *gin.Context) {
+	name := c.Param("name")
+
+	_, err := a.profiles.GetItem(name)
+	if err == profile.ErrItemNotFound {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err == nil {
+		err = a.profiles.DelItem(name)
+	}
+	if err == profile.ErrItemInUse {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "An error occurred while deleting the item. Please try again later.",
+		})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
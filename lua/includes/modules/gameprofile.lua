@@ -0,0 +1,582 @@
+--[[
+	gameprofile: a client of the gameprofile service for Garry's Mod servers.
+
+	Copy this file to garrysmod/lua/includes/modules/ and load it on the server:
+
+		require("gameprofile")
+		gameprofile.Configure({
+			URL = "http://profiles.example.com",
+			Server = "server_1",     -- the name of this server in the service's -server-keys file
+			Key = "5ed9c4c6b0a1...", -- its key, used to sign requests
+		})
+
+	Every call is asynchronous and ends with callback(err, result). err is nil on success, or a table with the
+	HTTP Status (0 when the service could not be reached), the Error message and the Problems of invalid records.
+
+	SteamIDs are the text form, eg. "STEAM_0:1:1234". Coins are Lua numbers, which are exact up to 2^53. Set
+	Int64Strings to get coins, prices and IDs as strings that keep every digit instead.
+
+	The requests this module makes, and the answers it expects, are written down in lua/contract/*.json.
+	The service's tests replay them, so a change to the API that would break this module fails the build.
+]]
+
+if not SERVER then return end
+
+local gameprofile = {}
+_G.gameprofile = gameprofile
+
+gameprofile.Config = {
+	-- URL is the address of the service, without the /v1 prefix.
+	URL = "http://localhost:80",
+	-- Server and Key sign every request. Leave Key unset to send unsigned requests.
+	Server = nil,
+	Key = nil,
+	-- CacheTTL is how many seconds profiles and ban checks are cached for.
+	CacheTTL = 60,
+	-- ConflictRetries is how many times UpdateProfile retries when another server changed the profile first.
+	ConflictRetries = 5,
+	-- BanTypes are the punishment types that keep a player out.
+	BanTypes = { ban = true },
+	-- Int64Strings asks the service for integers as strings, which keep every digit of large coin balances and
+	-- IDs. Strings may be sent for integers too. Convert them with tonumber before doing arithmetic.
+	Int64Strings = false,
+}
+
+local cfg = gameprofile.Config
+
+-- Configure changes the settings in gameprofile.Config.
+function gameprofile.Configure(t)
+	for k, v in pairs(t) do
+		cfg[k] = v
+	end
+end
+
+--[[ JSON
+
+	util.TableToJSON writes empty tables as [], which the service cannot read as an inventory, and may write large
+	numbers with an exponent. Tables are encoded here as objects, unless they are non-empty sequences or were marked
+	with gameprofile.Array.
+]]
+
+local arrayMeta = {}
+
+-- Array marks a table to be encoded as a JSON array, even when it is empty.
+function gameprofile.Array(t)
+	return setmetatable(t or {}, arrayMeta)
+end
+
+local escapes = { ['"'] = '\\"', ["\\"] = "\\\\", ["\b"] = "\\b", ["\f"] = "\\f", ["\n"] = "\\n", ["\r"] = "\\r", ["\t"] = "\\t" }
+
+local function quote(s)
+	return '"' .. s:gsub('[%c"\\]', function(c)
+		return escapes[c] or string.format("\\u%04x", c:byte())
+	end) .. '"'
+end
+
+local function isArray(t)
+	if getmetatable(t) == arrayMeta then return true end
+	local n = #t
+	if n == 0 then return false end
+	local count = 0
+	for _ in pairs(t) do count = count + 1 end
+	return count == n
+end
+
+local encodeValue
+
+local function encodeTable(t, out)
+	if isArray(t) then
+		out[#out + 1] = "["
+		for i = 1, #t do
+			if i > 1 then out[#out + 1] = "," end
+			encodeValue(t[i], out)
+		end
+		out[#out + 1] = "]"
+		return
+	end
+
+	local keys = {}
+	for k in pairs(t) do keys[#keys + 1] = tostring(k) end
+	table.sort(keys)
+
+	out[#out + 1] = "{"
+	for i, k in ipairs(keys) do
+		if i > 1 then out[#out + 1] = "," end
+		local v = t[k]
+		if v == nil then v = t[tonumber(k)] end
+		out[#out + 1] = quote(k)
+		out[#out + 1] = ":"
+		encodeValue(v, out)
+	end
+	out[#out + 1] = "}"
+end
+
+encodeValue = function(v, out)
+	local t = type(v)
+	if v == nil then
+		out[#out + 1] = "null"
+	elseif t == "boolean" then
+		out[#out + 1] = tostring(v)
+	elseif t == "number" then
+		if v ~= v or v == math.huge or v == -math.huge then
+			error("gameprofile: cannot encode " .. tostring(v) .. " as JSON")
+		end
+		if math.floor(v) == v then
+			out[#out + 1] = string.format("%.0f", v)
+		else
+			out[#out + 1] = string.format("%.17g", v)
+		end
+	elseif t == "string" then
+		out[#out + 1] = quote(v)
+	elseif t == "table" then
+		encodeTable(v, out)
+	else
+		error("gameprofile: cannot encode a " .. t .. " as JSON")
+	end
+end
+
+-- Encode returns v as JSON.
+function gameprofile.Encode(v)
+	local out = {}
+	encodeValue(v, out)
+	return table.concat(out)
+end
+
+-- Decode reads JSON. Keys that look like numbers, such as SteamID64s, are kept as strings.
+function gameprofile.Decode(s)
+	if s == nil or s == "" then return nil end
+	return util.JSONToTable(s, false, true)
+end
+
+--[[ Hashes
+
+	A profile's Hash is "v2_" and the hex SHA-256 of its canonical form: a line "profile", a line "id" and the ID,
+	a line "coins" and the coins in decimal, then a line "inventory" with the name and settings of every item and a
+	line "equipment" with the slot and item of every slot, each sorted by name. Text is written as its length in
+	bytes, a colon and the text. LuaJIT sorts strings by their bytes, like the service.
+	The vectors in the service's profile/testdata/hashes.json check an implementation.
+]]
+
+local function canonicalString(s)
+	s = tostring(s)
+	return #s .. ":" .. s
+end
+
+local function canonicalMap(out, name, m)
+	local keys = {}
+	for k in pairs(m or {}) do keys[#keys + 1] = tostring(k) end
+	table.sort(keys)
+	for _, k in ipairs(keys) do
+		local v = m[k]
+		if v == nil then v = m[tonumber(k)] end
+		out[#out + 1] = name .. " " .. canonicalString(k) .. " " .. canonicalString(v) .. "\n"
+	end
+end
+
+-- Hash returns the hash of a profile, the same as the Hash the service sends with it.
+function gameprofile.Hash(p)
+	local coins = p.Coins or 0
+	if isnumber(coins) then coins = string.format("%.0f", coins) end
+	local out = { "profile\n", "id " .. canonicalString(p.ID) .. "\n", "coins " .. coins .. "\n" }
+	canonicalMap(out, "inventory", p.Inventory)
+	canonicalMap(out, "equipment", p.Equipment)
+	return "v2_" .. util.SHA256(table.concat(out))
+end
+
+--[[ Signing
+
+	Requests are signed like the service signs its webhooks: the signature is "sha256=" and the hex HMAC-SHA256,
+	keyed with the server's key, of the timestamp, a dot, the method, a space, the path with its query, a newline
+	and the body. A nonce, sent in X-Gameprofile-Nonce, follows the timestamp after a dot: the service accepts every
+	signature once, so the nonce keeps apart requests that are the same and sent within a second.
+]]
+
+local function fromHex(h)
+	return (h:gsub("%x%x", function(c) return string.char(tonumber(c, 16)) end))
+end
+
+local function hmacSHA256(key, msg)
+	if #key > 64 then key = fromHex(util.SHA256(key)) end
+	key = key .. string.rep("\0", 64 - #key)
+
+	local inner, outer = {}, {}
+	for i = 1, 64 do
+		local b = key:byte(i)
+		inner[i] = string.char(bit.bxor(b, 0x36))
+		outer[i] = string.char(bit.bxor(b, 0x5c))
+	end
+
+	return util.SHA256(table.concat(outer) .. fromHex(util.SHA256(table.concat(inner) .. msg)))
+end
+
+-- Sign returns the signature of a request. nonce is optional.
+function gameprofile.Sign(key, timestamp, method, uri, body, nonce)
+	if nonce and nonce ~= "" then timestamp = timestamp .. "." .. nonce end
+	return "sha256=" .. hmacSHA256(key, timestamp .. "." .. method .. " " .. uri .. "\n" .. (body or ""))
+end
+
+local function nonce()
+	return util.SHA256(SysTime() .. " " .. math.random() .. " " .. tostring(cfg.Server)):sub(1, 32)
+end
+
+--[[ Requests ]]
+
+local function escape(s)
+	return (tostring(s):gsub("[^%w%-_%.~:]", function(c) return string.format("%%%02X", c:byte()) end))
+end
+
+local function query(params)
+	local parts = {}
+	for k, v in pairs(params or {}) do
+		parts[#parts + 1] = escape(k) .. "=" .. escape(v)
+	end
+	table.sort(parts)
+	if #parts == 0 then return "" end
+	return "?" .. table.concat(parts, "&")
+end
+
+-- Request calls the service. path is relative to /v1, eg. "/STEAM_0:1:1234". body is encoded as JSON if it is set.
+-- callback(err, result, status) gets the decoded answer.
+function gameprofile.Request(method, path, body, callback)
+	local uri = "/v1" .. path
+	local payload = body ~= nil and gameprofile.Encode(body) or ""
+
+	local headers = { ["X-Caller"] = cfg.Server or GetHostName() }
+	if cfg.Key then
+		local timestamp, n = tostring(os.time()), nonce()
+		headers["X-Gameprofile-Server"] = cfg.Server
+		headers["X-Gameprofile-Timestamp"] = timestamp
+		headers["X-Gameprofile-Nonce"] = n
+		headers["X-Gameprofile-Signature"] = gameprofile.Sign(cfg.Key, timestamp, method, uri, payload, n)
+	end
+	if cfg.Int64Strings then
+		headers["X-Gameprofile-Int64"] = "string"
+	end
+
+	HTTP({
+		url = cfg.URL .. uri,
+		method = method,
+		headers = headers,
+		body = body ~= nil and payload or nil,
+		type = body ~= nil and "application/json" or nil,
+		success = function(status, respBody)
+			local result = gameprofile.Decode(respBody)
+			if status >= 400 then
+				local err = { Status = status, Error = "HTTP " .. status, Body = result }
+				if istable(result) then
+					if isstring(result.error) then err.Error = result.error end
+					err.Problems = result.problems
+				end
+				callback(err, nil, status)
+				return
+			end
+			callback(nil, result, status)
+		end,
+		failed = function(reason)
+			callback({ Status = 0, Error = reason }, nil, 0)
+		end,
+	})
+end
+
+--[[ Profiles ]]
+
+local profiles = {} -- SteamID -> { profile = ProfileWithHash, expires = time }
+
+local function cacheProfile(p)
+	profiles[p.ID] = { profile = p, expires = CurTime() + cfg.CacheTTL }
+	return p
+end
+
+-- Forget drops a player's profile and bans from the cache.
+function gameprofile.Forget(steamid)
+	profiles[steamid] = nil
+	gameprofile.bans[steamid] = nil
+end
+
+-- GetProfile reads a profile, from the cache when it is fresh. The result has the Hash of the profile.
+function gameprofile.GetProfile(steamid, callback, fresh)
+	local cached = profiles[steamid]
+	if not fresh and cached and cached.expires > CurTime() then
+		callback(nil, cached.profile)
+		return
+	end
+
+	gameprofile.Request("GET", "/" .. escape(steamid), nil, function(err, p)
+		if err then
+			callback(err)
+			return
+		end
+		callback(nil, cacheProfile(p))
+	end)
+end
+
+-- GetProfiles reads many profiles at once, eg. every player after a map change. The result maps SteamIDs to
+-- profiles; players without a profile are left out.
+function gameprofile.GetProfiles(steamids, callback)
+	gameprofile.Request("POST", "/profiles/batch", { IDs = gameprofile.Array(steamids) }, function(err, result)
+		if err then
+			callback(err)
+			return
+		end
+		local byID = {}
+		for _, p in ipairs(result.Profiles) do
+			byID[p.ID] = cacheProfile(p)
+		end
+		callback(nil, byID)
+	end)
+end
+
+-- CreateProfile stores a new profile. It fails with Status 409 if the player already has one.
+function gameprofile.CreateProfile(p, callback)
+	p.Inventory = p.Inventory or {}
+	p.Equipment = p.Equipment or {}
+	gameprofile.Request("POST", "/", p, function(err, created)
+		if err then
+			callback(err)
+			return
+		end
+		callback(nil, cacheProfile(created))
+	end)
+end
+
+-- UpdateProfile applies change to a copy of the profile and stores it. change may return false to give up.
+-- If another server changed the profile first, change is applied again to the new profile, up to ConflictRetries
+-- times, so change must only depend on the profile it is given.
+function gameprofile.UpdateProfile(steamid, change, callback)
+	local attempts = 0
+
+	local function try(current)
+		local p = table.Copy(current)
+		if change(p) == false then
+			callback(nil, current)
+			return
+		end
+		p.ID = steamid
+		p.Hash = current.Hash
+
+		gameprofile.Request("PUT", "/" .. escape(steamid), p, function(err, updated)
+			if err and err.Status == 409 and attempts < cfg.ConflictRetries and istable(err.Body) then
+				-- The answer to a conflict is the profile as it is now.
+				attempts = attempts + 1
+				try(cacheProfile(err.Body))
+				return
+			end
+			if err then
+				if err.Status == 409 then profiles[steamid] = nil end
+				callback(err)
+				return
+			end
+			callback(nil, cacheProfile(updated))
+		end)
+	end
+
+	gameprofile.GetProfile(steamid, function(err, p)
+		if err then
+			callback(err)
+			return
+		end
+		try(p)
+	end)
+end
+
+-- AddCoins changes a player's coins by amount, which may be negative.
+function gameprofile.AddCoins(steamid, amount, callback)
+	gameprofile.UpdateProfile(steamid, function(p)
+		p.Coins = (tonumber(p.Coins) or 0) + amount
+	end, callback)
+end
+
+-- Leaderboard lists the richest players.
+function gameprofile.Leaderboard(limit, callback)
+	gameprofile.Request("GET", "/leaderboard" .. query({ limit = limit }), nil, callback)
+end
+
+-- Standing reads a player's rank, with around players above and below them.
+function gameprofile.Standing(steamid, around, callback)
+	gameprofile.Request("GET", "/" .. escape(steamid) .. "/rank" .. query({ around = around }), nil, callback)
+end
+
+--[[ Shop and inventory. Results hold the changed Profile, which is cached. ]]
+
+local function cachingResult(callback)
+	return function(err, result)
+		if err then
+			callback(err)
+			return
+		end
+		cacheProfile(result.Profile)
+		callback(nil, result)
+	end
+end
+
+-- Items lists the item catalog.
+function gameprofile.Items(callback)
+	gameprofile.Request("GET", "/items", nil, callback)
+end
+
+-- Purchase buys a catalog item at its catalog price. It fails with Status 409 if the player cannot afford it.
+function gameprofile.Purchase(steamid, item, callback)
+	gameprofile.Request("POST", "/" .. escape(steamid) .. "/purchases", { Item = item }, cachingResult(callback))
+end
+
+-- Refund refunds one of a player's purchases, given the ID of its receipt.
+function gameprofile.Refund(steamid, receipt, callback)
+	gameprofile.Request("POST", "/" .. escape(steamid) .. "/purchases/" .. receipt .. "/refund", nil, cachingResult(callback))
+end
+
+-- GrantItem gives an item to a player for free.
+function gameprofile.GrantItem(steamid, item, settings, callback)
+	local change = { Item = item, Settings = settings or "", By = cfg.Server }
+	gameprofile.Request("POST", "/" .. escape(steamid) .. "/inventory", change, cachingResult(callback))
+end
+
+-- SetItemSettings replaces the settings of an item a player owns.
+function gameprofile.SetItemSettings(steamid, item, settings, callback)
+	local change = { Item = item, Settings = settings, By = cfg.Server }
+	gameprofile.Request("PUT", "/" .. escape(steamid) .. "/inventory/" .. escape(item), change, cachingResult(callback))
+end
+
+-- TakeItem takes an item away from a player.
+function gameprofile.TakeItem(steamid, item, callback)
+	local path = "/" .. escape(steamid) .. "/inventory/" .. escape(item) .. query({ by = cfg.Server })
+	gameprofile.Request("DELETE", path, nil, cachingResult(callback))
+end
+
+-- SellItem sells an item back to the shop.
+function gameprofile.SellItem(steamid, item, callback)
+	local change = { By = cfg.Server }
+	gameprofile.Request("POST", "/" .. escape(steamid) .. "/inventory/" .. escape(item) .. "/sell", change, cachingResult(callback))
+end
+
+--[[ Punishments and bans ]]
+
+gameprofile.bans = {} -- SteamID -> { ban = Punishment or false, expires = time }
+
+-- daysFromCivil counts the days from 1970-01-01 to a date of the proleptic Gregorian calendar.
+local function daysFromCivil(y, m, d)
+	if m <= 2 then y = y - 1 end
+	local era = math.floor(y / 400)
+	local yoe = y - era * 400
+	local doy = math.floor((153 * ((m + 9) % 12) + 2) / 5) + d - 1
+	local doe = yoe * 365 + math.floor(yoe / 4) - math.floor(yoe / 100) + doy
+	return era * 146097 + doe - 719468
+end
+
+-- ParseTime turns an RFC 3339 time from the service into a Unix time. It returns nil for the zero time,
+-- which the service uses for punishments that do not expire.
+function gameprofile.ParseTime(s)
+	local y, mo, d, h, mi, sec, rest = tostring(s):match("^(%d+)-(%d+)-(%d+)T(%d+):(%d+):(%d+)(.*)$")
+	if not y or tonumber(y) <= 1 then return nil end
+
+	local t = daysFromCivil(tonumber(y), tonumber(mo), tonumber(d)) * 86400 + tonumber(h) * 3600 + tonumber(mi) * 60 + tonumber(sec)
+	local sign, oh, om = rest:match("([+-])(%d%d):(%d%d)$")
+	if sign then
+		local offset = tonumber(oh) * 3600 + tonumber(om) * 60
+		if sign == "+" then t = t - offset else t = t + offset end
+	end
+	return t
+end
+
+-- ActiveBan returns the punishment that keeps a player out, given the punishments in force by type, or nil.
+function gameprofile.ActiveBan(punishments)
+	for typ, p in pairs(punishments or {}) do
+		if cfg.BanTypes[typ] then
+			local expires = gameprofile.ParseTime(p.Expires)
+			if expires == nil or expires > os.time() then
+				return p
+			end
+		end
+	end
+	return nil
+end
+
+-- BanMessage is shown to banned players. Replace it to change the wording.
+function gameprofile.BanMessage(ban)
+	local msg = "You are banned from this server"
+	if ban.Reason and ban.Reason ~= "" then msg = msg .. ": " .. ban.Reason end
+	local expires = gameprofile.ParseTime(ban.Expires)
+	if expires then
+		msg = msg .. " (until " .. os.date("!%Y-%m-%d %H:%M UTC", expires) .. ")"
+	end
+	return msg
+end
+
+-- GetPunishments reads a player's current punishments by type.
+function gameprofile.GetPunishments(steamid, callback)
+	gameprofile.Request("GET", "/" .. escape(steamid) .. "/punishments", nil, function(err, ps)
+		if err and err.Status == 404 then
+			callback(nil, {})
+			return
+		end
+		callback(err, ps)
+	end)
+end
+
+-- GetStatus reads the punishments of a player in force on this server, by type. The service leaves out expired
+-- punishments and the ones scoped to other servers or game modes.
+function gameprofile.GetStatus(steamid, callback)
+	local params = { gamemode = engine.ActiveGamemode(), server = cfg.Server }
+	gameprofile.Request("GET", "/" .. escape(steamid) .. "/status" .. query(params), nil, function(err, st)
+		if err then
+			callback(err)
+			return
+		end
+		callback(nil, st.Punishments or {})
+	end)
+end
+
+-- CheckBan looks up whether a player is banned. callback(err, ban) gets the ban, or nil.
+function gameprofile.CheckBan(steamid, callback)
+	local cached = gameprofile.bans[steamid]
+	if cached and cached.expires > CurTime() then
+		callback(nil, cached.ban or nil)
+		return
+	end
+
+	gameprofile.GetStatus(steamid, function(err, ps)
+		if err then
+			callback(err)
+			return
+		end
+		local ban = gameprofile.ActiveBan(ps)
+		gameprofile.bans[steamid] = { ban = ban or false, expires = CurTime() + cfg.CacheTTL }
+		callback(nil, ban)
+	end)
+end
+
+-- Punish stores a punishment, eg. { PlayerID = steamid, Type = "ban", Reason = "cheating", Expires = "..." }.
+-- By defaults to this server. Leave Expires unset for the default duration of the type, which is permanent for bans.
+-- Punishments of types scoped to a server or a game mode need a Server or a GameMode.
+-- callback(err, result) gets the stored Punishment, which the service may have escalated for repeat offenders, and
+-- the Escalation that says which rule did it.
+function gameprofile.Punish(p, callback)
+	p.By = p.By or cfg.Server
+	p.Date = p.Date or os.date("!%Y-%m-%dT%H:%M:%SZ")
+	gameprofile.Request("POST", "/" .. escape(p.PlayerID) .. "/punishments", p, function(err, result)
+		gameprofile.bans[p.PlayerID] = nil
+		callback(err, result)
+	end)
+end
+
+-- Players are checked for bans as they connect. CheckPassword has to answer at once, so players whose ban status
+-- is cached are turned away there, and the others are kicked as soon as the service says they are banned.
+hook.Add("CheckPassword", "gameprofile.CheckBan", function(steamid64)
+	local steamid = util.SteamIDFrom64(steamid64)
+
+	local cached = gameprofile.bans[steamid]
+	if cached and cached.expires > CurTime() and cached.ban then
+		return false, gameprofile.BanMessage(cached.ban)
+	end
+
+	gameprofile.CheckBan(steamid, function(err, ban)
+		if err then
+			ErrorNoHalt("gameprofile: could not check the bans of " .. steamid .. ": " .. tostring(err.Error) .. "\n")
+			return
+		end
+		if ban then
+			game.KickID(steamid, gameprofile.BanMessage(ban))
+		end
+	end)
+end)
+
+return gameprofile
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alanfran/gameprofile/profile"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// contract is a fixture of lua/contract: the requests the Lua client makes, in order, and the answers it expects.
+//
+// Bodies of expected answers match when they hold at least the given fields. The string "*" matches any value.
+// "{{name}}" in a path, header or body is replaced by a value captured from an earlier answer, or by the current
+// Unix time for {{now}}. Steps with sign set are signed with the key of the fixture's server and a nonce of their own,
+// as gameprofile.Request does.
+type contract struct {
+	Name               string
+	Server             *struct{ Name, Key string }
+	RequireSignatures  bool
+	RequireSignedReads bool
+	Setup              struct {
+		Items       []profile.Item
+		Profiles    []profile.Profile
+		Punishments []profile.Punishment
+	}
+	Vectors []struct {
+		Key, Timestamp, Nonce, Method, URI, Body, Signature string
+	}
+	Steps []struct {
+		Name    string
+		Sign    bool
+		Request struct {
+			Method  string
+			Path    string
+			Headers map[string]string
+			Body    interface{}
+		}
+		Response struct {
+			Status int
+			Body   interface{}
+		}
+		Capture map[string]string
+	}
+}
+
+// expand replaces the {{name}} placeholders of s.
+func expand(s string, vars map[string]string) string {
+	for name, v := range vars {
+		s = strings.Replace(s, "{{"+name+"}}", v, -1)
+	}
+	return s
+}
+
+// expandValue replaces the placeholders in the strings of a decoded JSON value.
+func expandValue(v interface{}, vars map[string]string) interface{} {
+	switch v := v.(type) {
+	case string:
+		return expand(v, vars)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = expandValue(e, vars)
+		}
+		return out
+	case map[string]interface{}:
+		out := map[string]interface{}{}
+		for k, e := range v {
+			out[k] = expandValue(e, vars)
+		}
+		return out
+	}
+	return v
+}
+
+// matchContract returns a description of where actual differs from expected, or "" if it matches.
+func matchContract(expected, actual interface{}, at string) string {
+	if expected == "*" {
+		if actual == nil {
+			return at + " is missing"
+		}
+		return ""
+	}
+
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			return fmt.Sprintf("%s is %v, not an object", at, actual)
+		}
+		for k, v := range e {
+			if diff := matchContract(v, a[k], at+"."+k); diff != "" {
+				return diff
+			}
+		}
+		return ""
+
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok || len(a) != len(e) {
+			return fmt.Sprintf("%s is %v, not an array of %d", at, actual, len(e))
+		}
+		for i := range e {
+			if diff := matchContract(e[i], a[i], at+"["+strconv.Itoa(i)+"]"); diff != "" {
+				return diff
+			}
+		}
+		return ""
+	}
+
+	if fmt.Sprint(expected) != fmt.Sprint(actual) {
+		return fmt.Sprintf("%s is %v, not %v", at, actual, expected)
+	}
+	return ""
+}
+
+// captured returns the value at a dotted path of a decoded JSON value, as text.
+func captured(v interface{}, path string) string {
+	for _, field := range strings.Split(path, ".") {
+		m, _ := v.(map[string]interface{})
+		v = m[field]
+	}
+	return fmt.Sprint(v)
+}
+
+var _ = Describe("Lua client contract", func() {
+	files, err := filepath.Glob("lua/contract/*.json")
+	if err != nil || len(files) == 0 {
+		panic("no Lua contract fixtures")
+	}
+
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			panic(err)
+		}
+		// Numbers are kept as written, so that large integers keep every digit.
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		var fixture contract
+		if err := dec.Decode(&fixture); err != nil {
+			panic(file + ": " + err.Error())
+		}
+
+		Context(fixture.Name, func() {
+			for _, v := range fixture.Vectors {
+				v := v
+				It("signs "+v.Method+" "+v.URI+" like gameprofile.Sign", func() {
+					Expect(SignRequest(v.Key, v.Timestamp, v.Nonce, v.Method, v.URI, []byte(v.Body))).To(Equal(v.Signature))
+				})
+			}
+
+			It("answers the requests of the Lua client as documented", func() {
+				app := NewApp(profile.NewMockStore())
+				app.RequireSignatures = fixture.RequireSignatures
+				app.RequireSignedReads = fixture.RequireSignedReads
+				if fixture.Server != nil {
+					app.ServerKeys = map[string]string{fixture.Server.Key: fixture.Server.Name}
+				}
+				for _, it := range fixture.Setup.Items {
+					Expect(app.profiles.PutItem(it)).To(Succeed())
+				}
+				for _, p := range fixture.Setup.Profiles {
+					Expect(app.profiles.PutProfile(p)).To(Succeed())
+				}
+				for _, p := range fixture.Setup.Punishments {
+					_, err := app.profiles.PutPunishment(p)
+					Expect(err).ToNot(HaveOccurred())
+				}
+
+				vars := map[string]string{}
+				for i, step := range fixture.Steps {
+					vars["now"] = strconv.FormatInt(time.Now().Unix(), 10)
+
+					var body []byte
+					if step.Request.Body != nil {
+						var err error
+						body, err = json.Marshal(expandValue(step.Request.Body, vars))
+						Expect(err).ToNot(HaveOccurred())
+					}
+
+					path := expand(step.Request.Path, vars)
+					req, err := http.NewRequest(step.Request.Method, path, bytes.NewReader(body))
+					Expect(err).ToNot(HaveOccurred())
+					if body != nil {
+						req.Header.Set("Content-Type", "application/json")
+					}
+					for k, v := range step.Request.Headers {
+						req.Header.Set(k, expand(v, vars))
+					}
+					if step.Sign {
+						req.Header.Set(ServerHeader, fixture.Server.Name)
+						nonce := fmt.Sprintf("step-%d", i)
+						req.Header.Set(profile.TimestampHeader, vars["now"])
+						req.Header.Set(NonceHeader, nonce)
+						req.Header.Set(profile.SignatureHeader,
+							SignRequest(fixture.Server.Key, vars["now"], nonce, req.Method, path, body))
+					}
+
+					resp := httptest.NewRecorder()
+					app.engine.ServeHTTP(resp, req)
+					Expect(resp.Code).To(Equal(step.Response.Status), "%s: %s", step.Name, resp.Body.String())
+
+					var actual interface{}
+					if resp.Body.Len() > 0 {
+						dec := json.NewDecoder(resp.Body)
+						dec.UseNumber()
+						Expect(dec.Decode(&actual)).To(Succeed(), step.Name)
+					}
+					if step.Response.Body != nil {
+						diff := matchContract(expandValue(step.Response.Body, vars), actual, "body")
+						Expect(diff).To(BeEmpty(), step.Name)
+					}
+
+					for name, field := range step.Capture {
+						vars[name] = captured(actual, field)
+					}
+				}
+			})
+		})
+	}
+})
@@ -1,14 +1,117 @@
 package main
 
-import "github.com/alanfran/gameprofile/profile"
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/alanfran/gameprofile/profile"
+)
 
 func main() {
-	boltStore, err := profile.NewBoltStore("bolt.db")
+	dbPath := flag.String("db", "bolt.db", "path to the Bolt database")
+	addr := flag.String("addr", ":80", "interface and port to serve HTTP on")
+	grpcAddr := flag.String("grpc-addr", ":9090", "interface and port to serve gRPC on (disabled when empty)")
+	backupDir := flag.String("backup-dir", "", "directory for scheduled backups (disabled when empty)")
+	backupInterval := flag.Duration("backup-interval", 6*time.Hour, "time between scheduled backups")
+	keepDaily := flag.Int("keep-daily", 7, "number of days to keep a scheduled backup for")
+	keepWeekly := flag.Int("keep-weekly", 4, "number of weeks to keep a scheduled backup for")
+	serverKeys := flag.String("server-keys", "", "file of game server names and keys for the push channel")
+	adminKeys := flag.String("admin-keys", "", "file of admin names and keys for the /admin routes (closed when empty)")
+	requireSignedReads := flag.Bool("require-signed-reads", false, "reject reads that are not signed with a key from -server-keys, or made with a server or admin key")
+	requireSignatures := flag.Bool("require-signatures", false, "reject writes that are not signed with a key from -server-keys")
+	escalationPolicy := flag.String("escalation-policy", "", "JSON file of the rules that escalate punishments issued to repeat offenders")
+	idempotencyCacheSize := flag.Int("idempotency-cache-size", DefaultIdempotencyCacheSize, "most responses kept for requests that repeat an Idempotency-Key")
+	idempotencyWindow := flag.Duration("idempotency-window", DefaultIdempotencyWindow, "time responses are replayed for requests that repeat an Idempotency-Key")
+	flag.Usage = usage
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		args = []string{"serve"}
+	}
+
+	// Restoring replaces the database file, so it must not be opened here.
+	if args[0] == "restore" {
+		err := runRestore(*dbPath, args[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	boltStore, err := profile.NewBoltStore(*dbPath)
 	if err != nil {
 		panic(err)
 	}
 
-	a := NewApp(boltStore)
+	switch args[0] {
+	case "serve":
+		if *backupDir != "" {
+			go profile.RunBackups(boltStore, profile.BackupPolicy{
+				Dir:        *backupDir,
+				Interval:   *backupInterval,
+				KeepDaily:  *keepDaily,
+				KeepWeekly: *keepWeekly,
+			}, nil)
+		}
+
+		a := NewApp(boltStore)
+		a.IdempotencyWindow = *idempotencyWindow
+		a.IdempotencyCacheSize = *idempotencyCacheSize
+		a.RequireSignatures = *requireSignatures
+		a.RequireSignedReads = *requireSignedReads
+		if *serverKeys != "" {
+			a.ServerKeys, err = loadKeys(*serverKeys)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		if *adminKeys != "" {
+			a.AdminKeys, err = loadKeys(*adminKeys)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		if *escalationPolicy != "" {
+			a.Escalation, err = loadEscalationPolicy(*escalationPolicy)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		if *grpcAddr != "" {
+			go func() {
+				log.Fatal(a.RunGRPC(*grpcAddr))
+			}()
+		}
+		a.Run(*addr)
+	case "export":
+		err = runExport(boltStore, args[1:])
+	case "import":
+		err = runImport(boltStore, args[1:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: %s [flags] [command]
+
+Commands:
+  serve                       run the HTTP and gRPC services (default)
+  export [-o file]            write the Bolt database at -db to a JSON Lines archive
+  import [-overwrite] file    load a JSON Lines archive into the Bolt database at -db
+                              (other stores load archives with POST /admin/import)
+  restore snapshot            verify a backup and swap it in as the database (service must be stopped)
 
-	a.Run(":80")
+Flags:
+`, os.Args[0])
+	flag.PrintDefaults()
 }
@@ -12,15 +12,126 @@ type ProfileWithHash struct {
 	Hash string
 }
 
-// NewProfileWithHash creates a new ProfileWithHash given a Profile.
+// NewProfileWithHash creates a new ProfileWithHash given a Profile, hashed with profile.Hash.
 func NewProfileWithHash(p profile.Profile) ProfileWithHash {
-	hash, _ := structhash.Hash(p, 1)
 	return ProfileWithHash{
 		Profile: p,
-		Hash:    hash,
+		Hash:    profile.Hash(p),
 	}
 }
 
+// hashMatches reports whether hash is the hash of p. Hashes made with structhash, from before profile.Hash,
+// are still accepted, so that clients holding one are not refused when they next write.
+func hashMatches(hash string, p profile.Profile) bool {
+	if hash == profile.Hash(p) {
+		return true
+	}
+	legacy, err := structhash.Hash(p, 1)
+	return err == nil && hash == legacy
+}
+
+// ProfileList is a page of profiles returned by the listing endpoint.
+type ProfileList struct {
+	Profiles   []ProfileWithHash
+	NextCursor string
+}
+
+// ProfileBatch is the body of a request for many profiles at once.
+type ProfileBatch struct {
+	IDs []string
+}
+
+// ProfileBatchResult holds the profiles found by a batch read, and the IDs that have no profile.
+type ProfileBatchResult struct {
+	Profiles []ProfileWithHash
+	Missing  []string
+}
+
+// BulkRequest is the body of a bulk write. When Atomic is true, nothing is stored unless every write succeeds.
+type BulkRequest struct {
+	Atomic bool
+	Writes []profile.BulkOp
+}
+
+// BulkItemResult is the outcome of one write of a bulk request. ID is set for stored punishments,
+// and Hash for stored profiles. Escalation names the rule that escalated a punishment, if one fired.
+type BulkItemResult struct {
+	Status     int
+	Error      string              `json:",omitempty"`
+	Problems   []string            `json:",omitempty"`
+	ID         int64               `json:",omitempty"`
+	Hash       string              `json:",omitempty"`
+	Escalation *profile.Escalation `json:",omitempty"`
+}
+
+// BulkResponse lists the outcome of every write of a bulk request, in order.
+type BulkResponse struct {
+	Stored  int
+	Results []BulkItemResult
+}
+
+// Purchase is the body of a purchase request.
+type Purchase struct {
+	Item string
+}
+
+// PunishmentResult is the answer to issuing a punishment: the punishment as it was stored, and the escalation rule
+// that changed it, if one fired.
+type PunishmentResult struct {
+	Punishment profile.Punishment
+	Escalation *profile.Escalation `json:",omitempty"`
+}
+
+// AppealRequest is the body of a player's appeal against a punishment. The appeal is filed by the punished player
+// unless By names someone else, or the request is signed by a game server or made with an admin key.
+type AppealRequest struct {
+	PunishmentID int64
+	By           string `json:",omitempty"`
+	Comment      string
+}
+
+// AppealResult is the answer to a change to an appeal: the appeal, and its punishment as the change left it.
+type AppealResult struct {
+	Appeal     profile.Appeal
+	Punishment profile.Punishment
+}
+
+// PlayerStatus is the answer to a status check: the punishments of a player in force on the server that asked.
+type PlayerStatus struct {
+	PlayerID string
+	Server   string `json:",omitempty"`
+	GameMode string `json:",omitempty"`
+	// Punishments holds the punishments in force, by type.
+	Punishments map[string]profile.Punishment
+}
+
+// PurchaseResult is returned by purchases and refunds. It holds the receipt and the profile it changed,
+// so that clients get the new hash without reading the profile again.
+type PurchaseResult struct {
+	Receipt profile.Receipt
+	Profile ProfileWithHash
+}
+
+// InventoryChange is the body of a request that changes a single inventory item.
+type InventoryChange struct {
+	Item     string
+	Settings string
+	By       string
+}
+
+// InventoryResult is returned by inventory changes. It holds the logged event and the profile it changed.
+type InventoryResult struct {
+	Event   profile.InventoryEvent
+	Profile ProfileWithHash
+}
+
+// Restore is the body of a request to restore a profile to an earlier version.
+// Hash is the hash of the profile's current state, as for updates.
+type Restore struct {
+	Version int64
+	Hash    string
+}
+
 // IsProfileHashValid compares a given hash to the current state of a Profile.
 func (a *App) IsProfileHashValid(hash string, steamid string) bool {
 	p, err := a.profiles.GetProfile(steamid)
@@ -28,7 +139,5 @@ func (a *App) IsProfileHashValid(hash string, steamid string) bool {
 		return false
 	}
 
-	hash2, _ := structhash.Hash(p, 1)
-
-	return hash == hash2
+	return hashMatches(hash, p)
 }
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/ugorji/go/codec"
+)
+
+// MIMEMsgPack is the content type of MessagePack requests and responses.
+const MIMEMsgPack = binding.MIMEMSGPACK2
+
+// msgpackHandle reads and writes MessagePack with the same shape as the JSON of the API: maps with string keys,
+// text as strings and times in RFC 3339. Keys are sorted, so that equal documents encode to equal bytes.
+var msgpackHandle = func() *codec.MsgpackHandle {
+	h := &codec.MsgpackHandle{}
+	h.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	h.RawToString = true
+	h.WriteExt = true
+	h.Canonical = true
+	return h
+}()
+
+// isMsgPack reports whether a content type or an Accept entry is MessagePack.
+func isMsgPack(mime string) bool {
+	mime = strings.TrimSpace(strings.Split(mime, ";")[0])
+	return mime == binding.MIMEMSGPACK || mime == binding.MIMEMSGPACK2
+}
+
+// wantsMsgPack reports whether the client prefers MessagePack to JSON in its Accept header.
+func wantsMsgPack(c *gin.Context) bool {
+	return isMsgPack(c.NegotiateFormat(binding.MIMEJSON, binding.MIMEMSGPACK2, binding.MIMEMSGPACK))
+}
+
+// jsonToMsgPack encodes a JSON document as MessagePack. Integers stay integers.
+func jsonToMsgPack(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	var out []byte
+	err := codec.NewEncoderBytes(&out, msgpackHandle).Encode(fromJSON(v))
+	return out, err
+}
+
+// fromJSON replaces the json.Numbers of a decoded JSON value with integers or floats.
+func fromJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return i
+		}
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return u
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = fromJSON(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = fromJSON(v[k])
+		}
+	}
+	return v
+}
+
+// msgPackToJSON decodes a MessagePack document and encodes it as JSON.
+func msgPackToJSON(data []byte) ([]byte, error) {
+	var v interface{}
+	if err := codec.NewDecoderBytes(data, msgpackHandle).Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(toJSON(v))
+}
+
+// toJSON replaces the values of a decoded MessagePack document that JSON has no place for.
+// Timestamps become RFC 3339 strings and binary data becomes text.
+func toJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case []byte:
+		return string(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = toJSON(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = toJSON(v[k])
+		}
+	}
+	return v
+}
+
+// msgpackResponses sends JSON responses as MessagePack to clients that prefer it in their Accept header.
+// The MessagePack document has the same fields as the JSON one, so the Hash of a profile does not depend on
+// the encoding. Other responses, such as event streams and archives, are not changed.
+func (a *App) msgpackResponses() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !wantsMsgPack(c) {
+			c.Next()
+			return
+		}
+
+		w := &jsonWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		err := w.flush(func(body []byte) ([]byte, error) {
+			out, err := jsonToMsgPack(body)
+			if err == nil {
+				w.Header().Set("Content-Type", MIMEMsgPack)
+			}
+			return out, err
+		})
+		if err != nil {
+			c.Error(err)
+		}
+	}
+}
+
+// msgpackRequests reads MessagePack request bodies as their JSON equivalent, so that every handler accepts both.
+// It runs after signatures, which are made over the body as it was sent.
+func (a *App) msgpackRequests() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isMsgPack(c.ContentType()) {
+			c.Next()
+			return
+		}
+
+		data, err := ioutil.ReadAll(c.Request.Body)
+		if err == nil {
+			data, err = msgPackToJSON(data)
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "There was an error processing your request. Please make sure your MessagePack is well-formed.",
+			})
+			return
+		}
+
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(data))
+		c.Request.ContentLength = int64(len(data))
+		c.Request.Header.Set("Content-Type", binding.MIMEJSON)
+		c.Next()
+	}
+}
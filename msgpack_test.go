@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	"github.com/alanfran/gameprofile/profile"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/ugorji/go/codec"
+)
+
+var _ = Describe("MessagePack", func() {
+	var app *App
+
+	BeforeEach(func() {
+		app = NewApp(profile.NewMockStore())
+		app.ServerKeys = map[string]string{"secret": "server_1"}
+		Expect(app.profiles.PutItem(profile.Item{Name: "hat", Slot: "head", Price: 100})).To(Succeed())
+		Expect(app.profiles.PutProfile(profile.Profile{
+			ID: "some_user", Coins: 9007199254740993, Inventory: map[string]string{"hat": ""},
+		})).To(Succeed())
+	})
+
+	send := func(method, url, accept, contentType string, body []byte) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, bytes.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		resp := httptest.NewRecorder()
+		app.engine.ServeHTTP(resp, req)
+		return resp
+	}
+
+	encode := func(v interface{}) []byte {
+		var out []byte
+		Expect(codec.NewEncoderBytes(&out, msgpackHandle).Encode(v)).To(Succeed())
+		return out
+	}
+
+	decode := func(resp *httptest.ResponseRecorder) map[string]interface{} {
+		Expect(resp.Header().Get("Content-Type")).To(Equal(MIMEMsgPack))
+		var m map[string]interface{}
+		Expect(codec.NewDecoderBytes(resp.Body.Bytes(), msgpackHandle).Decode(&m)).To(Succeed())
+		return m
+	}
+
+	It("sends profiles with the same fields and hash as JSON", func() {
+		asJSON := send("GET", "/v1/some_user", "", "", nil)
+		Expect(asJSON.Code).To(Equal(http.StatusOK))
+		var pwh ProfileWithHash
+		Expect(json.Unmarshal(asJSON.Body.Bytes(), &pwh)).To(Succeed())
+
+		resp := send("GET", "/v1/some_user", MIMEMsgPack, "", nil)
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(resp.Body.Len()).To(BeNumerically("<", asJSON.Body.Len()))
+
+		m := decode(resp)
+		Expect(m["ID"]).To(Equal("some_user"))
+		Expect(m["Coins"]).To(BeEquivalentTo(9007199254740993))
+		Expect(m["Hash"]).To(Equal(pwh.Hash))
+	})
+
+	It("keeps JSON for clients that do not ask, or prefer it", func() {
+		resp := send("GET", "/v1/some_user", "application/json, application/msgpack", "", nil)
+		Expect(resp.Header().Get("Content-Type")).To(HavePrefix("application/json"))
+
+		resp = send("GET", "/v1/some_user", "*/*", "", nil)
+		Expect(resp.Header().Get("Content-Type")).To(HavePrefix("application/json"))
+	})
+
+	It("sends errors as MessagePack", func() {
+		resp := send("POST", "/v1/", MIMEMsgPack, MIMEMsgPack, encode(map[string]interface{}{"Coins": 10}))
+		Expect(resp.Code).To(Equal(http.StatusBadRequest))
+		Expect(decode(resp)["error"]).To(Equal("Please supply a profile with an ID."))
+	})
+
+	It("updates a profile with the hash read as MessagePack", func() {
+		m := decode(send("GET", "/v1/some_user", MIMEMsgPack, "", nil))
+		m["Coins"] = 9007199254740999
+
+		resp := send("PUT", "/v1/some_user", MIMEMsgPack, MIMEMsgPack, encode(m))
+		Expect(resp.Code).To(Equal(http.StatusOK), resp.Body.String())
+		Expect(decode(resp)["Coins"]).To(BeEquivalentTo(9007199254740999))
+
+		p, err := app.profiles.GetProfile("some_user")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p.Coins).To(Equal(int64(9007199254740999)))
+	})
+
+	It("reads MessagePack timestamps as times", func() {
+		date := time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)
+		p := map[string]interface{}{"PlayerID": "some_user", "By": "some_admin", "Type": "ban", "Reason": "cheating", "Date": date}
+		resp := send("POST", "/v1/bulk", "", MIMEMsgPack, encode(map[string]interface{}{
+			"Writes": []interface{}{map[string]interface{}{"Punishment": p}},
+		}))
+		Expect(resp.Code).To(Equal(http.StatusOK), resp.Body.String())
+
+		ps, err := app.profiles.QueryPunishments(profile.PunishmentQuery{PlayerID: "some_user"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ps).To(HaveLen(1))
+		Expect(ps[0].Date.Equal(date)).To(BeTrue())
+	})
+
+	It("checks signatures over the MessagePack body", func() {
+		Expect(app.profiles.PutItem(profile.Item{Name: "scarf", Slot: "neck", Price: 50})).To(Succeed())
+		body := encode(map[string]interface{}{"Item": "scarf", "By": "server_1"})
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+
+		req, err := http.NewRequest("POST", "/v1/some_user/inventory", bytes.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Set("Content-Type", MIMEMsgPack)
+		req.Header.Set(ServerHeader, "server_1")
+		req.Header.Set(profile.TimestampHeader, ts)
+		req.Header.Set(profile.SignatureHeader, SignRequest("secret", ts, "", "POST", "/v1/some_user/inventory", body))
+
+		resp := httptest.NewRecorder()
+		app.engine.ServeHTTP(resp, req)
+		Expect(resp.Code).To(Equal(http.StatusCreated), resp.Body.String())
+
+		p, err := app.profiles.GetProfile("some_user")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p.Inventory).To(HaveKey("scarf"))
+	})
+
+	It("rejects malformed MessagePack", func() {
+		resp := send("POST", "/v1/", "", MIMEMsgPack, []byte{0xc1})
+		Expect(resp.Code).To(Equal(http.StatusBadRequest))
+	})
+})
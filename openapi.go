@@ -0,0 +1,187 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// openAPIPath turns a gin path such as /:steamid/purchases/:id into an OpenAPI path and its parameters.
+func openAPIPath(path string) (string, []string) {
+	var params []string
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		if strings.HasPrefix(p, ":") {
+			params = append(params, p[1:])
+			parts[i] = "{" + p[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/"), params
+}
+
+// schemas collects the OpenAPI schemas of the types used by the API, by type name.
+type schemas map[string]interface{}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// of returns the schema of t. Named structs are added to s and referred to.
+func (s schemas) of(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return s.of(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Uint, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": s.of(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.of(t.Elem())}
+	case reflect.Struct:
+		if t == timeType {
+			return map[string]interface{}{"type": "string", "format": "date-time"}
+		}
+		if _, ok := s[t.Name()]; !ok {
+			// Reserve the name first, so that types that refer to themselves end.
+			s[t.Name()] = nil
+			s[t.Name()] = map[string]interface{}{"type": "object", "properties": s.properties(t)}
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]interface{}{}
+}
+
+// properties returns the schemas of the fields of a struct as encoding/json writes them.
+func (s schemas) properties(t reflect.Type) map[string]interface{} {
+	props := map[string]interface{}{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := strings.Split(f.Tag.Get("json"), ",")[0]
+		if tag == "-" || (f.PkgPath != "" && !f.Anonymous) {
+			continue
+		}
+
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			for name, p := range s.properties(f.Type) {
+				props[name] = p
+			}
+			continue
+		}
+
+		name := f.Name
+		if tag != "" {
+			name = tag
+		}
+		props[name] = s.of(f.Type)
+	}
+	return props
+}
+
+// content describes a body of the given Go value, in JSON or MessagePack, or of the given content type.
+func (s schemas) content(v interface{}, contentType string) map[string]interface{} {
+	if contentType != "" {
+		return map[string]interface{}{contentType: map[string]interface{}{}}
+	}
+	schema := map[string]interface{}{"schema": s.of(reflect.TypeOf(v))}
+	return map[string]interface{}{"application/json": schema, MIMEMsgPack: schema}
+}
+
+// openAPI returns the OpenAPI 3 document of the API, generated from its routes.
+func (a *App) openAPI() map[string]interface{} {
+	s := schemas{}
+	errorSchema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"error":    map[string]interface{}{"type": "string"},
+			"problems": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		},
+	}
+
+	paths := map[string]interface{}{}
+	for _, rt := range a.routes() {
+		path, params := openAPIPath(rt.Path)
+
+		var parameters []interface{}
+		for _, p := range params {
+			parameters = append(parameters, map[string]interface{}{
+				"name": p, "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"},
+			})
+		}
+		for _, q := range rt.Query {
+			parameters = append(parameters, map[string]interface{}{
+				"name": q, "in": "query", "schema": map[string]interface{}{"type": "string"},
+			})
+		}
+
+		status := rt.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		response := map[string]interface{}{"description": http.StatusText(status)}
+		if rt.Response != nil || rt.Produces != "" {
+			response["content"] = s.content(rt.Response, rt.Produces)
+		}
+
+		op := map[string]interface{}{
+			"summary":     rt.Summary,
+			"operationId": strings.ToLower(rt.Method) + strings.NewReplacer("/", "_", ":", "", ".", "_").Replace(rt.Path),
+			"responses": map[string]interface{}{
+				strconv.Itoa(status): response,
+				"default": map[string]interface{}{
+					"description": "Error",
+					"content": map[string]interface{}{
+						"application/json": map[string]interface{}{"schema": errorSchema},
+						MIMEMsgPack:        map[string]interface{}{"schema": errorSchema},
+					},
+				},
+			},
+		}
+		if len(parameters) > 0 {
+			op["parameters"] = parameters
+		}
+		if rt.Auth != nil {
+			op["security"] = []interface{}{map[string]interface{}{"bearerAuth": []interface{}{}}}
+		}
+		if rt.Body != nil || rt.Consumes != "" {
+			op["requestBody"] = map[string]interface{}{"required": true, "content": s.content(rt.Body, rt.Consumes)}
+		}
+
+		item, ok := paths[path].(map[string]interface{})
+		if !ok {
+			item = map[string]interface{}{}
+			paths[path] = item
+		}
+		item[strings.ToLower(rt.Method)] = op
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "gameprofile",
+			"version": strings.TrimPrefix(APIPrefix, "/"),
+		},
+		"servers": []interface{}{map[string]interface{}{"url": APIPrefix}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": s,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+// GetOpenAPI serves the OpenAPI document of the API.
+func (a *App) GetOpenAPI(c *gin.Context) {
+	c.JSON(http.StatusOK, a.openAPI())
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alanfran/gameprofile/profile"
+	"github.com/gorilla/websocket"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// apiCall is a request the drift test makes to a documented route, in order. Path is the route as the OpenAPI
+// document names it, and URL the path requested under APIPrefix. Body is encoded as JSON unless it is a string,
+// which is sent as it is. "{{name}}" in the URL and a string body is replaced by a value captured from an earlier
+// answer: Capture maps names to dotted paths into the answer's JSON, or "" for the whole body.
+type apiCall struct {
+	Method, Path, URL string
+	// Server calls with a server key instead of an admin key.
+	Server      bool
+	Body        interface{}
+	ContentType string
+	Capture     map[string]string
+}
+
+// lookup returns the value at a dotted path into a decoded JSON value, as a string.
+func lookup(v interface{}, path string) string {
+	for _, k := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		v = m[k]
+	}
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// matchSchema returns a description of where actual, decoded with UseNumber, differs from an OpenAPI schema of doc,
+// or "" if it matches. Fields the schema does not list are differences. null matches every schema, as encoding/json
+// writes nil slices, maps and pointers.
+func matchSchema(doc, schema map[string]interface{}, actual interface{}, at string) string {
+	if ref, ok := schema["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+		return matchSchema(doc, schemas[name].(map[string]interface{}), actual, at)
+	}
+	if actual == nil {
+		return ""
+	}
+
+	switch schema["type"] {
+	case "object":
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			return fmt.Sprintf("%s is %v, not an object", at, actual)
+		}
+		props, _ := schema["properties"].(map[string]interface{})
+		extra, _ := schema["additionalProperties"].(map[string]interface{})
+		for k, v := range a {
+			p, ok := props[k].(map[string]interface{})
+			if !ok && extra == nil {
+				return at + "." + k + " is not documented"
+			}
+			if !ok {
+				p = extra
+			}
+			if diff := matchSchema(doc, p, v, at+"."+k); diff != "" {
+				return diff
+			}
+		}
+	case "array":
+		a, ok := actual.([]interface{})
+		if !ok {
+			return fmt.Sprintf("%s is %v, not an array", at, actual)
+		}
+		items := schema["items"].(map[string]interface{})
+		for i, v := range a {
+			if diff := matchSchema(doc, items, v, fmt.Sprintf("%s[%d]", at, i)); diff != "" {
+				return diff
+			}
+		}
+	case "string":
+		a, ok := actual.(string)
+		if !ok {
+			return fmt.Sprintf("%s is %v, not a string", at, actual)
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, a); err != nil {
+				return fmt.Sprintf("%s is %q, not a date-time", at, a)
+			}
+		}
+	case "integer":
+		a, ok := actual.(json.Number)
+		if _, err := a.Int64(); !ok || err != nil {
+			return fmt.Sprintf("%s is %v, not an integer", at, actual)
+		}
+	case "number":
+		if _, ok := actual.(json.Number); !ok {
+			return fmt.Sprintf("%s is %v, not a number", at, actual)
+		}
+	case "boolean":
+		if _, ok := actual.(bool); !ok {
+			return fmt.Sprintf("%s is %v, not a boolean", at, actual)
+		}
+	}
+	return ""
+}
+
+var _ = Describe("API versioning", func() {
+	var app *App
+
+	BeforeEach(func() {
+		app = NewApp(profile.NewMockStore())
+	})
+
+	get := func(url string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", url, nil)
+		Expect(err).ToNot(HaveOccurred())
+		resp := httptest.NewRecorder()
+		app.engine.ServeHTTP(resp, req)
+		return resp
+	}
+
+	Context("GET /v1/openapi.json", func() {
+		var spec struct {
+			OpenAPI    string
+			Paths      map[string]map[string]json.RawMessage
+			Components struct {
+				Schemas map[string]json.RawMessage
+			}
+		}
+
+		BeforeEach(func() {
+			resp := get(APIPrefix + "/openapi.json")
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(json.Unmarshal(resp.Body.Bytes(), &spec)).To(Succeed())
+		})
+
+		It("is an OpenAPI 3 document", func() {
+			Expect(spec.OpenAPI).To(HavePrefix("3."))
+			Expect(spec.Components.Schemas).To(HaveKey("ProfileWithHash"))
+			Expect(spec.Components.Schemas).To(HaveKey("Punishment"))
+		})
+
+		It("describes every route served under /v1, and nothing else", func() {
+			var served []string
+			for _, r := range app.engine.Routes() {
+				if !strings.HasPrefix(r.Path, APIPrefix+"/") || r.Path == APIPrefix+"/openapi.json" {
+					continue
+				}
+				path, _ := openAPIPath(strings.TrimPrefix(r.Path, APIPrefix))
+				served = append(served, r.Method+" "+path)
+			}
+
+			var described []string
+			for path, methods := range spec.Paths {
+				for method := range methods {
+					described = append(described, strings.ToUpper(method)+" "+path)
+				}
+			}
+
+			sort.Strings(served)
+			sort.Strings(described)
+			Expect(described).To(Equal(served))
+		})
+
+		It("only refers to schemas it defines", func() {
+			body := get(APIPrefix + "/openapi.json").Body.String()
+			for _, ref := range strings.Split(body, `"$ref":"#/components/schemas/`)[1:] {
+				name := ref[:strings.Index(ref, `"`)]
+				Expect(spec.Components.Schemas).To(HaveKey(name))
+			}
+		})
+	})
+
+	Context("Documented answers", func() {
+		var dir string
+		var store *profile.BoltStore
+		var server *httptest.Server
+		var doc map[string]interface{}
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "test-openapi")
+			Expect(err).ToNot(HaveOccurred())
+			store, err = profile.NewBoltStore(filepath.Join(dir, "bolt.db"))
+			Expect(err).ToNot(HaveOccurred())
+
+			app = NewApp(store)
+			app.ServerKeys = map[string]string{"secret": "server_1"}
+			app.AdminKeys = map[string]string{"admin_secret": "some_admin"}
+			server = httptest.NewServer(app.engine)
+
+			dec := json.NewDecoder(get(APIPrefix + "/openapi.json").Body)
+			dec.UseNumber()
+			Expect(dec.Decode(&doc)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			server.CloseClientConnections()
+			server.Close()
+			Expect(store.Close()).To(Succeed())
+			Expect(os.RemoveAll(dir)).To(Succeed())
+		})
+
+		// Every documented route is called at least once, in an order that lets each call succeed.
+		calls := []apiCall{
+			{Method: "PUT", Path: "/items/{name}", URL: "/items/hat", Body: profile.Item{Name: "hat", Slot: "head", Price: 100,
+				Settings: map[string]string{"color": profile.SettingString}}},
+			{Method: "PUT", Path: "/items/{name}", URL: "/items/cape", Body: profile.Item{Name: "cape", Slot: "back", Price: 50}},
+			{Method: "GET", Path: "/items", URL: "/items"},
+			{Method: "GET", Path: "/items/{name}", URL: "/items/hat"},
+			{Method: "DELETE", Path: "/items/{name}", URL: "/items/cape"},
+
+			{Method: "POST", Path: "/", URL: "/", Body: profile.Profile{ID: "some_user", Coins: 1000},
+				Capture: map[string]string{"hash": "Hash"}},
+			{Method: "PUT", Path: "/{steamid}", URL: "/some_user",
+				Body: `{"ID": "some_user", "Coins": 900, "Hash": "{{hash}}"}`},
+			{Method: "GET", Path: "/{steamid}", URL: "/some_user"},
+			{Method: "GET", Path: "/profiles", URL: "/profiles?limit=10"},
+			{Method: "POST", Path: "/profiles/batch", URL: "/profiles/batch", Body: ProfileBatch{IDs: []string{"some_user", "nobody"}}},
+			{Method: "POST", Path: "/bulk", URL: "/bulk", Body: BulkRequest{Writes: []profile.BulkOp{
+				{Profile: &profile.Profile{ID: "another_user", Coins: 10}},
+				{Punishment: &profile.Punishment{PlayerID: "another_user", By: "some_admin", Type: "ban"}},
+			}}},
+			{Method: "GET", Path: "/{steamid}/history", URL: "/some_user/history"},
+			{Method: "GET", Path: "/leaderboard", URL: "/leaderboard"},
+			{Method: "GET", Path: "/{steamid}/rank", URL: "/some_user/rank"},
+
+			{Method: "POST", Path: "/{steamid}/purchases", URL: "/some_user/purchases", Body: Purchase{Item: "hat"},
+				Capture: map[string]string{"receipt": "Receipt.ID"}},
+			{Method: "GET", Path: "/{steamid}/purchases", URL: "/some_user/purchases"},
+			{Method: "POST", Path: "/{steamid}/purchases/{id}/refund", URL: "/some_user/purchases/{{receipt}}/refund"},
+
+			{Method: "POST", Path: "/{steamid}/inventory", URL: "/some_user/inventory", Body: InventoryChange{Item: "hat", By: "some_admin"}},
+			{Method: "PUT", Path: "/{steamid}/inventory/{item}", URL: "/some_user/inventory/hat", Body: InventoryChange{Settings: `{"color":"red"}`}},
+			{Method: "POST", Path: "/{steamid}/inventory/{item}/sell", URL: "/some_user/inventory/hat/sell", Body: InventoryChange{}},
+			{Method: "POST", Path: "/{steamid}/inventory", URL: "/some_user/inventory", Body: InventoryChange{Item: "hat", By: "some_admin"}},
+			{Method: "DELETE", Path: "/{steamid}/inventory/{item}", URL: "/some_user/inventory/hat?by=some_admin",
+				Capture: map[string]string{"hash": "Profile.Hash"}},
+			{Method: "GET", Path: "/admin/inventory/{steamid}", URL: "/admin/inventory/some_user"},
+			{Method: "POST", Path: "/admin/history/{steamid}/restore", URL: "/admin/history/some_user/restore",
+				Body: `{"Version": 1, "Hash": "{{hash}}"}`},
+
+			{Method: "PUT", Path: "/punishment-types/{name}", URL: "/punishment-types/warn",
+				Body: profile.PunishmentType{Name: "warn", Scope: profile.ScopeGlobal}},
+			{Method: "GET", Path: "/punishment-types", URL: "/punishment-types"},
+			{Method: "GET", Path: "/punishment-types/{name}", URL: "/punishment-types/warn"},
+			{Method: "DELETE", Path: "/punishment-types/{name}", URL: "/punishment-types/warn"},
+
+			{Method: "POST", Path: "/{steamid}/punishments", URL: "/some_user/punishments",
+				Body:    profile.Punishment{PlayerID: "some_user", By: "some_admin", Type: "ban", Reason: "aimbot"},
+				Capture: map[string]string{"punishment": "Punishment.ID"}},
+			{Method: "PUT", Path: "/{steamid}/punishments", URL: "/some_user/punishments",
+				Body: map[string]profile.Punishment{profile.TypeChatGag: {PlayerID: "some_user", By: "some_admin", Type: profile.TypeChatGag}}},
+			{Method: "GET", Path: "/{steamid}/punishments", URL: "/some_user/punishments"},
+			{Method: "GET", Path: "/punishments", URL: "/punishments?player=some_user"},
+			{Method: "GET", Path: "/{steamid}/status", URL: "/some_user/status?gamemode=sandbox"},
+
+			{Method: "POST", Path: "/appeals", URL: "/appeals", Body: `{"PunishmentID": {{punishment}}, "Comment": "I was not cheating."}`,
+				Capture: map[string]string{"appeal": "ID"}},
+			{Method: "GET", Path: "/appeals", URL: "/appeals"},
+			{Method: "GET", Path: "/appeals/{id}", URL: "/appeals/{{appeal}}"},
+			{Method: "POST", Path: "/appeals/{id}/events", URL: "/appeals/{{appeal}}/events",
+				Body: profile.AppealEvent{Action: profile.AppealAccept}},
+
+			{Method: "POST", Path: "/admin/webhooks", URL: "/admin/webhooks",
+				Body:    profile.Webhook{URL: "https://example.com/hook", Secret: "secret"},
+				Capture: map[string]string{"webhook": "ID"}},
+			{Method: "GET", Path: "/admin/webhooks", URL: "/admin/webhooks"},
+			{Method: "GET", Path: "/admin/webhooks/{id}", URL: "/admin/webhooks/{{webhook}}"},
+			{Method: "PUT", Path: "/admin/webhooks/{id}", URL: "/admin/webhooks/{{webhook}}",
+				Body: profile.Webhook{URL: "https://example.com/hook", Events: []string{profile.EventPunishmentPut}}},
+			{Method: "GET", Path: "/admin/webhooks/{id}/deliveries", URL: "/admin/webhooks/1/deliveries"},
+			{Method: "GET", Path: "/admin/deliveries", URL: "/admin/deliveries"},
+			{Method: "POST", Path: "/admin/deliveries/{id}/redeliver", URL: "/admin/deliveries/1/redeliver"},
+			{Method: "DELETE", Path: "/admin/webhooks/{id}", URL: "/admin/webhooks/{{webhook}}"},
+
+			{Method: "GET", Path: "/admin/export", URL: "/admin/export", Capture: map[string]string{"archive": ""}},
+			{Method: "POST", Path: "/admin/import", URL: "/admin/import", Body: "{{archive}}", ContentType: "application/x-ndjson"},
+			{Method: "GET", Path: "/admin/backup", URL: "/admin/backup"},
+
+			{Method: "GET", Path: "/events", URL: "/events", Server: true},
+			{Method: "GET", Path: "/push", URL: "/push", Server: true},
+		}
+
+		It("answers every documented route with the documented status and body", func() {
+			_, err := store.PutWebhook(profile.Webhook{URL: "https://example.com/dead", Secret: "secret"})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = store.PutDelivery(profile.Delivery{WebhookID: 1, Status: profile.DeliveryDead})
+			Expect(err).ToNot(HaveOccurred())
+
+			called := map[string]bool{}
+			vars := map[string]string{}
+			for _, call := range calls {
+				name := call.Method + " " + call.Path
+				called[name] = true
+
+				op, ok := doc["paths"].(map[string]interface{})[call.Path].(map[string]interface{})[strings.ToLower(call.Method)].(map[string]interface{})
+				Expect(ok).To(BeTrue(), "%s is not documented", name)
+				var status string
+				var documented map[string]interface{}
+				for code, r := range op["responses"].(map[string]interface{}) {
+					if code != "default" {
+						status, documented = code, r.(map[string]interface{})
+					}
+				}
+				content, _ := documented["content"].(map[string]interface{})
+
+				auth := "Bearer admin_secret"
+				if call.Server {
+					auth = "Bearer secret"
+				}
+				url := APIPrefix + expand(call.URL, vars)
+
+				if call.Path == "/push" {
+					ws := "ws" + strings.TrimPrefix(server.URL, "http") + url
+					conn, resp, err := websocket.DefaultDialer.Dial(ws, http.Header{"Authorization": {auth}})
+					Expect(err).ToNot(HaveOccurred(), name)
+					conn.Close()
+					Expect(fmt.Sprint(resp.StatusCode)).To(Equal(status), name)
+					continue
+				}
+
+				var body []byte
+				switch b := call.Body.(type) {
+				case nil:
+				case string:
+					body = []byte(expand(b, vars))
+				default:
+					var err error
+					body, err = json.Marshal(b)
+					Expect(err).ToNot(HaveOccurred())
+				}
+				ctx, cancel := context.WithCancel(context.Background())
+				req, err := http.NewRequest(call.Method, server.URL+url, bytes.NewReader(body))
+				Expect(err).ToNot(HaveOccurred())
+				req = req.WithContext(ctx)
+				req.Header.Set("Authorization", auth)
+				if body != nil {
+					req.Header.Set("Content-Type", "application/json")
+				}
+				if call.ContentType != "" {
+					req.Header.Set("Content-Type", call.ContentType)
+				}
+
+				resp, err := http.DefaultClient.Do(req)
+				Expect(err).ToNot(HaveOccurred(), name)
+				mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+				var answer []byte
+				if mediaType != "text/event-stream" {
+					answer, err = ioutil.ReadAll(resp.Body)
+					Expect(err).ToNot(HaveOccurred())
+				}
+				resp.Body.Close()
+				cancel()
+
+				Expect(fmt.Sprint(resp.StatusCode)).To(Equal(status), "%s: %s", name, answer)
+				if content == nil {
+					Expect(answer).To(BeEmpty(), name)
+					continue
+				}
+				Expect(content).To(HaveKey(mediaType), name)
+
+				var actual interface{}
+				if mediaType == "application/json" {
+					dec := json.NewDecoder(bytes.NewReader(answer))
+					dec.UseNumber()
+					Expect(dec.Decode(&actual)).To(Succeed(), name)
+					schema := content[mediaType].(map[string]interface{})["schema"].(map[string]interface{})
+					Expect(matchSchema(doc, schema, actual, "body")).To(BeEmpty(), name)
+				}
+				for v, path := range call.Capture {
+					if path == "" {
+						vars[v] = string(answer)
+					} else {
+						vars[v] = lookup(actual, path)
+					}
+				}
+			}
+
+			for path, methods := range doc["paths"].(map[string]interface{}) {
+				for method := range methods.(map[string]interface{}) {
+					name := strings.ToUpper(method) + " " + path
+					Expect(called).To(HaveKey(name), "%s is documented but not called", name)
+				}
+			}
+		})
+	})
+
+	Context("Unversioned paths", func() {
+		BeforeEach(func() {
+			Expect(app.profiles.PutProfile(profile.Profile{ID: "some_user"})).To(Succeed())
+		})
+
+		It("are served under /v1 without deprecation", func() {
+			resp := get(APIPrefix + "/some_user")
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(resp.Header().Get("Deprecation")).To(BeEmpty())
+		})
+
+		It("still work, and point to their successor", func() {
+			resp := get("/some_user")
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(resp.Header().Get("Deprecation")).To(Equal("true"))
+			Expect(resp.Header().Get("Link")).To(Equal(`</v1/some_user>; rel="successor-version"`))
+		})
+
+		It("are not added for routes that came with /v1", func() {
+			for _, url := range []string{"/openapi.json", "/punishment-types", "/some_user/status", "/appeals", "/admin/export"} {
+				Expect(get(url).Code).To(Equal(http.StatusNotFound), url)
+			}
+		})
+	})
+})
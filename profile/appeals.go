@@ -0,0 +1,221 @@
+package profile
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Statuses of an Appeal.
+const (
+	AppealOpen     = "open"
+	AppealAccepted = "accepted"
+	AppealRejected = "rejected"
+)
+
+// Actions recorded in the history of an Appeal.
+const (
+	AppealSubmit  = "submit"
+	AppealComment = "comment"
+	AppealAccept  = "accept"
+	AppealReject  = "reject"
+)
+
+// Errors returned by appeal stores.
+var (
+	ErrAppealNotFound = errors.New("Appeal not found.")
+	// ErrAppealExists is returned when a punishment that already has an open appeal is appealed again.
+	ErrAppealExists = errors.New("The punishment already has an open appeal.")
+	// ErrAppealDecided is returned when an appeal that was accepted or rejected is decided again.
+	ErrAppealDecided = errors.New("The appeal has already been decided.")
+	// ErrPunishmentNotActive is returned when an expired punishment is appealed.
+	ErrPunishmentNotActive = errors.New("Only punishments in force can be appealed.")
+	// ErrInvalidAppealStatus is returned when an AppealQuery has an unknown Status.
+	ErrInvalidAppealStatus = errors.New("Status must be open, accepted or rejected.")
+)
+
+// Appeal is a player's request to lift or shorten a punishment. Every change to it is kept in History,
+// oldest first.
+type Appeal struct {
+	ID           int64
+	PunishmentID int64
+	PlayerID     string
+	Status       string
+	Created      time.Time
+	Updated      time.Time
+	History      AppealHistory
+}
+
+// AppealHistory is the list of changes to an appeal. It is stored as a single JSON value in SQL databases,
+// rather than as an array.
+type AppealHistory []AppealEvent
+
+// Value implements driver.Valuer.
+func (h AppealHistory) Value() (driver.Value, error) {
+	return json.Marshal(h)
+}
+
+// Scan implements sql.Scanner.
+func (h *AppealHistory) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*h = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, h)
+	case string:
+		return json.Unmarshal([]byte(v), h)
+	}
+	return fmt.Errorf("cannot read an appeal history from %T", src)
+}
+
+// AppealEvent is a change to an appeal: its submission, a comment, or the decision. Events without a Date
+// happen now.
+type AppealEvent struct {
+	Action  string
+	By      string
+	Date    time.Time
+	Comment string `json:",omitempty"`
+
+	// Expires is the expiry date an accepted appeal gives the punishment. When an appeal is accepted without one,
+	// the punishment is lifted at the Date of the decision, and Expires is set to it.
+	Expires time.Time
+	// PreviousExpires is the expiry date the punishment had before the appeal was accepted, zero if it was permanent.
+	PreviousExpires time.Time
+}
+
+// AppealQuery selects appeals. Zero fields match every appeal.
+type AppealQuery struct {
+	Status       string
+	PlayerID     string
+	PunishmentID int64
+	Limit        int
+}
+
+func (q *AppealQuery) normalize() error {
+	switch q.Status {
+	case "", AppealOpen, AppealAccepted, AppealRejected:
+	default:
+		return ErrInvalidAppealStatus
+	}
+
+	if q.Limit <= 0 {
+		q.Limit = DefaultQueryLimit
+	}
+	if q.Limit > MaxQueryLimit {
+		q.Limit = MaxQueryLimit
+	}
+	return nil
+}
+
+func (q AppealQuery) matches(a Appeal) bool {
+	return (q.Status == "" || q.Status == a.Status) &&
+		(q.PlayerID == "" || q.PlayerID == a.PlayerID) &&
+		(q.PunishmentID == 0 || q.PunishmentID == a.PunishmentID)
+}
+
+// AppealStorer defines the behavior of a store for appeals against punishments.
+type AppealStorer interface {
+	// FileAppeal opens an appeal against a punishment in force, with e as its submission.
+	// A punishment has at most one open appeal.
+	FileAppeal(punishmentID int64, e AppealEvent) (Appeal, error)
+	GetAppeal(id int64) (Appeal, error)
+	// QueryAppeals returns the appeals matching q, newest first.
+	QueryAppeals(q AppealQuery) ([]Appeal, error)
+	// RecordAppealEvent adds a comment or the decision to an appeal. Accepting an appeal changes the expiry date
+	// of the punishment in the same transaction. It returns the appeal and its punishment.
+	RecordAppealEvent(id int64, e AppealEvent) (Appeal, Punishment, error)
+}
+
+// openAppeal returns a new appeal against p, submitted with e.
+// The player appeals for themselves unless e names someone else, eg. a member of staff filing it for them.
+func openAppeal(p Punishment, e AppealEvent) (Appeal, error) {
+	e.Action = AppealSubmit
+	if e.Date.IsZero() {
+		e.Date = time.Now()
+	}
+	if e.By == "" {
+		e.By = p.PlayerID
+	}
+
+	if e.Comment == "" {
+		return Appeal{}, &ValidationError{Problems: []string{"Appeals need a statement in Comment."}}
+	}
+	if !p.Active(e.Date) {
+		return Appeal{}, ErrPunishmentNotActive
+	}
+
+	return Appeal{
+		PunishmentID: p.ID,
+		PlayerID:     p.PlayerID,
+		Status:       AppealOpen,
+		Created:      e.Date,
+		Updated:      e.Date,
+		History:      AppealHistory{e},
+	}, nil
+}
+
+// record applies a comment or a decision to an appeal against p, and appends it to the history.
+// Accepting the appeal changes the expiry date of p, which the caller must store.
+func (a *Appeal) record(p *Punishment, e AppealEvent) error {
+	if e.Date.IsZero() {
+		e.Date = time.Now()
+	}
+
+	var problems []string
+	if e.By == "" {
+		problems = append(problems, "Changes to appeals need a By.")
+	}
+
+	switch e.Action {
+	case AppealComment:
+		if e.Comment == "" {
+			problems = append(problems, "Comments need a Comment.")
+		}
+		if !e.Expires.IsZero() {
+			problems = append(problems, "Only accepted appeals can change the expiry date.")
+		}
+
+	case AppealAccept, AppealReject:
+		if a.Status != AppealOpen {
+			return ErrAppealDecided
+		}
+		if e.Action == AppealReject && !e.Expires.IsZero() {
+			problems = append(problems, "Only accepted appeals can change the expiry date.")
+		}
+		// An accepted appeal can only shorten the punishment, and not into the past.
+		if e.Action == AppealAccept && !e.Expires.IsZero() {
+			if e.Expires.Before(e.Date) {
+				problems = append(problems, "The new expiry date cannot be in the past. Leave Expires out to lift the punishment.")
+			} else if !p.Expires.IsZero() && !e.Expires.Before(p.Expires) {
+				problems = append(problems, "An accepted appeal can only shorten the punishment.")
+			}
+		}
+
+	default:
+		problems = append(problems, "Action must be comment, accept or reject.")
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	switch e.Action {
+	case AppealAccept:
+		if e.Expires.IsZero() {
+			e.Expires = e.Date
+		}
+		e.PreviousExpires = p.Expires
+		p.Expires = e.Expires
+		a.Status = AppealAccepted
+
+	case AppealReject:
+		a.Status = AppealRejected
+	}
+
+	a.History = append(a.History, e)
+	a.Updated = e.Date
+	return nil
+}
@@ -0,0 +1,273 @@
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ArchiveFormat and ArchiveVersion identify the JSON Lines archives written by Export.
+// The version is bumped whenever the record layout changes in a way older readers cannot handle.
+const (
+	ArchiveFormat  = "gameprofile"
+	ArchiveVersion = 3
+)
+
+// Kinds of records stored in an archive.
+const (
+	KindItem           = "item"
+	KindPunishmentType = "punishment_type"
+	KindProfile        = "profile"
+	KindPunishment     = "punishment"
+)
+
+// ArchiveHeader is the first line of every archive.
+type ArchiveHeader struct {
+	Format  string
+	Version int
+	Created time.Time
+}
+
+// ArchiveRecord is a single line of an archive. Exactly one of the payload fields is set, according to Kind.
+type ArchiveRecord struct {
+	Kind           string
+	Item           *Item           `json:",omitempty"`
+	PunishmentType *PunishmentType `json:",omitempty"`
+	Profile        *Profile        `json:",omitempty"`
+	Punishment     *Punishment     `json:",omitempty"`
+}
+
+// ArchiveWriter writes records to a JSON Lines archive.
+type ArchiveWriter struct {
+	enc *json.Encoder
+}
+
+// NewArchiveWriter writes an archive header to w and returns a writer for the records that follow.
+func NewArchiveWriter(w io.Writer) (*ArchiveWriter, error) {
+	enc := json.NewEncoder(w)
+
+	err := enc.Encode(ArchiveHeader{
+		Format:  ArchiveFormat,
+		Version: ArchiveVersion,
+		Created: time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ArchiveWriter{enc: enc}, nil
+}
+
+// WriteItem appends a catalog Item record to the archive.
+func (w *ArchiveWriter) WriteItem(it Item) error {
+	return w.enc.Encode(ArchiveRecord{Kind: KindItem, Item: &it})
+}
+
+// WritePunishmentType appends a PunishmentType record to the archive.
+func (w *ArchiveWriter) WritePunishmentType(t PunishmentType) error {
+	return w.enc.Encode(ArchiveRecord{Kind: KindPunishmentType, PunishmentType: &t})
+}
+
+// WriteProfile appends a Profile record to the archive.
+func (w *ArchiveWriter) WriteProfile(p Profile) error {
+	return w.enc.Encode(ArchiveRecord{Kind: KindProfile, Profile: &p})
+}
+
+// WritePunishment appends a Punishment record to the archive.
+func (w *ArchiveWriter) WritePunishment(p Punishment) error {
+	return w.enc.Encode(ArchiveRecord{Kind: KindPunishment, Punishment: &p})
+}
+
+// ArchiveReader reads records from a JSON Lines archive one at a time.
+type ArchiveReader struct {
+	Header ArchiveHeader
+
+	dec  *json.Decoder
+	line int
+}
+
+// NewArchiveReader reads and validates the archive header from r.
+func NewArchiveReader(r io.Reader) (*ArchiveReader, error) {
+	ar := &ArchiveReader{dec: json.NewDecoder(r), line: 1}
+
+	err := ar.dec.Decode(&ar.Header)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading archive header: %v", err)
+	}
+
+	if ar.Header.Format != ArchiveFormat {
+		return nil, errors.New("Not a gameprofile archive.")
+	}
+
+	if ar.Header.Version < 1 || ar.Header.Version > ArchiveVersion {
+		return nil, fmt.Errorf("Unsupported archive version %d.", ar.Header.Version)
+	}
+
+	return ar, nil
+}
+
+// Next returns the next record in the archive, or io.EOF when there are no more records.
+func (r *ArchiveReader) Next() (ArchiveRecord, error) {
+	var rec ArchiveRecord
+
+	err := r.dec.Decode(&rec)
+	if err == io.EOF {
+		return rec, err
+	}
+	r.line++
+	if err != nil {
+		return rec, fmt.Errorf("Error reading archive line %d: %v", r.line, err)
+	}
+
+	switch {
+	case rec.Kind == KindItem && rec.Item != nil:
+	case rec.Kind == KindPunishmentType && rec.PunishmentType != nil:
+	case rec.Kind == KindProfile && rec.Profile != nil:
+	case rec.Kind == KindPunishment && rec.Punishment != nil:
+	default:
+		return rec, fmt.Errorf("Invalid record of kind %q on archive line %d.", rec.Kind, r.line)
+	}
+
+	return rec, nil
+}
+
+// Export writes the item catalog, the punishment types and every profile and punishment in s to w as an archive.
+// Items and punishment types come first, so that profiles and punishments can be validated against them on import.
+func Export(s Storer, w io.Writer) error {
+	aw, err := NewArchiveWriter(w)
+	if err != nil {
+		return err
+	}
+
+	items, err := s.GetItems()
+	if err != nil {
+		return err
+	}
+	for _, it := range items {
+		err = aw.WriteItem(it)
+		if err != nil {
+			return err
+		}
+	}
+
+	types, err := s.GetPunishmentTypes()
+	if err != nil {
+		return err
+	}
+	for _, t := range types {
+		err = aw.WritePunishmentType(t)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.EachProfile(aw.WriteProfile)
+	if err != nil {
+		return err
+	}
+
+	return s.EachPunishment(aw.WritePunishment)
+}
+
+// ImportOptions control how Import treats records that already exist in the store.
+type ImportOptions struct {
+	// Overwrite replaces existing records. When false, existing records are skipped.
+	Overwrite bool
+}
+
+// ImportStats counts the records processed by Import.
+type ImportStats struct {
+	Items           int
+	PunishmentTypes int
+	Profiles        int
+	Punishments     int
+	Skipped         int
+}
+
+// Import reads an archive from r and stores its records in s.
+// It stops at the first invalid record; records read before it stay stored.
+func Import(s Storer, r io.Reader, opts ImportOptions) (ImportStats, error) {
+	var stats ImportStats
+
+	ar, err := NewArchiveReader(r)
+	if err != nil {
+		return stats, err
+	}
+
+	for {
+		rec, err := ar.Next()
+		if err == io.EOF {
+			return stats, nil
+		}
+		if err != nil {
+			return stats, err
+		}
+
+		switch rec.Kind {
+		case KindItem:
+			_, err = s.GetItem(rec.Item.Name)
+			if err == nil && !opts.Overwrite {
+				stats.Skipped++
+				continue
+			}
+
+			err = s.PutItem(*rec.Item)
+			if err != nil {
+				return stats, err
+			}
+			stats.Items++
+
+		case KindPunishmentType:
+			// Every store has the built-in types, so only the ones that differ are counted.
+			t, err := s.GetPunishmentType(rec.PunishmentType.Name)
+			if err == nil && t == *rec.PunishmentType {
+				continue
+			}
+			if err == nil && !opts.Overwrite {
+				stats.Skipped++
+				continue
+			}
+
+			err = s.PutPunishmentType(*rec.PunishmentType)
+			if err != nil {
+				return stats, err
+			}
+			stats.PunishmentTypes++
+
+		case KindProfile:
+			_, err = s.GetProfile(rec.Profile.ID)
+			if err == nil && !opts.Overwrite {
+				stats.Skipped++
+				continue
+			}
+
+			err = s.PutProfile(*rec.Profile)
+			if err != nil {
+				return stats, err
+			}
+			stats.Profiles++
+
+		case KindPunishment:
+			_, err = s.GetPunishment(rec.Punishment.ID)
+			if err == nil {
+				if !opts.Overwrite {
+					stats.Skipped++
+					continue
+				}
+
+				err = s.DelPunishment(rec.Punishment.ID)
+				if err != nil {
+					return stats, err
+				}
+			}
+
+			_, err = s.ImportPunishment(*rec.Punishment)
+			if err != nil {
+				return stats, err
+			}
+			stats.Punishments++
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package profile
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Archive", func() {
+	var src, dst *MockStore
+	var testItem Item
+	var testProfile Profile
+	var testPunishment Punishment
+
+	BeforeEach(func() {
+		src = NewMockStore()
+		dst = NewMockStore()
+
+		testItem = Item{
+			Name:     "hat",
+			Slot:     "head",
+			Price:    100,
+			Settings: map[string]string{"color": SettingString},
+		}
+		testProfile = Profile{
+			ID:        "some_user",
+			Coins:     999,
+			Inventory: map[string]string{"hat": `{"color":"red"}`},
+			Equipment: map[string]string{"head": "hat"},
+		}
+		testPunishment = Punishment{
+			ID:       1234,
+			PlayerID: "some_user",
+			By:       "some_admin",
+			Type:     "ban",
+			Reason:   "reason goes here",
+			Date:     time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC),
+			Expires:  time.Date(2017, 1, 3, 3, 4, 5, 0, time.UTC),
+		}
+
+		Expect(src.PutItem(testItem)).To(Succeed())
+		Expect(src.PutProfile(testProfile)).To(Succeed())
+		_, err := src.ImportPunishment(testPunishment)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("round-trips every record through Export and Import", func() {
+		var buf bytes.Buffer
+		Expect(Export(src, &buf)).To(Succeed())
+
+		stats, err := Import(dst, &buf, ImportOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stats).To(Equal(ImportStats{Items: 1, Profiles: 1, Punishments: 1}))
+
+		it, err := dst.GetItem(testItem.Name)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(it).To(Equal(testItem))
+
+		p, err := dst.GetProfile(testProfile.ID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p).To(Equal(testProfile))
+
+		ps, err := dst.GetPunishments(testPunishment.PlayerID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ps).To(Equal(map[string]Punishment{testPunishment.Type: testPunishment}))
+	})
+
+	It("carries custom punishment types before the punishments that use them", func() {
+		Expect(src.PutPunishmentType(PunishmentType{Name: "spawn_ban", Scope: ScopeGameMode, DefaultDuration: "24h"})).To(Succeed())
+		scoped := Punishment{ID: 1235, PlayerID: "some_user", By: "some_admin", Type: "spawn_ban", GameMode: "sandbox",
+			Date: testPunishment.Date}
+		_, err := src.ImportPunishment(scoped)
+		Expect(err).ToNot(HaveOccurred())
+
+		var buf bytes.Buffer
+		Expect(Export(src, &buf)).To(Succeed())
+
+		stats, err := Import(dst, &buf, ImportOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stats).To(Equal(ImportStats{Items: 1, PunishmentTypes: 1, Profiles: 1, Punishments: 2}))
+
+		ps, err := dst.GetPunishments("some_user")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ps["spawn_ban@gamemode:sandbox"].Expires).To(Equal(testPunishment.Date.Add(24 * time.Hour)))
+	})
+
+	Context("When a record already exists", func() {
+		var archive string
+
+		BeforeEach(func() {
+			var buf bytes.Buffer
+			Expect(Export(src, &buf)).To(Succeed())
+			archive = buf.String()
+
+			changed := testProfile
+			changed.Coins = 1
+			Expect(dst.PutItem(testItem)).To(Succeed())
+			Expect(dst.PutProfile(changed)).To(Succeed())
+			_, err := dst.ImportPunishment(testPunishment)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("skips it by default", func() {
+			stats, err := Import(dst, strings.NewReader(archive), ImportOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stats).To(Equal(ImportStats{Skipped: 3}))
+
+			p, err := dst.GetProfile(testProfile.ID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Coins).To(Equal(int64(1)))
+		})
+
+		It("replaces it when overwriting", func() {
+			stats, err := Import(dst, strings.NewReader(archive), ImportOptions{Overwrite: true})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stats).To(Equal(ImportStats{Items: 1, Profiles: 1, Punishments: 1}))
+
+			p, err := dst.GetProfile(testProfile.ID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).To(Equal(testProfile))
+		})
+	})
+
+	Context("When reading an invalid archive", func() {
+		It("rejects a missing header", func() {
+			_, err := Import(dst, strings.NewReader(`{"Kind":"profile","Profile":{"ID":"x"}}`), ImportOptions{})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("rejects an unsupported version", func() {
+			_, err := Import(dst, strings.NewReader(`{"Format":"gameprofile","Version":99}`), ImportOptions{})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("rejects records without a payload", func() {
+			archive := `{"Format":"gameprofile","Version":1}` + "\n" + `{"Kind":"profile"}`
+			_, err := Import(dst, strings.NewReader(archive), ImportOptions{})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
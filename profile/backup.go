@@ -0,0 +1,299 @@
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Backuper is implemented by stores that can write a consistent snapshot of themselves while in use.
+type Backuper interface {
+	// Backup writes a snapshot to w and returns the number of bytes written.
+	Backup(w io.Writer) (int64, error)
+}
+
+// Backup writes a consistent copy of the database to w.
+// The copy is taken inside a read transaction, so writers are not blocked while it runs.
+func (s *BoltStore) Backup(w io.Writer) (int64, error) {
+	var n int64
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return n, err
+}
+
+// BackupToFile writes a snapshot to path. The file only appears once it has been completely written.
+func BackupToFile(b Backuper, path string) error {
+	tmp := path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.Backup(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// BackupPolicy describes when scheduled backups are taken and how many are kept.
+type BackupPolicy struct {
+	// Dir is the directory backups are written to.
+	Dir string
+	// Interval is the time between backups.
+	Interval time.Duration
+	// KeepDaily is the number of most recent days for which the newest backup is kept.
+	KeepDaily int
+	// KeepWeekly is the number of most recent ISO weeks for which the newest backup is kept.
+	KeepWeekly int
+}
+
+const (
+	backupPrefix     = "gameprofile-"
+	backupSuffix     = ".db"
+	backupTimeLayout = "20060102T150405Z"
+)
+
+// RunBackups writes a backup to policy.Dir every policy.Interval and prunes old ones, until stop is closed.
+// Failures are logged and retried at the next interval.
+func RunBackups(b Backuper, policy BackupPolicy, stop <-chan struct{}) {
+	t := time.NewTicker(policy.Interval)
+	defer t.Stop()
+
+	for {
+		_, err := ScheduledBackup(b, policy, time.Now())
+		if err != nil {
+			log.Printf("backup: %v", err)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// ScheduledBackup takes one backup named after now, then removes backups that fall outside the retention policy.
+// It returns the path of the new backup.
+func ScheduledBackup(b Backuper, policy BackupPolicy, now time.Time) (string, error) {
+	err := os.MkdirAll(policy.Dir, 0700)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(policy.Dir, backupPrefix+now.UTC().Format(backupTimeLayout)+backupSuffix)
+
+	err = BackupToFile(b, path)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = PruneBackups(policy.Dir, policy.KeepDaily, policy.KeepWeekly)
+	return path, err
+}
+
+// PruneBackups deletes the backups in dir that are not the newest of one of the keepDaily most recent days
+// or one of the keepWeekly most recent weeks. It returns the paths of the deleted files.
+func PruneBackups(dir string, keepDaily, keepWeekly int) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	backups := map[time.Time]string{}
+	var times []time.Time
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, backupPrefix) || !strings.HasSuffix(name, backupSuffix) {
+			continue
+		}
+
+		t, err := time.Parse(backupTimeLayout, strings.TrimSuffix(strings.TrimPrefix(name, backupPrefix), backupSuffix))
+		if err != nil {
+			continue
+		}
+
+		backups[t] = filepath.Join(dir, name)
+		times = append(times, t)
+	}
+
+	keep := retainedBackups(times, keepDaily, keepWeekly)
+
+	var removed []string
+	for _, t := range times {
+		if keep[t] {
+			continue
+		}
+
+		err = os.Remove(backups[t])
+		if err != nil {
+			return removed, err
+		}
+		removed = append(removed, backups[t])
+	}
+
+	return removed, nil
+}
+
+// retainedBackups picks the newest backup of each of the most recent daily and weekly periods.
+func retainedBackups(times []time.Time, keepDaily, keepWeekly int) map[time.Time]bool {
+	sorted := append([]time.Time(nil), times...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].After(sorted[j]) })
+
+	keep := map[time.Time]bool{}
+
+	days := map[string]bool{}
+	weeks := map[string]bool{}
+	for _, t := range sorted {
+		day := t.Format("2006-01-02")
+		if !days[day] && len(days) < keepDaily {
+			days[day] = true
+			keep[t] = true
+		}
+
+		year, week := t.ISOWeek()
+		w := fmt.Sprintf("%d-%02d", year, week)
+		if !weeks[w] && len(weeks) < keepWeekly {
+			weeks[w] = true
+			keep[t] = true
+		}
+	}
+
+	return keep
+}
+
+// VerifyBoltSnapshot opens a Bolt database file read-only and checks that it is a usable profile store:
+// the page structure must be consistent, the required buckets must exist and every record must decode.
+func VerifyBoltSnapshot(path string) error {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) error {
+		// Check must be drained completely, as it keeps using the transaction until it closes the channel.
+		var corrupt error
+		for err := range tx.Check() {
+			if corrupt == nil {
+				corrupt = err
+			}
+		}
+		if corrupt != nil {
+			return fmt.Errorf("Snapshot is corrupt: %v", corrupt)
+		}
+
+		profiles := tx.Bucket(profilesBucket)
+		punishments := tx.Bucket(punishmentsBucket)
+		if profiles == nil || punishments == nil {
+			return errors.New("Snapshot is missing the profiles or punishments bucket.")
+		}
+
+		err := profiles.ForEach(func(k, v []byte) error {
+			var p Profile
+			err := json.Unmarshal(v, &p)
+			if err != nil {
+				return fmt.Errorf("Profile %q does not decode: %v", k, err)
+			}
+			if p.ID != string(k) {
+				return fmt.Errorf("Profile %q is stored under the wrong key.", k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return punishments.ForEach(func(k, v []byte) error {
+			var ps map[string]Punishment
+			err := json.Unmarshal(v, &ps)
+			if err != nil {
+				return fmt.Errorf("Punishments of %q do not decode: %v", k, err)
+			}
+			return nil
+		})
+	})
+}
+
+// RestoreBolt verifies the snapshot at src and swaps it in as the database at dest.
+// The database being replaced is kept next to it with a ".pre-restore" suffix.
+// The service must not be running, as Bolt holds an exclusive lock on dest while it is open.
+func RestoreBolt(src, dest string) error {
+	err := VerifyBoltSnapshot(src)
+	if err != nil {
+		return err
+	}
+
+	// Make sure nothing has dest open. The lock is released again before the swap.
+	if _, err := os.Stat(dest); err == nil {
+		db, err := bolt.Open(dest, 0600, &bolt.Options{Timeout: 1 * time.Second})
+		if err != nil {
+			return fmt.Errorf("Could not lock %s, is the service still running? %v", dest, err)
+		}
+		db.Close()
+	}
+
+	tmp := dest + ".restore"
+	err = copyFile(src, tmp)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(dest); err == nil {
+		err = os.Rename(dest, dest+".pre-restore")
+		if err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+
+	return os.Rename(tmp, dest)
+}
+
+// copyFile copies src to dest and flushes it to disk.
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dest)
+	}
+	return err
+}
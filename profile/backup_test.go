@@ -0,0 +1,121 @@
+package profile
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Backup", func() {
+	var s *BoltStore
+	var dir string
+	var testProfile Profile
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "test-backup")
+		Expect(err).ToNot(HaveOccurred())
+
+		s, err = NewBoltStore(filepath.Join(dir, "bolt.db"))
+		Expect(err).ToNot(HaveOccurred())
+
+		testProfile = Profile{
+			ID:        "some_user",
+			Coins:     999,
+			Inventory: map[string]string{},
+			Equipment: map[string]string{},
+		}
+		Expect(s.PutProfile(testProfile)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		s.db.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("writes a snapshot that can be opened as a store", func() {
+		snapshot := filepath.Join(dir, "snapshot.db")
+		Expect(BackupToFile(s, snapshot)).To(Succeed())
+		Expect(VerifyBoltSnapshot(snapshot)).To(Succeed())
+
+		copied, err := NewBoltStore(snapshot)
+		Expect(err).ToNot(HaveOccurred())
+		defer copied.db.Close()
+
+		p, err := copied.GetProfile(testProfile.ID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p).To(Equal(testProfile))
+	})
+
+	It("can stream a snapshot while the store is in use", func() {
+		var buf bytes.Buffer
+		n, err := s.Backup(&buf)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(BeNumerically("==", buf.Len()))
+
+		Expect(s.PutProfile(Profile{ID: "another_user"})).To(Succeed())
+	})
+
+	Context("When restoring", func() {
+		var snapshot, dest string
+
+		BeforeEach(func() {
+			snapshot = filepath.Join(dir, "snapshot.db")
+			dest = filepath.Join(dir, "restored.db")
+			Expect(BackupToFile(s, snapshot)).To(Succeed())
+		})
+
+		It("swaps in a valid snapshot and keeps the old database", func() {
+			Expect(ioutil.WriteFile(dest, nil, 0600)).To(Succeed())
+			Expect(RestoreBolt(snapshot, dest)).To(Succeed())
+
+			_, err := os.Stat(dest + ".pre-restore")
+			Expect(err).ToNot(HaveOccurred())
+
+			restored, err := NewBoltStore(dest)
+			Expect(err).ToNot(HaveOccurred())
+			defer restored.db.Close()
+
+			p, err := restored.GetProfile(testProfile.ID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).To(Equal(testProfile))
+		})
+
+		It("refuses a file that is not a valid snapshot", func() {
+			garbage := filepath.Join(dir, "garbage.db")
+			Expect(ioutil.WriteFile(garbage, []byte("not a database"), 0600)).To(Succeed())
+
+			Expect(RestoreBolt(garbage, dest)).ToNot(Succeed())
+			_, err := os.Stat(dest)
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("refuses a database that is still in use", func() {
+			Expect(RestoreBolt(snapshot, filepath.Join(dir, "bolt.db"))).ToNot(Succeed())
+		})
+	})
+
+	Context("When pruning scheduled backups", func() {
+		It("keeps the newest backup of each recent day and week", func() {
+			policy := BackupPolicy{Dir: filepath.Join(dir, "backups"), KeepDaily: 2, KeepWeekly: 2}
+			start := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC) // a Wednesday
+
+			var paths []string
+			for i := 0; i < 10; i++ {
+				path, err := ScheduledBackup(s, policy, start.Add(time.Duration(i)*24*time.Hour))
+				Expect(err).ToNot(HaveOccurred())
+				paths = append(paths, path)
+			}
+
+			files, err := filepath.Glob(filepath.Join(policy.Dir, "*.db"))
+			Expect(err).ToNot(HaveOccurred())
+			// The last two days, plus the newest backup of the previous week (Sunday March 5th).
+			Expect(files).To(ConsistOf(paths[9], paths[8], paths[4]))
+		})
+	})
+})
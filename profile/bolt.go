@@ -1,8 +1,9 @@
 package profile
 
 import (
+	"bytes"
+	"encoding/binary"
 	"encoding/json"
-	"errors"
 	"time"
 
 	"github.com/boltdb/bolt"
@@ -12,40 +13,158 @@ type BoltStore struct {
 	db *bolt.DB
 }
 
+// Bucket names.
+var (
+	profilesBucket      = []byte("profiles")
+	profilesCoinsBucket = []byte("profiles_by_coins")
+	punishmentsBucket   = []byte("punishments")
+)
+
 func NewBoltStore(path string) (*BoltStore, error) {
 	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second})
 	if err != nil {
 		return nil, err
 	}
 
-	// Ensure the profiles and punishments buckets exist.
-	db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte("profiles"))
+	// Ensure the buckets exist, and build indexes that are missing from databases created by older versions.
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(profilesBucket)
 		if err != nil {
 			return err
 		}
-		_, err = tx.CreateBucketIfNotExists([]byte("punishments"))
+		_, err = tx.CreateBucketIfNotExists(punishmentsBucket)
 		if err != nil {
 			return err
 		}
+		for _, b := range [][]byte{itemsBucket, receiptsBucket, receiptsByPlayerBucket, inventoryEventsBucket, historyBucket,
+			webhooksBucket, deliveriesBucket, appealsBucket, openAppealsBucket} {
+			_, err = tx.CreateBucketIfNotExists(b)
+			if err != nil {
+				return err
+			}
+		}
+
+		if tx.Bucket(profilesCoinsBucket) == nil {
+			err = buildCoinsIndex(tx)
+			if err != nil {
+				return err
+			}
+		}
+		if tx.Bucket(punishmentRecordsBucket) == nil {
+			err = migratePunishments(tx)
+			if err != nil {
+				return err
+			}
+		}
+		if tx.Bucket(punishmentTypesBucket) == nil {
+			err = migratePunishmentTypes(tx)
+			if err != nil {
+				return err
+			}
+		}
 
 		return nil
 	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
 
 	return &BoltStore{db: db}, nil
 }
 
-// PutProfile stores the JSON representation of a Profile in the database with its ID as the key.
-func (s *BoltStore) PutProfile(p Profile) error {
+// Close releases the database file.
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// coinsKey returns the key of a profile in the coins index.
+// Coins are stored big-endian with the sign bit flipped, so that keys sort in numerical order, followed by the ID.
+func coinsKey(p Profile) []byte {
+	k := make([]byte, 8, 8+len(p.ID))
+	binary.BigEndian.PutUint64(k, uint64(p.Coins)^(1<<63))
+	return append(k, p.ID...)
+}
+
+// buildCoinsIndex creates the coins index from the profiles bucket.
+func buildCoinsIndex(tx *bolt.Tx) error {
+	idx, err := tx.CreateBucket(profilesCoinsBucket)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(profilesBucket).ForEach(func(k, v []byte) error {
+		var p Profile
+		err := json.Unmarshal(v, &p)
+		if err != nil {
+			return err
+		}
+		return idx.Put(coinsKey(p), nil)
+	})
+}
+
+// getProfile reads a Profile inside a transaction.
+func getProfile(tx *bolt.Tx, steamid string) (Profile, error) {
+	var p Profile
+
+	v := tx.Bucket(profilesBucket).Get([]byte(steamid))
+	if v == nil {
+		return p, ErrProfileNotFound
+	}
+
+	err := json.Unmarshal(v, &p)
+	return p, err
+}
+
+// putProfile validates a Profile against the item catalog and writes it inside a transaction,
+// keeping the indexes up to date and recording the write in the profile's history.
+func putProfile(tx *bolt.Tx, p Profile, by string) error {
+	var prev *Profile
+	old, err := getProfile(tx, p.ID)
+	if err == nil {
+		prev = &old
+	}
+
+	err = ValidateProfile(prev, p, boltItemLookup(tx))
+	if err != nil {
+		return err
+	}
+
 	j, err := json.Marshal(p)
 	if err != nil {
 		return err
 	}
 
-	return s.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("profiles"))
-		err := b.Put([]byte(p.ID), j)
+	idx := tx.Bucket(profilesCoinsBucket)
+	if prev != nil {
+		err = idx.Delete(coinsKey(old))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = idx.Put(coinsKey(p), nil)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Bucket(profilesBucket).Put([]byte(p.ID), j)
+	if err != nil {
 		return err
+	}
+
+	return putVersion(tx, prev, p, by)
+}
+
+// PutProfile stores the JSON representation of a Profile in the database with its ID as the key.
+func (s *BoltStore) PutProfile(p Profile) error {
+	return s.PutProfileBy(p, "")
+}
+
+// PutProfileBy stores a Profile and records by as the caller in its history.
+func (s *BoltStore) PutProfileBy(p Profile, by string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putProfile(tx, p, by)
 	})
 }
 
@@ -54,101 +173,160 @@ func (s *BoltStore) GetProfile(steamid string) (Profile, error) {
 	var p Profile
 
 	err := s.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("profiles"))
-		v := b.Get([]byte(steamid))
-		if v == nil {
-			return errors.New("Profile not found.")
-		}
-		return json.Unmarshal(v, &p)
+		var err error
+		p, err = getProfile(tx, steamid)
+		return err
 	})
 
 	return p, err
 }
 
-//GetCoins(string) int64
-//PutCoins(string, int64) int64
-
-func (s *BoltStore) GetPunishments(steamid string) (map[string]Punishment, error) {
-	var ps map[string]Punishment
+// GetProfiles reads many profiles in a single view transaction.
+func (s *BoltStore) GetProfiles(steamids []string) (map[string]Profile, error) {
+	ps := map[string]Profile{}
 
 	err := s.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("punishments"))
-		v := b.Get([]byte(steamid))
-		return json.Unmarshal(v, &ps)
+		for _, id := range steamids {
+			p, err := getProfile(tx, id)
+			if err == ErrProfileNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			ps[id] = p
+		}
+		return nil
 	})
 
+	return ps, err
+}
+
+// ListProfiles returns a page of profiles, walking the profiles bucket or the coins index with a cursor.
+func (s *BoltStore) ListProfiles(opts ListOptions) (ProfilePage, error) {
+	after, err := opts.normalize()
 	if err != nil {
-		return ps, err
+		return ProfilePage{}, err
 	}
 
-	if len(ps) == 0 {
-		return ps, errors.New("No punishments found.")
-	}
+	var ps []Profile
+	err = s.db.View(func(tx *bolt.Tx) error {
+		profiles := tx.Bucket(profilesBucket)
 
-	return ps, err
-}
+		b := profiles
+		var start []byte
+		if opts.SortBy == SortByCoins {
+			b = tx.Bucket(profilesCoinsBucket)
+			if after != nil {
+				start = coinsKey(Profile{ID: after.ID, Coins: after.Coins})
+			}
+		} else if after != nil {
+			start = []byte(after.ID)
+		}
+
+		c := b.Cursor()
+		next := c.Next
+		if opts.Desc {
+			next = c.Prev
+		}
 
-func (s *BoltStore) PutPunishment(p Punishment) error {
-	var ps map[string]Punishment
+		for k, v := seekPast(c, start, opts.Desc); k != nil && len(ps) <= opts.Limit; k, v = next() {
+			if opts.SortBy == SortByCoins {
+				v = profiles.Get(k[8:])
+			}
+
+			var p Profile
+			err := json.Unmarshal(v, &p)
+			if err != nil {
+				return err
+			}
+			ps = append(ps, p)
+		}
+
+		return nil
+	})
 
-	if p.PlayerID == "" || p.By == "" || p.Type == "" {
-		return errors.New("PlayerID, By, and Type are required fields.")
+	return opts.page(ps), err
+}
+
+// seekPast moves c to the first key that comes after start in the direction of iteration.
+// A nil start positions c at the first key (or the last, when iterating in descending order).
+func seekPast(c *bolt.Cursor, start []byte, desc bool) ([]byte, []byte) {
+	if start == nil {
+		if desc {
+			return c.Last()
+		}
+		return c.First()
 	}
 
-	ps, err := s.GetPunishments(p.PlayerID)
-	if err != nil {
-		ps = map[string]Punishment{}
+	k, v := c.Seek(start)
+	if desc {
+		if k == nil {
+			return c.Last()
+		}
+		for k != nil && bytes.Compare(k, start) >= 0 {
+			k, v = c.Prev()
+		}
+		return k, v
 	}
 
-	ps[p.Type] = p
+	if k != nil && bytes.Equal(k, start) {
+		return c.Next()
+	}
+	return k, v
+}
 
-	j, err := json.Marshal(ps)
-	if err != nil {
-		return err
+// boltLeaderboard walks the coins index backwards, richest first. It must only be used inside tx.
+func boltLeaderboard(tx *bolt.Tx) walkFunc {
+	return func(visit func(id string, coins int64) bool) error {
+		c := tx.Bucket(profilesCoinsBucket).Cursor()
+		for k, _ := c.Last(); k != nil; k, _ = c.Prev() {
+			coins := int64(binary.BigEndian.Uint64(k) ^ (1 << 63))
+			if !visit(string(k[8:]), coins) {
+				return nil
+			}
+		}
+		return nil
 	}
+}
 
-	err = s.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("punishments"))
-		return b.Put([]byte(p.PlayerID), j)
+// TopProfiles returns the n richest players.
+func (s *BoltStore) TopProfiles(n int) ([]Ranking, error) {
+	var rs []Ranking
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		rs, err = topRankings(boltLeaderboard(tx), n)
+		return err
 	})
+	return rs, err
+}
 
-	return err
+// GetStanding returns a player's rank and the n players above and below them.
+// Only the keys of the coins index are read down to the player, so no profiles are decoded.
+func (s *BoltStore) GetStanding(steamid string, n int) (Standing, error) {
+	var st Standing
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		st, err = standingOf(boltLeaderboard(tx), steamid, n)
+		return err
+	})
+	return st, err
 }
 
-func (s *BoltStore) DelPunishment(pid int64) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("punishments"))
-		found := false
+//GetCoins(string) int64
+//PutCoins(string, int64) int64
 
-		err := b.ForEach(func(k, v []byte) error {
-			var ps map[string]Punishment
-			err := json.Unmarshal(v, &ps)
+// EachProfile calls fn for every Profile in the database, in key order.
+func (s *BoltStore) EachProfile(fn func(Profile) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(profilesBucket)
+		return b.ForEach(func(k, v []byte) error {
+			var p Profile
+			err := json.Unmarshal(v, &p)
 			if err != nil {
 				return err
 			}
-			for _, v := range ps {
-				if v.ID == pid {
-					found = true
-					delete(ps, v.Type)
-					j, err := json.Marshal(ps)
-					if err != nil {
-						return err
-					}
-					err = b.Put([]byte(v.PlayerID), j)
-					return err
-				}
-			}
-			return err
+			return fn(p)
 		})
-
-		if err != nil {
-			return err
-		}
-
-		if !found {
-			return errors.New("Punishment not found.")
-		}
-
-		return err
 	})
 }
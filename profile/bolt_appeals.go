@@ -0,0 +1,185 @@
+package profile
+
+import (
+	"encoding/json"
+
+	"github.com/boltdb/bolt"
+)
+
+// Appeals are stored under their ID. openAppealsBucket maps the ID of every punishment with an open appeal
+// to the ID of the appeal.
+var (
+	appealsBucket     = []byte("appeals")
+	openAppealsBucket = []byte("appeals_open_by_punishment")
+)
+
+// getAppeal reads an appeal inside a transaction.
+func getAppeal(tx *bolt.Tx, id int64) (Appeal, error) {
+	var a Appeal
+
+	v := tx.Bucket(appealsBucket).Get(idKey(id))
+	if v == nil {
+		return a, ErrAppealNotFound
+	}
+
+	err := json.Unmarshal(v, &a)
+	return a, err
+}
+
+// putAppeal writes an appeal inside a transaction, assigning it an ID if it has none, and keeps the index of open
+// appeals up to date.
+func putAppeal(tx *bolt.Tx, a Appeal) (Appeal, error) {
+	b := tx.Bucket(appealsBucket)
+
+	if a.ID == 0 {
+		seq, err := b.NextSequence()
+		if err != nil {
+			return a, err
+		}
+		a.ID = int64(seq)
+	}
+
+	j, err := json.Marshal(a)
+	if err != nil {
+		return a, err
+	}
+	err = b.Put(idKey(a.ID), j)
+	if err != nil {
+		return a, err
+	}
+
+	open := tx.Bucket(openAppealsBucket)
+	if a.Status == AppealOpen {
+		return a, open.Put(idKey(a.PunishmentID), idKey(a.ID))
+	}
+	return a, open.Delete(idKey(a.PunishmentID))
+}
+
+// updatePunishmentRecord rewrites a punishment record in place, and the player's current punishment when it is
+// that record. Unlike putPunishment, it leaves a newer punishment of the same type current.
+// The indexes do not include the expiry date, so they are left alone.
+func updatePunishmentRecord(tx *bolt.Tx, p Punishment) error {
+	j, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	err = tx.Bucket(punishmentRecordsBucket).Put(idKey(p.ID), j)
+	if err != nil {
+		return err
+	}
+
+	ps, err := currentPunishments(tx, p.PlayerID)
+	if err != nil {
+		return err
+	}
+	if cur, ok := ps[p.Key()]; !ok || cur.ID != p.ID {
+		return nil
+	}
+	ps[p.Key()] = p
+	return putCurrentPunishments(tx, p.PlayerID, ps)
+}
+
+// FileAppeal opens an appeal against a punishment in force.
+func (s *BoltStore) FileAppeal(punishmentID int64, e AppealEvent) (Appeal, error) {
+	var a Appeal
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		p, err := getPunishment(tx, punishmentID)
+		if err != nil {
+			return err
+		}
+
+		if tx.Bucket(openAppealsBucket).Get(idKey(punishmentID)) != nil {
+			return ErrAppealExists
+		}
+
+		a, err = openAppeal(p, e)
+		if err != nil {
+			return err
+		}
+
+		a, err = putAppeal(tx, a)
+		return err
+	})
+
+	return a, err
+}
+
+// GetAppeal returns the appeal with the given ID.
+func (s *BoltStore) GetAppeal(id int64) (Appeal, error) {
+	var a Appeal
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		a, err = getAppeal(tx, id)
+		return err
+	})
+
+	return a, err
+}
+
+// QueryAppeals walks the appeals from the newest until q.Limit of them match.
+func (s *BoltStore) QueryAppeals(q AppealQuery) ([]Appeal, error) {
+	as := []Appeal{}
+
+	err := q.normalize()
+	if err != nil {
+		return as, err
+	}
+
+	err = s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(appealsBucket).Cursor()
+
+		for k, v := c.Last(); k != nil && len(as) < q.Limit; k, v = c.Prev() {
+			var a Appeal
+			err := json.Unmarshal(v, &a)
+			if err != nil {
+				return err
+			}
+			if q.matches(a) {
+				as = append(as, a)
+			}
+		}
+
+		return nil
+	})
+
+	return as, err
+}
+
+// RecordAppealEvent adds a comment or the decision to an appeal in a single transaction, changing the punishment
+// when the appeal is accepted.
+func (s *BoltStore) RecordAppealEvent(id int64, e AppealEvent) (Appeal, Punishment, error) {
+	var a Appeal
+	var p Punishment
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		a, err = getAppeal(tx, id)
+		if err != nil {
+			return err
+		}
+
+		p, err = getPunishment(tx, a.PunishmentID)
+		if err != nil {
+			return err
+		}
+
+		err = a.record(&p, e)
+		if err != nil {
+			return err
+		}
+
+		if e.Action == AppealAccept {
+			err = updatePunishmentRecord(tx, p)
+			if err != nil {
+				return err
+			}
+		}
+
+		a, err = putAppeal(tx, a)
+		return err
+	})
+
+	return a, p, err
+}
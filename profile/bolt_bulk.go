@@ -0,0 +1,65 @@
+package profile
+
+import (
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// bulkWrite stores a single write of a bulk request inside a transaction, and returns the stored punishment of
+// punishment writes.
+func bulkWrite(tx *bolt.Tx, op BulkOp, by string) (*Punishment, error) {
+	err := op.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	if op.Profile != nil {
+		return nil, putProfile(tx, *op.Profile, by)
+	}
+
+	p, err := PreparePunishment(*op.Punishment, time.Now(), boltPunishmentTypeLookup(tx))
+	if err != nil {
+		return nil, err
+	}
+	p, err = putPunishment(tx, p)
+	return &p, err
+}
+
+// BulkWrite stores many records in a single transaction when atomic is true, and in one transaction each otherwise.
+func (s *BoltStore) BulkWrite(ops []BulkOp, atomic bool, by string) ([]BulkResult, error) {
+	results := make([]BulkResult, len(ops))
+
+	if !atomic {
+		for i, op := range ops {
+			results[i].Err = s.db.Update(func(tx *bolt.Tx) error {
+				p, err := bulkWrite(tx, op, by)
+				if err == nil {
+					results[i].stored(p)
+				}
+				return err
+			})
+		}
+		return results, nil
+	}
+
+	failed := -1
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		for i, op := range ops {
+			p, err := bulkWrite(tx, op, by)
+			if err != nil {
+				failed = i
+				results[i].Err = err
+				return err
+			}
+			results[i].stored(p)
+		}
+		return nil
+	})
+	if failed >= 0 {
+		rollBack(results, failed)
+		return results, nil
+	}
+
+	return results, err
+}
@@ -0,0 +1,72 @@
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/boltdb/bolt"
+)
+
+// historyBucket holds every version of every profile, keyed by player and version number.
+var historyBucket = []byte("profile_history")
+
+// lastVersion returns the number of a player's newest version inside a transaction, or 0 if there is none.
+func lastVersion(tx *bolt.Tx, steamid string) int64 {
+	prefix := indexPrefix(steamid)
+	k := seekBefore(tx.Bucket(historyBucket).Cursor(), prefixEnd(prefix))
+	if k == nil || !bytes.HasPrefix(k, prefix) {
+		return 0
+	}
+	return idFromKey(k)
+}
+
+// putVersion records a write of p over old inside a transaction.
+func putVersion(tx *bolt.Tx, old *Profile, p Profile, by string) error {
+	v := newVersion(lastVersion(tx, p.ID), old, p, by)
+
+	j, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(historyBucket).Put(append(indexPrefix(p.ID), idKey(v.Version)...), j)
+}
+
+// GetHistory returns a player's profile versions, newest first.
+func (s *BoltStore) GetHistory(steamid string) ([]ProfileVersion, error) {
+	vs := []ProfileVersion{}
+	prefix := indexPrefix(steamid)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(historyBucket)
+		c := b.Cursor()
+
+		for k := seekBefore(c, prefixEnd(prefix)); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Prev() {
+			var v ProfileVersion
+			err := json.Unmarshal(b.Get(k), &v)
+			if err != nil {
+				return err
+			}
+			vs = append(vs, v)
+		}
+
+		return nil
+	})
+
+	return vs, err
+}
+
+// GetVersion returns a single version of a player's profile.
+func (s *BoltStore) GetVersion(steamid string, version int64) (ProfileVersion, error) {
+	var v ProfileVersion
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		j := tx.Bucket(historyBucket).Get(append(indexPrefix(steamid), idKey(version)...))
+		if j == nil {
+			return ErrVersionNotFound
+		}
+		return json.Unmarshal(j, &v)
+	})
+
+	return v, err
+}
@@ -0,0 +1,85 @@
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/boltdb/bolt"
+)
+
+// inventoryEventsBucket holds every player's inventory log, keyed by player and event ID.
+var inventoryEventsBucket = []byte("inventory_events")
+
+// putInventoryEvent appends an event to a player's inventory log inside a transaction.
+func putInventoryEvent(tx *bolt.Tx, e InventoryEvent) (InventoryEvent, error) {
+	b := tx.Bucket(inventoryEventsBucket)
+
+	seq, err := b.NextSequence()
+	if err != nil {
+		return e, err
+	}
+	e.ID = int64(seq)
+
+	j, err := json.Marshal(e)
+	if err != nil {
+		return e, err
+	}
+
+	return e, b.Put(append(indexPrefix(e.PlayerID), idKey(e.ID)...), j)
+}
+
+// ChangeInventory changes a single inventory item and logs the change in a single transaction.
+func (s *BoltStore) ChangeInventory(e InventoryEvent) (InventoryEvent, Profile, error) {
+	var p Profile
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		it, err := getItem(tx, e.Item)
+		if err != nil {
+			return err
+		}
+
+		p, err = getProfile(tx, e.PlayerID)
+		if err != nil {
+			return err
+		}
+
+		err = applyInventoryEvent(&p, it, &e)
+		if err != nil {
+			return err
+		}
+
+		err = putProfile(tx, p, e.By)
+		if err != nil {
+			return err
+		}
+
+		e, err = putInventoryEvent(tx, e)
+		return err
+	})
+
+	return e, p, err
+}
+
+// GetInventoryEvents returns a player's inventory log, newest first.
+func (s *BoltStore) GetInventoryEvents(steamid string) ([]InventoryEvent, error) {
+	es := []InventoryEvent{}
+	prefix := indexPrefix(steamid)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(inventoryEventsBucket)
+		c := b.Cursor()
+
+		for k := seekBefore(c, prefixEnd(prefix)); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Prev() {
+			var e InventoryEvent
+			err := json.Unmarshal(b.Get(k), &e)
+			if err != nil {
+				return err
+			}
+			es = append(es, e)
+		}
+
+		return nil
+	})
+
+	return es, err
+}
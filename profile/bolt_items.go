@@ -0,0 +1,103 @@
+package profile
+
+import (
+	"encoding/json"
+
+	"github.com/boltdb/bolt"
+)
+
+var itemsBucket = []byte("items")
+
+// getItem reads a catalog item inside a transaction.
+func getItem(tx *bolt.Tx, name string) (Item, error) {
+	var it Item
+
+	v := tx.Bucket(itemsBucket).Get([]byte(name))
+	if v == nil {
+		return it, ErrItemNotFound
+	}
+
+	err := json.Unmarshal(v, &it)
+	return it, err
+}
+
+// boltItemLookup looks items up for ValidateProfile inside a transaction.
+func boltItemLookup(tx *bolt.Tx) func(string) (Item, bool) {
+	return func(name string) (Item, bool) {
+		it, err := getItem(tx, name)
+		return it, err == nil
+	}
+}
+
+// GetItem returns the catalog item with the given name.
+func (s *BoltStore) GetItem(name string) (Item, error) {
+	var it Item
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		it, err = getItem(tx, name)
+		return err
+	})
+
+	return it, err
+}
+
+// GetItems returns the whole catalog, ordered by name.
+func (s *BoltStore) GetItems() ([]Item, error) {
+	items := []Item{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(itemsBucket).ForEach(func(k, v []byte) error {
+			var it Item
+			err := json.Unmarshal(v, &it)
+			items = append(items, it)
+			return err
+		})
+	})
+
+	return items, err
+}
+
+// PutItem adds an item to the catalog, or replaces the item with the same name.
+func (s *BoltStore) PutItem(it Item) error {
+	err := it.Validate()
+	if err != nil {
+		return err
+	}
+
+	j, err := json.Marshal(it)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(itemsBucket).Put([]byte(it.Name), j)
+	})
+}
+
+// DelItem removes an item from the catalog. Every profile is checked to make sure nobody owns it.
+func (s *BoltStore) DelItem(name string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		_, err := getItem(tx, name)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Bucket(profilesBucket).ForEach(func(k, v []byte) error {
+			var p Profile
+			err := json.Unmarshal(v, &p)
+			if err != nil {
+				return err
+			}
+			if _, ok := p.Inventory[name]; ok {
+				return ErrItemInUse
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(itemsBucket).Delete([]byte(name))
+	})
+}
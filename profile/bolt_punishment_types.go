@@ -0,0 +1,138 @@
+package profile
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/boltdb/bolt"
+)
+
+var punishmentTypesBucket = []byte("punishment_types")
+
+// migratePunishmentTypes creates the registry of punishment types with the built-in types. For databases written
+// by older versions, the types of the stored punishments are registered too, as global types, so that they can
+// still be given.
+func migratePunishmentTypes(tx *bolt.Tx) error {
+	b, err := tx.CreateBucket(punishmentTypesBucket)
+	if err != nil {
+		return err
+	}
+
+	types := map[string]PunishmentType{}
+	err = tx.Bucket(punishmentRecordsBucket).ForEach(func(k, v []byte) error {
+		var p Punishment
+		err := json.Unmarshal(v, &p)
+		name := strings.ToLower(strings.TrimSpace(p.Type))
+		if punishmentTypeName.MatchString(name) {
+			types[name] = PunishmentType{Name: name, Scope: ScopeGlobal}
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, t := range BuiltinPunishmentTypes {
+		types[t.Name] = t
+	}
+
+	for _, t := range types {
+		j, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		err = b.Put([]byte(t.Name), j)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getPunishmentType reads a punishment type inside a transaction.
+func getPunishmentType(tx *bolt.Tx, name string) (PunishmentType, error) {
+	var t PunishmentType
+
+	v := tx.Bucket(punishmentTypesBucket).Get([]byte(name))
+	if v == nil {
+		return t, ErrPunishmentTypeNotFound
+	}
+
+	err := json.Unmarshal(v, &t)
+	return t, err
+}
+
+// boltPunishmentTypeLookup looks punishment types up for PreparePunishment inside a transaction.
+func boltPunishmentTypeLookup(tx *bolt.Tx) func(string) (PunishmentType, bool) {
+	return func(name string) (PunishmentType, bool) {
+		t, err := getPunishmentType(tx, name)
+		return t, err == nil
+	}
+}
+
+// GetPunishmentType returns the registered punishment type with the given name.
+func (s *BoltStore) GetPunishmentType(name string) (PunishmentType, error) {
+	var t PunishmentType
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		t, err = getPunishmentType(tx, name)
+		return err
+	})
+
+	return t, err
+}
+
+// GetPunishmentTypes returns every registered punishment type, ordered by name.
+func (s *BoltStore) GetPunishmentTypes() ([]PunishmentType, error) {
+	types := []PunishmentType{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(punishmentTypesBucket).ForEach(func(k, v []byte) error {
+			var t PunishmentType
+			err := json.Unmarshal(v, &t)
+			types = append(types, t)
+			return err
+		})
+	})
+
+	return types, err
+}
+
+// PutPunishmentType registers a punishment type, or replaces the type with the same name.
+func (s *BoltStore) PutPunishmentType(t PunishmentType) error {
+	err := t.Validate()
+	if err != nil {
+		return err
+	}
+
+	j, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(punishmentTypesBucket).Put([]byte(t.Name), j)
+	})
+}
+
+// DelPunishmentType removes a punishment type from the registry, unless it is built in or in use.
+// The type index tells whether punishments of the type are stored.
+func (s *BoltStore) DelPunishmentType(name string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		_, err := getPunishmentType(tx, name)
+		if err != nil {
+			return err
+		}
+		if isBuiltinPunishmentType(name) {
+			return ErrBuiltinPunishmentType
+		}
+
+		prefix := indexPrefix(name)
+		k, _ := tx.Bucket(punishmentIndexes[2].bucket).Cursor().Seek(prefix)
+		if k != nil && strings.HasPrefix(string(k), string(prefix)) {
+			return ErrPunishmentTypeInUse
+		}
+
+		return tx.Bucket(punishmentTypesBucket).Delete([]byte(name))
+	})
+}
@@ -0,0 +1,394 @@
+package profile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Every punishment is stored in punishmentRecordsBucket under its ID. The punishments bucket holds each player's
+// current punishment of every type, and the index buckets map a field, the date and the ID to the record.
+var (
+	punishmentRecordsBucket = []byte("punishment_records")
+
+	punishmentIndexes = []struct {
+		bucket []byte
+		field  func(Punishment) string
+	}{
+		{[]byte("punishments_by_player"), func(p Punishment) string { return p.PlayerID }},
+		{[]byte("punishments_by_issuer"), func(p Punishment) string { return p.By }},
+		{[]byte("punishments_by_type"), func(p Punishment) string { return p.Type }},
+		{[]byte("punishments_by_date"), nil},
+	}
+)
+
+// idKey encodes a punishment ID so that keys sort numerically.
+func idKey(id int64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, uint64(id))
+	return k
+}
+
+// idFromKey decodes the ID at the end of an index key.
+func idFromKey(k []byte) int64 {
+	return int64(binary.BigEndian.Uint64(k[len(k)-8:]))
+}
+
+// timeKey encodes a time so that keys sort chronologically, including times before 1970.
+func timeKey(t time.Time) []byte {
+	k := make([]byte, 12)
+	binary.BigEndian.PutUint64(k, uint64(t.Unix())^(1<<63))
+	binary.BigEndian.PutUint32(k[8:], uint32(t.Nanosecond()))
+	return k
+}
+
+// indexPrefix returns the part of an index key shared by all punishments with the given field value.
+func indexPrefix(value string) []byte {
+	return append([]byte(value), 0)
+}
+
+// indexKey returns the key of p in an index on the given field, or in the date index when field is nil.
+func indexKey(field func(Punishment) string, p Punishment) []byte {
+	var k []byte
+	if field != nil {
+		k = indexPrefix(field(p))
+	}
+	k = append(k, timeKey(p.Date)...)
+	return append(k, idKey(p.ID)...)
+}
+
+// migratePunishments creates the punishment records and indexes for databases written by older versions,
+// which only kept the punishments bucket and did not assign IDs. Punishments without a unique ID are given one.
+func migratePunishments(tx *bolt.Tx) error {
+	_, err := tx.CreateBucket(punishmentRecordsBucket)
+	if err != nil {
+		return err
+	}
+	for _, idx := range punishmentIndexes {
+		_, err = tx.CreateBucketIfNotExists(idx.bucket)
+		if err != nil {
+			return err
+		}
+	}
+
+	var ps []Punishment
+	err = tx.Bucket(punishmentsBucket).ForEach(func(k, v []byte) error {
+		var m map[string]Punishment
+		err := json.Unmarshal(v, &m)
+		for _, p := range m {
+			ps = append(ps, p)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	records := tx.Bucket(punishmentRecordsBucket)
+	for _, p := range ps {
+		if records.Get(idKey(p.ID)) != nil {
+			p.ID = 0
+		}
+
+		_, err = putPunishment(tx, p)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getPunishment reads a punishment record inside a transaction.
+func getPunishment(tx *bolt.Tx, id int64) (Punishment, error) {
+	var p Punishment
+
+	v := tx.Bucket(punishmentRecordsBucket).Get(idKey(id))
+	if v == nil {
+		return p, ErrPunishmentNotFound
+	}
+
+	err := json.Unmarshal(v, &p)
+	return p, err
+}
+
+// currentPunishments reads a player's current punishments, by type, inside a transaction.
+func currentPunishments(tx *bolt.Tx, steamid string) (map[string]Punishment, error) {
+	ps := map[string]Punishment{}
+
+	v := tx.Bucket(punishmentsBucket).Get([]byte(steamid))
+	if v == nil {
+		return ps, nil
+	}
+
+	err := json.Unmarshal(v, &ps)
+	return ps, err
+}
+
+// putCurrentPunishments writes a player's current punishments inside a transaction.
+func putCurrentPunishments(tx *bolt.Tx, steamid string, ps map[string]Punishment) error {
+	b := tx.Bucket(punishmentsBucket)
+	if len(ps) == 0 {
+		return b.Delete([]byte(steamid))
+	}
+
+	j, err := json.Marshal(ps)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(steamid), j)
+}
+
+// putPunishment stores a punishment inside a transaction, assigning it an ID if it has none.
+// A punishment with an ID that is already taken is not stored, and ErrPunishmentExists is returned. The sequence is
+// moved past IDs given explicitly by an import, so that later punishments do not reuse them.
+func putPunishment(tx *bolt.Tx, p Punishment) (Punishment, error) {
+	records := tx.Bucket(punishmentRecordsBucket)
+
+	if p.ID == 0 {
+		// Skip over IDs that databases written by older versions gave explicitly.
+		for p.ID == 0 || records.Get(idKey(p.ID)) != nil {
+			seq, err := records.NextSequence()
+			if err != nil {
+				return p, err
+			}
+			p.ID = int64(seq)
+		}
+	} else if records.Get(idKey(p.ID)) != nil {
+		return p, ErrPunishmentExists
+	} else if uint64(p.ID) > records.Sequence() {
+		err := records.SetSequence(uint64(p.ID))
+		if err != nil {
+			return p, err
+		}
+	}
+
+	j, err := json.Marshal(p)
+	if err != nil {
+		return p, err
+	}
+
+	err = records.Put(idKey(p.ID), j)
+	if err != nil {
+		return p, err
+	}
+
+	for _, idx := range punishmentIndexes {
+		err = tx.Bucket(idx.bucket).Put(indexKey(idx.field, p), nil)
+		if err != nil {
+			return p, err
+		}
+	}
+
+	ps, err := currentPunishments(tx, p.PlayerID)
+	if err != nil {
+		return p, err
+	}
+	ps[p.Key()] = p
+
+	return p, putCurrentPunishments(tx, p.PlayerID, ps)
+}
+
+// unlinkPunishment removes a punishment from the indexes and from its player's current punishments.
+func unlinkPunishment(tx *bolt.Tx, p Punishment) error {
+	for _, idx := range punishmentIndexes {
+		err := tx.Bucket(idx.bucket).Delete(indexKey(idx.field, p))
+		if err != nil {
+			return err
+		}
+	}
+
+	ps, err := currentPunishments(tx, p.PlayerID)
+	if err != nil {
+		return err
+	}
+
+	if cur, ok := ps[p.Key()]; ok && cur.ID == p.ID {
+		delete(ps, p.Key())
+	}
+
+	return putCurrentPunishments(tx, p.PlayerID, ps)
+}
+
+// GetPunishments returns the current punishment of each type for a player.
+func (s *BoltStore) GetPunishments(steamid string) (map[string]Punishment, error) {
+	var ps map[string]Punishment
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		ps, err = currentPunishments(tx, steamid)
+		return err
+	})
+
+	if err != nil {
+		return ps, err
+	}
+
+	if len(ps) == 0 {
+		return ps, ErrNoPunishments
+	}
+
+	return ps, err
+}
+
+// GetPunishment returns the punishment with the given ID.
+func (s *BoltStore) GetPunishment(id int64) (Punishment, error) {
+	var p Punishment
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		p, err = getPunishment(tx, id)
+		return err
+	})
+
+	return p, err
+}
+
+// PutPunishment stores a punishment of a registered type. It becomes the player's current punishment of its type
+// and scope, while the one it replaces stays in the history returned by QueryPunishments.
+func (s *BoltStore) PutPunishment(p Punishment) (Punishment, error) {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		p, err = PreparePunishment(p, time.Now(), boltPunishmentTypeLookup(tx))
+		if err != nil {
+			return err
+		}
+		p, err = putPunishment(tx, p)
+		return err
+	})
+	return p, err
+}
+
+// ImportPunishment stores a punishment under its ID, or the next free one if it has none.
+func (s *BoltStore) ImportPunishment(p Punishment) (Punishment, error) {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		p, err = prepareRecord(p, time.Now(), boltPunishmentTypeLookup(tx))
+		if err != nil {
+			return err
+		}
+		p, err = putPunishment(tx, p)
+		return err
+	})
+	return p, err
+}
+
+// DelPunishment deletes the punishment with the given ID.
+func (s *BoltStore) DelPunishment(pid int64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		p, err := getPunishment(tx, pid)
+		if err != nil {
+			return err
+		}
+
+		err = unlinkPunishment(tx, p)
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(punishmentRecordsBucket).Delete(idKey(pid))
+	})
+}
+
+// EachPunishment calls fn for every punishment in the database, in ID order.
+func (s *BoltStore) EachPunishment(fn func(Punishment) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(punishmentRecordsBucket).ForEach(func(k, v []byte) error {
+			var p Punishment
+			err := json.Unmarshal(v, &p)
+			if err != nil {
+				return err
+			}
+			return fn(p)
+		})
+	})
+}
+
+// QueryPunishments returns the punishments matching q, newest first.
+// It walks the most selective index backwards through the date range and filters the records it finds.
+func (s *BoltStore) QueryPunishments(q PunishmentQuery) ([]Punishment, error) {
+	err := q.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	// Pick the index to walk, in order of expected selectivity.
+	idx := punishmentIndexes[3]
+	var prefix []byte
+	switch {
+	case q.PlayerID != "":
+		idx, prefix = punishmentIndexes[0], indexPrefix(q.PlayerID)
+	case q.By != "":
+		idx, prefix = punishmentIndexes[1], indexPrefix(q.By)
+	case q.Type != "":
+		idx, prefix = punishmentIndexes[2], indexPrefix(q.Type)
+	}
+
+	ps := []Punishment{}
+	err = s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(idx.bucket).Cursor()
+
+		var k []byte
+		if q.Until.IsZero() {
+			k = seekBefore(c, prefixEnd(prefix))
+		} else {
+			k = seekBefore(c, append(append([]byte{}, prefix...), timeKey(q.Until)...))
+		}
+
+		var since []byte
+		if !q.Since.IsZero() {
+			since = append(append([]byte{}, prefix...), timeKey(q.Since)...)
+		}
+
+		for ; k != nil && bytes.HasPrefix(k, prefix) && len(ps) < q.Limit; k, _ = c.Prev() {
+			if since != nil && bytes.Compare(k, since) < 0 {
+				break
+			}
+
+			p, err := getPunishment(tx, idFromKey(k))
+			if err != nil {
+				return err
+			}
+
+			if q.matches(p) {
+				ps = append(ps, p)
+			}
+		}
+
+		return nil
+	})
+
+	return ps, err
+}
+
+// seekBefore moves c to the last key that sorts before end, or to the last key in the bucket when end is nil.
+func seekBefore(c *bolt.Cursor, end []byte) []byte {
+	if end == nil {
+		k, _ := c.Last()
+		return k
+	}
+
+	k, _ := c.Seek(end)
+	if k == nil {
+		k, _ = c.Last()
+		return k
+	}
+
+	k, _ = c.Prev()
+	return k
+}
+
+// prefixEnd returns the smallest key that sorts after every key starting with prefix, or nil for an empty prefix.
+// Index prefixes end in a zero byte, so incrementing it is enough.
+func prefixEnd(prefix []byte) []byte {
+	if len(prefix) == 0 {
+		return nil
+	}
+
+	end := append([]byte{}, prefix...)
+	end[len(end)-1]++
+	return end
+}
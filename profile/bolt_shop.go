@@ -0,0 +1,165 @@
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Receipts are stored under their ID, and indexed by player and ID so that a player's history can be read in order.
+var (
+	receiptsBucket         = []byte("receipts")
+	receiptsByPlayerBucket = []byte("receipts_by_player")
+)
+
+// getReceipt reads a receipt inside a transaction.
+func getReceipt(tx *bolt.Tx, id int64) (Receipt, error) {
+	var r Receipt
+
+	v := tx.Bucket(receiptsBucket).Get(idKey(id))
+	if v == nil {
+		return r, ErrReceiptNotFound
+	}
+
+	err := json.Unmarshal(v, &r)
+	return r, err
+}
+
+// putReceipt writes a receipt inside a transaction, assigning it an ID if it has none.
+func putReceipt(tx *bolt.Tx, r Receipt) (Receipt, error) {
+	b := tx.Bucket(receiptsBucket)
+
+	if r.ID == 0 {
+		seq, err := b.NextSequence()
+		if err != nil {
+			return r, err
+		}
+		r.ID = int64(seq)
+	}
+
+	j, err := json.Marshal(r)
+	if err != nil {
+		return r, err
+	}
+
+	err = b.Put(idKey(r.ID), j)
+	if err != nil {
+		return r, err
+	}
+
+	return r, tx.Bucket(receiptsByPlayerBucket).Put(append(indexPrefix(r.PlayerID), idKey(r.ID)...), nil)
+}
+
+// Purchase sells an item to a player in a single transaction.
+func (s *BoltStore) Purchase(steamid, item string, now time.Time) (Receipt, Profile, error) {
+	var r Receipt
+	var p Profile
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		it, err := getItem(tx, item)
+		if err != nil {
+			return err
+		}
+
+		p, err = getProfile(tx, steamid)
+		if err != nil {
+			return err
+		}
+
+		r, err = buy(&p, it, now)
+		if err != nil {
+			return err
+		}
+
+		err = putProfile(tx, p, steamid)
+		if err != nil {
+			return err
+		}
+
+		r, err = putReceipt(tx, r)
+		if err != nil {
+			return err
+		}
+
+		_, err = putInventoryEvent(tx, purchaseEvent(r))
+		return err
+	})
+
+	return r, p, err
+}
+
+// Refund reverses a purchase in a single transaction.
+func (s *BoltStore) Refund(receiptID int64, now time.Time) (Receipt, Profile, error) {
+	var r Receipt
+	var p Profile
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		r, err = getReceipt(tx, receiptID)
+		if err != nil {
+			return err
+		}
+
+		p, err = getProfile(tx, r.PlayerID)
+		if err != nil {
+			return err
+		}
+
+		settings, err := refund(&p, &r, now)
+		if err != nil {
+			return err
+		}
+
+		err = putProfile(tx, p, r.PlayerID)
+		if err != nil {
+			return err
+		}
+
+		r, err = putReceipt(tx, r)
+		if err != nil {
+			return err
+		}
+
+		_, err = putInventoryEvent(tx, refundEvent(r, settings))
+		return err
+	})
+
+	return r, p, err
+}
+
+// GetReceipt returns the receipt with the given ID.
+func (s *BoltStore) GetReceipt(id int64) (Receipt, error) {
+	var r Receipt
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		r, err = getReceipt(tx, id)
+		return err
+	})
+
+	return r, err
+}
+
+// GetReceipts returns a player's receipts, newest first.
+func (s *BoltStore) GetReceipts(steamid string) ([]Receipt, error) {
+	rs := []Receipt{}
+	prefix := indexPrefix(steamid)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(receiptsByPlayerBucket).Cursor()
+
+		for k := seekBefore(c, prefixEnd(prefix)); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Prev() {
+			r, err := getReceipt(tx, idFromKey(k))
+			if err != nil {
+				return err
+			}
+			rs = append(rs, r)
+		}
+
+		return nil
+	})
+
+	return rs, err
+}
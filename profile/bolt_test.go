@@ -1,10 +1,13 @@
 package profile
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"os"
 	"time"
 
+	"github.com/boltdb/bolt"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -54,13 +57,754 @@ var _ = Describe("Bolt", func() {
 				Expect(err).To(HaveOccurred())
 			})
 		})
+
+		It("Iterates over every profile", func() {
+			for _, id := range []string{"user_a", "user_b", "user_c"} {
+				Expect(s.PutProfile(Profile{ID: id})).To(Succeed())
+			}
+
+			var ids []string
+			Expect(s.EachProfile(func(p Profile) error {
+				ids = append(ids, p.ID)
+				return nil
+			})).To(Succeed())
+			Expect(ids).To(ConsistOf("user_a", "user_b", "user_c"))
+		})
+
+		Context("When listing profiles", func() {
+			BeforeEach(func() {
+				coins := map[string]int64{"user_a": 50, "user_b": 10, "user_c": 50, "user_d": 30}
+				for id, c := range coins {
+					Expect(s.PutProfile(Profile{ID: id, Coins: c})).To(Succeed())
+				}
+			})
+
+			ids := func(ps []Profile) []string {
+				var r []string
+				for _, p := range ps {
+					r = append(r, p.ID)
+				}
+				return r
+			}
+
+			It("pages through them by ID", func() {
+				page, err := s.ListProfiles(ListOptions{Limit: 3})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ids(page.Profiles)).To(Equal([]string{"user_a", "user_b", "user_c"}))
+				Expect(page.NextCursor).ToNot(BeEmpty())
+
+				page, err = s.ListProfiles(ListOptions{Limit: 3, Cursor: page.NextCursor})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ids(page.Profiles)).To(Equal([]string{"user_d"}))
+				Expect(page.NextCursor).To(BeEmpty())
+			})
+
+			It("sorts them by coins", func() {
+				page, err := s.ListProfiles(ListOptions{SortBy: SortByCoins})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ids(page.Profiles)).To(Equal([]string{"user_b", "user_d", "user_a", "user_c"}))
+			})
+
+			It("pages through them by coins in descending order", func() {
+				opts := ListOptions{SortBy: SortByCoins, Desc: true, Limit: 2}
+				page, err := s.ListProfiles(opts)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ids(page.Profiles)).To(Equal([]string{"user_c", "user_a"}))
+
+				opts.Cursor = page.NextCursor
+				page, err = s.ListProfiles(opts)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ids(page.Profiles)).To(Equal([]string{"user_d", "user_b"}))
+				Expect(page.NextCursor).To(BeEmpty())
+			})
+
+			It("keeps the coins order up to date when a profile changes", func() {
+				Expect(s.PutProfile(Profile{ID: "user_b", Coins: 70})).To(Succeed())
+
+				page, err := s.ListProfiles(ListOptions{SortBy: SortByCoins})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ids(page.Profiles)).To(Equal([]string{"user_d", "user_a", "user_c", "user_b"}))
+			})
+
+			It("rejects a cursor from a different sort order", func() {
+				page, err := s.ListProfiles(ListOptions{Limit: 1})
+				Expect(err).ToNot(HaveOccurred())
+
+				_, err = s.ListProfiles(ListOptions{Limit: 1, SortBy: SortByCoins, Cursor: page.NextCursor})
+				Expect(err).To(Equal(ErrInvalidCursor))
+			})
+		})
+
+		It("reads many profiles at once", func() {
+			Expect(s.PutProfile(Profile{ID: "user_a", Coins: 1})).To(Succeed())
+			Expect(s.PutProfile(Profile{ID: "user_b", Coins: 2})).To(Succeed())
+
+			ps, err := s.GetProfiles([]string{"user_a", "nobody", "user_b"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ps).To(HaveLen(2))
+			Expect(ps["user_a"].Coins).To(Equal(int64(1)))
+			Expect(ps["user_b"].Coins).To(Equal(int64(2)))
+
+			ps, err = s.GetProfiles(nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ps).To(BeEmpty())
+		})
+	})
+
+	Context("Leaderboard", func() {
+		BeforeEach(func() {
+			coins := map[string]int64{"user_a": 500, "user_b": 300, "user_c": 300, "user_d": 200, "user_e": 100}
+			for id, c := range coins {
+				Expect(s.PutProfile(Profile{ID: id, Coins: c})).To(Succeed())
+			}
+		})
+
+		It("returns the richest players with shared ranks for ties", func() {
+			rs, err := s.TopProfiles(4)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rs).To(Equal([]Ranking{
+				{Rank: 1, ID: "user_a", Coins: 500},
+				{Rank: 2, ID: "user_c", Coins: 300},
+				{Rank: 2, ID: "user_b", Coins: 300},
+				{Rank: 4, ID: "user_d", Coins: 200},
+			}))
+		})
+
+		It("returns a player's standing with their neighbours", func() {
+			st, err := s.GetStanding("user_b", 1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(st.Ranking).To(Equal(Ranking{Rank: 2, ID: "user_b", Coins: 300}))
+			Expect(st.Above).To(Equal([]Ranking{{Rank: 2, ID: "user_c", Coins: 300}}))
+			Expect(st.Below).To(Equal([]Ranking{{Rank: 4, ID: "user_d", Coins: 200}}))
+		})
+
+		It("stays up to date when coins change", func() {
+			Expect(s.PutProfile(Profile{ID: "user_e", Coins: 1000})).To(Succeed())
+
+			st, err := s.GetStanding("user_e", 2)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(st.Rank).To(Equal(int64(1)))
+			Expect(st.Above).To(BeEmpty())
+			Expect(st.Below).To(Equal([]Ranking{
+				{Rank: 2, ID: "user_a", Coins: 500},
+				{Rank: 3, ID: "user_c", Coins: 300},
+			}))
+		})
+
+		It("fails for a player without a profile", func() {
+			_, err := s.GetStanding("this_does_not_exist", 1)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("Item catalog", func() {
+		var hat Item
+
+		BeforeEach(func() {
+			hat = Item{
+				Name:     "hat",
+				Slot:     "head",
+				Price:    100,
+				Tradable: true,
+				Settings: map[string]string{"color": SettingString, "glow": SettingBool},
+			}
+			Expect(s.PutItem(hat)).To(Succeed())
+		})
+
+		It("stores items", func() {
+			it, err := s.GetItem(hat.Name)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(it).To(Equal(hat))
+
+			items, err := s.GetItems()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(items).To(Equal([]Item{hat}))
+		})
+
+		It("rejects invalid items", func() {
+			Expect(s.PutItem(Item{Name: "cheap", Price: -1})).ToNot(Succeed())
+			Expect(s.PutItem(Item{Name: "odd", Settings: map[string]string{"size": "huge"}})).ToNot(Succeed())
+		})
+
+		It("accepts profiles that own and equip catalog items", func() {
+			p := Profile{
+				ID:        "some_user",
+				Inventory: map[string]string{"hat": `{"color":"red","glow":true}`},
+				Equipment: map[string]string{"head": "hat"},
+			}
+			Expect(s.PutProfile(p)).To(Succeed())
+		})
+
+		It("rejects profiles with unknown items, bad settings, unowned equipment or wrong slots", func() {
+			for _, p := range []Profile{
+				{ID: "some_user", Inventory: map[string]string{"sword": ""}},
+				{ID: "some_user", Inventory: map[string]string{"hat": `{"color":1}`}},
+				{ID: "some_user", Inventory: map[string]string{"hat": `{"size":"big"}`}},
+				{ID: "some_user", Inventory: map[string]string{"hat": "red"}},
+				{ID: "some_user", Equipment: map[string]string{"head": "hat"}},
+				{ID: "some_user", Inventory: map[string]string{"hat": ""}, Equipment: map[string]string{"feet": "hat"}},
+			} {
+				err := s.PutProfile(p)
+				Expect(err).To(BeAssignableToTypeOf(&ValidationError{}))
+			}
+		})
+
+		It("only checks what changes in profiles stored before the catalog", func() {
+			legacy := Profile{
+				ID:        "old_user",
+				Coins:     5,
+				Inventory: map[string]string{"sword": "", "hat": "red"},
+				Equipment: map[string]string{"hand": "sword"},
+			}
+			Expect(s.db.Update(func(tx *bolt.Tx) error {
+				j, err := json.Marshal(legacy)
+				if err != nil {
+					return err
+				}
+				return tx.Bucket(profilesBucket).Put([]byte(legacy.ID), j)
+			})).To(Succeed())
+
+			p := legacy
+			p.Coins = 10
+			Expect(s.PutProfile(p)).To(Succeed())
+
+			p.Inventory = map[string]string{"sword": "", "hat": "blue"}
+			Expect(s.PutProfile(p)).To(BeAssignableToTypeOf(&ValidationError{}))
+			p.Inventory = map[string]string{"sword": "", "hat": "red", "boots": ""}
+			Expect(s.PutProfile(p)).To(BeAssignableToTypeOf(&ValidationError{}))
+			p.Inventory = map[string]string{"hat": "red"}
+			Expect(s.PutProfile(p)).To(BeAssignableToTypeOf(&ValidationError{}))
+		})
+
+		It("refuses to delete an item that players own", func() {
+			Expect(s.PutProfile(Profile{ID: "some_user", Inventory: map[string]string{"hat": ""}})).To(Succeed())
+			Expect(s.DelItem(hat.Name)).To(Equal(ErrItemInUse))
+
+			Expect(s.PutProfile(Profile{ID: "some_user"})).To(Succeed())
+			Expect(s.DelItem(hat.Name)).To(Succeed())
+			_, err := s.GetItem(hat.Name)
+			Expect(err).To(Equal(ErrItemNotFound))
+		})
+	})
+
+	Context("Punishment types", func() {
+		var spawnBan PunishmentType
+
+		BeforeEach(func() {
+			spawnBan = PunishmentType{Name: "spawn_ban", Scope: ScopeServer, DefaultDuration: "24h"}
+			Expect(s.PutPunishmentType(spawnBan)).To(Succeed())
+		})
+
+		It("stores custom types next to the built-in ones", func() {
+			t, err := s.GetPunishmentType(spawnBan.Name)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(t).To(Equal(spawnBan))
+
+			ts, err := s.GetPunishmentTypes()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ts).To(ConsistOf(append(BuiltinPunishmentTypes, spawnBan)))
+		})
+
+		It("rejects invalid types, and punishments of unknown types or outside their scope", func() {
+			Expect(s.PutPunishmentType(PunishmentType{Name: "Spawn Ban", Scope: ScopeGlobal})).ToNot(Succeed())
+			Expect(s.PutPunishmentType(PunishmentType{Name: "spawn_ban", Scope: "map"})).ToNot(Succeed())
+
+			for _, p := range []Punishment{
+				{PlayerID: "some_user", By: "some_admin", Type: "spin"},
+				{PlayerID: "some_user", By: "some_admin", Type: "spawn_ban"},
+				{PlayerID: "some_user", By: "some_admin", Type: "spawn_ban", GameMode: "sandbox"},
+			} {
+				_, err := s.PutPunishment(p)
+				Expect(err).To(BeAssignableToTypeOf(&ValidationError{}))
+			}
+		})
+
+		It("keeps one current punishment of a type per scope", func() {
+			date := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+			for _, server := range []string{"server_1", "server_2"} {
+				p := Punishment{PlayerID: "some_user", By: "some_admin", Type: "Spawn_Ban", Server: server, Date: date}
+				_, err := s.PutPunishment(p)
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			ps, err := s.GetPunishments("some_user")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ps).To(HaveLen(2))
+			Expect(ps["spawn_ban@server:server_1"].Expires).To(Equal(date.Add(24 * time.Hour)))
+			Expect(ps["spawn_ban@server:server_2"].Server).To(Equal("server_2"))
+		})
+
+		It("only deletes custom types nobody is punished with", func() {
+			Expect(s.DelPunishmentType(TypeBan)).To(Equal(ErrBuiltinPunishmentType))
+
+			p, err := s.PutPunishment(Punishment{PlayerID: "some_user", By: "some_admin", Type: "spawn_ban", Server: "server_1"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.DelPunishmentType(spawnBan.Name)).To(Equal(ErrPunishmentTypeInUse))
+
+			Expect(s.DelPunishment(p.ID)).To(Succeed())
+			Expect(s.DelPunishmentType(spawnBan.Name)).To(Succeed())
+			_, err = s.GetPunishmentType(spawnBan.Name)
+			Expect(err).To(Equal(ErrPunishmentTypeNotFound))
+		})
+	})
+
+	Context("Shop", func() {
+		now := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+
+		BeforeEach(func() {
+			Expect(s.PutItem(Item{Name: "hat", Slot: "head", Price: 100})).To(Succeed())
+			Expect(s.PutItem(Item{Name: "crown", Slot: "head", Price: 1000})).To(Succeed())
+			Expect(s.PutProfile(Profile{ID: "some_user", Coins: 150})).To(Succeed())
+		})
+
+		It("sells an item and records a receipt", func() {
+			r, p, err := s.Purchase("some_user", "hat", now)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(r.ID).ToNot(BeZero())
+			Expect(r.PlayerID).To(Equal("some_user"))
+			Expect(r.Price).To(Equal(int64(100)))
+			Expect(p.Coins).To(Equal(int64(50)))
+			Expect(p.Inventory).To(HaveKey("hat"))
+
+			stored, err := s.GetProfile("some_user")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stored.Coins).To(Equal(int64(50)))
+			Expect(stored.Inventory).To(HaveKey("hat"))
+
+			rs, err := s.GetReceipts("some_user")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rs).To(HaveLen(1))
+			Expect(rs[0].ID).To(Equal(r.ID))
+		})
+
+		It("refuses purchases the player cannot afford or already owns", func() {
+			_, _, err := s.Purchase("some_user", "crown", now)
+			Expect(err).To(Equal(ErrNotEnoughCoins))
+
+			_, _, err = s.Purchase("some_user", "hat", now)
+			Expect(err).ToNot(HaveOccurred())
+			_, _, err = s.Purchase("some_user", "hat", now)
+			Expect(err).To(Equal(ErrAlreadyOwned))
+
+			_, _, err = s.Purchase("some_user", "sword", now)
+			Expect(err).To(Equal(ErrItemNotFound))
+
+			p, err := s.GetProfile("some_user")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Coins).To(Equal(int64(50)))
+		})
+
+		It("refunds a purchase once, unequipping the item", func() {
+			r, p, err := s.Purchase("some_user", "hat", now)
+			Expect(err).ToNot(HaveOccurred())
+			p.Equipment = map[string]string{"head": "hat"}
+			Expect(s.PutProfile(p)).To(Succeed())
+
+			r, p, err = s.Refund(r.ID, now.Add(time.Hour))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(r.Refunded.Equal(now.Add(time.Hour))).To(BeTrue())
+			Expect(p.Coins).To(Equal(int64(150)))
+			Expect(p.Inventory).ToNot(HaveKey("hat"))
+			Expect(p.Equipment).ToNot(HaveKey("head"))
+
+			_, _, err = s.Refund(r.ID, now)
+			Expect(err).To(Equal(ErrAlreadyRefunded))
+
+			_, _, err = s.Refund(r.ID+100, now)
+			Expect(err).To(Equal(ErrReceiptNotFound))
+		})
+
+		It("lists a player's purchases newest first", func() {
+			Expect(s.PutProfile(Profile{ID: "some_user", Coins: 2000})).To(Succeed())
+			r1, _, err := s.Purchase("some_user", "hat", now)
+			Expect(err).ToNot(HaveOccurred())
+			r2, _, err := s.Purchase("some_user", "crown", now)
+			Expect(err).ToNot(HaveOccurred())
+
+			rs, err := s.GetReceipts("some_user")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rs).To(HaveLen(2))
+			Expect(rs[0].ID).To(Equal(r2.ID))
+			Expect(rs[1].ID).To(Equal(r1.ID))
+
+			rs, err = s.GetReceipts("other_user")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rs).To(BeEmpty())
+		})
+	})
+
+	Context("Inventory", func() {
+		now := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+
+		change := func(kind, item, settings string) (InventoryEvent, Profile, error) {
+			return s.ChangeInventory(InventoryEvent{PlayerID: "some_user", Kind: kind, Item: item, Settings: settings, By: "some_admin", Date: now})
+		}
+
+		BeforeEach(func() {
+			Expect(s.PutItem(Item{Name: "hat", Slot: "head", Price: 100, Settings: map[string]string{"color": SettingString}})).To(Succeed())
+			Expect(s.PutProfile(Profile{ID: "some_user", Coins: 10})).To(Succeed())
+		})
+
+		It("grants, updates, sells and logs single items", func() {
+			_, p, err := change(InventoryGrant, "hat", `{"color":"red"}`)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Inventory).To(Equal(map[string]string{"hat": `{"color":"red"}`}))
+
+			e, p, err := change(InventorySettings, "hat", `{"color":"blue"}`)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(e.OldSettings).To(Equal(`{"color":"red"}`))
+			Expect(p.Inventory["hat"]).To(Equal(`{"color":"blue"}`))
+
+			e, p, err = change(InventorySell, "hat", "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(e.Coins).To(Equal(int64(100 * SellBackPercent / 100)))
+			Expect(p.Coins).To(Equal(10 + e.Coins))
+			Expect(p.Inventory).To(BeEmpty())
+
+			stored, err := s.GetProfile("some_user")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stored.Coins).To(Equal(p.Coins))
+
+			es, err := s.GetInventoryEvents("some_user")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(es).To(HaveLen(3))
+			Expect(es[0].Kind).To(Equal(InventorySell))
+			Expect(es[0].OldSettings).To(Equal(`{"color":"blue"}`))
+			Expect(es[2].Kind).To(Equal(InventoryGrant))
+			Expect(es[2].By).To(Equal("some_admin"))
+		})
+
+		It("removes and unequips an item", func() {
+			_, p, err := change(InventoryGrant, "hat", "")
+			Expect(err).ToNot(HaveOccurred())
+			p.Equipment = map[string]string{"head": "hat"}
+			Expect(s.PutProfile(p)).To(Succeed())
+
+			_, p, err = change(InventoryRemove, "hat", "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Inventory).To(BeEmpty())
+			Expect(p.Equipment).To(BeEmpty())
+			Expect(p.Coins).To(Equal(int64(10)))
+		})
+
+		It("rejects changes that do not fit the inventory", func() {
+			_, _, err := change(InventoryRemove, "hat", "")
+			Expect(err).To(Equal(ErrNotOwned))
+
+			_, _, err = change(InventoryGrant, "hat", `{"size":1}`)
+			Expect(err).To(BeAssignableToTypeOf(&ValidationError{}))
+
+			_, _, err = change(InventoryGrant, "sword", "")
+			Expect(err).To(Equal(ErrItemNotFound))
+
+			_, _, err = change(InventoryGrant, "hat", "")
+			Expect(err).ToNot(HaveOccurred())
+			_, _, err = change(InventoryGrant, "hat", "")
+			Expect(err).To(Equal(ErrAlreadyOwned))
+
+			es, err := s.GetInventoryEvents("some_user")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(es).To(HaveLen(1))
+		})
+
+		It("logs purchases and refunds", func() {
+			Expect(s.PutProfile(Profile{ID: "some_user", Coins: 100})).To(Succeed())
+			r, _, err := s.Purchase("some_user", "hat", now)
+			Expect(err).ToNot(HaveOccurred())
+			_, _, err = s.Refund(r.ID, now)
+			Expect(err).ToNot(HaveOccurred())
+
+			es, err := s.GetInventoryEvents("some_user")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(es).To(HaveLen(2))
+			Expect(es[0].Kind).To(Equal(InventoryRefund))
+			Expect(es[0].Coins).To(Equal(int64(100)))
+			Expect(es[1].Kind).To(Equal(InventoryPurchase))
+			Expect(es[1].Coins).To(Equal(int64(-100)))
+		})
+	})
+
+	Context("History", func() {
+		It("records every write of a profile", func() {
+			Expect(s.PutItem(Item{Name: "hat", Slot: "head"})).To(Succeed())
+
+			first := Profile{ID: "some_user", Coins: 10}
+			Expect(s.PutProfileBy(first, "server_1")).To(Succeed())
+			second := Profile{ID: "some_user", Coins: 20, Inventory: map[string]string{"hat": ""}}
+			Expect(s.PutProfile(second)).To(Succeed())
+			_, _, err := s.ChangeInventory(InventoryEvent{PlayerID: "some_user", Kind: InventoryRemove, Item: "hat", By: "some_admin"})
+			Expect(err).ToNot(HaveOccurred())
+
+			vs, err := s.GetHistory("some_user")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(vs).To(HaveLen(3))
+
+			Expect(vs[0].Version).To(Equal(int64(3)))
+			Expect(vs[0].By).To(Equal("some_admin"))
+			Expect(vs[0].Old.Inventory).To(HaveKey("hat"))
+			Expect(vs[0].New.Inventory).To(BeEmpty())
+
+			Expect(vs[2].Version).To(Equal(int64(1)))
+			Expect(vs[2].By).To(Equal("server_1"))
+			Expect(vs[2].Old).To(BeNil())
+			Expect(vs[2].New.Coins).To(Equal(int64(10)))
+			Expect(vs[2].Date).ToNot(BeZero())
+
+			v, err := s.GetVersion("some_user", 2)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(v.Old.Coins).To(Equal(int64(10)))
+			Expect(v.New.Coins).To(Equal(int64(20)))
+
+			_, err = s.GetVersion("some_user", 4)
+			Expect(err).To(Equal(ErrVersionNotFound))
+
+			vs, err = s.GetHistory("other_user")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(vs).To(BeEmpty())
+		})
+	})
+
+	Context("Webhooks", func() {
+		It("stores webhook subscriptions", func() {
+			w, err := s.PutWebhook(Webhook{URL: "http://localhost/hook", Secret: "secret", Events: []string{EventPunishmentPut}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(w.ID).ToNot(BeZero())
+
+			w.MinCoinDelta = 100
+			_, err = s.PutWebhook(w)
+			Expect(err).ToNot(HaveOccurred())
+
+			got, err := s.GetWebhook(w.ID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(got).To(Equal(w))
+
+			hooks, err := s.GetWebhooks()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hooks).To(HaveLen(1))
+
+			_, err = s.PutWebhook(Webhook{URL: "ftp://localhost", Secret: "secret"})
+			Expect(err).To(BeAssignableToTypeOf(&ValidationError{}))
+			_, err = s.PutWebhook(Webhook{ID: w.ID + 1, URL: "http://localhost/hook", Secret: "secret"})
+			Expect(err).To(Equal(ErrWebhookNotFound))
+
+			Expect(s.DelWebhook(w.ID)).To(Succeed())
+			Expect(s.DelWebhook(w.ID)).To(Equal(ErrWebhookNotFound))
+			_, err = s.GetWebhook(w.ID)
+			Expect(err).To(Equal(ErrWebhookNotFound))
+		})
+
+		It("keeps a log of deliveries", func() {
+			for _, d := range []Delivery{
+				{WebhookID: 1, Status: DeliveryDelivered},
+				{WebhookID: 2, Status: DeliveryDead},
+				{WebhookID: 1, Status: DeliveryPending},
+			} {
+				_, err := s.PutDelivery(d)
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			d, err := s.GetDelivery(3)
+			Expect(err).ToNot(HaveOccurred())
+			d.Status = DeliveryDead
+			d.Attempts = 8
+			_, err = s.PutDelivery(d)
+			Expect(err).ToNot(HaveOccurred())
+
+			ds, err := s.QueryDeliveries(DeliveryQuery{WebhookID: 1})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ds).To(HaveLen(2))
+			Expect(ds[0].ID).To(Equal(int64(3)))
+			Expect(ds[0].Attempts).To(Equal(8))
+
+			ds, err = s.QueryDeliveries(DeliveryQuery{Status: DeliveryDead, Limit: 1})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ds).To(HaveLen(1))
+			Expect(ds[0].ID).To(Equal(int64(3)))
+
+			_, err = s.QueryDeliveries(DeliveryQuery{Status: "lost"})
+			Expect(err).To(Equal(ErrInvalidDeliveryStatus))
+			_, err = s.GetDelivery(4)
+			Expect(err).To(Equal(ErrDeliveryNotFound))
+		})
+	})
+
+	Context("Appeals", func() {
+		now := time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)
+
+		BeforeEach(func() {
+			for _, p := range []Punishment{
+				{ID: 1, PlayerID: "some_user", By: "some_admin", Type: TypeBan, Date: now.Add(-time.Hour)},
+				{ID: 2, PlayerID: "some_user", By: "some_admin", Type: TypeVoiceMute, Date: now.Add(-time.Hour), Expires: now.Add(48 * time.Hour)},
+				{ID: 3, PlayerID: "some_user", By: "some_admin", Type: TypeChatGag, Date: now.Add(-time.Hour), Expires: now.Add(-time.Minute)},
+			} {
+				_, err := s.ImportPunishment(p)
+				Expect(err).ToNot(HaveOccurred())
+			}
+		})
+
+		It("files appeals against punishments in force, one open appeal at a time", func() {
+			a, err := s.FileAppeal(1, AppealEvent{Date: now, Comment: "I was not cheating."})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(a.ID).ToNot(BeZero())
+			Expect(a.PlayerID).To(Equal("some_user"))
+			Expect(a.Status).To(Equal(AppealOpen))
+			Expect(a.History).To(HaveLen(1))
+			Expect(a.History[0].Action).To(Equal(AppealSubmit))
+			Expect(a.History[0].By).To(Equal("some_user"))
+
+			got, err := s.GetAppeal(a.ID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(got.History[0].Comment).To(Equal("I was not cheating."))
+
+			_, err = s.FileAppeal(1, AppealEvent{Date: now, Comment: "Please."})
+			Expect(err).To(Equal(ErrAppealExists))
+			_, err = s.FileAppeal(3, AppealEvent{Date: now, Comment: "I was not spamming."})
+			Expect(err).To(Equal(ErrPunishmentNotActive))
+			_, err = s.FileAppeal(4, AppealEvent{Date: now, Comment: "Who banned me?"})
+			Expect(err).To(Equal(ErrPunishmentNotFound))
+			_, err = s.FileAppeal(2, AppealEvent{Date: now})
+			Expect(err).To(BeAssignableToTypeOf(&ValidationError{}))
+			_, err = s.GetAppeal(a.ID + 1)
+			Expect(err).To(Equal(ErrAppealNotFound))
+		})
+
+		It("lifts or shortens the punishment when an appeal is accepted, and records every change", func() {
+			a, err := s.FileAppeal(1, AppealEvent{Date: now, Comment: "I was not cheating."})
+			Expect(err).ToNot(HaveOccurred())
+
+			a, _, err = s.RecordAppealEvent(a.ID, AppealEvent{Action: AppealComment, By: "some_admin", Date: now.Add(time.Minute), Comment: "Checking the demo."})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(a.Status).To(Equal(AppealOpen))
+
+			a, p, err := s.RecordAppealEvent(a.ID, AppealEvent{Action: AppealAccept, By: "some_admin", Date: now.Add(2 * time.Minute)})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(a.Status).To(Equal(AppealAccepted))
+			Expect(a.History).To(HaveLen(3))
+			Expect(a.History[2].Expires).To(BeTemporally("==", now.Add(2*time.Minute)))
+			Expect(a.History[2].PreviousExpires.IsZero()).To(BeTrue())
+			Expect(p.Expires).To(BeTemporally("==", now.Add(2*time.Minute)))
+
+			p, err = s.GetPunishment(1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Expires).To(BeTemporally("==", now.Add(2*time.Minute)))
+
+			_, _, err = s.RecordAppealEvent(a.ID, AppealEvent{Action: AppealReject, By: "some_admin", Date: now.Add(3 * time.Minute)})
+			Expect(err).To(Equal(ErrAppealDecided))
+
+			a, err = s.FileAppeal(2, AppealEvent{Date: now, Comment: "It was a joke."})
+			Expect(err).ToNot(HaveOccurred())
+			_, _, err = s.RecordAppealEvent(a.ID, AppealEvent{Action: AppealAccept, By: "some_admin", Date: now, Expires: now.Add(72 * time.Hour)})
+			Expect(err).To(BeAssignableToTypeOf(&ValidationError{}))
+
+			a, p, err = s.RecordAppealEvent(a.ID, AppealEvent{Action: AppealAccept, By: "some_admin", Date: now, Expires: now.Add(24 * time.Hour)})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(a.History).To(HaveLen(2))
+			Expect(a.History[1].PreviousExpires).To(BeTemporally("==", now.Add(48*time.Hour)))
+
+			ps, err := s.GetPunishments("some_user")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ps[TypeVoiceMute].Expires).To(BeTemporally("==", now.Add(24*time.Hour)))
+		})
+
+		It("leaves the punishment alone when an appeal is rejected, and lists appeals by status", func() {
+			a1, err := s.FileAppeal(1, AppealEvent{Date: now, Comment: "I was not cheating."})
+			Expect(err).ToNot(HaveOccurred())
+			a2, err := s.FileAppeal(2, AppealEvent{Date: now, Comment: "It was a joke."})
+			Expect(err).ToNot(HaveOccurred())
+
+			_, p, err := s.RecordAppealEvent(a1.ID, AppealEvent{Action: AppealReject, By: "some_admin", Date: now, Comment: "The demo shows an aimbot."})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Expires.IsZero()).To(BeTrue())
+
+			as, err := s.QueryAppeals(AppealQuery{Status: AppealOpen})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(as).To(HaveLen(1))
+			Expect(as[0].ID).To(Equal(a2.ID))
+
+			as, err = s.QueryAppeals(AppealQuery{Status: AppealRejected})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(as).To(HaveLen(1))
+			Expect(as[0].ID).To(Equal(a1.ID))
+
+			as, err = s.QueryAppeals(AppealQuery{PlayerID: "some_user"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(as).To(HaveLen(2))
+			Expect(as[0].ID).To(Equal(a2.ID))
+
+			// A rejected appeal leaves the punishment open to a new one.
+			_, err = s.FileAppeal(1, AppealEvent{Date: now, Comment: "Here is a video."})
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = s.QueryAppeals(AppealQuery{Status: "lost"})
+			Expect(err).To(Equal(ErrInvalidAppealStatus))
+		})
+	})
+
+	Context("Bulk writes", func() {
+		var ops []BulkOp
+
+		BeforeEach(func() {
+			ops = []BulkOp{
+				{Profile: &Profile{ID: "user_a", Coins: 10}},
+				{Punishment: &Punishment{PlayerID: "user_a", By: "some_admin", Type: "ban", Date: time.Now()}},
+				{Profile: &Profile{ID: "user_b", Inventory: map[string]string{"hat": ""}}},
+			}
+		})
+
+		It("stores every write of an all-or-nothing request", func() {
+			Expect(s.PutItem(Item{Name: "hat", Slot: "head"})).To(Succeed())
+
+			results, err := s.BulkWrite(ops, true, "server_1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(results).To(HaveLen(3))
+			for _, r := range results {
+				Expect(r.Err).ToNot(HaveOccurred())
+			}
+			Expect(results[1].ID).ToNot(BeZero())
+
+			ps, err := s.GetProfiles([]string{"user_a", "user_b"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ps).To(HaveLen(2))
+			_, err = s.GetPunishment(results[1].ID)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("stores nothing when a write of an all-or-nothing request fails", func() {
+			results, err := s.BulkWrite(ops, true, "server_1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(results[0].Err).To(Equal(ErrBulkRolledBack))
+			Expect(results[1].Err).To(Equal(ErrBulkRolledBack))
+			Expect(results[2].Err).To(BeAssignableToTypeOf(&ValidationError{}))
+
+			ps, err := s.GetProfiles([]string{"user_a", "user_b"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ps).To(BeEmpty())
+			found, err := s.QueryPunishments(PunishmentQuery{PlayerID: "user_a"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeEmpty())
+		})
+
+		It("stores the writes that succeed in a best-effort request", func() {
+			ops = append(ops, BulkOp{})
+
+			results, err := s.BulkWrite(ops, false, "server_1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(results[0].Err).ToNot(HaveOccurred())
+			Expect(results[1].Err).ToNot(HaveOccurred())
+			Expect(results[2].Err).To(BeAssignableToTypeOf(&ValidationError{}))
+			Expect(results[3].Err).To(BeAssignableToTypeOf(&ValidationError{}))
+
+			ps, err := s.GetProfiles([]string{"user_a", "user_b"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ps).To(HaveKey("user_a"))
+			Expect(ps).ToNot(HaveKey("user_b"))
+		})
 	})
 
 	Context("Punishments", func() {
 		var testPunishment Punishment
 		BeforeEach(func() {
 			testPunishment = Punishment{
-				ID:       1234,
 				PlayerID: "some_user",
 				By:       "some_admin",
 				Type:     "ban",
@@ -73,7 +817,20 @@ var _ = Describe("Bolt", func() {
 		Context("When storing a punishment", func() {
 			Context("and all required fields are present", func() {
 				It("succeeds", func() {
-					Expect(s.PutPunishment(testPunishment)).Should(Succeed())
+					_, err := s.PutPunishment(testPunishment)
+					Expect(err).ToNot(HaveOccurred())
+				})
+			})
+
+			Context("that already has an ID", func() {
+				It("fails, as the store gives it one", func() {
+					testPunishment.ID = 1234
+					_, err := s.PutPunishment(testPunishment)
+					Expect(err).To(BeAssignableToTypeOf(&ValidationError{}))
+
+					results, err := s.BulkWrite([]BulkOp{{Punishment: &testPunishment}}, false, "some_admin")
+					Expect(err).ToNot(HaveOccurred())
+					Expect(results[0].Err).To(BeAssignableToTypeOf(&ValidationError{}))
 				})
 			})
 
@@ -95,7 +852,8 @@ var _ = Describe("Bolt", func() {
 					}
 
 					for _, v := range incompletePunishments {
-						Expect(s.PutPunishment(v)).ToNot(Succeed())
+						_, err := s.PutPunishment(v)
+						Expect(err).To(HaveOccurred())
 					}
 				})
 			})
@@ -104,7 +862,9 @@ var _ = Describe("Bolt", func() {
 		Context("When retrieving punishments", func() {
 			Context("and that player has punishments", func() {
 				BeforeEach(func() {
-					Expect(s.PutPunishment(testPunishment)).To(Succeed())
+					var err error
+					testPunishment, err = s.PutPunishment(testPunishment)
+					Expect(err).ToNot(HaveOccurred())
 				})
 
 				It("succeeds", func() {
@@ -122,10 +882,147 @@ var _ = Describe("Bolt", func() {
 			})
 		})
 
+		Context("When iterating over punishments", func() {
+			BeforeEach(func() {
+				var err error
+				testPunishment, err = s.PutPunishment(testPunishment)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("visits each one", func() {
+				var ids []int64
+				Expect(s.EachPunishment(func(p Punishment) error {
+					ids = append(ids, p.ID)
+					return nil
+				})).To(Succeed())
+				Expect(ids).To(ConsistOf(testPunishment.ID))
+			})
+		})
+
+		Context("When querying punishments", func() {
+			var now time.Time
+
+			BeforeEach(func() {
+				now = time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+				Expect(s.PutPunishmentType(PunishmentType{Name: "mute", Scope: ScopeGlobal})).To(Succeed())
+				for _, p := range []Punishment{
+					{ID: 1, PlayerID: "player_a", By: "admin_x", Type: "ban", Reason: "Cheating with an aimbot", Date: now.Add(-72 * time.Hour), Expires: now.Add(-24 * time.Hour)},
+					{ID: 2, PlayerID: "player_b", By: "admin_x", Type: "mute", Reason: "Mic spam", Date: now.Add(-48 * time.Hour), Expires: now.Add(24 * time.Hour)},
+					{ID: 3, PlayerID: "player_a", By: "admin_y", Type: "mute", Reason: "Slurs", Date: now.Add(-24 * time.Hour)},
+					{ID: 4, PlayerID: "player_c", By: "admin_x", Type: "ban", Reason: "AIMBOT", Date: now.Add(-1 * time.Hour), Expires: now.Add(time.Hour)},
+				} {
+					_, err := s.ImportPunishment(p)
+					Expect(err).ToNot(HaveOccurred())
+				}
+			})
+
+			query := func(q PunishmentQuery) []int64 {
+				q.Now = now
+				ps, err := s.QueryPunishments(q)
+				Expect(err).ToNot(HaveOccurred())
+
+				ids := []int64{}
+				for _, p := range ps {
+					ids = append(ids, p.ID)
+				}
+				return ids
+			}
+
+			It("filters by issuer, newest first", func() {
+				Expect(query(PunishmentQuery{By: "admin_x"})).To(Equal([]int64{4, 2, 1}))
+			})
+
+			It("filters by type and status", func() {
+				Expect(query(PunishmentQuery{Type: "mute", Status: StatusActive})).To(Equal([]int64{3, 2}))
+				Expect(query(PunishmentQuery{Status: StatusExpired})).To(Equal([]int64{1}))
+			})
+
+			It("filters by date range", func() {
+				Expect(query(PunishmentQuery{Since: now.Add(-48 * time.Hour), Until: now.Add(-2 * time.Hour)})).To(Equal([]int64{3, 2}))
+			})
+
+			It("searches the reason ignoring case", func() {
+				Expect(query(PunishmentQuery{Reason: "aimbot"})).To(Equal([]int64{4, 1}))
+			})
+
+			It("limits the number of results", func() {
+				Expect(query(PunishmentQuery{Limit: 2})).To(Equal([]int64{4, 3}))
+			})
+
+			It("keeps punishments that were replaced by a newer one of the same type", func() {
+				newer, err := s.PutPunishment(Punishment{PlayerID: "player_a", By: "admin_y", Type: "ban", Date: now, Expires: now.Add(time.Hour)})
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(query(PunishmentQuery{PlayerID: "player_a", Type: "ban"})).To(Equal([]int64{newer.ID, 1}))
+
+				ps, err := s.GetPunishments("player_a")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ps["ban"].ID).To(Equal(newer.ID))
+			})
+
+			It("rejects an unknown status", func() {
+				_, err := s.QueryPunishments(PunishmentQuery{Status: "pending"})
+				Expect(err).To(Equal(ErrInvalidStatus))
+			})
+		})
+
+		Context("When retrieving a punishment by ID", func() {
+			BeforeEach(func() {
+				var err error
+				testPunishment, err = s.PutPunishment(testPunishment)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("succeeds if it exists", func() {
+				p, err := s.GetPunishment(testPunishment.ID)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(p.Reason).To(Equal(testPunishment.Reason))
+			})
+
+			It("fails if it does not", func() {
+				_, err := s.GetPunishment(9001)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		Context("When importing a punishment", func() {
+			BeforeEach(func() {
+				testPunishment.ID = 1234
+				_, err := s.ImportPunishment(testPunishment)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("keeps its ID", func() {
+				p, err := s.GetPunishment(1234)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(p.Reason).To(Equal(testPunishment.Reason))
+			})
+
+			It("fails if the ID is taken", func() {
+				testPunishment.Reason = "another reason"
+				_, err := s.ImportPunishment(testPunishment)
+				Expect(err).To(Equal(ErrPunishmentExists))
+
+				p, err := s.GetPunishment(1234)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(p.Reason).To(Equal("reason goes here"))
+			})
+
+			It("gives later punishments IDs past the imported ones", func() {
+				testPunishment.ID = 0
+				testPunishment.Type = TypeVoiceMute
+				p, err := s.PutPunishment(testPunishment)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(p.ID).To(BeNumerically(">", 1234))
+			})
+		})
+
 		Context("When deleting a punishment", func() {
 			Context("that exists", func() {
 				BeforeEach(func() {
-					Expect(s.PutPunishment(testPunishment)).To(Succeed())
+					var err error
+					testPunishment, err = s.PutPunishment(testPunishment)
+					Expect(err).ToNot(HaveOccurred())
 				})
 
 				It("succeeds", func() {
@@ -138,10 +1035,62 @@ var _ = Describe("Bolt", func() {
 
 			Context("that does not exist", func() {
 				It("fails", func() {
-					Expect(s.DelPunishment(9001)).ToNot(Succeed())
+					Expect(s.DelPunishment(9001)).To(Equal(ErrPunishmentNotFound))
 				})
 			})
 		})
 	})
 
+	Context("When opening a database written by an older version", func() {
+		BeforeEach(func() {
+			s.db.Close()
+			os.Remove(file)
+
+			db, err := bolt.Open(file, 0600, nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			legacy, err := json.Marshal(map[string]Punishment{
+				"ban":  {PlayerID: "some_user", By: "some_admin", Type: "ban"},
+				"mute": {PlayerID: "some_user", By: "some_admin", Type: "mute"},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(db.Update(func(tx *bolt.Tx) error {
+				_, err := tx.CreateBucket([]byte("profiles"))
+				if err != nil {
+					return err
+				}
+				b, err := tx.CreateBucket([]byte("punishments"))
+				if err != nil {
+					return err
+				}
+				return b.Put([]byte("some_user"), legacy)
+			})).To(Succeed())
+			Expect(db.Close()).To(Succeed())
+
+			s, err = NewBoltStore(file)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("gives every punishment its own ID and indexes it", func() {
+			ps, err := s.GetPunishments("some_user")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ps["ban"].ID).ToNot(BeZero())
+			Expect(ps["mute"].ID).ToNot(BeZero())
+			Expect(ps["ban"].ID).ToNot(Equal(ps["mute"].ID))
+
+			found, err := s.QueryPunishments(PunishmentQuery{By: "some_admin"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(HaveLen(2))
+
+			Expect(s.DelPunishment(ps["ban"].ID)).To(Succeed())
+		})
+
+		It("registers the punishment types already in use", func() {
+			t, err := s.GetPunishmentType("mute")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(t).To(Equal(PunishmentType{Name: "mute", Scope: ScopeGlobal}))
+		})
+	})
+
 })
@@ -0,0 +1,152 @@
+package profile
+
+import (
+	"encoding/json"
+
+	"github.com/boltdb/bolt"
+)
+
+// Webhooks and deliveries are stored under their ID.
+var (
+	webhooksBucket   = []byte("webhooks")
+	deliveriesBucket = []byte("webhook_deliveries")
+)
+
+// GetWebhooks returns every webhook, ordered by ID.
+func (s *BoltStore) GetWebhooks() ([]Webhook, error) {
+	hooks := []Webhook{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(webhooksBucket).ForEach(func(k, v []byte) error {
+			var w Webhook
+			err := json.Unmarshal(v, &w)
+			hooks = append(hooks, w)
+			return err
+		})
+	})
+
+	return hooks, err
+}
+
+// GetWebhook returns the webhook with the given ID.
+func (s *BoltStore) GetWebhook(id int64) (Webhook, error) {
+	var w Webhook
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(webhooksBucket).Get(idKey(id))
+		if v == nil {
+			return ErrWebhookNotFound
+		}
+		return json.Unmarshal(v, &w)
+	})
+
+	return w, err
+}
+
+// PutWebhook creates or replaces a webhook. Replacing one that does not exist returns ErrWebhookNotFound.
+func (s *BoltStore) PutWebhook(w Webhook) (Webhook, error) {
+	err := w.Validate()
+	if err != nil {
+		return w, err
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(webhooksBucket)
+
+		if w.ID == 0 {
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			w.ID = int64(seq)
+		} else if b.Get(idKey(w.ID)) == nil {
+			return ErrWebhookNotFound
+		}
+
+		j, err := json.Marshal(w)
+		if err != nil {
+			return err
+		}
+		return b.Put(idKey(w.ID), j)
+	})
+
+	return w, err
+}
+
+// DelWebhook removes a webhook. Its deliveries are kept in the log.
+func (s *BoltStore) DelWebhook(id int64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(webhooksBucket)
+		if b.Get(idKey(id)) == nil {
+			return ErrWebhookNotFound
+		}
+		return b.Delete(idKey(id))
+	})
+}
+
+// GetDelivery returns the delivery with the given ID.
+func (s *BoltStore) GetDelivery(id int64) (Delivery, error) {
+	var d Delivery
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(deliveriesBucket).Get(idKey(id))
+		if v == nil {
+			return ErrDeliveryNotFound
+		}
+		return json.Unmarshal(v, &d)
+	})
+
+	return d, err
+}
+
+// PutDelivery creates or updates a delivery.
+func (s *BoltStore) PutDelivery(d Delivery) (Delivery, error) {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(deliveriesBucket)
+
+		if d.ID == 0 {
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			d.ID = int64(seq)
+		}
+
+		j, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		return b.Put(idKey(d.ID), j)
+	})
+
+	return d, err
+}
+
+// QueryDeliveries walks the deliveries from the newest until q.Limit of them match.
+func (s *BoltStore) QueryDeliveries(q DeliveryQuery) ([]Delivery, error) {
+	ds := []Delivery{}
+
+	err := q.normalize()
+	if err != nil {
+		return ds, err
+	}
+
+	err = s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(deliveriesBucket).Cursor()
+
+		for k, v := c.Last(); k != nil && len(ds) < q.Limit; k, v = c.Prev() {
+			var d Delivery
+			err := json.Unmarshal(v, &d)
+			if err != nil {
+				return err
+			}
+			if q.matches(d) {
+				ds = append(ds, d)
+			}
+		}
+
+		return nil
+	})
+
+	return ds, err
+}
@@ -0,0 +1,62 @@
+package profile
+
+import "errors"
+
+// ErrBulkRolledBack is reported for the writes of an all-or-nothing request that were not stored
+// because another write of the request failed.
+var ErrBulkRolledBack = errors.New("Not stored because another write in the request failed.")
+
+// BulkOp is a single write of a bulk request. Exactly one of Profile and Punishment is set.
+type BulkOp struct {
+	Profile    *Profile    `json:",omitempty"`
+	Punishment *Punishment `json:",omitempty"`
+}
+
+// Validate checks the parts of a write that do not depend on the stored data.
+func (op BulkOp) Validate() error {
+	switch {
+	case (op.Profile == nil) == (op.Punishment == nil):
+		return &ValidationError{Problems: []string{"Each write needs exactly one of Profile and Punishment."}}
+	case op.Profile != nil && op.Profile.ID == "":
+		return &ValidationError{Problems: []string{"Profiles need an ID."}}
+	case op.Punishment != nil && (op.Punishment.PlayerID == "" || op.Punishment.By == "" || op.Punishment.Type == ""):
+		return &ValidationError{Problems: []string{"PlayerID, By, and Type are required fields."}}
+	}
+	return nil
+}
+
+// BulkResult is the outcome of a single write. Err is nil if it was stored.
+// ID is the ID of a stored punishment, and Punishment the punishment as it was stored. Escalation says how an
+// EscalatingStore escalated the punishment, if it did.
+type BulkResult struct {
+	Err        error
+	ID         int64
+	Punishment *Punishment
+	Escalation *Escalation
+}
+
+// stored fills in the result of a write that was stored.
+func (r *BulkResult) stored(p *Punishment) {
+	r.Punishment = p
+	if p != nil {
+		r.ID = p.ID
+	}
+}
+
+// BulkStorer defines the behavior of a store that writes many records in one request.
+type BulkStorer interface {
+	// BulkWrite stores profiles and punishments in order, recording by as the caller in profile histories.
+	// When atomic is true, they are written in a single transaction and nothing is stored unless every write succeeds.
+	// Otherwise every write stands on its own. The results say what happened to each write; the error is only set
+	// when the request as a whole failed.
+	BulkWrite(ops []BulkOp, atomic bool, by string) ([]BulkResult, error)
+}
+
+// rollBack marks every write of an all-or-nothing request as not stored, except the one that failed.
+func rollBack(results []BulkResult, failed int) {
+	for i := range results {
+		if i != failed {
+			results[i] = BulkResult{Err: ErrBulkRolledBack}
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Kinds of values an item setting can hold.
+const (
+	SettingString = "string"
+	SettingNumber = "number"
+	SettingBool   = "bool"
+)
+
+// Errors returned by the item catalog.
+var (
+	ErrItemNotFound = errors.New("Item not found.")
+	ErrItemInUse    = errors.New("Item is still owned by some players.")
+)
+
+// Item is an entry of the item catalog. Only catalog items can be held in a Profile's Inventory.
+type Item struct {
+	Name string
+	// Slot is the Equipment slot the item is worn in, or empty if it cannot be equipped.
+	Slot     string
+	Price    int64
+	Tradable bool
+	// Settings maps the name of each setting the item accepts to its kind (SettingString, SettingNumber or SettingBool).
+	// In an Inventory, an item's settings are a JSON object holding some of these, or an empty string.
+	Settings map[string]string
+}
+
+// ItemStorer defines the behavior of an item catalog.
+type ItemStorer interface {
+	GetItem(name string) (Item, error)
+	GetItems() ([]Item, error)
+	PutItem(Item) error
+	// DelItem fails with ErrItemInUse while any profile still has the item in its Inventory.
+	DelItem(name string) error
+}
+
+// ValidationError lists everything wrong with a record that was rejected by a store.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "Validation failed: " + strings.Join(e.Problems, " ")
+}
+
+// Validate checks that an item can be stored in the catalog.
+func (it Item) Validate() error {
+	var problems []string
+
+	if it.Name == "" {
+		problems = append(problems, "Items need a name.")
+	}
+	if it.Price < 0 {
+		problems = append(problems, "Prices cannot be negative.")
+	}
+	for _, name := range sortedKeys(it.Settings) {
+		switch it.Settings[name] {
+		case SettingString, SettingNumber, SettingBool:
+		default:
+			problems = append(problems, fmt.Sprintf("Setting %q has unknown kind %q.", name, it.Settings[name]))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// ValidateSettings checks an inventory settings string against the item's settings schema.
+func (it Item) ValidateSettings(settings string) error {
+	if settings == "" {
+		return nil
+	}
+
+	var values map[string]interface{}
+	err := json.Unmarshal([]byte(settings), &values)
+	if err != nil {
+		return fmt.Errorf("Settings of %q must be a JSON object.", it.Name)
+	}
+
+	for _, name := range sortedKeys(values) {
+		kind, ok := it.Settings[name]
+		if !ok {
+			return fmt.Errorf("Item %q has no setting %q.", it.Name, name)
+		}
+
+		switch values[name].(type) {
+		case string:
+			ok = kind == SettingString
+		case float64:
+			ok = kind == SettingNumber
+		case bool:
+			ok = kind == SettingBool
+		default:
+			ok = false
+		}
+		if !ok {
+			return fmt.Errorf("Setting %q of item %q must be a %s.", name, it.Name, kind)
+		}
+	}
+
+	return nil
+}
+
+// ValidateProfile checks a Profile against the item catalog: every inventory item must exist and have valid settings,
+// and every equipped item must be owned and fit the slot it is equipped in. lookup returns false for unknown items.
+// old is the stored profile that p replaces, or nil for a new one. Only the inventory entries and slots that p changes
+// are checked, so that profiles stored before the catalog, or before an item changed, can still be written.
+func ValidateProfile(old *Profile, p Profile, lookup func(name string) (Item, bool)) error {
+	var problems []string
+
+	if p.ID == "" {
+		problems = append(problems, "Profiles need an ID.")
+	}
+
+	for _, name := range changedItems(old, p) {
+		settings, owned := p.Inventory[name]
+		if !owned {
+			continue
+		}
+
+		it, ok := lookup(name)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("Item %q is not in the catalog.", name))
+			continue
+		}
+
+		err := it.ValidateSettings(settings)
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	for _, slot := range sortedKeys(p.Equipment) {
+		name := p.Equipment[slot]
+		if name == "" {
+			continue
+		}
+		// An item equipped before is checked again only when it was taken out of the inventory.
+		if old != nil && old.Equipment[slot] == name {
+			if _, owned := p.Inventory[name]; owned {
+				continue
+			}
+			if _, owned := old.Inventory[name]; !owned {
+				continue
+			}
+		}
+
+		if _, owned := p.Inventory[name]; !owned {
+			problems = append(problems, fmt.Sprintf("Item %q is equipped but not owned.", name))
+			continue
+		}
+
+		it, ok := lookup(name)
+		if ok && it.Slot != slot {
+			problems = append(problems, fmt.Sprintf("Item %q cannot be equipped in slot %q.", name, slot))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// changedItems returns the names of the inventory entries that p adds, changes or removes since old, in order.
+func changedItems(old *Profile, p Profile) []string {
+	if old == nil {
+		return sortedKeys(p.Inventory)
+	}
+
+	changed := map[string]string{}
+	for name, settings := range p.Inventory {
+		if prev, ok := old.Inventory[name]; !ok || prev != settings {
+			changed[name] = settings
+		}
+	}
+	for name := range old.Inventory {
+		if _, ok := p.Inventory[name]; !ok {
+			changed[name] = ""
+		}
+	}
+	return sortedKeys(changed)
+}
+
+// itemLookup adapts a catalog held in memory for ValidateProfile.
+func itemLookup(items map[string]Item) func(string) (Item, bool) {
+	return func(name string) (Item, bool) {
+		it, ok := items[name]
+		return it, ok
+	}
+}
+
+// sortedKeys returns the keys of a map with string keys in order, so problems are reported deterministically.
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]string:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]interface{}:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
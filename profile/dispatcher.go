@@ -0,0 +1,248 @@
+package profile
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Defaults used by NewDispatcher.
+const (
+	DefaultWebhookAttempts = 8
+	DefaultWebhookBackoff  = time.Second
+	DefaultWebhookTimeout  = 10 * time.Second
+)
+
+// Headers sent with every webhook request.
+const (
+	SignatureHeader = "X-Gameprofile-Signature"
+	TimestampHeader = "X-Gameprofile-Timestamp"
+	EventHeader     = "X-Gameprofile-Event"
+	DeliveryHeader  = "X-Gameprofile-Delivery"
+)
+
+// Sign returns the signature of a webhook request: the hex HMAC-SHA256 of the timestamp, a dot and the body,
+// keyed with the webhook's secret, prefixed with "sha256=". Receivers compute it to check the SignatureHeader.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher sends the events of a Bus to the webhooks that want them, recording every delivery.
+// Failed deliveries are retried with exponential backoff, and dead-lettered after MaxAttempts.
+type Dispatcher struct {
+	// MaxAttempts is the number of times a delivery is tried.
+	MaxAttempts int
+	// Backoff is the wait before the first retry. It doubles after every failed attempt.
+	Backoff time.Duration
+	Client  *http.Client
+
+	store WebhookStorer
+	bus   *Bus
+	sub   *Subscription
+
+	mu   sync.Mutex
+	stop <-chan struct{}
+}
+
+// NewDispatcher returns a Dispatcher that reads webhooks from store and events from bus.
+// It subscribes to bus straight away, so that events published before Run are not missed.
+func NewDispatcher(store WebhookStorer, bus *Bus) *Dispatcher {
+	return &Dispatcher{
+		MaxAttempts: DefaultWebhookAttempts,
+		Backoff:     DefaultWebhookBackoff,
+		Client:      &http.Client{Timeout: DefaultWebhookTimeout},
+		store:       store,
+		bus:         bus,
+		sub:         bus.Subscribe(EventFilter{}, 0),
+	}
+}
+
+// Run dispatches events until stop is closed. Pending deliveries left by an earlier run are resumed first.
+func (d *Dispatcher) Run(stop <-chan struct{}) {
+	d.mu.Lock()
+	d.stop = stop
+	d.mu.Unlock()
+
+	pending, err := d.store.QueryDeliveries(DeliveryQuery{Status: DeliveryPending, Limit: MaxQueryLimit})
+	if err != nil {
+		log.Printf("webhooks: %v", err)
+	}
+	for _, del := range pending {
+		go d.deliver(del, stop)
+	}
+
+	var last int64
+	sub := d.sub
+	defer func() { sub.Close() }()
+
+	for {
+		select {
+		case <-stop:
+			return
+
+		case e, ok := <-sub.C:
+			if !ok {
+				// Dispatching fell behind the store. Catch up from the backlog.
+				sub = d.bus.Subscribe(EventFilter{}, last)
+				if sub.Gap {
+					log.Printf("webhooks: events after %d were missed", last)
+				}
+				continue
+			}
+			last = e.ID
+			d.dispatch(e, stop)
+		}
+	}
+}
+
+// dispatch records a delivery of e for every webhook that wants it, and starts sending them.
+func (d *Dispatcher) dispatch(e Event, stop <-chan struct{}) {
+	hooks, err := d.store.GetWebhooks()
+	if err != nil {
+		log.Printf("webhooks: %v", err)
+		return
+	}
+
+	now := time.Now().UTC()
+	for _, w := range hooks {
+		if !w.Wants(e) {
+			continue
+		}
+
+		del, err := d.store.PutDelivery(Delivery{
+			WebhookID:   w.ID,
+			Event:       e,
+			Status:      DeliveryPending,
+			NextAttempt: now,
+			Created:     now,
+			Updated:     now,
+		})
+		if err != nil {
+			log.Printf("webhooks: %v", err)
+			continue
+		}
+		go d.deliver(del, stop)
+	}
+}
+
+// Redeliver sends a delivery again from its first attempt, such as one taken from the dead-letter list.
+// If the dispatcher is not running, the delivery is left pending for the next Run.
+func (d *Dispatcher) Redeliver(id int64) (Delivery, error) {
+	del, err := d.store.GetDelivery(id)
+	if err != nil {
+		return del, err
+	}
+
+	now := time.Now().UTC()
+	del.Status = DeliveryPending
+	del.Attempts = 0
+	del.NextAttempt = now
+	del.Updated = now
+	del, err = d.store.PutDelivery(del)
+	if err != nil {
+		return del, err
+	}
+
+	d.mu.Lock()
+	stop := d.stop
+	d.mu.Unlock()
+	if stop != nil {
+		go d.deliver(del, stop)
+	}
+	return del, nil
+}
+
+// deliver attempts a delivery until it succeeds, runs out of attempts or stop is closed.
+func (d *Dispatcher) deliver(del Delivery, stop <-chan struct{}) {
+	for del.Status == DeliveryPending {
+		if wait := time.Until(del.NextAttempt); wait > 0 {
+			t := time.NewTimer(wait)
+			select {
+			case <-stop:
+				t.Stop()
+				return
+			case <-t.C:
+			}
+		}
+
+		d.attempt(&del, time.Now().UTC())
+
+		_, err := d.store.PutDelivery(del)
+		if err != nil {
+			log.Printf("webhooks: %v", err)
+			return
+		}
+	}
+}
+
+// attempt sends a delivery once and updates its status.
+func (d *Dispatcher) attempt(del *Delivery, now time.Time) {
+	del.Attempts++
+	del.Updated = now
+
+	w, err := d.store.GetWebhook(del.WebhookID)
+	if err == ErrWebhookNotFound {
+		del.Status = DeliveryDead
+		del.LastError = "The webhook was deleted."
+		return
+	}
+	if err == nil {
+		del.LastStatusCode, err = d.send(w, *del, now)
+	}
+
+	if err == nil {
+		del.Status = DeliveryDelivered
+		del.LastError = ""
+		return
+	}
+
+	del.LastError = err.Error()
+	if del.Attempts >= d.MaxAttempts {
+		del.Status = DeliveryDead
+		return
+	}
+	del.NextAttempt = now.Add(d.Backoff << uint(del.Attempts-1))
+}
+
+// send POSTs the delivery's event to the webhook. Any status other than 2xx is an error.
+func (d *Dispatcher) send(w Webhook, del Delivery, now time.Time) (int, error) {
+	body, err := json.Marshal(del.Event)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, del.Event.Type)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(del.ID, 10))
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(w.Secret, timestamp, body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("The receiver answered %s.", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
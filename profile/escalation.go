@@ -0,0 +1,347 @@
+package profile
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EscalationRule raises the punishments of a type that are issued to players with a record. It fires when the
+// player has at least Count earlier punishments of the Counted types, and turns the punishment into one of type
+// EscalateTo, lasting Duration.
+type EscalationRule struct {
+	// Name identifies the rule in the answers of the service.
+	Name string
+	// Type is the type of the issued punishments the rule applies to.
+	Type string
+	// Counted lists the types of the earlier punishments that are counted. It defaults to Type.
+	Counted []string `json:",omitempty"`
+	Count   int
+	// Within limits the count to the punishments given in that long before the issued one, eg. "720h".
+	// Without it, every earlier punishment is counted.
+	Within string `json:",omitempty"`
+	// EscalateTo is the type the punishment is given with instead. It defaults to Type.
+	EscalateTo string `json:",omitempty"`
+	// Duration is how long the escalated punishment lasts, eg. "168h". Without it, the punishment gets the default
+	// duration of its type, which is forever for bans.
+	Duration string `json:",omitempty"`
+}
+
+// EscalationPolicy is an ordered list of escalation rules. The first rule that fires is applied, so rules for
+// longer records come before the ones for shorter records.
+type EscalationPolicy struct {
+	Rules []EscalationRule
+}
+
+// Escalation says how a punishment was escalated.
+type Escalation struct {
+	// Rule is the Name of the rule that fired.
+	Rule string
+	// From is the type the punishment was issued with.
+	From string
+	// Prior is the number of earlier punishments the rule counted.
+	Prior int
+}
+
+// Validate checks that the rules of a policy can be applied.
+func (pol EscalationPolicy) Validate() error {
+	var problems []string
+	names := map[string]bool{}
+
+	for i, r := range pol.Rules {
+		at := fmt.Sprintf("Rule %d", i+1)
+		if r.Name != "" {
+			at = fmt.Sprintf("Rule %q", r.Name)
+		}
+
+		switch {
+		case r.Name == "":
+			problems = append(problems, at+" needs a Name.")
+		case names[r.Name]:
+			problems = append(problems, at+" is defined more than once.")
+		}
+		names[r.Name] = true
+
+		for _, t := range append([]string{r.Type}, r.Counted...) {
+			if !punishmentTypeName.MatchString(t) {
+				problems = append(problems, fmt.Sprintf("%s names punishment type %q, which is not a valid name.", at, t))
+			}
+		}
+		if r.EscalateTo != "" && !punishmentTypeName.MatchString(r.EscalateTo) {
+			problems = append(problems, fmt.Sprintf("%s escalates to punishment type %q, which is not a valid name.", at, r.EscalateTo))
+		}
+
+		if r.Count < 1 {
+			problems = append(problems, at+" needs a Count of at least 1.")
+		}
+
+		for _, f := range []struct{ name, value string }{{"Within", r.Within}, {"Duration", r.Duration}} {
+			if f.value == "" {
+				continue
+			}
+			if d, err := time.ParseDuration(f.value); err != nil || d <= 0 {
+				problems = append(problems, fmt.Sprintf("%s has a %s of %q, which is not a positive duration, such as 72h.", at, f.name, f.value))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// Escalate applies the first rule of the policy that fires for the issued punishment p, given the player's
+// earlier punishments. It returns p unchanged and a nil Escalation when no rule fires.
+// The escalated punishment starts at its Date, or at now when it has none. Its GameMode and Server are fitted to the
+// scope of the type it escalates to, which types looks up.
+func (pol EscalationPolicy) Escalate(p Punishment, history []Punishment, now time.Time, types func(name string) (PunishmentType, bool)) (Punishment, *Escalation) {
+	issued := strings.ToLower(strings.TrimSpace(p.Type))
+	start := p.Date
+	if start.IsZero() {
+		start = now
+	}
+
+	for _, r := range pol.Rules {
+		if r.Type != issued {
+			continue
+		}
+
+		prior := r.count(p, history, start)
+		if prior < r.Count {
+			continue
+		}
+
+		esc := &Escalation{Rule: r.Name, From: issued, Prior: prior}
+		p.Type = issued
+		if r.EscalateTo != "" {
+			p.Type = r.EscalateTo
+		}
+		p.Expires = time.Time{}
+		if d, _ := time.ParseDuration(r.Duration); d > 0 {
+			p.Expires = start.Add(d)
+		}
+		if t, ok := types(p.Type); ok {
+			p = scopeTo(p, t.Scope)
+		}
+		return p, esc
+	}
+
+	return p, nil
+}
+
+// scopeTo fits the place a punishment applies to a scope. Escalating to a type with a wider scope drops the GameMode
+// or Server the punishment was issued for. A narrower scope needs a place the punishment does not name, so it is left
+// for PreparePunishment to reject.
+func scopeTo(p Punishment, scope string) Punishment {
+	switch scope {
+	case ScopeGlobal:
+		p.GameMode, p.Server = "", ""
+	case ScopeGameMode:
+		p.Server = ""
+	case ScopeServer:
+		p.GameMode = ""
+	}
+	return p
+}
+
+// EscalatingStore wraps a Storer and escalates the punishments issued through it, whichever API they come from.
+// Imported punishments are stored as they are.
+type EscalatingStore struct {
+	Storer
+	policy  func() EscalationPolicy
+	players playerLocks
+}
+
+// NewEscalatingStore returns a Storer that escalates punishments by the policy that policy returns at the time.
+func NewEscalatingStore(s Storer, policy func() EscalationPolicy) *EscalatingStore {
+	return &EscalatingStore{Storer: s, policy: policy}
+}
+
+// Unwrap returns the wrapped Storer.
+func (s *EscalatingStore) Unwrap() Storer {
+	return s.Storer
+}
+
+// escalate applies the policy to a punishment that is about to be issued, by the player's stored record and the
+// punishments issued to them earlier in the same request. The caller holds the player's lock.
+func (s *EscalatingStore) escalate(p Punishment, issued []Punishment) (Punishment, *Escalation, error) {
+	pol := s.policy()
+	if len(pol.Rules) == 0 || p.PlayerID == "" {
+		return p, nil, nil
+	}
+
+	history, err := s.Storer.QueryPunishments(PunishmentQuery{PlayerID: p.PlayerID, Limit: MaxQueryLimit})
+	if err != nil {
+		return p, nil, err
+	}
+	history = append(history, issued...)
+
+	p, esc := pol.Escalate(p, history, time.Now(), func(name string) (PunishmentType, bool) {
+		t, err := s.Storer.GetPunishmentType(name)
+		return t, err == nil
+	})
+	return p, esc, nil
+}
+
+// PutPunishment escalates p before storing it.
+func (s *EscalatingStore) PutPunishment(p Punishment) (Punishment, error) {
+	defer s.players.lock([]string{p.PlayerID})()
+
+	p, _, err := s.escalate(p, nil)
+	if err != nil {
+		return p, err
+	}
+	return s.Storer.PutPunishment(p)
+}
+
+// BulkWrite escalates the punishments of the request before storing them, and reports the rules that fired in the
+// results. Punishments count toward the ones issued to the same player later in the request. Writes that stand on
+// their own are stored before a later punishment of the same player is escalated, as they may fail.
+func (s *EscalatingStore) BulkWrite(ops []BulkOp, atomic bool, by string) ([]BulkResult, error) {
+	var players []string
+	for _, op := range ops {
+		if op.Punishment != nil {
+			players = append(players, op.Punishment.PlayerID)
+		}
+	}
+	defer s.players.lock(players)()
+
+	results := make([]BulkResult, 0, len(ops))
+	var batch []BulkOp
+	var escs []*Escalation
+	issued := map[string][]Punishment{}
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		stored, err := s.Storer.BulkWrite(batch, atomic, by)
+		if err != nil {
+			return err
+		}
+		for i := range stored {
+			if stored[i].Err == nil {
+				stored[i].Escalation = escs[i]
+			}
+		}
+		results = append(results, stored...)
+		batch, escs, issued = nil, nil, map[string][]Punishment{}
+		return nil
+	}
+
+	for _, op := range ops {
+		var esc *Escalation
+		if op.Punishment != nil {
+			player := op.Punishment.PlayerID
+			if !atomic && len(issued[player]) > 0 {
+				err := flush()
+				if err != nil {
+					return results, err
+				}
+			}
+
+			p, e, err := s.escalate(*op.Punishment, issued[player])
+			if err != nil {
+				return results, err
+			}
+			op.Punishment, esc = &p, e
+
+			// Stores date punishments without a Date when they store them, which is about now.
+			dated := p
+			if dated.Date.IsZero() {
+				dated.Date = time.Now()
+			}
+			issued[player] = append(issued[player], dated)
+		}
+		batch = append(batch, op)
+		escs = append(escs, esc)
+	}
+
+	err := flush()
+	return results, err
+}
+
+// playerLocks serializes the punishments issued to each player through a store, so that every one of them is
+// escalated by a record that includes the ones issued before it. The zero value is ready to use.
+type playerLocks struct {
+	mu    sync.Mutex
+	locks map[string]*playerLock
+}
+
+// playerLock is the lock of a player, with the number of callers holding or waiting for it.
+type playerLock struct {
+	sync.Mutex
+	users int
+}
+
+// lock locks the given players and returns the function that unlocks them. The players are locked in order, so that
+// callers locking several of them cannot deadlock.
+func (l *playerLocks) lock(players []string) func() {
+	players = append([]string(nil), players...)
+	sort.Strings(players)
+
+	var held []string
+	for i, player := range players {
+		if i > 0 && player == players[i-1] {
+			continue
+		}
+
+		l.mu.Lock()
+		if l.locks == nil {
+			l.locks = map[string]*playerLock{}
+		}
+		pl := l.locks[player]
+		if pl == nil {
+			pl = &playerLock{}
+			l.locks[player] = pl
+		}
+		pl.users++
+		l.mu.Unlock()
+
+		pl.Lock()
+		held = append(held, player)
+	}
+
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for _, player := range held {
+			pl := l.locks[player]
+			pl.Unlock()
+			pl.users--
+			if pl.users == 0 {
+				delete(l.locks, player)
+			}
+		}
+	}
+}
+
+// count returns the number of punishments in history the rule counts toward escalating p, which starts at start.
+func (r EscalationRule) count(p Punishment, history []Punishment, start time.Time) int {
+	counted := r.Counted
+	if len(counted) == 0 {
+		counted = []string{r.Type}
+	}
+
+	var since time.Time
+	if d, _ := time.ParseDuration(r.Within); d > 0 {
+		since = start.Add(-d)
+	}
+
+	n := 0
+	for _, h := range history {
+		if h.PlayerID != p.PlayerID || h.Date.Before(since) || h.Date.After(start) {
+			continue
+		}
+		for _, t := range counted {
+			if h.Type == t {
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
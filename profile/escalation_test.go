@@ -0,0 +1,95 @@
+package profile
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Escalation policies", func() {
+	now := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	// Three warnings, then a day's ban, then a week's.
+	policy := EscalationPolicy{Rules: []EscalationRule{
+		{Name: "week_ban", Type: "warning", Counted: []string{"warning", TypeBan}, Count: 4, Within: "720h", EscalateTo: TypeBan, Duration: "168h"},
+		{Name: "day_ban", Type: "warning", Count: 3, Within: "720h", EscalateTo: TypeBan, Duration: "24h"},
+		{Name: "permanent_ban", Type: TypeBan, Count: 2},
+	}}
+
+	types := punishmentTypeLookup(map[string]PunishmentType{
+		TypeBan:     {Name: TypeBan, Scope: ScopeGlobal},
+		"warning":   {Name: "warning", Scope: ScopeServer},
+		"mode_mute": {Name: "mode_mute", Scope: ScopeGameMode},
+	})
+
+	history := func(types ...string) []Punishment {
+		var ps []Punishment
+		for i, t := range types {
+			ps = append(ps, Punishment{ID: int64(i + 1), PlayerID: "some_user", Type: t, Date: now.Add(-time.Duration(len(types)-i) * time.Hour)})
+		}
+		return ps
+	}
+
+	It("leaves punishments alone until a rule fires", func() {
+		p := Punishment{PlayerID: "some_user", By: "some_admin", Type: "Warning"}
+		out, esc := policy.Escalate(p, history("warning", "warning"), now, types)
+		Expect(esc).To(BeNil())
+		Expect(out).To(Equal(p))
+	})
+
+	It("applies the first rule that fires", func() {
+		p := Punishment{PlayerID: "some_user", By: "some_admin", Type: "warning", Date: now}
+		out, esc := policy.Escalate(p, history("warning", "warning", "warning"), now, types)
+		Expect(esc).To(Equal(&Escalation{Rule: "day_ban", From: "warning", Prior: 3}))
+		Expect(out.Type).To(Equal(TypeBan))
+		Expect(out.Expires).To(Equal(now.Add(24 * time.Hour)))
+
+		out, esc = policy.Escalate(p, history("warning", "warning", "warning", TypeBan), now, types)
+		Expect(esc.Rule).To(Equal("week_ban"))
+		Expect(out.Expires).To(Equal(now.Add(168 * time.Hour)))
+	})
+
+	It("fits the punishment to the scope of the type it escalates to", func() {
+		p := Punishment{PlayerID: "some_user", By: "some_admin", Type: "warning", Server: "server_1", Date: now}
+		out, esc := policy.Escalate(p, history("warning", "warning", "warning"), now, types)
+		Expect(esc.Rule).To(Equal("day_ban"))
+		Expect(out.Server).To(BeEmpty())
+		Expect(out.GameMode).To(BeEmpty())
+
+		_, err := PreparePunishment(out, now, types)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(scopeTo(Punishment{GameMode: "ttt", Server: "server_1"}, ScopeGameMode)).To(Equal(Punishment{GameMode: "ttt"}))
+	})
+
+	It("only counts the player's punishments in the window of the rule", func() {
+		old := history("warning", "warning", "warning")
+		for i := range old {
+			old[i].Date = now.Add(-1000 * time.Hour)
+		}
+		old = append(old, Punishment{ID: 9, PlayerID: "another_user", Type: "warning", Date: now})
+
+		_, esc := policy.Escalate(Punishment{PlayerID: "some_user", Type: "warning"}, old, now, types)
+		Expect(esc).To(BeNil())
+	})
+
+	It("clears the expiry date for the default duration of the type when the rule has none", func() {
+		p := Punishment{PlayerID: "some_user", Type: TypeBan, Expires: now.Add(time.Hour)}
+		out, esc := policy.Escalate(p, history(TypeBan, TypeBan), now, types)
+		Expect(esc.Rule).To(Equal("permanent_ban"))
+		Expect(out.Expires.IsZero()).To(BeTrue())
+	})
+
+	It("rejects rules that cannot be applied", func() {
+		Expect(policy.Validate()).To(Succeed())
+
+		bad := EscalationPolicy{Rules: []EscalationRule{
+			{Name: "twice", Type: "warning", Count: 1},
+			{Name: "twice", Type: "Warning", Count: 0, Within: "a month", EscalateTo: "Ban"},
+		}}
+		err := bad.Validate()
+		Expect(err).To(BeAssignableToTypeOf(&ValidationError{}))
+		Expect(err.(*ValidationError).Problems).To(HaveLen(5))
+	})
+})
@@ -0,0 +1,161 @@
+package profile
+
+import "time"
+
+// EventStore wraps a Storer and publishes an event on a Bus after every successful write of a profile or punishment.
+type EventStore struct {
+	Storer
+	bus *Bus
+}
+
+// NewEventStore returns a Storer that publishes the changes made through it on bus.
+func NewEventStore(s Storer, bus *Bus) *EventStore {
+	return &EventStore{Storer: s, bus: bus}
+}
+
+// Unwrap returns the wrapped Storer.
+func (s *EventStore) Unwrap() Storer {
+	return s.Storer
+}
+
+// Underlying returns the Storer at the bottom of a stack of wrappers, such as an EventStore.
+func Underlying(s Storer) Storer {
+	for {
+		w, ok := s.(interface{ Unwrap() Storer })
+		if !ok {
+			return s
+		}
+		s = w.Unwrap()
+	}
+}
+
+// oldProfile reads a profile before it is changed. Writes that race with it may make the result stale,
+// so it is only used to describe events.
+func (s *EventStore) oldProfile(steamid string) *Profile {
+	p, err := s.Storer.GetProfile(steamid)
+	if err != nil {
+		return nil
+	}
+	return &p
+}
+
+func (s *EventStore) publishProfile(old *Profile, p Profile) {
+	s.bus.Publish(Event{Type: EventProfilePut, PlayerID: p.ID, Profile: &p, OldProfile: old})
+}
+
+func (s *EventStore) PutProfile(p Profile) error {
+	return s.PutProfileBy(p, "")
+}
+
+func (s *EventStore) PutProfileBy(p Profile, by string) error {
+	old := s.oldProfile(p.ID)
+	err := s.Storer.PutProfileBy(p, by)
+	if err == nil {
+		s.publishProfile(old, p)
+	}
+	return err
+}
+
+func (s *EventStore) Purchase(steamid, item string, now time.Time) (Receipt, Profile, error) {
+	old := s.oldProfile(steamid)
+	r, p, err := s.Storer.Purchase(steamid, item, now)
+	if err == nil {
+		s.publishProfile(old, p)
+	}
+	return r, p, err
+}
+
+func (s *EventStore) Refund(receiptID int64, now time.Time) (Receipt, Profile, error) {
+	var old *Profile
+	if r, err := s.Storer.GetReceipt(receiptID); err == nil {
+		old = s.oldProfile(r.PlayerID)
+	}
+
+	r, p, err := s.Storer.Refund(receiptID, now)
+	if err == nil {
+		s.publishProfile(old, p)
+	}
+	return r, p, err
+}
+
+func (s *EventStore) ChangeInventory(e InventoryEvent) (InventoryEvent, Profile, error) {
+	old := s.oldProfile(e.PlayerID)
+	e, p, err := s.Storer.ChangeInventory(e)
+	if err == nil {
+		s.publishProfile(old, p)
+	}
+	return e, p, err
+}
+
+// BulkWrite publishes an event for every write that was stored, in the order of the request.
+func (s *EventStore) BulkWrite(ops []BulkOp, atomic bool, by string) ([]BulkResult, error) {
+	var ids []string
+	for _, op := range ops {
+		if op.Profile != nil {
+			ids = append(ids, op.Profile.ID)
+		}
+	}
+	olds, err := s.Storer.GetProfiles(ids)
+	if err != nil {
+		olds = map[string]Profile{}
+	}
+
+	results, err := s.Storer.BulkWrite(ops, atomic, by)
+	if err != nil {
+		return results, err
+	}
+
+	for i, op := range ops {
+		if results[i].Err != nil {
+			continue
+		}
+
+		if op.Profile != nil {
+			var old *Profile
+			if p, ok := olds[op.Profile.ID]; ok {
+				old = &p
+			}
+			s.publishProfile(old, *op.Profile)
+			olds[op.Profile.ID] = *op.Profile
+			continue
+		}
+
+		p := *results[i].Punishment
+		s.bus.Publish(Event{Type: EventPunishmentPut, PlayerID: p.PlayerID, Punishment: &p})
+	}
+
+	return results, nil
+}
+
+// PutPunishment publishes the punishment as it was stored, so that events carry its ID, normalized type and
+// expiry date.
+func (s *EventStore) PutPunishment(p Punishment) (Punishment, error) {
+	p, err := s.Storer.PutPunishment(p)
+	if err == nil {
+		s.bus.Publish(Event{Type: EventPunishmentPut, PlayerID: p.PlayerID, Punishment: &p})
+	}
+	return p, err
+}
+
+// DelPunishment reads the punishment before deleting it, so that the event says whose punishment it was.
+func (s *EventStore) DelPunishment(pid int64) error {
+	p, err := s.Storer.GetPunishment(pid)
+	if err != nil {
+		return err
+	}
+
+	err = s.Storer.DelPunishment(pid)
+	if err == nil {
+		s.bus.Publish(Event{Type: EventPunishmentDel, PlayerID: p.PlayerID, Punishment: &p})
+	}
+	return err
+}
+
+// RecordAppealEvent publishes the punishment when an accepted appeal changes it, so that servers lift or shorten it.
+func (s *EventStore) RecordAppealEvent(id int64, e AppealEvent) (Appeal, Punishment, error) {
+	a, p, err := s.Storer.RecordAppealEvent(id, e)
+	if err == nil && e.Action == AppealAccept {
+		s.bus.Publish(Event{Type: EventPunishmentPut, PlayerID: p.PlayerID, Punishment: &p})
+	}
+	return a, p, err
+}
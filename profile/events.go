@@ -0,0 +1,163 @@
+package profile
+
+import (
+	"sync"
+	"time"
+)
+
+// Types of events published on a Bus.
+const (
+	EventProfilePut    = "profile.put"
+	EventPunishmentPut = "punishment.put"
+	EventPunishmentDel = "punishment.del"
+)
+
+// Sizes used by NewBus and Subscribe.
+const (
+	DefaultBusBacklog     = 1000
+	SubscriptionQueueSize = 64
+)
+
+// Event describes a change to a stored record. Profile is set for profile events and Punishment for punishment events.
+// OldProfile is the profile before the change, if it existed.
+type Event struct {
+	ID         int64
+	Type       string
+	PlayerID   string
+	Date       time.Time
+	Profile    *Profile    `json:",omitempty"`
+	OldProfile *Profile    `json:",omitempty"`
+	Punishment *Punishment `json:",omitempty"`
+}
+
+// EventFilter selects events by player and type. Empty fields match every event.
+type EventFilter struct {
+	PlayerID string
+	Types    []string
+}
+
+func (f EventFilter) matches(e Event) bool {
+	if f.PlayerID != "" && f.PlayerID != e.PlayerID {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if t == e.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// Bus passes events from the store to subscribers inside the process.
+// It keeps the most recent events so that subscribers can resume after reconnecting.
+type Bus struct {
+	mu      sync.Mutex
+	lastID  int64
+	backlog []Event
+	size    int
+	subs    map[*Subscription]struct{}
+}
+
+// NewBus returns a Bus that keeps the last backlog events.
+func NewBus(backlog int) *Bus {
+	if backlog <= 0 {
+		backlog = DefaultBusBacklog
+	}
+	return &Bus{size: backlog, subs: map[*Subscription]struct{}{}}
+}
+
+// Subscription receives the events of a Bus that match its filter.
+// If the subscriber falls more than SubscriptionQueueSize events behind, it is dropped and C is closed.
+// It can then subscribe again, resuming from the last event it received.
+type Subscription struct {
+	C <-chan Event
+	// Gap is true if some of the events the subscriber asked to resume from were no longer kept by the Bus.
+	Gap bool
+
+	c      chan Event
+	filter EventFilter
+	bus    *Bus
+}
+
+// LastID returns the ID of the newest event.
+func (b *Bus) LastID() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lastID
+}
+
+// Publish assigns the next ID to e and sends it to every matching subscriber.
+func (b *Bus) Publish(e Event) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	e.ID = b.lastID
+	if e.Date.IsZero() {
+		e.Date = time.Now().UTC()
+	}
+
+	b.backlog = append(b.backlog, e)
+	if len(b.backlog) > b.size {
+		b.backlog = b.backlog[len(b.backlog)-b.size:]
+	}
+
+	for s := range b.subs {
+		if !s.filter.matches(e) {
+			continue
+		}
+		select {
+		case s.c <- e:
+		default:
+			// The subscriber is too slow. Drop it rather than hold up the store.
+			b.drop(s)
+		}
+	}
+
+	return e
+}
+
+// Subscribe returns a subscription to the events matching f. If after is not zero, the kept events with greater IDs
+// are delivered first, so that a subscriber that saw the event with ID after misses nothing.
+func (b *Bus) Subscribe(f EventFilter, after int64) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var missed []Event
+	gap := false
+	if after > 0 && after < b.lastID {
+		gap = len(b.backlog) == 0 || b.backlog[0].ID > after+1
+		for _, e := range b.backlog {
+			if e.ID > after && f.matches(e) {
+				missed = append(missed, e)
+			}
+		}
+	}
+
+	c := make(chan Event, SubscriptionQueueSize+len(missed))
+	for _, e := range missed {
+		c <- e
+	}
+
+	s := &Subscription{C: c, Gap: gap, c: c, filter: f, bus: b}
+	b.subs[s] = struct{}{}
+	return s
+}
+
+// Close stops the subscription and closes C. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.drop(s)
+}
+
+// drop removes a subscription. The caller holds the lock.
+func (b *Bus) drop(s *Subscription) {
+	if _, ok := b.subs[s]; ok {
+		delete(b.subs, s)
+		close(s.c)
+	}
+}
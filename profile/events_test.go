@@ -0,0 +1,158 @@
+package profile
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Event bus", func() {
+	var bus *Bus
+
+	BeforeEach(func() {
+		bus = NewBus(3)
+	})
+
+	It("delivers matching events to subscribers", func() {
+		all := bus.Subscribe(EventFilter{}, 0)
+		player := bus.Subscribe(EventFilter{PlayerID: "some_user"}, 0)
+		bans := bus.Subscribe(EventFilter{Types: []string{EventPunishmentPut}}, 0)
+		defer all.Close()
+		defer player.Close()
+		defer bans.Close()
+
+		bus.Publish(Event{Type: EventProfilePut, PlayerID: "some_user"})
+		bus.Publish(Event{Type: EventPunishmentPut, PlayerID: "other_user"})
+
+		Expect((<-all.C).ID).To(Equal(int64(1)))
+		Expect((<-all.C).ID).To(Equal(int64(2)))
+		Expect((<-player.C).Type).To(Equal(EventProfilePut))
+		Expect((<-bans.C).PlayerID).To(Equal("other_user"))
+		Expect(player.C).ToNot(Receive())
+		Expect(bans.C).ToNot(Receive())
+	})
+
+	It("resumes from an event ID", func() {
+		for i := 0; i < 5; i++ {
+			bus.Publish(Event{Type: EventProfilePut, PlayerID: "some_user"})
+		}
+
+		sub := bus.Subscribe(EventFilter{}, 2)
+		defer sub.Close()
+		Expect(sub.Gap).To(BeFalse())
+		Expect((<-sub.C).ID).To(Equal(int64(3)))
+		Expect((<-sub.C).ID).To(Equal(int64(4)))
+		Expect((<-sub.C).ID).To(Equal(int64(5)))
+
+		old := bus.Subscribe(EventFilter{}, 0)
+		defer old.Close()
+		Expect(old.C).ToNot(Receive())
+
+		lost := bus.Subscribe(EventFilter{}, 1)
+		defer lost.Close()
+		Expect(lost.Gap).To(BeTrue())
+		Expect((<-lost.C).ID).To(Equal(int64(3)))
+	})
+
+	It("drops subscribers that fall behind", func() {
+		sub := bus.Subscribe(EventFilter{}, 0)
+		for i := 0; i <= SubscriptionQueueSize; i++ {
+			bus.Publish(Event{Type: EventProfilePut})
+		}
+
+		n := 0
+		for range sub.C {
+			n++
+		}
+		Expect(n).To(Equal(SubscriptionQueueSize))
+		sub.Close()
+	})
+
+	Context("EventStore", func() {
+		var s *EventStore
+		var sub *Subscription
+
+		BeforeEach(func() {
+			s = NewEventStore(NewMockStore(), bus)
+			sub = bus.Subscribe(EventFilter{}, 0)
+		})
+
+		AfterEach(func() {
+			sub.Close()
+		})
+
+		It("publishes profile and punishment writes", func() {
+			Expect(s.PutProfile(Profile{ID: "some_user"})).To(Succeed())
+			p, err := s.PutPunishment(Punishment{PlayerID: "some_user", By: "some_admin", Type: "ban"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.DelPunishment(p.ID)).To(Succeed())
+
+			e := <-sub.C
+			Expect(e.Type).To(Equal(EventProfilePut))
+			Expect(e.Profile.ID).To(Equal("some_user"))
+			Expect(e.OldProfile).To(BeNil())
+
+			e = <-sub.C
+			Expect(e.Type).To(Equal(EventPunishmentPut))
+			Expect(e.Punishment.Type).To(Equal("ban"))
+
+			e = <-sub.C
+			Expect(e.Type).To(Equal(EventPunishmentDel))
+			Expect(e.PlayerID).To(Equal("some_user"))
+		})
+
+		It("publishes punishments as they were stored", func() {
+			_, err := s.PutPunishment(Punishment{PlayerID: "some_user", By: "some_admin", Type: "Voice_Mute"})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = s.BulkWrite([]BulkOp{{Punishment: &Punishment{PlayerID: "some_user", By: "some_admin", Type: " Chat_Gag"}}}, true, "server_1")
+			Expect(err).ToNot(HaveOccurred())
+
+			for _, t := range []string{TypeVoiceMute, TypeChatGag} {
+				e := <-sub.C
+				Expect(e.Punishment.ID).ToNot(BeZero())
+				Expect(e.Punishment.Type).To(Equal(t))
+				Expect(e.Punishment.Expires.IsZero()).To(BeFalse())
+			}
+		})
+
+		It("includes the previous profile", func() {
+			Expect(s.PutProfile(Profile{ID: "some_user", Coins: 1})).To(Succeed())
+			Expect(s.PutProfile(Profile{ID: "some_user", Coins: 2})).To(Succeed())
+
+			<-sub.C
+			e := <-sub.C
+			Expect(e.OldProfile.Coins).To(Equal(int64(1)))
+			Expect(e.Profile.Coins).To(Equal(int64(2)))
+		})
+
+		It("does not publish failed writes", func() {
+			Expect(s.PutProfile(Profile{})).ToNot(Succeed())
+			Expect(s.DelPunishment(5)).ToNot(Succeed())
+			Expect(sub.C).ToNot(Receive())
+		})
+
+		It("publishes the stored writes of a bulk request", func() {
+			Expect(s.PutProfile(Profile{ID: "some_user", Coins: 1})).To(Succeed())
+			<-sub.C
+
+			_, err := s.BulkWrite([]BulkOp{
+				{Profile: &Profile{ID: "some_user", Coins: 2}},
+				{Profile: &Profile{}},
+				{Punishment: &Punishment{PlayerID: "some_user", By: "some_admin", Type: "ban"}},
+			}, false, "server_1")
+			Expect(err).ToNot(HaveOccurred())
+
+			e := <-sub.C
+			Expect(e.OldProfile.Coins).To(Equal(int64(1)))
+			Expect(e.Profile.Coins).To(Equal(int64(2)))
+
+			e = <-sub.C
+			Expect(e.Type).To(Equal(EventPunishmentPut))
+			Expect(e.Punishment.ID).ToNot(BeZero())
+			Expect(sub.C).ToNot(Receive())
+		})
+
+		It("unwraps to the underlying store", func() {
+			Expect(Underlying(s)).To(BeAssignableToTypeOf(&MockStore{}))
+		})
+	})
+})
@@ -0,0 +1,57 @@
+package profile
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// HashVersion prefixes the hashes made by Hash, so that a later revision of the scheme can be told apart.
+const HashVersion = "v2_"
+
+// CanonicalForm returns the text a profile's hash is computed from. It is made of one line per value:
+//
+//	profile
+//	id <str(ID)>
+//	coins <Coins in decimal>
+//	inventory <str(item)> <str(settings)>   for every item, by item name
+//	equipment <str(slot)> <str(item)>       for every slot, by slot name
+//
+// where str(s) is the length of s in bytes, a colon and s, and names are sorted by their bytes.
+// Fields added to Profile later are only written when they are set, so that they do not change the hash of
+// profiles that do not use them. Nil and empty maps are the same.
+func CanonicalForm(p Profile) string {
+	var b strings.Builder
+	b.WriteString("profile\n")
+	b.WriteString("id " + canonicalString(p.ID) + "\n")
+	b.WriteString("coins " + strconv.FormatInt(p.Coins, 10) + "\n")
+	writeCanonicalMap(&b, "inventory", p.Inventory)
+	writeCanonicalMap(&b, "equipment", p.Equipment)
+	return b.String()
+}
+
+func canonicalString(s string) string {
+	return strconv.Itoa(len(s)) + ":" + s
+}
+
+func writeCanonicalMap(b *strings.Builder, name string, m map[string]string) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		b.WriteString(name + " " + canonicalString(k) + " " + canonicalString(m[k]) + "\n")
+	}
+}
+
+// Hash returns the hash of a profile: HashVersion and the hex SHA-256 of its CanonicalForm.
+// Clients send it back with updates to show which state they changed. It does not depend on the encoding of the
+// profile, nor on the Go types that hold it.
+func Hash(p Profile) string {
+	sum := sha256.Sum256([]byte(CanonicalForm(p)))
+	return HashVersion + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,49 @@
+package profile
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Profile hash", func() {
+	It("matches the golden vectors", func() {
+		data, err := ioutil.ReadFile("testdata/hashes.json")
+		Expect(err).ToNot(HaveOccurred())
+
+		var vectors []struct {
+			Name      string
+			Profile   Profile
+			Canonical string
+			Hash      string
+		}
+		Expect(json.Unmarshal(data, &vectors)).To(Succeed())
+		Expect(vectors).ToNot(BeEmpty())
+
+		for _, v := range vectors {
+			Expect(CanonicalForm(v.Profile)).To(Equal(v.Canonical), v.Name)
+			Expect(Hash(v.Profile)).To(Equal(v.Hash), v.Name)
+		}
+	})
+
+	It("changes with every field", func() {
+		p := Profile{ID: "some_user", Coins: 1, Inventory: map[string]string{"hat": ""}, Equipment: map[string]string{"head": "hat"}}
+		changes := []Profile{
+			{ID: "other_user", Coins: 1, Inventory: p.Inventory, Equipment: p.Equipment},
+			{ID: "some_user", Coins: 2, Inventory: p.Inventory, Equipment: p.Equipment},
+			{ID: "some_user", Coins: 1, Inventory: map[string]string{"hat": "red"}, Equipment: p.Equipment},
+			{ID: "some_user", Coins: 1, Inventory: p.Inventory},
+		}
+		for _, c := range changes {
+			Expect(Hash(c)).ToNot(Equal(Hash(p)))
+		}
+	})
+
+	It("cannot be fooled by separators in text", func() {
+		a := Profile{ID: "x", Inventory: map[string]string{"a 1:b": ""}}
+		b := Profile{ID: "x", Inventory: map[string]string{"a": "b"}}
+		Expect(Hash(a)).ToNot(Equal(Hash(b)))
+	})
+})
@@ -0,0 +1,44 @@
+package profile
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrVersionNotFound is returned when a profile has no version with the requested number.
+var ErrVersionNotFound = errors.New("Version not found.")
+
+// ProfileVersion records a single write of a Profile.
+type ProfileVersion struct {
+	PlayerID string
+	// Version numbers start at 1 for each player and grow by one with every write.
+	Version int64
+	// Old is the profile before the write, or nil if the write created it.
+	Old *Profile
+	New Profile
+	// By names the caller that made the write, if known.
+	By   string
+	Date time.Time
+}
+
+// HistoryStorer defines the behavior of a store that keeps every version of each Profile.
+// Every write of a profile is recorded, including those made by purchases and inventory changes.
+type HistoryStorer interface {
+	// PutProfileBy stores a profile like PutProfile, recording by as the caller in its history.
+	PutProfileBy(p Profile, by string) error
+	// GetHistory returns a player's profile versions, newest first.
+	GetHistory(steamid string) ([]ProfileVersion, error)
+	GetVersion(steamid string, version int64) (ProfileVersion, error)
+}
+
+// newVersion returns the version that follows last for a write of p over old.
+func newVersion(last int64, old *Profile, p Profile, by string) ProfileVersion {
+	return ProfileVersion{
+		PlayerID: p.ID,
+		Version:  last + 1,
+		Old:      old,
+		New:      p,
+		By:       by,
+		Date:     time.Now().UTC(),
+	}
+}
@@ -0,0 +1,121 @@
+package profile
+
+import (
+	"fmt"
+	"time"
+)
+
+// Kinds of inventory events.
+const (
+	InventoryGrant    = "grant"
+	InventoryRemove   = "remove"
+	InventorySell     = "sell"
+	InventorySettings = "settings"
+	InventoryPurchase = "purchase"
+	InventoryRefund   = "refund"
+)
+
+// SellBackPercent is the part of an item's catalog price that a player gets back for selling it.
+const SellBackPercent = 50
+
+// InventoryEvent records a change to a single item in a player's Inventory.
+type InventoryEvent struct {
+	ID       int64
+	PlayerID string
+	Kind     string
+	Item     string
+	// Settings are the item's settings after the change, and OldSettings the ones before it.
+	Settings    string
+	OldSettings string
+	// Coins is the change of the player's coins, eg. negative for purchases.
+	Coins int64
+	By    string
+	Date  time.Time
+}
+
+// InventoryStorer defines the behavior of a store that changes single inventory items and keeps a log of the changes.
+type InventoryStorer interface {
+	// ChangeInventory applies a grant, remove, sell or settings event to a player's Inventory and logs it,
+	// in a single atomic operation. The PlayerID, Kind, Item, By and Date of e are set by the caller, and for grants
+	// and settings changes also the Settings. It returns the logged event and the updated profile.
+	ChangeInventory(e InventoryEvent) (InventoryEvent, Profile, error)
+	// GetInventoryEvents returns a player's inventory log, newest first.
+	GetInventoryEvents(steamid string) ([]InventoryEvent, error)
+}
+
+// applyInventoryEvent applies e to p, filling in the parts of e that depend on the profile.
+// The profile still has to be validated against the catalog.
+func applyInventoryEvent(p *Profile, it Item, e *InventoryEvent) error {
+	old, owned := p.Inventory[it.Name]
+
+	switch e.Kind {
+	case InventoryGrant:
+		if owned {
+			return ErrAlreadyOwned
+		}
+		giveItem(p, it.Name, e.Settings)
+
+	case InventoryRemove, InventorySell:
+		if !owned {
+			return ErrNotOwned
+		}
+		takeItem(p, it.Name)
+		e.Settings = ""
+		if e.Kind == InventorySell {
+			e.Coins = it.Price * SellBackPercent / 100
+			p.Coins += e.Coins
+		}
+
+	case InventorySettings:
+		if !owned {
+			return ErrNotOwned
+		}
+		giveItem(p, it.Name, e.Settings)
+
+	default:
+		return fmt.Errorf("Unknown inventory change %q.", e.Kind)
+	}
+
+	e.OldSettings = old
+	return nil
+}
+
+// giveItem puts an item with the given settings into a copy of p's Inventory.
+func giveItem(p *Profile, name, settings string) {
+	inv := make(map[string]string, len(p.Inventory)+1)
+	for k, v := range p.Inventory {
+		inv[k] = v
+	}
+	inv[name] = settings
+
+	p.Inventory = inv
+}
+
+// takeItem removes an item from copies of p's Inventory and Equipment.
+func takeItem(p *Profile, name string) {
+	inv := make(map[string]string, len(p.Inventory))
+	for k, v := range p.Inventory {
+		if k != name {
+			inv[k] = v
+		}
+	}
+
+	eq := make(map[string]string, len(p.Equipment))
+	for slot, v := range p.Equipment {
+		if v != name {
+			eq[slot] = v
+		}
+	}
+
+	p.Inventory = inv
+	p.Equipment = eq
+}
+
+// purchaseEvent and refundEvent log the inventory changes made by the shop.
+func purchaseEvent(r Receipt) InventoryEvent {
+	return InventoryEvent{PlayerID: r.PlayerID, Kind: InventoryPurchase, Item: r.Item, Coins: -r.Price, By: r.PlayerID, Date: r.Date}
+}
+
+func refundEvent(r Receipt, settings string) InventoryEvent {
+	return InventoryEvent{PlayerID: r.PlayerID, Kind: InventoryRefund, Item: r.Item, OldSettings: settings, Coins: r.Price, By: r.PlayerID, Date: r.Refunded}
+}
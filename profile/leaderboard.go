@@ -0,0 +1,122 @@
+package profile
+
+// Leaderboard sizes used when the caller asks for none or for too many.
+const (
+	DefaultLeaderboardSize = 10
+	MaxLeaderboardSize     = 100
+	MaxStandingNeighbors   = 25
+)
+
+// leaderboardOrder is the order of the coin leaderboard: richest first, ties broken by descending ID.
+var leaderboardOrder = ListOptions{SortBy: SortByCoins, Desc: true}
+
+// Ranking is a player's position on the coin leaderboard.
+// Players with the same number of coins share a rank, and the next rank is skipped accordingly.
+type Ranking struct {
+	Rank  int64
+	ID    string
+	Coins int64
+}
+
+// Standing is a player's ranking together with the players just above and below them on the leaderboard.
+type Standing struct {
+	Ranking
+	// Above lists the players ranked higher, in leaderboard order, so the last one is directly above the player.
+	Above []Ranking
+	// Below lists the players ranked lower, in leaderboard order, so the first one is directly below the player.
+	Below []Ranking
+}
+
+// clampLeaderboardSize applies the default and maximum to a requested number of players.
+func clampLeaderboardSize(n, max int) int {
+	if n <= 0 {
+		return DefaultLeaderboardSize
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
+
+// ranker assigns ranks to profiles visited in leaderboard order.
+type ranker struct {
+	pos   int64
+	rank  int64
+	coins int64
+}
+
+func (r *ranker) next(id string, coins int64) Ranking {
+	r.pos++
+	if r.pos == 1 || coins != r.coins {
+		r.rank = r.pos
+		r.coins = coins
+	}
+	return Ranking{Rank: r.rank, ID: id, Coins: coins}
+}
+
+// walkFunc visits profiles in leaderboard order until visit returns false.
+type walkFunc func(visit func(id string, coins int64) bool) error
+
+// topRankings collects the first n rankings of a walk.
+func topRankings(walk walkFunc, n int) ([]Ranking, error) {
+	n = clampLeaderboardSize(n, MaxLeaderboardSize)
+
+	var r ranker
+	rs := []Ranking{}
+	err := walk(func(id string, coins int64) bool {
+		rs = append(rs, r.next(id, coins))
+		return len(rs) < n
+	})
+
+	return rs, err
+}
+
+// standingOf walks the leaderboard from the top down to n players past steamid, keeping the n players before it.
+func standingOf(walk walkFunc, steamid string, n int) (Standing, error) {
+	if n < 0 {
+		n = 0
+	}
+	if n > MaxStandingNeighbors {
+		n = MaxStandingNeighbors
+	}
+
+	var r ranker
+	var st Standing
+	found := false
+
+	err := walk(func(id string, coins int64) bool {
+		rk := r.next(id, coins)
+
+		if found {
+			st.Below = append(st.Below, rk)
+			return len(st.Below) < n
+		}
+
+		if id == steamid {
+			found = true
+			st.Ranking = rk
+			return n > 0
+		}
+
+		st.Above = append(st.Above, rk)
+		if len(st.Above) > n {
+			st.Above = st.Above[1:]
+		}
+		return true
+	})
+	if err != nil {
+		return st, err
+	}
+
+	if !found {
+		return st, ErrProfileNotFound
+	}
+
+	if st.Above == nil {
+		st.Above = []Ranking{}
+	}
+	if st.Below == nil {
+		st.Below = []Ranking{}
+	}
+	return st, nil
+}
@@ -0,0 +1,114 @@
+package profile
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// Orders in which ListProfiles can return profiles.
+const (
+	SortByID    = "id"
+	SortByCoins = "coins"
+)
+
+// Page sizes used by ListProfiles when the caller asks for none or for too many.
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 500
+)
+
+// Errors returned by ListProfiles for options it cannot satisfy.
+var (
+	ErrInvalidCursor = errors.New("Invalid cursor.")
+	ErrInvalidSort   = errors.New("Profiles can only be sorted by id or coins.")
+)
+
+// ListOptions select a page of profiles.
+type ListOptions struct {
+	// Cursor is the NextCursor of the previous page, or empty for the first page.
+	Cursor string
+	// Limit is the maximum number of profiles on the page.
+	Limit int
+	// SortBy is SortByID (the default) or SortByCoins. Profiles with equal Coins are ordered by ID.
+	SortBy string
+	// Desc reverses the order.
+	Desc bool
+}
+
+// ProfilePage is one page of a profile listing.
+type ProfilePage struct {
+	Profiles []Profile
+	// NextCursor fetches the following page. It is empty on the last page.
+	NextCursor string
+}
+
+// listCursor is the decoded form of a cursor: the sort key of the last profile on the previous page.
+type listCursor struct {
+	SortBy string
+	Desc   bool
+	ID     string
+	Coins  int64
+}
+
+// normalize fills in defaults and decodes the cursor, which is nil for the first page.
+func (o *ListOptions) normalize() (*listCursor, error) {
+	if o.SortBy == "" {
+		o.SortBy = SortByID
+	}
+	if o.SortBy != SortByID && o.SortBy != SortByCoins {
+		return nil, ErrInvalidSort
+	}
+
+	if o.Limit <= 0 {
+		o.Limit = DefaultListLimit
+	}
+	if o.Limit > MaxListLimit {
+		o.Limit = MaxListLimit
+	}
+
+	if o.Cursor == "" {
+		return nil, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(o.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c listCursor
+	err = json.Unmarshal(b, &c)
+	if err != nil || c.SortBy != o.SortBy || c.Desc != o.Desc {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
+
+// cursorAfter encodes a cursor pointing just past p.
+func (o ListOptions) cursorAfter(p Profile) string {
+	b, _ := json.Marshal(listCursor{SortBy: o.SortBy, Desc: o.Desc, ID: p.ID, Coins: p.Coins})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// less reports whether a comes before b in the listing order.
+func (o ListOptions) less(a, b Profile) bool {
+	if o.Desc {
+		a, b = b, a
+	}
+
+	if o.SortBy == SortByCoins && a.Coins != b.Coins {
+		return a.Coins < b.Coins
+	}
+	return a.ID < b.ID
+}
+
+// page cuts a listing that was fetched with one extra profile down to the limit, and sets NextCursor if there is more.
+func (o ListOptions) page(ps []Profile) ProfilePage {
+	if len(ps) <= o.Limit {
+		return ProfilePage{Profiles: ps}
+	}
+
+	ps = ps[:o.Limit]
+	return ProfilePage{Profiles: ps, NextCursor: o.cursorAfter(ps[len(ps)-1])}
+}
@@ -1,41 +1,143 @@
 package profile
 
-import "errors"
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
 
 // MockStore provides a simple in-memory store for use in unit tests.
 type MockStore struct {
 	profiles          map[string]Profile
 	punishments       map[int64]Punishment
 	punishmentsSerial int64
+	items             map[string]Item
+	punishmentTypes   map[string]PunishmentType
+	receipts          map[int64]Receipt
+	inventoryEvents   []InventoryEvent
+	history           map[string][]ProfileVersion
+	appeals           []Appeal
+
+	// Webhook deliveries are written by the dispatcher's goroutines, so the webhook records are guarded.
+	webhooksMu sync.Mutex
+	webhooks   []Webhook
+	webhookSeq int64
+	deliveries []Delivery
 }
 
 // NewMockStore returns an initialized MockStore.
 func NewMockStore() *MockStore {
-	return &MockStore{
-		profiles:    map[string]Profile{},
-		punishments: map[int64]Punishment{},
+	s := &MockStore{
+		profiles:        map[string]Profile{},
+		punishments:     map[int64]Punishment{},
+		items:           map[string]Item{},
+		punishmentTypes: map[string]PunishmentType{},
+		receipts:        map[int64]Receipt{},
+		history:         map[string][]ProfileVersion{},
+	}
+	for _, t := range BuiltinPunishmentTypes {
+		s.punishmentTypes[t.Name] = t
 	}
+	return s
 }
 
 // GetProfile returns a profile with the matching ID.
 func (s *MockStore) GetProfile(id string) (p Profile, err error) {
 	p, ok := s.profiles[id]
 	if !ok {
-		return p, errors.New("Profile not found.")
+		return p, ErrProfileNotFound
 	}
 	return p, nil
 }
 
+// GetProfiles returns the profiles with the matching IDs that exist.
+func (s *MockStore) GetProfiles(ids []string) (map[string]Profile, error) {
+	ps := map[string]Profile{}
+	for _, id := range ids {
+		if p, ok := s.profiles[id]; ok {
+			ps[id] = p
+		}
+	}
+	return ps, nil
+}
+
 // PutProfile stores a profile.
 func (s *MockStore) PutProfile(p Profile) error {
+	return s.PutProfileBy(p, "")
+}
+
+// PutProfileBy stores a profile and records by as the caller in its history.
+func (s *MockStore) PutProfileBy(p Profile, by string) error {
 	if p.ID == "" {
 		return errors.New("Error putting profile: no ID provided.")
 	}
 
+	var old *Profile
+	if prev, ok := s.profiles[p.ID]; ok {
+		old = &prev
+	}
+
+	err := ValidateProfile(old, p, itemLookup(s.items))
+	if err != nil {
+		return err
+	}
+
 	s.profiles[p.ID] = p
+	s.history[p.ID] = append(s.history[p.ID], newVersion(int64(len(s.history[p.ID])), old, p, by))
+	return nil
+}
+
+// ListProfiles returns a page of profiles, sorting every stored profile.
+func (s *MockStore) ListProfiles(opts ListOptions) (ProfilePage, error) {
+	after, err := opts.normalize()
+	if err != nil {
+		return ProfilePage{}, err
+	}
+
+	var ps []Profile
+	for _, p := range s.profiles {
+		if after != nil && !opts.less(Profile{ID: after.ID, Coins: after.Coins}, p) {
+			continue
+		}
+		ps = append(ps, p)
+	}
+
+	sort.Slice(ps, func(i, j int) bool { return opts.less(ps[i], ps[j]) })
+
+	if len(ps) > opts.Limit+1 {
+		ps = ps[:opts.Limit+1]
+	}
+
+	return opts.page(ps), nil
+}
+
+// leaderboard visits every profile in leaderboard order.
+func (s *MockStore) leaderboard(visit func(id string, coins int64) bool) error {
+	ps := make([]Profile, 0, len(s.profiles))
+	for _, p := range s.profiles {
+		ps = append(ps, p)
+	}
+	sort.Slice(ps, func(i, j int) bool { return leaderboardOrder.less(ps[i], ps[j]) })
+
+	for _, p := range ps {
+		if !visit(p.ID, p.Coins) {
+			return nil
+		}
+	}
 	return nil
 }
 
+// TopProfiles returns the n richest players.
+func (s *MockStore) TopProfiles(n int) ([]Ranking, error) {
+	return topRankings(s.leaderboard, n)
+}
+
+// GetStanding returns a player's rank and the n players above and below them.
+func (s *MockStore) GetStanding(steamid string, n int) (Standing, error) {
+	return standingOf(s.leaderboard, steamid, n)
+}
+
 //GetCoins(string) int64
 //PutCoins(string, int64) int64
 
@@ -43,41 +145,593 @@ func (s *MockStore) PutProfile(p Profile) error {
 func (s *MockStore) GetPunishments(pid string) (ps map[string]Punishment, err error) {
 	ps = map[string]Punishment{}
 
-	for k := range s.punishments {
-		if s.punishments[k].PlayerID == pid {
-			ps[s.punishments[k].Type] = s.punishments[k]
+	// Later punishments replace earlier ones of the same type and scope.
+	err = s.EachPunishment(func(p Punishment) error {
+		if p.PlayerID == pid {
+			ps[p.Key()] = p
 		}
+		return nil
+	})
+	if err != nil {
+		return ps, err
 	}
 
 	if len(ps) == 0 {
-		err = errors.New("No punishments found.")
+		err = ErrNoPunishments
 	}
 
 	return ps, err
 }
 
-// PutPunishment stores a punishment.
-func (s *MockStore) PutPunishment(p Punishment) error {
-	if p.PlayerID == "" || p.By == "" || p.Type == "" {
-		return errors.New("PlayerID, By, and Reason fields are required.")
+// GetPunishment returns the punishment with the given ID.
+func (s *MockStore) GetPunishment(id int64) (Punishment, error) {
+	p, ok := s.punishments[id]
+	if !ok {
+		return p, ErrPunishmentNotFound
+	}
+	return p, nil
+}
+
+// PutPunishment stores a punishment of a registered type.
+func (s *MockStore) PutPunishment(p Punishment) (Punishment, error) {
+	p, err := PreparePunishment(p, time.Now(), punishmentTypeLookup(s.punishmentTypes))
+	if err != nil {
+		return p, err
 	}
 
+	return s.putPunishment(p), nil
+}
+
+// ImportPunishment stores a punishment under its ID, or the next free one if it has none.
+func (s *MockStore) ImportPunishment(p Punishment) (Punishment, error) {
+	p, err := prepareRecord(p, time.Now(), punishmentTypeLookup(s.punishmentTypes))
+	if err != nil {
+		return p, err
+	}
+	if p.ID != 0 && s.punishments[p.ID].ID != 0 {
+		return p, ErrPunishmentExists
+	}
+	if p.ID > s.punishmentsSerial {
+		s.punishmentsSerial = p.ID
+	}
+
+	return s.putPunishment(p), nil
+}
+
+// putPunishment stores a punishment, assigning it the next free ID if it has none.
+func (s *MockStore) putPunishment(p Punishment) Punishment {
 	if p.ID == 0 {
-		p.ID = s.punishmentsSerial
-		s.punishmentsSerial++
+		for p.ID == 0 || s.punishments[p.ID].ID != 0 {
+			s.punishmentsSerial++
+			p.ID = s.punishmentsSerial
+		}
 	}
 	s.punishments[p.ID] = p
+	return p
+}
 
-	return nil
+// BulkWrite stores many records. For all-or-nothing requests every write is checked before any is stored.
+func (s *MockStore) BulkWrite(ops []BulkOp, atomic bool, by string) ([]BulkResult, error) {
+	results := make([]BulkResult, len(ops))
+
+	check := func(op BulkOp) error {
+		err := op.Validate()
+		if err == nil && op.Profile != nil {
+			var old *Profile
+			if prev, ok := s.profiles[op.Profile.ID]; ok {
+				old = &prev
+			}
+			err = ValidateProfile(old, *op.Profile, itemLookup(s.items))
+		}
+		if err == nil && op.Punishment != nil {
+			_, err = PreparePunishment(*op.Punishment, time.Now(), punishmentTypeLookup(s.punishmentTypes))
+		}
+		return err
+	}
+
+	if atomic {
+		for i, op := range ops {
+			err := check(op)
+			if err != nil {
+				results[i].Err = err
+				rollBack(results, i)
+				return results, nil
+			}
+		}
+	}
+
+	for i, op := range ops {
+		err := check(op)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		if op.Profile != nil {
+			results[i].Err = s.PutProfileBy(*op.Profile, by)
+			continue
+		}
+
+		stored, err := s.PutPunishment(*op.Punishment)
+		results[i].Err = err
+		if err == nil {
+			results[i].stored(&stored)
+		}
+	}
+
+	return results, nil
 }
 
 // DelPunishment removes a punishment from the store.
 func (s *MockStore) DelPunishment(id int64) error {
 	_, ok := s.punishments[id]
 	if !ok {
-		return errors.New("Error deleting punishment: ID not found")
+		return ErrPunishmentNotFound
 	}
 
 	delete(s.punishments, id)
 	return nil
 }
+
+// EachProfile calls fn for every stored profile, in ID order.
+func (s *MockStore) EachProfile(fn func(Profile) error) error {
+	ids := make([]string, 0, len(s.profiles))
+	for id := range s.profiles {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		err := fn(s.profiles[id])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EachPunishment calls fn for every stored punishment, in ID order.
+func (s *MockStore) EachPunishment(fn func(Punishment) error) error {
+	ids := make([]int64, 0, len(s.punishments))
+	for id := range s.punishments {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		err := fn(s.punishments[id])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// QueryPunishments returns the punishments matching q, newest first.
+func (s *MockStore) QueryPunishments(q PunishmentQuery) ([]Punishment, error) {
+	err := q.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	ps := []Punishment{}
+	for _, p := range s.punishments {
+		if q.matches(p) {
+			ps = append(ps, p)
+		}
+	}
+
+	sort.Slice(ps, func(i, j int) bool { return newerPunishment(ps[i], ps[j]) })
+
+	if len(ps) > q.Limit {
+		ps = ps[:q.Limit]
+	}
+	return ps, nil
+}
+
+// GetItem returns the catalog item with the given name.
+func (s *MockStore) GetItem(name string) (Item, error) {
+	it, ok := s.items[name]
+	if !ok {
+		return it, ErrItemNotFound
+	}
+	return it, nil
+}
+
+// GetItems returns the whole catalog, ordered by name.
+func (s *MockStore) GetItems() ([]Item, error) {
+	items := []Item{}
+	for _, it := range s.items {
+		items = append(items, it)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	return items, nil
+}
+
+// PutItem adds an item to the catalog, or replaces the item with the same name.
+func (s *MockStore) PutItem(it Item) error {
+	err := it.Validate()
+	if err != nil {
+		return err
+	}
+
+	s.items[it.Name] = it
+	return nil
+}
+
+// DelItem removes an item from the catalog, unless a profile owns it.
+func (s *MockStore) DelItem(name string) error {
+	if _, ok := s.items[name]; !ok {
+		return ErrItemNotFound
+	}
+
+	for _, p := range s.profiles {
+		if _, ok := p.Inventory[name]; ok {
+			return ErrItemInUse
+		}
+	}
+
+	delete(s.items, name)
+	return nil
+}
+
+// GetPunishmentType returns the registered punishment type with the given name.
+func (s *MockStore) GetPunishmentType(name string) (PunishmentType, error) {
+	t, ok := s.punishmentTypes[name]
+	if !ok {
+		return t, ErrPunishmentTypeNotFound
+	}
+	return t, nil
+}
+
+// GetPunishmentTypes returns every registered punishment type, ordered by name.
+func (s *MockStore) GetPunishmentTypes() ([]PunishmentType, error) {
+	types := []PunishmentType{}
+	for _, t := range s.punishmentTypes {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].Name < types[j].Name })
+	return types, nil
+}
+
+// PutPunishmentType registers a punishment type, or replaces the type with the same name.
+func (s *MockStore) PutPunishmentType(t PunishmentType) error {
+	err := t.Validate()
+	if err != nil {
+		return err
+	}
+
+	s.punishmentTypes[t.Name] = t
+	return nil
+}
+
+// DelPunishmentType removes a punishment type from the registry, unless it is built in or in use.
+func (s *MockStore) DelPunishmentType(name string) error {
+	if _, ok := s.punishmentTypes[name]; !ok {
+		return ErrPunishmentTypeNotFound
+	}
+	if isBuiltinPunishmentType(name) {
+		return ErrBuiltinPunishmentType
+	}
+
+	for _, p := range s.punishments {
+		if p.Type == name {
+			return ErrPunishmentTypeInUse
+		}
+	}
+
+	delete(s.punishmentTypes, name)
+	return nil
+}
+
+// Purchase sells an item to a player.
+func (s *MockStore) Purchase(steamid, item string, now time.Time) (Receipt, Profile, error) {
+	it, err := s.GetItem(item)
+	if err != nil {
+		return Receipt{}, Profile{}, err
+	}
+
+	p, err := s.GetProfile(steamid)
+	if err != nil {
+		return Receipt{}, p, err
+	}
+
+	r, err := buy(&p, it, now)
+	if err != nil {
+		return r, p, err
+	}
+
+	err = s.PutProfileBy(p, steamid)
+	if err != nil {
+		return r, p, err
+	}
+
+	r.ID = int64(len(s.receipts) + 1)
+	s.receipts[r.ID] = r
+	s.logInventoryEvent(purchaseEvent(r))
+	return r, p, nil
+}
+
+// Refund reverses a purchase.
+func (s *MockStore) Refund(receiptID int64, now time.Time) (Receipt, Profile, error) {
+	r, err := s.GetReceipt(receiptID)
+	if err != nil {
+		return r, Profile{}, err
+	}
+
+	p, err := s.GetProfile(r.PlayerID)
+	if err != nil {
+		return r, p, err
+	}
+
+	settings, err := refund(&p, &r, now)
+	if err != nil {
+		return r, p, err
+	}
+
+	err = s.PutProfileBy(p, r.PlayerID)
+	if err != nil {
+		return r, p, err
+	}
+
+	s.receipts[r.ID] = r
+	s.logInventoryEvent(refundEvent(r, settings))
+	return r, p, nil
+}
+
+// GetReceipt returns the receipt with the given ID.
+func (s *MockStore) GetReceipt(id int64) (Receipt, error) {
+	r, ok := s.receipts[id]
+	if !ok {
+		return r, ErrReceiptNotFound
+	}
+	return r, nil
+}
+
+// GetReceipts returns a player's receipts, newest first.
+func (s *MockStore) GetReceipts(steamid string) ([]Receipt, error) {
+	rs := []Receipt{}
+	for _, r := range s.receipts {
+		if r.PlayerID == steamid {
+			rs = append(rs, r)
+		}
+	}
+
+	sort.Slice(rs, func(i, j int) bool { return rs[i].ID > rs[j].ID })
+	return rs, nil
+}
+
+// logInventoryEvent appends an event to the inventory log.
+func (s *MockStore) logInventoryEvent(e InventoryEvent) InventoryEvent {
+	e.ID = int64(len(s.inventoryEvents) + 1)
+	s.inventoryEvents = append(s.inventoryEvents, e)
+	return e
+}
+
+// ChangeInventory changes a single inventory item and logs the change.
+func (s *MockStore) ChangeInventory(e InventoryEvent) (InventoryEvent, Profile, error) {
+	it, err := s.GetItem(e.Item)
+	if err != nil {
+		return e, Profile{}, err
+	}
+
+	p, err := s.GetProfile(e.PlayerID)
+	if err != nil {
+		return e, p, err
+	}
+
+	err = applyInventoryEvent(&p, it, &e)
+	if err != nil {
+		return e, p, err
+	}
+
+	err = s.PutProfileBy(p, e.By)
+	if err != nil {
+		return e, p, err
+	}
+
+	return s.logInventoryEvent(e), p, nil
+}
+
+// GetInventoryEvents returns a player's inventory log, newest first.
+func (s *MockStore) GetInventoryEvents(steamid string) ([]InventoryEvent, error) {
+	es := []InventoryEvent{}
+	for i := len(s.inventoryEvents) - 1; i >= 0; i-- {
+		if s.inventoryEvents[i].PlayerID == steamid {
+			es = append(es, s.inventoryEvents[i])
+		}
+	}
+	return es, nil
+}
+
+// GetHistory returns a player's profile versions, newest first.
+func (s *MockStore) GetHistory(steamid string) ([]ProfileVersion, error) {
+	vs := []ProfileVersion{}
+	for i := len(s.history[steamid]) - 1; i >= 0; i-- {
+		vs = append(vs, s.history[steamid][i])
+	}
+	return vs, nil
+}
+
+// GetVersion returns a single version of a player's profile.
+func (s *MockStore) GetVersion(steamid string, version int64) (ProfileVersion, error) {
+	vs := s.history[steamid]
+	if version < 1 || version > int64(len(vs)) {
+		return ProfileVersion{}, ErrVersionNotFound
+	}
+	return vs[version-1], nil
+}
+
+// GetWebhooks returns every webhook, ordered by ID.
+func (s *MockStore) GetWebhooks() ([]Webhook, error) {
+	s.webhooksMu.Lock()
+	defer s.webhooksMu.Unlock()
+	return append([]Webhook{}, s.webhooks...), nil
+}
+
+// GetWebhook returns the webhook with the given ID.
+func (s *MockStore) GetWebhook(id int64) (Webhook, error) {
+	s.webhooksMu.Lock()
+	defer s.webhooksMu.Unlock()
+	for _, w := range s.webhooks {
+		if w.ID == id {
+			return w, nil
+		}
+	}
+	return Webhook{}, ErrWebhookNotFound
+}
+
+// PutWebhook creates or replaces a webhook.
+func (s *MockStore) PutWebhook(w Webhook) (Webhook, error) {
+	err := w.Validate()
+	if err != nil {
+		return w, err
+	}
+
+	s.webhooksMu.Lock()
+	defer s.webhooksMu.Unlock()
+
+	if w.ID == 0 {
+		s.webhookSeq++
+		w.ID = s.webhookSeq
+		s.webhooks = append(s.webhooks, w)
+		return w, nil
+	}
+	for i := range s.webhooks {
+		if s.webhooks[i].ID == w.ID {
+			s.webhooks[i] = w
+			return w, nil
+		}
+	}
+	return w, ErrWebhookNotFound
+}
+
+// DelWebhook removes a webhook. Its deliveries are kept in the log.
+func (s *MockStore) DelWebhook(id int64) error {
+	s.webhooksMu.Lock()
+	defer s.webhooksMu.Unlock()
+	for i, w := range s.webhooks {
+		if w.ID == id {
+			s.webhooks = append(s.webhooks[:i], s.webhooks[i+1:]...)
+			return nil
+		}
+	}
+	return ErrWebhookNotFound
+}
+
+// GetDelivery returns the delivery with the given ID.
+func (s *MockStore) GetDelivery(id int64) (Delivery, error) {
+	s.webhooksMu.Lock()
+	defer s.webhooksMu.Unlock()
+	if id < 1 || id > int64(len(s.deliveries)) {
+		return Delivery{}, ErrDeliveryNotFound
+	}
+	return s.deliveries[id-1], nil
+}
+
+// PutDelivery creates or updates a delivery.
+func (s *MockStore) PutDelivery(d Delivery) (Delivery, error) {
+	s.webhooksMu.Lock()
+	defer s.webhooksMu.Unlock()
+	if d.ID == 0 {
+		d.ID = int64(len(s.deliveries)) + 1
+		s.deliveries = append(s.deliveries, d)
+		return d, nil
+	}
+	if d.ID > int64(len(s.deliveries)) {
+		return d, ErrDeliveryNotFound
+	}
+	s.deliveries[d.ID-1] = d
+	return d, nil
+}
+
+// QueryDeliveries returns the deliveries matching q, newest first.
+func (s *MockStore) QueryDeliveries(q DeliveryQuery) ([]Delivery, error) {
+	ds := []Delivery{}
+
+	err := q.normalize()
+	if err != nil {
+		return ds, err
+	}
+
+	s.webhooksMu.Lock()
+	defer s.webhooksMu.Unlock()
+	for i := len(s.deliveries) - 1; i >= 0 && len(ds) < q.Limit; i-- {
+		if q.matches(s.deliveries[i]) {
+			ds = append(ds, s.deliveries[i])
+		}
+	}
+	return ds, nil
+}
+
+// FileAppeal opens an appeal against a punishment in force.
+func (s *MockStore) FileAppeal(punishmentID int64, e AppealEvent) (Appeal, error) {
+	p, err := s.GetPunishment(punishmentID)
+	if err != nil {
+		return Appeal{}, err
+	}
+
+	for _, a := range s.appeals {
+		if a.PunishmentID == punishmentID && a.Status == AppealOpen {
+			return Appeal{}, ErrAppealExists
+		}
+	}
+
+	a, err := openAppeal(p, e)
+	if err != nil {
+		return a, err
+	}
+
+	a.ID = int64(len(s.appeals)) + 1
+	s.appeals = append(s.appeals, a)
+	return a, nil
+}
+
+// GetAppeal returns the appeal with the given ID.
+func (s *MockStore) GetAppeal(id int64) (Appeal, error) {
+	if id < 1 || id > int64(len(s.appeals)) {
+		return Appeal{}, ErrAppealNotFound
+	}
+	return s.appeals[id-1], nil
+}
+
+// QueryAppeals returns the appeals matching q, newest first.
+func (s *MockStore) QueryAppeals(q AppealQuery) ([]Appeal, error) {
+	as := []Appeal{}
+
+	err := q.normalize()
+	if err != nil {
+		return as, err
+	}
+
+	for i := len(s.appeals) - 1; i >= 0 && len(as) < q.Limit; i-- {
+		if q.matches(s.appeals[i]) {
+			as = append(as, s.appeals[i])
+		}
+	}
+	return as, nil
+}
+
+// RecordAppealEvent adds a comment or the decision to an appeal, changing the punishment when it is accepted.
+func (s *MockStore) RecordAppealEvent(id int64, e AppealEvent) (Appeal, Punishment, error) {
+	a, err := s.GetAppeal(id)
+	if err != nil {
+		return a, Punishment{}, err
+	}
+
+	p, err := s.GetPunishment(a.PunishmentID)
+	if err != nil {
+		return a, p, err
+	}
+
+	// The history is copied, so that a rejected event leaves the stored appeal alone.
+	a.History = append(AppealHistory{}, a.History...)
+	err = a.record(&p, e)
+	if err != nil {
+		return a, p, err
+	}
+
+	s.punishments[p.ID] = p
+	s.appeals[id-1] = a
+	return a, p, nil
+}
@@ -1,11 +1,15 @@
 package profile
 
 import (
-	"errors"
+	"strings"
+	"time"
 
 	pg "gopkg.in/pg.v4"
 )
 
+// eachBatchSize is the number of rows fetched per query while iterating over a table.
+const eachBatchSize = 500
+
 // PostgresStore stores a reference to the database and has methods for interacting with it.
 type PostgresStore struct {
 	db *pg.DB
@@ -23,6 +27,11 @@ func NewPostgresStore(db *pg.DB) *PostgresStore {
 		panic(err)
 	}
 
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS profiles_coins_idx ON profiles (coins, id)`)
+	if err != nil {
+		panic(err)
+	}
+
 	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS punishments (
 		id BIGSERIAL,
 		player_id TEXT NOT NULL,
@@ -36,23 +45,373 @@ func NewPostgresStore(db *pg.DB) *PostgresStore {
 	if err != nil {
 		panic(err)
 	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS items (
+		name TEXT PRIMARY KEY,
+		slot TEXT,
+		price BIGINT,
+		tradable BOOLEAN,
+		settings JSONB
+	)`)
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE punishments ADD COLUMN IF NOT EXISTS game_mode TEXT, ADD COLUMN IF NOT EXISTS server TEXT`)
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS punishment_types (
+		name TEXT PRIMARY KEY,
+		scope TEXT NOT NULL,
+		default_duration TEXT
+	)`)
+	if err != nil {
+		panic(err)
+	}
+
+	// Register the built-in types, and the types of punishments stored by older versions so they can still be given.
+	for _, t := range BuiltinPunishmentTypes {
+		_, err = db.Exec(`INSERT INTO punishment_types (name, scope, default_duration) VALUES (?, ?, ?)
+			ON CONFLICT (name) DO NOTHING`, t.Name, t.Scope, t.DefaultDuration)
+		if err != nil {
+			panic(err)
+		}
+	}
+	_, err = db.Exec(`INSERT INTO punishment_types (name, scope, default_duration)
+		SELECT DISTINCT lower(type), ?, '' FROM punishments WHERE lower(type) ~ '^[a-z0-9_]+$'
+		ON CONFLICT (name) DO NOTHING`, ScopeGlobal)
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS profile_versions (
+		player_id TEXT NOT NULL,
+		version BIGINT NOT NULL,
+		old JSONB,
+		new JSONB,
+		by TEXT,
+		date TIMESTAMP,
+		PRIMARY KEY(player_id, version)
+	)`)
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS receipts (
+		id BIGSERIAL PRIMARY KEY,
+		player_id TEXT NOT NULL,
+		item TEXT NOT NULL,
+		price BIGINT,
+		date TIMESTAMP,
+		refunded TIMESTAMP
+	)`)
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS receipts_player_idx ON receipts (player_id, id)`)
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS inventory_events (
+		id BIGSERIAL PRIMARY KEY,
+		player_id TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		item TEXT NOT NULL,
+		settings TEXT,
+		old_settings TEXT,
+		coins BIGINT,
+		by TEXT,
+		date TIMESTAMP
+	)`)
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS inventory_events_player_idx ON inventory_events (player_id, id)`)
+	if err != nil {
+		panic(err)
+	}
+
+	// Event types and punishment types are PostgreSQL arrays, which is how the driver encodes string slices.
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS webhooks (
+		id BIGSERIAL PRIMARY KEY,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		events TEXT[],
+		punishment_types TEXT[],
+		min_coin_delta BIGINT
+	)`)
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS deliveries (
+		id BIGSERIAL PRIMARY KEY,
+		webhook_id BIGINT NOT NULL,
+		event JSONB,
+		status TEXT NOT NULL,
+		attempts INTEGER,
+		last_error TEXT,
+		last_status_code INTEGER,
+		next_attempt TIMESTAMP,
+		created TIMESTAMP,
+		updated TIMESTAMP
+	)`)
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS deliveries_webhook_idx ON deliveries (webhook_id, id)`)
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS deliveries_status_idx ON deliveries (status, id)`)
+	if err != nil {
+		panic(err)
+	}
+
+	// The history of an appeal is only ever read with the appeal, so it is kept as JSON. The unique index allows a
+	// single open appeal per punishment.
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS appeals (
+		id BIGSERIAL PRIMARY KEY,
+		punishment_id BIGINT NOT NULL,
+		player_id TEXT NOT NULL,
+		status TEXT NOT NULL,
+		created TIMESTAMP,
+		updated TIMESTAMP,
+		history JSONB
+	)`)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, idx := range []string{
+		`CREATE INDEX IF NOT EXISTS appeals_status_idx ON appeals (status, id)`,
+		`CREATE INDEX IF NOT EXISTS appeals_player_idx ON appeals (player_id, id)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS appeals_open_idx ON appeals (punishment_id) WHERE status = 'open'`,
+	} {
+		_, err = db.Exec(idx)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// Punishment IDs are unique on their own, as GetPunishment and appeals look punishments up by ID alone. The key
+	// of the table also holds the type because of older versions; databases they left with duplicate IDs fail here.
+	_, err = db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS punishments_id_idx ON punishments (id)`)
+	if err != nil {
+		panic(err)
+	}
+
+	// Indexes for QueryPunishments. Each starts with the field it filters on and ends with the date it sorts by.
+	for _, idx := range []string{
+		`CREATE INDEX IF NOT EXISTS punishments_player_idx ON punishments (player_id, date)`,
+		`CREATE INDEX IF NOT EXISTS punishments_by_idx ON punishments (by, date)`,
+		`CREATE INDEX IF NOT EXISTS punishments_type_idx ON punishments (type, date)`,
+		`CREATE INDEX IF NOT EXISTS punishments_date_idx ON punishments (date)`,
+		`CREATE INDEX IF NOT EXISTS punishments_expires_idx ON punishments (expires)`,
+	} {
+		_, err = db.Exec(idx)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// Reason searches use a trigram index when the pg_trgm extension is available, and a sequential scan otherwise.
+	_, err = db.Exec(`CREATE EXTENSION IF NOT EXISTS pg_trgm`)
+	if err == nil {
+		db.Exec(`CREATE INDEX IF NOT EXISTS punishments_reason_idx ON punishments USING gin (reason gin_trgm_ops)`)
+	}
 	return &PostgresStore{db}
 }
 
-// GetProfile retrieves a player's profile from the database, or an empty one if not found.
-func (s PostgresStore) GetProfile(playerID string) (p Profile, err error) {
-	p = Profile{ID: playerID}
-	err = s.db.Select(&p)
+// GetProfile retrieves a player's profile from the database, or ErrProfileNotFound if there is none.
+func (s PostgresStore) GetProfile(playerID string) (Profile, error) {
+	p := Profile{ID: playerID}
+	err := s.db.Select(&p)
+	if err == pg.ErrNoRows {
+		return Profile{}, ErrProfileNotFound
+	}
 	return p, err
 }
 
-// PutProfile puts a profile into the database.
+// GetProfiles reads many profiles with a single IN query.
+func (s PostgresStore) GetProfiles(playerIDs []string) (map[string]Profile, error) {
+	ps := map[string]Profile{}
+	if len(playerIDs) == 0 {
+		return ps, nil
+	}
+
+	var rows []Profile
+	err := s.db.Model(&rows).Where("id IN (?)", pg.In(playerIDs)).Select()
+	if err != nil {
+		return ps, err
+	}
+
+	for _, p := range rows {
+		ps[p.ID] = p
+	}
+	return ps, nil
+}
+
+// PutProfile validates a profile against the item catalog and puts it into the database.
 func (s PostgresStore) PutProfile(p Profile) error {
-	err := s.db.Create(&p)
+	return s.PutProfileBy(p, "")
+}
+
+// PutProfileBy stores a profile and records by as the caller in its history, in a single transaction.
+func (s PostgresStore) PutProfileBy(p Profile, by string) error {
+	return s.db.RunInTransaction(func(tx *pg.Tx) error {
+		var old *Profile
+		prev, err := lockProfile(tx, p.ID)
+		if err == nil {
+			old = &prev
+		} else if err != ErrProfileNotFound {
+			return err
+		}
+
+		err = s.validateProfile(tx, old, p)
+		if err != nil {
+			return err
+		}
+
+		return writeProfile(tx, old, p, by)
+	})
+}
+
+// writeProfile writes a profile over old, which is nil for new profiles, inside a transaction
+// and records the write in the profile's history.
+func writeProfile(tx *pg.Tx, old *Profile, p Profile, by string) error {
+	var err error
+	if old == nil {
+		err = tx.Create(&p)
+	} else {
+		_, err = tx.Model(&p).Update()
+	}
 	if err != nil {
-		_, err = s.db.Model(&p).Update()
+		return err
 	}
-	return err
+
+	var last struct {
+		Version int64
+	}
+	_, err = tx.QueryOne(&last, `SELECT COALESCE(MAX(version), 0) AS version FROM profile_versions WHERE player_id = ?`, p.ID)
+	if err != nil {
+		return err
+	}
+
+	v := newVersion(last.Version, old, p, by)
+	return tx.Create(&v)
+}
+
+// ListProfiles returns a page of profiles using keyset pagination on (coins, id) or id.
+func (s PostgresStore) ListProfiles(opts ListOptions) (ProfilePage, error) {
+	after, err := opts.normalize()
+	if err != nil {
+		return ProfilePage{}, err
+	}
+
+	cmp, dir := ">", "ASC"
+	if opts.Desc {
+		cmp, dir = "<", "DESC"
+	}
+
+	var ps []Profile
+	q := s.db.Model(&ps).Limit(opts.Limit + 1)
+
+	if opts.SortBy == SortByCoins {
+		q = q.Order("coins "+dir, "id "+dir)
+		if after != nil {
+			q = q.Where("(coins, id) "+cmp+" (?, ?)", after.Coins, after.ID)
+		}
+	} else {
+		q = q.Order("id " + dir)
+		if after != nil {
+			q = q.Where("id "+cmp+" ?", after.ID)
+		}
+	}
+
+	err = q.Select()
+	if err != nil {
+		return ProfilePage{}, err
+	}
+
+	return opts.page(ps), nil
+}
+
+// TopProfiles returns the n richest players. Only the top rows of the coins index are ranked.
+func (s PostgresStore) TopProfiles(n int) ([]Ranking, error) {
+	n = clampLeaderboardSize(n, MaxLeaderboardSize)
+
+	rs := []Ranking{}
+	_, err := s.db.Query(&rs, `SELECT rank() OVER (ORDER BY coins DESC) AS rank, id, coins
+		FROM (SELECT id, coins FROM profiles ORDER BY coins DESC, id DESC LIMIT ?) AS top
+		ORDER BY coins DESC, id DESC`, n)
+	return rs, err
+}
+
+// GetStanding returns a player's rank and the n players above and below them.
+// The neighbours are read with keyset queries on the coins index, and ranked with two counts.
+func (s PostgresStore) GetStanding(steamid string, n int) (Standing, error) {
+	if n < 0 {
+		n = 0
+	}
+	if n > MaxStandingNeighbors {
+		n = MaxStandingNeighbors
+	}
+
+	var st Standing
+	p, err := s.GetProfile(steamid)
+	if err != nil {
+		return st, err
+	}
+
+	var above, below []Profile
+	err = s.db.Model(&above).Where("(coins, id) > (?, ?)", p.Coins, p.ID).
+		Order("coins ASC", "id ASC").Limit(n).Select()
+	if err != nil {
+		return st, err
+	}
+	err = s.db.Model(&below).Where("(coins, id) < (?, ?)", p.Coins, p.ID).
+		Order("coins DESC", "id DESC").Limit(n).Select()
+	if err != nil {
+		return st, err
+	}
+
+	// Put everything in leaderboard order and find the position of the first row.
+	rows := make([]Profile, 0, len(above)+1+len(below))
+	for i := len(above) - 1; i >= 0; i-- {
+		rows = append(rows, above[i])
+	}
+	rows = append(rows, p)
+	rows = append(rows, below...)
+
+	pos, err := s.db.Model(&Profile{}).Where("(coins, id) > (?, ?)", rows[0].Coins, rows[0].ID).Count()
+	if err != nil {
+		return st, err
+	}
+	rank, err := s.db.Model(&Profile{}).Where("coins > ?", rows[0].Coins).Count()
+	if err != nil {
+		return st, err
+	}
+
+	// Continue ranking from the first row, as if the leaderboard had been walked from the top.
+	r := ranker{pos: int64(pos), rank: int64(rank) + 1, coins: rows[0].Coins}
+
+	rs := make([]Ranking, len(rows))
+	for i, row := range rows {
+		rs[i] = r.next(row.ID, row.Coins)
+	}
+
+	st.Above = rs[:len(above)]
+	st.Ranking = rs[len(above)]
+	st.Below = rs[len(above)+1:]
+	return st, nil
 }
 
 // GetCoins
@@ -64,32 +423,819 @@ func (s PostgresStore) GetPunishments(steamid string) (map[string]Punishment, er
 	var r []Punishment
 	m := make(map[string]Punishment)
 
-	err := s.db.Model(&r).Where("player_id = ?", steamid).Select()
+	err := s.db.Model(&r).Where("player_id = ?", steamid).Order("id").Select()
 	if err != nil {
 		return m, err
 	}
 
+	// Later punishments replace earlier ones of the same type and scope.
 	for _, v := range r {
-		m[v.Type] = v
+		m[v.Key()] = v
 	}
 
 	if len(m) == 0 {
-		return m, errors.New("No punishments found.")
+		return m, ErrNoPunishments
 	}
 
 	return m, err
 }
 
-// PutPunishment adds a punishment to the database.
-func (s PostgresStore) PutPunishment(p Punishment) error {
-	err := s.db.Create(&p)
+// GetPunishment returns the punishment with the given ID.
+func (s PostgresStore) GetPunishment(punishmentID int64) (Punishment, error) {
+	var ps []Punishment
+	err := s.db.Model(&ps).Where("id = ?", punishmentID).Limit(1).Select()
+	if err != nil {
+		return Punishment{}, err
+	}
+
+	if len(ps) == 0 {
+		return Punishment{}, ErrPunishmentNotFound
+	}
+	return ps[0], nil
+}
+
+// PutPunishment adds a punishment of a registered type to the database.
+func (s PostgresStore) PutPunishment(p Punishment) (Punishment, error) {
+	p, err := PreparePunishment(p, time.Now(), s.lookupPunishmentType)
+	if err != nil {
+		return p, err
+	}
+
+	err = s.db.RunInTransaction(func(tx *pg.Tx) error {
+		return insertPunishment(tx, &p)
+	})
+	return p, err
+}
 
+// ImportPunishment adds a punishment to the database under its ID, or the next one of the sequence if it has none.
+func (s PostgresStore) ImportPunishment(p Punishment) (Punishment, error) {
+	p, err := prepareRecord(p, time.Now(), s.lookupPunishmentType)
+	if err != nil {
+		return p, err
+	}
+
+	err = s.db.RunInTransaction(func(tx *pg.Tx) error {
+		if p.ID != 0 {
+			n, err := tx.Model(&Punishment{}).Where("id = ?", p.ID).Count()
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				return ErrPunishmentExists
+			}
+		}
+		return insertPunishment(tx, &p)
+	})
+	return p, err
+}
+
+// insertPunishment inserts a punishment inside a transaction. Punishments without an ID get the next one of the
+// sequence, which is moved past IDs given explicitly by an import, so that later punishments do not reuse them.
+func insertPunishment(tx *pg.Tx, p *Punishment) error {
+	explicit := p.ID != 0
+	err := tx.Create(p)
+	if err != nil || !explicit {
+		return err
+	}
+
+	// The sequence never moves back, as other transactions may have taken IDs above the highest stored one.
+	_, err = tx.Exec(`SELECT setval('punishments_id_seq', GREATEST(max(id), (SELECT last_value FROM punishments_id_seq)))
+		FROM punishments`)
 	return err
 }
 
 // DelPunishment deletes a punishment from the database.
 func (s PostgresStore) DelPunishment(punishmentID int64) error {
-	p := Punishment{ID: punishmentID}
-	err := s.db.Delete(&p)
+	res, err := s.db.Model(&Punishment{}).Where("id = ?", punishmentID).Delete()
+	if err != nil {
+		return err
+	}
+
+	if res.Affected() == 0 {
+		return ErrPunishmentNotFound
+	}
+	return nil
+}
+
+// QueryPunishments returns the punishments matching q, newest first.
+func (s PostgresStore) QueryPunishments(q PunishmentQuery) ([]Punishment, error) {
+	err := q.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	var ps []Punishment
+	query := s.db.Model(&ps).Order("date DESC", "id DESC").Limit(q.Limit)
+
+	if q.PlayerID != "" {
+		query = query.Where("player_id = ?", q.PlayerID)
+	}
+	if q.By != "" {
+		query = query.Where(`"by" = ?`, q.By)
+	}
+	if q.Type != "" {
+		query = query.Where("type = ?", q.Type)
+	}
+	if !q.Since.IsZero() {
+		query = query.Where("date >= ?", q.Since)
+	}
+	if !q.Until.IsZero() {
+		query = query.Where("date < ?", q.Until)
+	}
+
+	switch q.Status {
+	case StatusActive:
+		query = query.Where("(expires IS NULL OR expires > ?)", q.Now)
+	case StatusExpired:
+		query = query.Where("expires <= ?", q.Now)
+	}
+
+	if q.Reason != "" {
+		query = query.Where(`reason ILIKE ? ESCAPE '\'`, "%"+likeEscaper.Replace(q.Reason)+"%")
+	}
+
+	err = query.Select()
+	if ps == nil {
+		ps = []Punishment{}
+	}
+	return ps, err
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// EachProfile calls fn for every profile in the database, fetching them in batches ordered by ID.
+func (s PostgresStore) EachProfile(fn func(Profile) error) error {
+	last := ""
+	for {
+		var ps []Profile
+		err := s.db.Model(&ps).Where("id > ?", last).Order("id").Limit(eachBatchSize).Select()
+		if err != nil {
+			return err
+		}
+
+		for _, p := range ps {
+			err = fn(p)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(ps) < eachBatchSize {
+			return nil
+		}
+		last = ps[len(ps)-1].ID
+	}
+}
+
+// EachPunishment calls fn for every punishment in the database, fetching them in batches ordered by ID.
+func (s PostgresStore) EachPunishment(fn func(Punishment) error) error {
+	var last int64 = -1
+	for {
+		var ps []Punishment
+		err := s.db.Model(&ps).Where("id > ?", last).Order("id").Limit(eachBatchSize).Select()
+		if err != nil {
+			return err
+		}
+
+		for _, p := range ps {
+			err = fn(p)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(ps) < eachBatchSize {
+			return nil
+		}
+		last = ps[len(ps)-1].ID
+	}
+}
+
+// validateProfile loads the catalog entries of the items a profile write changes, and validates it against old,
+// the profile it replaces.
+func (s PostgresStore) validateProfile(tx *pg.Tx, old *Profile, p Profile) error {
+	items := map[string]Item{}
+
+	names := changedItems(old, p)
+	for _, name := range p.Equipment {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) > 0 {
+		var found []Item
+		err := tx.Model(&found).Where("name IN (?)", pg.In(names)).Select()
+		if err != nil {
+			return err
+		}
+
+		for _, it := range found {
+			items[it.Name] = it
+		}
+	}
+
+	return ValidateProfile(old, p, itemLookup(items))
+}
+
+// GetItem returns the catalog item with the given name.
+func (s PostgresStore) GetItem(name string) (Item, error) {
+	var items []Item
+	err := s.db.Model(&items).Where("name = ?", name).Select()
+	if err != nil {
+		return Item{}, err
+	}
+
+	if len(items) == 0 {
+		return Item{}, ErrItemNotFound
+	}
+	return items[0], nil
+}
+
+// GetItems returns the whole catalog, ordered by name.
+func (s PostgresStore) GetItems() ([]Item, error) {
+	items := []Item{}
+	err := s.db.Model(&items).Order("name").Select()
+	return items, err
+}
+
+// PutItem adds an item to the catalog, or replaces the item with the same name.
+func (s PostgresStore) PutItem(it Item) error {
+	err := it.Validate()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`INSERT INTO items (name, slot, price, tradable, settings) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET slot = EXCLUDED.slot, price = EXCLUDED.price,
+		tradable = EXCLUDED.tradable, settings = EXCLUDED.settings`,
+		it.Name, it.Slot, it.Price, it.Tradable, it.Settings)
+	return err
+}
+
+// DelItem removes an item from the catalog, unless a profile owns it.
+func (s PostgresStore) DelItem(name string) error {
+	owners, err := s.db.Model(&Profile{}).Where("inventory -> ? IS NOT NULL", name).Count()
+	if err != nil {
+		return err
+	}
+	if owners > 0 {
+		return ErrItemInUse
+	}
+
+	res, err := s.db.Model(&Item{}).Where("name = ?", name).Delete()
+	if err != nil {
+		return err
+	}
+	if res.Affected() == 0 {
+		return ErrItemNotFound
+	}
+	return nil
+}
+
+// lookupPunishmentType looks punishment types up for PreparePunishment.
+func (s PostgresStore) lookupPunishmentType(name string) (PunishmentType, bool) {
+	t, err := s.GetPunishmentType(name)
+	return t, err == nil
+}
+
+// GetPunishmentType returns the registered punishment type with the given name.
+func (s PostgresStore) GetPunishmentType(name string) (PunishmentType, error) {
+	var types []PunishmentType
+	err := s.db.Model(&types).Where("name = ?", name).Select()
+	if err != nil {
+		return PunishmentType{}, err
+	}
+
+	if len(types) == 0 {
+		return PunishmentType{}, ErrPunishmentTypeNotFound
+	}
+	return types[0], nil
+}
+
+// GetPunishmentTypes returns every registered punishment type, ordered by name.
+func (s PostgresStore) GetPunishmentTypes() ([]PunishmentType, error) {
+	types := []PunishmentType{}
+	err := s.db.Model(&types).Order("name").Select()
+	return types, err
+}
+
+// PutPunishmentType registers a punishment type, or replaces the type with the same name.
+func (s PostgresStore) PutPunishmentType(t PunishmentType) error {
+	err := t.Validate()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`INSERT INTO punishment_types (name, scope, default_duration) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET scope = EXCLUDED.scope, default_duration = EXCLUDED.default_duration`,
+		t.Name, t.Scope, t.DefaultDuration)
 	return err
 }
+
+// DelPunishmentType removes a punishment type from the registry, unless it is built in or in use.
+func (s PostgresStore) DelPunishmentType(name string) error {
+	if isBuiltinPunishmentType(name) {
+		_, err := s.GetPunishmentType(name)
+		if err != nil {
+			return err
+		}
+		return ErrBuiltinPunishmentType
+	}
+
+	used, err := s.db.Model(&Punishment{}).Where("type = ?", name).Count()
+	if err != nil {
+		return err
+	}
+	if used > 0 {
+		return ErrPunishmentTypeInUse
+	}
+
+	res, err := s.db.Model(&PunishmentType{}).Where("name = ?", name).Delete()
+	if err != nil {
+		return err
+	}
+	if res.Affected() == 0 {
+		return ErrPunishmentTypeNotFound
+	}
+	return nil
+}
+
+// lockProfile reads a profile inside a transaction, locking its row until the transaction ends.
+func lockProfile(tx *pg.Tx, steamid string) (Profile, error) {
+	var ps []Profile
+	_, err := tx.Query(&ps, `SELECT * FROM profiles WHERE id = ? FOR UPDATE`, steamid)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	if len(ps) == 0 {
+		return Profile{}, ErrProfileNotFound
+	}
+	return ps[0], nil
+}
+
+// Purchase sells an item to a player in a single transaction, holding a lock on the profile.
+// The item is added without settings and equipment is left alone, so the profile stays valid.
+func (s PostgresStore) Purchase(steamid, item string, now time.Time) (Receipt, Profile, error) {
+	var r Receipt
+	var p Profile
+
+	it, err := s.GetItem(item)
+	if err != nil {
+		return r, p, err
+	}
+
+	err = s.db.RunInTransaction(func(tx *pg.Tx) error {
+		var err error
+		p, err = lockProfile(tx, steamid)
+		if err != nil {
+			return err
+		}
+		old := p
+
+		r, err = buy(&p, it, now)
+		if err != nil {
+			return err
+		}
+
+		err = writeProfile(tx, &old, p, steamid)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Create(&r)
+		if err != nil {
+			return err
+		}
+
+		e := purchaseEvent(r)
+		return tx.Create(&e)
+	})
+
+	return r, p, err
+}
+
+// Refund reverses a purchase in a single transaction, holding locks on the receipt and the profile.
+func (s PostgresStore) Refund(receiptID int64, now time.Time) (Receipt, Profile, error) {
+	var r Receipt
+	var p Profile
+
+	err := s.db.RunInTransaction(func(tx *pg.Tx) error {
+		var rs []Receipt
+		_, err := tx.Query(&rs, `SELECT * FROM receipts WHERE id = ? FOR UPDATE`, receiptID)
+		if err != nil {
+			return err
+		}
+		if len(rs) == 0 {
+			return ErrReceiptNotFound
+		}
+		r = rs[0]
+
+		p, err = lockProfile(tx, r.PlayerID)
+		if err != nil {
+			return err
+		}
+		old := p
+
+		settings, err := refund(&p, &r, now)
+		if err != nil {
+			return err
+		}
+
+		err = writeProfile(tx, &old, p, r.PlayerID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Model(&r).Update()
+		if err != nil {
+			return err
+		}
+
+		e := refundEvent(r, settings)
+		return tx.Create(&e)
+	})
+
+	return r, p, err
+}
+
+// GetReceipt returns the receipt with the given ID.
+func (s PostgresStore) GetReceipt(id int64) (Receipt, error) {
+	var rs []Receipt
+	err := s.db.Model(&rs).Where("id = ?", id).Select()
+	if err != nil {
+		return Receipt{}, err
+	}
+
+	if len(rs) == 0 {
+		return Receipt{}, ErrReceiptNotFound
+	}
+	return rs[0], nil
+}
+
+// GetReceipts returns a player's receipts, newest first.
+func (s PostgresStore) GetReceipts(steamid string) ([]Receipt, error) {
+	rs := []Receipt{}
+	err := s.db.Model(&rs).Where("player_id = ?", steamid).Order("id DESC").Select()
+	return rs, err
+}
+
+// ChangeInventory changes a single inventory item and logs the change in a single transaction,
+// holding a lock on the profile.
+func (s PostgresStore) ChangeInventory(e InventoryEvent) (InventoryEvent, Profile, error) {
+	var p Profile
+
+	it, err := s.GetItem(e.Item)
+	if err != nil {
+		return e, p, err
+	}
+
+	err = s.db.RunInTransaction(func(tx *pg.Tx) error {
+		var err error
+		p, err = lockProfile(tx, e.PlayerID)
+		if err != nil {
+			return err
+		}
+		old := p
+
+		err = applyInventoryEvent(&p, it, &e)
+		if err != nil {
+			return err
+		}
+
+		err = s.validateProfile(tx, &old, p)
+		if err != nil {
+			return err
+		}
+
+		err = writeProfile(tx, &old, p, e.By)
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&e)
+	})
+
+	return e, p, err
+}
+
+// GetInventoryEvents returns a player's inventory log, newest first.
+func (s PostgresStore) GetInventoryEvents(steamid string) ([]InventoryEvent, error) {
+	es := []InventoryEvent{}
+	err := s.db.Model(&es).Where("player_id = ?", steamid).Order("id DESC").Select()
+	return es, err
+}
+
+// GetHistory returns a player's profile versions, newest first.
+func (s PostgresStore) GetHistory(steamid string) ([]ProfileVersion, error) {
+	vs := []ProfileVersion{}
+	err := s.db.Model(&vs).Where("player_id = ?", steamid).Order("version DESC").Select()
+	return vs, err
+}
+
+// GetVersion returns a single version of a player's profile.
+func (s PostgresStore) GetVersion(steamid string, version int64) (ProfileVersion, error) {
+	var vs []ProfileVersion
+	err := s.db.Model(&vs).Where("player_id = ? AND version = ?", steamid, version).Select()
+	if err != nil {
+		return ProfileVersion{}, err
+	}
+
+	if len(vs) == 0 {
+		return ProfileVersion{}, ErrVersionNotFound
+	}
+	return vs[0], nil
+}
+
+// GetWebhooks returns every webhook, ordered by ID.
+func (s PostgresStore) GetWebhooks() ([]Webhook, error) {
+	hooks := []Webhook{}
+	err := s.db.Model(&hooks).Order("id").Select()
+	return hooks, err
+}
+
+// GetWebhook returns the webhook with the given ID.
+func (s PostgresStore) GetWebhook(id int64) (Webhook, error) {
+	var hooks []Webhook
+	err := s.db.Model(&hooks).Where("id = ?", id).Select()
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	if len(hooks) == 0 {
+		return Webhook{}, ErrWebhookNotFound
+	}
+	return hooks[0], nil
+}
+
+// PutWebhook creates or replaces a webhook. Replacing one that does not exist returns ErrWebhookNotFound.
+func (s PostgresStore) PutWebhook(w Webhook) (Webhook, error) {
+	err := w.Validate()
+	if err != nil {
+		return w, err
+	}
+
+	if w.ID == 0 {
+		err = s.db.Create(&w)
+		return w, err
+	}
+
+	res, err := s.db.Model(&w).Update()
+	if err != nil {
+		return w, err
+	}
+	if res.Affected() == 0 {
+		return w, ErrWebhookNotFound
+	}
+	return w, nil
+}
+
+// DelWebhook removes a webhook. Its deliveries are kept in the log.
+func (s PostgresStore) DelWebhook(id int64) error {
+	res, err := s.db.Exec(`DELETE FROM webhooks WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if res.Affected() == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// GetDelivery returns the delivery with the given ID.
+func (s PostgresStore) GetDelivery(id int64) (Delivery, error) {
+	var ds []Delivery
+	err := s.db.Model(&ds).Where("id = ?", id).Select()
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	if len(ds) == 0 {
+		return Delivery{}, ErrDeliveryNotFound
+	}
+	return ds[0], nil
+}
+
+// PutDelivery creates or updates a delivery.
+func (s PostgresStore) PutDelivery(d Delivery) (Delivery, error) {
+	if d.ID == 0 {
+		err := s.db.Create(&d)
+		return d, err
+	}
+
+	_, err := s.db.Model(&d).Update()
+	return d, err
+}
+
+// QueryDeliveries returns the deliveries matching q, newest first.
+func (s PostgresStore) QueryDeliveries(q DeliveryQuery) ([]Delivery, error) {
+	ds := []Delivery{}
+
+	err := q.normalize()
+	if err != nil {
+		return ds, err
+	}
+
+	query := s.db.Model(&ds)
+	if q.WebhookID != 0 {
+		query = query.Where("webhook_id = ?", q.WebhookID)
+	}
+	if q.Status != "" {
+		query = query.Where("status = ?", q.Status)
+	}
+
+	err = query.Order("id DESC").Limit(q.Limit).Select()
+	return ds, err
+}
+
+// lockPunishment reads a punishment inside a transaction, holding a lock on it until the transaction ends.
+func lockPunishment(tx *pg.Tx, id int64) (Punishment, error) {
+	var ps []Punishment
+	_, err := tx.Query(&ps, `SELECT * FROM punishments WHERE id = ? FOR UPDATE`, id)
+	if err != nil {
+		return Punishment{}, err
+	}
+
+	if len(ps) == 0 {
+		return Punishment{}, ErrPunishmentNotFound
+	}
+	return ps[0], nil
+}
+
+// FileAppeal opens an appeal against a punishment in force, holding a lock on the punishment.
+func (s PostgresStore) FileAppeal(punishmentID int64, e AppealEvent) (Appeal, error) {
+	var a Appeal
+
+	err := s.db.RunInTransaction(func(tx *pg.Tx) error {
+		p, err := lockPunishment(tx, punishmentID)
+		if err != nil {
+			return err
+		}
+
+		n, err := tx.Model(&Appeal{}).Where("punishment_id = ? AND status = ?", punishmentID, AppealOpen).Count()
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return ErrAppealExists
+		}
+
+		a, err = openAppeal(p, e)
+		if err != nil {
+			return err
+		}
+		return tx.Create(&a)
+	})
+
+	return a, err
+}
+
+// GetAppeal returns the appeal with the given ID.
+func (s PostgresStore) GetAppeal(id int64) (Appeal, error) {
+	var as []Appeal
+	err := s.db.Model(&as).Where("id = ?", id).Select()
+	if err != nil {
+		return Appeal{}, err
+	}
+
+	if len(as) == 0 {
+		return Appeal{}, ErrAppealNotFound
+	}
+	return as[0], nil
+}
+
+// QueryAppeals returns the appeals matching q, newest first.
+func (s PostgresStore) QueryAppeals(q AppealQuery) ([]Appeal, error) {
+	as := []Appeal{}
+
+	err := q.normalize()
+	if err != nil {
+		return as, err
+	}
+
+	query := s.db.Model(&as)
+	if q.Status != "" {
+		query = query.Where("status = ?", q.Status)
+	}
+	if q.PlayerID != "" {
+		query = query.Where("player_id = ?", q.PlayerID)
+	}
+	if q.PunishmentID != 0 {
+		query = query.Where("punishment_id = ?", q.PunishmentID)
+	}
+
+	err = query.Order("id DESC").Limit(q.Limit).Select()
+	return as, err
+}
+
+// RecordAppealEvent adds a comment or the decision to an appeal in a single transaction, holding locks on the appeal
+// and the punishment, and changes the punishment when the appeal is accepted.
+func (s PostgresStore) RecordAppealEvent(id int64, e AppealEvent) (Appeal, Punishment, error) {
+	var a Appeal
+	var p Punishment
+
+	err := s.db.RunInTransaction(func(tx *pg.Tx) error {
+		var as []Appeal
+		_, err := tx.Query(&as, `SELECT * FROM appeals WHERE id = ? FOR UPDATE`, id)
+		if err != nil {
+			return err
+		}
+		if len(as) == 0 {
+			return ErrAppealNotFound
+		}
+		a = as[0]
+
+		p, err = lockPunishment(tx, a.PunishmentID)
+		if err != nil {
+			return err
+		}
+
+		err = a.record(&p, e)
+		if err != nil {
+			return err
+		}
+
+		if e.Action == AppealAccept {
+			_, err = tx.Exec(`UPDATE punishments SET expires = ? WHERE id = ?`, p.Expires, p.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.Model(&a).Update()
+		return err
+	})
+
+	return a, p, err
+}
+
+// bulkWrite stores a single write of a bulk request inside a transaction, holding a lock on written profiles.
+func (s PostgresStore) bulkWrite(tx *pg.Tx, op BulkOp, by string) (*Punishment, error) {
+	err := op.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	if op.Punishment != nil {
+		p, err := PreparePunishment(*op.Punishment, time.Now(), s.lookupPunishmentType)
+		if err != nil {
+			return nil, err
+		}
+		err = insertPunishment(tx, &p)
+		return &p, err
+	}
+
+	p := *op.Profile
+	var old *Profile
+	prev, err := lockProfile(tx, p.ID)
+	if err == nil {
+		old = &prev
+	} else if err != ErrProfileNotFound {
+		return nil, err
+	}
+
+	err = s.validateProfile(tx, old, p)
+	if err != nil {
+		return nil, err
+	}
+	return nil, writeProfile(tx, old, p, by)
+}
+
+// BulkWrite stores many records in a single transaction when atomic is true, and in one transaction each otherwise.
+func (s PostgresStore) BulkWrite(ops []BulkOp, atomic bool, by string) ([]BulkResult, error) {
+	results := make([]BulkResult, len(ops))
+
+	if !atomic {
+		for i, op := range ops {
+			results[i].Err = s.db.RunInTransaction(func(tx *pg.Tx) error {
+				p, err := s.bulkWrite(tx, op, by)
+				if err == nil {
+					results[i].stored(p)
+				}
+				return err
+			})
+		}
+		return results, nil
+	}
+
+	failed := -1
+	err := s.db.RunInTransaction(func(tx *pg.Tx) error {
+		for i, op := range ops {
+			p, err := s.bulkWrite(tx, op, by)
+			if err != nil {
+				failed = i
+				results[i].Err = err
+				return err
+			}
+			results[i].stored(p)
+		}
+		return nil
+	})
+	if failed >= 0 {
+		rollBack(results, failed)
+		return results, nil
+	}
+
+	return results, err
+}
@@ -1,6 +1,21 @@
 package profile
 
-import "time"
+import (
+	"errors"
+	"time"
+)
+
+// ErrProfileNotFound is returned when there is no profile with the requested ID.
+var ErrProfileNotFound = errors.New("Profile not found.")
+
+// ErrNoPunishments is returned when a player has no punishments.
+var ErrNoPunishments = errors.New("No punishments found.")
+
+// ErrPunishmentNotFound is returned when there is no punishment with the requested ID.
+var ErrPunishmentNotFound = errors.New("Punishment not found.")
+
+// ErrPunishmentExists is returned when importing a punishment under an ID that is already taken.
+var ErrPunishmentExists = errors.New("A punishment with that ID already exists.")
 
 // Profile stores informatin about a player.
 type Profile struct {
@@ -19,17 +34,48 @@ type Punishment struct {
 	Reason   string
 	Date     time.Time
 	Expires  time.Time
+
+	// GameMode and Server limit where the punishment applies, as the Scope of its type requires.
+	GameMode string `json:",omitempty"`
+	Server   string `json:",omitempty"`
 }
 
 // Storer defines the behavior of a Profile Store.
 type Storer interface {
 	GetProfile(steamid string) (Profile, error)
+	// GetProfiles reads many profiles at once. Profiles that do not exist are left out of the result.
+	GetProfiles(steamids []string) (map[string]Profile, error)
 	PutProfile(Profile) error
+	ListProfiles(opts ListOptions) (ProfilePage, error)
+
+	// TopProfiles and GetStanding read the coin leaderboard.
+	TopProfiles(n int) ([]Ranking, error)
+	GetStanding(steamid string, n int) (Standing, error)
 
 	//GetCoins(string) int64
 	//PutCoins(string, int64) int64
 
 	GetPunishments(steamid string) (map[string]Punishment, error)
-	PutPunishment(Punishment) error
+	GetPunishment(pid int64) (Punishment, error)
+	// PutPunishment stores a punishment and returns it as it was stored, with its ID, normalized type and
+	// default expiry date.
+	PutPunishment(Punishment) (Punishment, error)
+	// ImportPunishment stores a punishment read from an archive under its ID, or the next free one if it has none.
+	// It is the only way to choose the ID of a punishment, and fails with ErrPunishmentExists if the ID is taken.
+	ImportPunishment(Punishment) (Punishment, error)
 	DelPunishment(pid int64) error
+	QueryPunishments(q PunishmentQuery) ([]Punishment, error)
+
+	// EachProfile and EachPunishment call fn for every stored record, stopping at the first error.
+	EachProfile(fn func(Profile) error) error
+	EachPunishment(fn func(Punishment) error) error
+
+	ItemStorer
+	PunishmentTypeStorer
+	ShopStorer
+	InventoryStorer
+	HistoryStorer
+	WebhookStorer
+	BulkStorer
+	AppealStorer
 }
@@ -0,0 +1,208 @@
+package profile
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Scopes of punishment types: where the punishments of a type are in force.
+const (
+	// ScopeGlobal punishments apply on every server.
+	ScopeGlobal = "global"
+	// ScopeGameMode punishments apply on the servers running the punishment's GameMode.
+	ScopeGameMode = "gamemode"
+	// ScopeServer punishments apply on the punishment's Server only.
+	ScopeServer = "server"
+)
+
+// Built-in punishment types. Stores register them when they are created.
+const (
+	TypeBan        = "ban"
+	TypeVoiceMute  = "voice_mute"
+	TypeChatGag    = "chat_gag"
+	TypeShopFreeze = "shop_freeze"
+)
+
+// BuiltinPunishmentTypes are registered in every store. Their scope and default duration can be changed,
+// but they cannot be deleted.
+var BuiltinPunishmentTypes = []PunishmentType{
+	{Name: TypeBan, Scope: ScopeGlobal},
+	{Name: TypeVoiceMute, Scope: ScopeGlobal, DefaultDuration: "1h"},
+	{Name: TypeChatGag, Scope: ScopeGlobal, DefaultDuration: "1h"},
+	{Name: TypeShopFreeze, Scope: ScopeGlobal, DefaultDuration: "168h"},
+}
+
+// Errors returned by the registry of punishment types.
+var (
+	ErrPunishmentTypeNotFound = errors.New("Punishment type not found.")
+	ErrPunishmentTypeInUse    = errors.New("Punishments of this type are still stored.")
+	ErrBuiltinPunishmentType  = errors.New("Built-in punishment types cannot be deleted.")
+)
+
+// punishmentTypeName is the form of the names of punishment types.
+var punishmentTypeName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// PunishmentType is an entry of the registry of punishment types. Only registered types can be given.
+type PunishmentType struct {
+	Name string
+	// Scope is ScopeGlobal, ScopeGameMode or ScopeServer.
+	Scope string
+	// DefaultDuration is how long punishments given without an expiry date last, eg. "72h".
+	// Punishments of types without one are permanent unless they are given an expiry date.
+	DefaultDuration string
+}
+
+// PunishmentTypeStorer defines the behavior of a registry of punishment types.
+type PunishmentTypeStorer interface {
+	GetPunishmentType(name string) (PunishmentType, error)
+	GetPunishmentTypes() ([]PunishmentType, error)
+	PutPunishmentType(PunishmentType) error
+	// DelPunishmentType fails with ErrBuiltinPunishmentType for built-in types, and with ErrPunishmentTypeInUse
+	// while punishments of the type are stored.
+	DelPunishmentType(name string) error
+}
+
+// isBuiltinPunishmentType reports whether name is one of BuiltinPunishmentTypes.
+func isBuiltinPunishmentType(name string) bool {
+	for _, t := range BuiltinPunishmentTypes {
+		if t.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks that a punishment type can be registered.
+func (t PunishmentType) Validate() error {
+	var problems []string
+
+	if !punishmentTypeName.MatchString(t.Name) {
+		problems = append(problems, "Punishment types are named with lowercase letters, digits and underscores.")
+	}
+
+	switch t.Scope {
+	case ScopeGlobal, ScopeGameMode, ScopeServer:
+	default:
+		problems = append(problems, fmt.Sprintf("Scope %q is not one of global, gamemode and server.", t.Scope))
+	}
+
+	if t.DefaultDuration != "" {
+		d, err := time.ParseDuration(t.DefaultDuration)
+		if err != nil || d <= 0 {
+			problems = append(problems, fmt.Sprintf("Default duration %q is not a positive duration, such as 72h.", t.DefaultDuration))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// Duration returns the default duration of the type, or 0 for none.
+func (t PunishmentType) Duration() time.Duration {
+	d, _ := time.ParseDuration(t.DefaultDuration)
+	return d
+}
+
+// PreparePunishment checks a punishment against the registry of punishment types and fills in what its type implies.
+// The type's name is lowercased, punishments without a Date are dated now, and punishments without an expiry date get
+// the type's default duration, counted from their Date. lookup returns false for unregistered types.
+// Punishments are given their ID when they are stored, so those that already have one are rejected.
+func PreparePunishment(p Punishment, now time.Time, lookup func(name string) (PunishmentType, bool)) (Punishment, error) {
+	if p.ID != 0 {
+		return p, &ValidationError{Problems: []string{"Punishments are given an ID when they are stored, and cannot have one yet."}}
+	}
+	return prepareRecord(p, now, lookup)
+}
+
+// prepareRecord is PreparePunishment for punishments that keep the ID they have, such as imported ones.
+func prepareRecord(p Punishment, now time.Time, lookup func(name string) (PunishmentType, bool)) (Punishment, error) {
+	if p.PlayerID == "" || p.By == "" || p.Type == "" {
+		return p, &ValidationError{Problems: []string{"PlayerID, By, and Type are required fields."}}
+	}
+
+	p.Type = strings.ToLower(strings.TrimSpace(p.Type))
+	t, ok := lookup(p.Type)
+	if !ok {
+		return p, &ValidationError{Problems: []string{fmt.Sprintf("Punishment type %q is not registered.", p.Type)}}
+	}
+
+	var problem string
+	switch {
+	case t.Scope == ScopeGlobal && (p.GameMode != "" || p.Server != ""):
+		problem = "Punishments of type %q apply everywhere, and cannot have a GameMode or Server."
+	case t.Scope == ScopeGameMode && (p.GameMode == "" || p.Server != ""):
+		problem = "Punishments of type %q apply to a game mode, and need a GameMode but no Server."
+	case t.Scope == ScopeServer && (p.Server == "" || p.GameMode != ""):
+		problem = "Punishments of type %q apply to a server, and need a Server but no GameMode."
+	}
+	if problem != "" {
+		return p, &ValidationError{Problems: []string{fmt.Sprintf(problem, p.Type)}}
+	}
+
+	if p.Date.IsZero() {
+		p.Date = now
+	}
+	if d := t.Duration(); d > 0 && p.Expires.IsZero() {
+		p.Expires = p.Date.Add(d)
+	}
+
+	return p, nil
+}
+
+// punishmentTypeLookup adapts a registry held in memory for PreparePunishment.
+func punishmentTypeLookup(types map[string]PunishmentType) func(string) (PunishmentType, bool) {
+	return func(name string) (PunishmentType, bool) {
+		t, ok := types[name]
+		return t, ok
+	}
+}
+
+// Key identifies the current punishments of a player: a player has one current punishment of each type in each
+// place it applies. It is the Type of global punishments, and the Type followed by "@gamemode:" and the GameMode,
+// or "@server:" and the Server, for scoped ones.
+func (p Punishment) Key() string {
+	switch {
+	case p.Server != "":
+		return p.Type + "@server:" + p.Server
+	case p.GameMode != "":
+		return p.Type + "@gamemode:" + p.GameMode
+	}
+	return p.Type
+}
+
+// AppliesTo reports whether the punishment is in force on the named server, running the named game mode.
+func (p Punishment) AppliesTo(server, gameMode string) bool {
+	return (p.Server == "" || p.Server == server) && (p.GameMode == "" || p.GameMode == gameMode)
+}
+
+// Applicable returns the punishments among a player's current ones that are active on the named server, running
+// the named game mode, by type. When several of a type apply, the one that ends last is kept.
+func Applicable(current map[string]Punishment, server, gameMode string, now time.Time) map[string]Punishment {
+	ps := map[string]Punishment{}
+	for _, p := range current {
+		if !p.Active(now) || !p.AppliesTo(server, gameMode) {
+			continue
+		}
+		if other, ok := ps[p.Type]; ok && !endsLater(p, other) {
+			continue
+		}
+		ps[p.Type] = p
+	}
+	return ps
+}
+
+// endsLater reports whether a ends after b. Permanent punishments end last, and ties go to the later ID.
+func endsLater(a, b Punishment) bool {
+	switch {
+	case a.Expires.IsZero() != b.Expires.IsZero():
+		return a.Expires.IsZero()
+	case !a.Expires.Equal(b.Expires):
+		return a.Expires.After(b.Expires)
+	}
+	return a.ID > b.ID
+}
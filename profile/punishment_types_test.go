@@ -0,0 +1,79 @@
+package profile
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Punishment types", func() {
+	now := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	lookup := punishmentTypeLookup(map[string]PunishmentType{
+		TypeBan:     {Name: TypeBan, Scope: ScopeGlobal},
+		TypeChatGag: {Name: TypeChatGag, Scope: ScopeGlobal, DefaultDuration: "1h"},
+		"build_ban": {Name: "build_ban", Scope: ScopeGameMode},
+		"local_ban": {Name: "local_ban", Scope: ScopeServer, DefaultDuration: "72h"},
+	})
+
+	Context("PreparePunishment", func() {
+		It("normalizes the type and applies its default duration", func() {
+			p, err := PreparePunishment(Punishment{PlayerID: "some_user", By: "some_admin", Type: " Chat_Gag"}, now, lookup)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Type).To(Equal(TypeChatGag))
+			Expect(p.Expires).To(Equal(now.Add(time.Hour)))
+
+			p, err = PreparePunishment(Punishment{PlayerID: "some_user", By: "some_admin", Type: "local_ban", Server: "server_1",
+				Date: now.Add(-time.Hour)}, now, lookup)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Expires).To(Equal(now.Add(71 * time.Hour)))
+		})
+
+		It("keeps explicit expiry dates and permanent types", func() {
+			p, err := PreparePunishment(Punishment{PlayerID: "some_user", By: "some_admin", Type: TypeChatGag, Expires: now}, now, lookup)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Expires).To(Equal(now))
+
+			p, err = PreparePunishment(Punishment{PlayerID: "some_user", By: "some_admin", Type: TypeBan}, now, lookup)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Expires.IsZero()).To(BeTrue())
+		})
+
+		It("rejects unknown types and punishments outside the scope of their type", func() {
+			for _, p := range []Punishment{
+				{PlayerID: "some_user", By: "some_admin"},
+				{PlayerID: "some_user", By: "some_admin", Type: "spin"},
+				{PlayerID: "some_user", By: "some_admin", Type: TypeBan, Server: "server_1"},
+				{PlayerID: "some_user", By: "some_admin", Type: "build_ban"},
+				{PlayerID: "some_user", By: "some_admin", Type: "local_ban", Server: "server_1", GameMode: "sandbox"},
+			} {
+				_, err := PreparePunishment(p, now, lookup)
+				Expect(err).To(BeAssignableToTypeOf(&ValidationError{}), p.Type)
+			}
+		})
+	})
+
+	Context("Applicable", func() {
+		current := map[string]Punishment{}
+		for _, p := range []Punishment{
+			{ID: 1, Type: TypeBan, Expires: now.Add(time.Hour)},
+			{ID: 2, Type: TypeBan, Server: "server_1"},
+			{ID: 3, Type: TypeBan, Server: "server_2"},
+			{ID: 4, Type: "build_ban", GameMode: "sandbox", Expires: now.Add(-time.Hour)},
+			{ID: 5, Type: TypeChatGag, GameMode: "sandbox", Expires: now.Add(time.Hour)},
+		} {
+			current[p.Key()] = p
+		}
+
+		It("keeps the active punishments of the server that ends last, by type", func() {
+			ps := Applicable(current, "server_1", "sandbox", now)
+			Expect(ps).To(HaveLen(2))
+			Expect(ps[TypeBan].ID).To(Equal(int64(2)))
+			Expect(ps[TypeChatGag].ID).To(Equal(int64(5)))
+
+			ps = Applicable(current, "server_3", "darkrp", now)
+			Expect(ps).To(HaveLen(1))
+			Expect(ps[TypeBan].ID).To(Equal(int64(1)))
+		})
+	})
+})
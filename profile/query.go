@@ -0,0 +1,99 @@
+package profile
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Punishment statuses a PunishmentQuery can filter on.
+const (
+	StatusActive  = "active"
+	StatusExpired = "expired"
+)
+
+// Result sizes used by QueryPunishments when the caller asks for none or for too many.
+const (
+	DefaultQueryLimit = 100
+	MaxQueryLimit     = 1000
+)
+
+// ErrInvalidStatus is returned when a PunishmentQuery has a Status other than StatusActive or StatusExpired.
+var ErrInvalidStatus = errors.New("Status must be active or expired.")
+
+// PunishmentQuery selects punishments across all players. Empty fields do not filter.
+type PunishmentQuery struct {
+	PlayerID string
+	By       string
+	Type     string
+
+	// Since and Until restrict the punishment Date to the range [Since, Until).
+	Since time.Time
+	Until time.Time
+
+	// Status is StatusActive or StatusExpired, relative to Now.
+	Status string
+	Now    time.Time
+
+	// Reason matches punishments whose Reason contains it, ignoring case.
+	Reason string
+
+	Limit int
+}
+
+// Active reports whether the punishment is in effect at the given time.
+// Punishments without an expiry date are permanent.
+func (p Punishment) Active(now time.Time) bool {
+	return p.Expires.IsZero() || p.Expires.After(now)
+}
+
+// normalize validates the query and fills in defaults.
+func (q *PunishmentQuery) normalize() error {
+	if q.Status != "" && q.Status != StatusActive && q.Status != StatusExpired {
+		return ErrInvalidStatus
+	}
+
+	if q.Now.IsZero() {
+		q.Now = time.Now()
+	}
+
+	if q.Limit <= 0 {
+		q.Limit = DefaultQueryLimit
+	}
+	if q.Limit > MaxQueryLimit {
+		q.Limit = MaxQueryLimit
+	}
+
+	return nil
+}
+
+// matches reports whether p satisfies every filter of the query.
+func (q PunishmentQuery) matches(p Punishment) bool {
+	switch {
+	case q.PlayerID != "" && p.PlayerID != q.PlayerID:
+		return false
+	case q.By != "" && p.By != q.By:
+		return false
+	case q.Type != "" && p.Type != q.Type:
+		return false
+	case !q.Since.IsZero() && p.Date.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && !p.Date.Before(q.Until):
+		return false
+	case q.Status == StatusActive && !p.Active(q.Now):
+		return false
+	case q.Status == StatusExpired && p.Active(q.Now):
+		return false
+	case q.Reason != "" && !strings.Contains(strings.ToLower(p.Reason), strings.ToLower(q.Reason)):
+		return false
+	}
+	return true
+}
+
+// newerPunishment orders punishments newest first, by Date and then by ID.
+func newerPunishment(a, b Punishment) bool {
+	if !a.Date.Equal(b.Date) {
+		return a.Date.After(b.Date)
+	}
+	return a.ID > b.ID
+}
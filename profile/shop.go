@@ -0,0 +1,73 @@
+package profile
+
+import (
+	"errors"
+	"time"
+)
+
+// Errors returned by purchases and refunds.
+var (
+	ErrNotEnoughCoins  = errors.New("Not enough coins.")
+	ErrAlreadyOwned    = errors.New("The item is already owned.")
+	ErrNotOwned        = errors.New("The item is no longer owned.")
+	ErrReceiptNotFound = errors.New("Receipt not found.")
+	ErrAlreadyRefunded = errors.New("The purchase has already been refunded.")
+)
+
+// Receipt records a purchase from the shop.
+type Receipt struct {
+	ID       int64
+	PlayerID string
+	Item     string
+	// Price is the number of coins paid, which is what a refund gives back even if the catalog price changed since.
+	Price int64
+	Date  time.Time
+	// Refunded is the time of the refund, or zero if the purchase was not refunded.
+	Refunded time.Time
+}
+
+// ShopStorer defines the behavior of a store that sells catalog items to players.
+// Each method changes the profile and the receipts in a single atomic operation.
+type ShopStorer interface {
+	// Purchase deducts the item's catalog price from the player's coins, adds the item to their Inventory
+	// and records a receipt. It returns the receipt and the updated profile.
+	Purchase(steamid, item string, now time.Time) (Receipt, Profile, error)
+	// Refund gives the price on a receipt back to the player and removes the item from their Inventory and Equipment.
+	// It returns the updated receipt and profile.
+	Refund(receiptID int64, now time.Time) (Receipt, Profile, error)
+	GetReceipt(id int64) (Receipt, error)
+	// GetReceipts returns a player's purchase history, newest first.
+	GetReceipts(steamid string) ([]Receipt, error)
+}
+
+// buy applies a purchase of it to p and returns the receipt for it, without an ID.
+func buy(p *Profile, it Item, now time.Time) (Receipt, error) {
+	if _, ok := p.Inventory[it.Name]; ok {
+		return Receipt{}, ErrAlreadyOwned
+	}
+	if p.Coins < it.Price {
+		return Receipt{}, ErrNotEnoughCoins
+	}
+
+	giveItem(p, it.Name, "")
+	p.Coins -= it.Price
+
+	return Receipt{PlayerID: p.ID, Item: it.Name, Price: it.Price, Date: now}, nil
+}
+
+// refund applies the refund of r to p and marks r as refunded. It returns the settings the item had.
+func refund(p *Profile, r *Receipt, now time.Time) (string, error) {
+	if !r.Refunded.IsZero() {
+		return "", ErrAlreadyRefunded
+	}
+	settings, ok := p.Inventory[r.Item]
+	if !ok {
+		return "", ErrNotOwned
+	}
+
+	takeItem(p, r.Item)
+	p.Coins += r.Price
+	r.Refunded = now
+
+	return settings, nil
+}
@@ -0,0 +1,158 @@
+package profile
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Statuses of a webhook Delivery.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	// DeliveryDead marks deliveries that failed every attempt. They form the dead-letter list.
+	DeliveryDead = "dead"
+)
+
+// Errors returned by webhook stores.
+var (
+	ErrWebhookNotFound  = errors.New("Webhook not found.")
+	ErrDeliveryNotFound = errors.New("Delivery not found.")
+	// ErrInvalidDeliveryStatus is returned when a DeliveryQuery has an unknown Status.
+	ErrInvalidDeliveryStatus = errors.New("Status must be pending, delivered or dead.")
+)
+
+// Webhook is a subscription of an outside service to the events of the store.
+// Events are POSTed to URL as JSON and signed with Secret. The service never sends the secret back.
+type Webhook struct {
+	ID     int64
+	URL    string
+	Secret string `json:",omitempty"`
+	// Events lists the event types to send. An empty list sends every type.
+	Events []string
+	// PunishmentTypes restricts punishment events to punishments of these types, eg. "ban".
+	PunishmentTypes []string
+	// MinCoinDelta restricts profile events to changes of at least this many coins, up or down.
+	MinCoinDelta int64
+}
+
+// Validate checks that a webhook can be stored.
+func (w Webhook) Validate() error {
+	var problems []string
+
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problems = append(problems, "Webhooks need an http or https URL.")
+	}
+	if w.Secret == "" {
+		problems = append(problems, "Webhooks need a signing secret.")
+	}
+	for _, t := range w.Events {
+		switch t {
+		case EventProfilePut, EventPunishmentPut, EventPunishmentDel:
+		default:
+			problems = append(problems, fmt.Sprintf("Unknown event type %q.", t))
+		}
+	}
+	if w.MinCoinDelta < 0 {
+		problems = append(problems, "The coin delta threshold cannot be negative.")
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// Wants reports whether an event passes the webhook's filters.
+func (w Webhook) Wants(e Event) bool {
+	if len(w.Events) > 0 && !contains(w.Events, e.Type) {
+		return false
+	}
+
+	switch {
+	case e.Punishment != nil:
+		return len(w.PunishmentTypes) == 0 || contains(w.PunishmentTypes, e.Punishment.Type)
+
+	case e.Profile != nil:
+		var old int64
+		if e.OldProfile != nil {
+			old = e.OldProfile.Coins
+		}
+		delta := e.Profile.Coins - old
+		if delta < 0 {
+			delta = -delta
+		}
+		return delta >= w.MinCoinDelta
+	}
+
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery records the sending of an event to a webhook.
+type Delivery struct {
+	ID        int64
+	WebhookID int64
+	Event     Event
+	Status    string
+	Attempts  int
+	// LastError and LastStatusCode describe the outcome of the latest attempt.
+	LastError      string
+	LastStatusCode int
+	// NextAttempt is when a pending delivery is retried.
+	NextAttempt time.Time
+	Created     time.Time
+	Updated     time.Time
+}
+
+// DeliveryQuery selects deliveries for the delivery log. Zero fields match every delivery.
+type DeliveryQuery struct {
+	WebhookID int64
+	Status    string
+	Limit     int
+}
+
+func (q *DeliveryQuery) normalize() error {
+	switch q.Status {
+	case "", DeliveryPending, DeliveryDelivered, DeliveryDead:
+	default:
+		return ErrInvalidDeliveryStatus
+	}
+
+	if q.Limit <= 0 {
+		q.Limit = DefaultQueryLimit
+	}
+	if q.Limit > MaxQueryLimit {
+		q.Limit = MaxQueryLimit
+	}
+	return nil
+}
+
+func (q DeliveryQuery) matches(d Delivery) bool {
+	return (q.WebhookID == 0 || q.WebhookID == d.WebhookID) && (q.Status == "" || q.Status == d.Status)
+}
+
+// WebhookStorer defines the behavior of a store for webhook subscriptions and their delivery log.
+type WebhookStorer interface {
+	GetWebhooks() ([]Webhook, error)
+	GetWebhook(id int64) (Webhook, error)
+	// PutWebhook stores a webhook, assigning it an ID if it has none, and returns it.
+	PutWebhook(Webhook) (Webhook, error)
+	DelWebhook(id int64) error
+
+	GetDelivery(id int64) (Delivery, error)
+	// PutDelivery stores a delivery, assigning it an ID if it has none, and returns it.
+	PutDelivery(Delivery) (Delivery, error)
+	// QueryDeliveries returns the deliveries matching q, newest first.
+	QueryDeliveries(q DeliveryQuery) ([]Delivery, error)
+}
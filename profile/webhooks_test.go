@@ -0,0 +1,181 @@
+package profile
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// receiver is a local webhook endpoint that records requests and fails the first failures of them.
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	if r.failures > 0 {
+		r.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
+
+func (r *receiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+var _ = Describe("Webhooks", func() {
+	Context("Filters", func() {
+		ban := Event{Type: EventPunishmentPut, Punishment: &Punishment{Type: "ban"}}
+		mute := Event{Type: EventPunishmentPut, Punishment: &Punishment{Type: "mute"}}
+		small := Event{Type: EventProfilePut, Profile: &Profile{Coins: 150}, OldProfile: &Profile{Coins: 100}}
+		large := Event{Type: EventProfilePut, Profile: &Profile{Coins: 0}, OldProfile: &Profile{Coins: 5000}}
+
+		It("selects events by type", func() {
+			w := Webhook{Events: []string{EventPunishmentPut}}
+			Expect(w.Wants(ban)).To(BeTrue())
+			Expect(w.Wants(small)).To(BeFalse())
+			Expect(Webhook{}.Wants(small)).To(BeTrue())
+		})
+
+		It("selects punishments by type", func() {
+			w := Webhook{PunishmentTypes: []string{"ban"}}
+			Expect(w.Wants(ban)).To(BeTrue())
+			Expect(w.Wants(mute)).To(BeFalse())
+		})
+
+		It("selects coin changes by size in either direction", func() {
+			w := Webhook{MinCoinDelta: 1000}
+			Expect(w.Wants(small)).To(BeFalse())
+			Expect(w.Wants(large)).To(BeTrue())
+			Expect(w.Wants(Event{Type: EventProfilePut, Profile: &Profile{Coins: 1000}})).To(BeTrue())
+		})
+	})
+
+	Context("Dispatcher", func() {
+		var store *MockStore
+		var bus *Bus
+		var d *Dispatcher
+		var recv *receiver
+		var server *httptest.Server
+		var stop chan struct{}
+
+		BeforeEach(func() {
+			store = NewMockStore()
+			bus = NewBus(0)
+			d = NewDispatcher(store, bus)
+			d.Backoff = 10 * time.Millisecond
+			d.MaxAttempts = 3
+
+			recv = &receiver{}
+			server = httptest.NewServer(recv)
+			stop = make(chan struct{})
+		})
+
+		AfterEach(func() {
+			close(stop)
+			server.Close()
+		})
+
+		start := func() {
+			go d.Run(stop)
+		}
+
+		deliveries := func() []Delivery {
+			ds, err := store.QueryDeliveries(DeliveryQuery{})
+			Expect(err).ToNot(HaveOccurred())
+			return ds
+		}
+
+		latestStatus := func() string {
+			ds := deliveries()
+			if len(ds) == 0 {
+				return ""
+			}
+			return ds[0].Status
+		}
+
+		It("sends signed events to the webhooks that want them", func() {
+			_, err := store.PutWebhook(Webhook{URL: server.URL, Secret: "secret", PunishmentTypes: []string{"ban"}})
+			Expect(err).ToNot(HaveOccurred())
+			start()
+
+			bus.Publish(Event{Type: EventPunishmentPut, PlayerID: "some_user", Punishment: &Punishment{Type: "mute"}})
+			bus.Publish(Event{Type: EventPunishmentPut, PlayerID: "some_user", Punishment: &Punishment{Type: "ban"}})
+
+			Eventually(recv.count).Should(Equal(1))
+			Eventually(latestStatus).Should(Equal(DeliveryDelivered))
+			Consistently(recv.count, "50ms").Should(Equal(1))
+
+			req := recv.requests[0]
+			Expect(req.Header.Get(EventHeader)).To(Equal(EventPunishmentPut))
+			Expect(req.Header.Get(DeliveryHeader)).To(Equal("1"))
+			Expect(req.Header.Get(SignatureHeader)).To(Equal(Sign("secret", req.Header.Get(TimestampHeader), recv.bodies[0])))
+			Expect(string(recv.bodies[0])).To(ContainSubstring(`"Type":"ban"`))
+		})
+
+		It("retries failed deliveries with backoff", func() {
+			recv.failures = 2
+			_, err := store.PutWebhook(Webhook{URL: server.URL, Secret: "secret"})
+			Expect(err).ToNot(HaveOccurred())
+			start()
+
+			bus.Publish(Event{Type: EventProfilePut, Profile: &Profile{ID: "some_user", Coins: 5}})
+
+			Eventually(latestStatus).Should(Equal(DeliveryDelivered))
+			del := deliveries()[0]
+			Expect(del.Attempts).To(Equal(3))
+			Expect(del.LastStatusCode).To(Equal(http.StatusOK))
+			Expect(del.LastError).To(BeEmpty())
+		})
+
+		It("dead-letters deliveries that fail every attempt and can send them again", func() {
+			recv.failures = 3
+			_, err := store.PutWebhook(Webhook{URL: server.URL, Secret: "secret"})
+			Expect(err).ToNot(HaveOccurred())
+			start()
+
+			bus.Publish(Event{Type: EventProfilePut, Profile: &Profile{ID: "some_user", Coins: 5}})
+
+			Eventually(func() []Delivery {
+				ds, _ := store.QueryDeliveries(DeliveryQuery{Status: DeliveryDead})
+				return ds
+			}).Should(HaveLen(1))
+			del := deliveries()[0]
+			Expect(del.Attempts).To(Equal(3))
+			Expect(del.LastStatusCode).To(Equal(http.StatusServiceUnavailable))
+			Expect(del.LastError).ToNot(BeEmpty())
+
+			_, err = d.Redeliver(del.ID)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(latestStatus).Should(Equal(DeliveryDelivered))
+			Expect(recv.count()).To(Equal(4))
+		})
+
+		It("resumes pending deliveries when it starts", func() {
+			w, err := store.PutWebhook(Webhook{URL: server.URL, Secret: "secret"})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = store.PutDelivery(Delivery{WebhookID: w.ID, Status: DeliveryPending, Event: Event{ID: 7, Type: EventProfilePut}})
+			Expect(err).ToNot(HaveOccurred())
+
+			start()
+
+			Eventually(recv.count).Should(Equal(1))
+			Eventually(latestStatus).Should(Equal(DeliveryDelivered))
+		})
+	})
+})
@@ -2,6 +2,7 @@ package main
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/alanfran/gameprofile/profile"
 	"github.com/gin-gonic/gin"
@@ -32,7 +33,7 @@ func (a *App) GetProfile(c *gin.Context) {
 
 func (a *App) PostProfile(c *gin.Context) {
 	var p profile.Profile
-	err := c.Bind(&p)
+	err := bindJSON(c, &p)
 
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -54,7 +55,14 @@ func (a *App) PostProfile(c *gin.Context) {
 		return
 	}
 
-	err = a.profiles.PutProfile(p)
+	err = a.profiles.PutProfileBy(p, caller(c))
+	if verr, ok := err.(*profile.ValidationError); ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "The profile does not match the item catalog.",
+			"problems": verr.Problems,
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "An error occurred while storing your profile. Please try again later.",
@@ -76,7 +84,7 @@ func (a *App) PutProfile(c *gin.Context) {
 	}
 
 	var pwh ProfileWithHash
-	err := c.Bind(&pwh)
+	err := bindJSON(c, &pwh)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -100,14 +108,19 @@ func (a *App) PutProfile(c *gin.Context) {
 		return
 	}
 
-	currentPwh := NewProfileWithHash(p)
-
-	if pwh.Hash != currentPwh.Hash {
-		c.JSON(http.StatusConflict, currentPwh)
+	if !hashMatches(pwh.Hash, p) {
+		c.JSON(http.StatusConflict, NewProfileWithHash(p))
 		return
 	}
 
-	err = a.profiles.PutProfile(pwh.Profile)
+	err = a.profiles.PutProfileBy(pwh.Profile, caller(c))
+	if verr, ok := err.(*profile.ValidationError); ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "The profile does not match the item catalog.",
+			"problems": verr.Problems,
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "An error occurred while storing the profile. Please try again later.",
@@ -117,3 +130,141 @@ func (a *App) PutProfile(c *gin.Context) {
 
 	c.JSON(http.StatusOK, NewProfileWithHash(pwh.Profile))
 }
+
+// ListProfiles returns a page of profiles.
+// Query parameters: cursor (from the previous page), limit, sort ("id" or "coins") and order ("asc" or "desc").
+func (a *App) ListProfiles(c *gin.Context) {
+	opts := profile.ListOptions{
+		Cursor: c.Query("cursor"),
+		SortBy: c.Query("sort"),
+		Desc:   c.Query("order") == "desc",
+	}
+
+	if l := c.Query("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "The limit must be a number.",
+			})
+			return
+		}
+		opts.Limit = limit
+	}
+
+	page, err := a.profiles.ListProfiles(opts)
+	if err == profile.ErrInvalidCursor || err == profile.ErrInvalidSort {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "An error occurred while listing profiles. Please try again later.",
+		})
+		return
+	}
+
+	list := ProfileList{
+		Profiles:   make([]ProfileWithHash, len(page.Profiles)),
+		NextCursor: page.NextCursor,
+	}
+	for i, p := range page.Profiles {
+		list.Profiles[i] = NewProfileWithHash(p)
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// maxBatchProfiles is the most profiles a batch read may ask for.
+const maxBatchProfiles = 256
+
+// PostProfileBatch reads many profiles at once, such as every player on a server after a map change.
+// Profiles are returned in the order they were asked for, followed by the IDs that have no profile.
+func (a *App) PostProfileBatch(c *gin.Context) {
+	var batch ProfileBatch
+	err := bindJSON(c, &batch)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "There was an error processing your request. Please make sure your JSON is well-formed.",
+		})
+		return
+	}
+
+	if len(batch.IDs) > maxBatchProfiles {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Please ask for at most " + strconv.Itoa(maxBatchProfiles) + " profiles at once.",
+		})
+		return
+	}
+
+	ps, err := a.profiles.GetProfiles(batch.IDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "An error occurred while reading the profiles. Please try again later.",
+		})
+		return
+	}
+
+	result := ProfileBatchResult{Profiles: []ProfileWithHash{}, Missing: []string{}}
+	seen := map[string]bool{}
+	for _, id := range batch.IDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		if p, ok := ps[id]; ok {
+			result.Profiles = append(result.Profiles, NewProfileWithHash(p))
+		} else {
+			result.Missing = append(result.Missing, id)
+		}
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetLeaderboard returns the richest players. The limit query parameter sets how many.
+func (a *App) GetLeaderboard(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "The limit must be a number.",
+		})
+		return
+	}
+
+	rs, err := a.profiles.TopProfiles(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "An error occurred while reading the leaderboard. Please try again later.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, rs)
+}
+
+// GetStanding returns a player's rank on the leaderboard.
+// The around query parameter sets how many players above and below them are included.
+func (a *App) GetStanding(c *gin.Context) {
+	steamid := c.Param("steamid")
+
+	around, err := strconv.Atoi(c.DefaultQuery("around", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "The around parameter must be a number.",
+		})
+		return
+	}
+
+	st, err := a.profiles.GetStanding(steamid, around)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Could not find a profile with that SteamID.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, st)
+}
@@ -0,0 +1,29 @@
+package profilerpc
+
+import (
+	"encoding/json"
+
+	"google.golang.org/grpc/encoding"
+)
+
+// CodecName is the content subtype the service is spoken with. Messages are encoded as JSON,
+// the same way the HTTP API encodes them, so that the records of the profile package can be sent as they are.
+const CodecName = "json"
+
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (codec) Name() string {
+	return CodecName
+}
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
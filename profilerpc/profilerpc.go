@@ -0,0 +1,323 @@
+// Package profilerpc defines the gRPC interface of the profile service, and a typed client for it.
+//
+// The service offers the operations of the HTTP API on profiles and punishments, and a stream of changes.
+// Messages are the records of the profile package, encoded as JSON (see CodecName).
+package profilerpc
+
+import (
+	"context"
+
+	"github.com/alanfran/gameprofile/profile"
+	"google.golang.org/grpc"
+)
+
+// ServiceName is the full name of the gRPC service.
+const ServiceName = "gameprofile.Profiles"
+
+// ProfileWithHash is a profile with the hash of its state. Updates must carry the hash of the state they replace.
+type ProfileWithHash struct {
+	profile.Profile
+	Hash string
+}
+
+// PlayerRequest names a player.
+type PlayerRequest struct {
+	ID string
+}
+
+// ProfilesRequest asks for many profiles at once.
+type ProfilesRequest struct {
+	IDs []string
+}
+
+// ProfilesReply holds the profiles found by GetProfiles, in the order they were asked for,
+// and the IDs that have no profile.
+type ProfilesReply struct {
+	Profiles []ProfileWithHash
+	Missing  []string
+}
+
+// ProfileList is a page of profiles. NextCursor is empty on the last page.
+type ProfileList struct {
+	Profiles   []ProfileWithHash
+	NextCursor string
+}
+
+// LeaderboardRequest asks for the Limit richest players.
+type LeaderboardRequest struct {
+	Limit int
+}
+
+// Leaderboard lists the richest players.
+type Leaderboard struct {
+	Rankings []profile.Ranking
+}
+
+// StandingRequest asks for a player's rank, with Around players above and below them.
+type StandingRequest struct {
+	ID     string
+	Around int
+}
+
+// PunishmentMap holds a player's current punishments by type.
+type PunishmentMap struct {
+	PlayerID    string
+	Punishments map[string]profile.Punishment
+}
+
+// PunishmentList holds the results of a punishment search, newest first.
+type PunishmentList struct {
+	Punishments []profile.Punishment
+}
+
+// WatchRequest selects the changes to stream. After is the ID of the last event the client got, to resume from.
+type WatchRequest struct {
+	profile.EventFilter
+	After int64
+}
+
+// EventGap is the type of the event sent first on a stream when some of the events after WatchRequest.After
+// are no longer kept.
+const EventGap = "gap"
+
+// Empty is the reply of operations that return nothing.
+type Empty struct{}
+
+// ProfilesServer is the server side of the service.
+type ProfilesServer interface {
+	GetProfile(context.Context, *PlayerRequest) (*ProfileWithHash, error)
+	GetProfiles(context.Context, *ProfilesRequest) (*ProfilesReply, error)
+	// CreateProfile stores a new profile. It fails with AlreadyExists if the profile exists.
+	CreateProfile(context.Context, *profile.Profile) (*ProfileWithHash, error)
+	// UpdateProfile replaces a profile. It fails with Aborted if the hash does not match the stored profile.
+	UpdateProfile(context.Context, *ProfileWithHash) (*ProfileWithHash, error)
+	ListProfiles(context.Context, *profile.ListOptions) (*ProfileList, error)
+	TopProfiles(context.Context, *LeaderboardRequest) (*Leaderboard, error)
+	GetStanding(context.Context, *StandingRequest) (*profile.Standing, error)
+
+	GetPunishments(context.Context, *PlayerRequest) (*PunishmentMap, error)
+	PutPunishment(context.Context, *profile.Punishment) (*Empty, error)
+	// PutPunishments stores several punishments of a player. Either all of them or none are stored.
+	PutPunishments(context.Context, *PunishmentMap) (*Empty, error)
+	QueryPunishments(context.Context, *profile.PunishmentQuery) (*PunishmentList, error)
+
+	// Watch streams changes to profiles and punishments until the client goes away.
+	Watch(*WatchRequest, Profiles_WatchServer) error
+}
+
+// Profiles_WatchServer is the server side of a Watch stream.
+type Profiles_WatchServer interface {
+	Send(*profile.Event) error
+	grpc.ServerStream
+}
+
+type watchServer struct {
+	grpc.ServerStream
+}
+
+func (s watchServer) Send(e *profile.Event) error {
+	return s.ServerStream.SendMsg(e)
+}
+
+// unary describes a method that takes a message of the type made by newIn and replies with one message.
+func unary(name string, newIn func() interface{},
+	call func(ProfilesServer, context.Context, interface{}) (interface{}, error)) grpc.MethodDesc {
+
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			in := newIn()
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return call(srv.(ProfilesServer), ctx, in)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/" + name}
+			return interceptor(ctx, in, info, func(ctx context.Context, in interface{}) (interface{}, error) {
+				return call(srv.(ProfilesServer), ctx, in)
+			})
+		},
+	}
+}
+
+// ServiceDesc describes the service to a grpc.Server.
+var ServiceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*ProfilesServer)(nil),
+	Methods: []grpc.MethodDesc{
+		unary("GetProfile", func() interface{} { return new(PlayerRequest) },
+			func(s ProfilesServer, ctx context.Context, in interface{}) (interface{}, error) {
+				return s.GetProfile(ctx, in.(*PlayerRequest))
+			}),
+		unary("GetProfiles", func() interface{} { return new(ProfilesRequest) },
+			func(s ProfilesServer, ctx context.Context, in interface{}) (interface{}, error) {
+				return s.GetProfiles(ctx, in.(*ProfilesRequest))
+			}),
+		unary("CreateProfile", func() interface{} { return new(profile.Profile) },
+			func(s ProfilesServer, ctx context.Context, in interface{}) (interface{}, error) {
+				return s.CreateProfile(ctx, in.(*profile.Profile))
+			}),
+		unary("UpdateProfile", func() interface{} { return new(ProfileWithHash) },
+			func(s ProfilesServer, ctx context.Context, in interface{}) (interface{}, error) {
+				return s.UpdateProfile(ctx, in.(*ProfileWithHash))
+			}),
+		unary("ListProfiles", func() interface{} { return new(profile.ListOptions) },
+			func(s ProfilesServer, ctx context.Context, in interface{}) (interface{}, error) {
+				return s.ListProfiles(ctx, in.(*profile.ListOptions))
+			}),
+		unary("TopProfiles", func() interface{} { return new(LeaderboardRequest) },
+			func(s ProfilesServer, ctx context.Context, in interface{}) (interface{}, error) {
+				return s.TopProfiles(ctx, in.(*LeaderboardRequest))
+			}),
+		unary("GetStanding", func() interface{} { return new(StandingRequest) },
+			func(s ProfilesServer, ctx context.Context, in interface{}) (interface{}, error) {
+				return s.GetStanding(ctx, in.(*StandingRequest))
+			}),
+		unary("GetPunishments", func() interface{} { return new(PlayerRequest) },
+			func(s ProfilesServer, ctx context.Context, in interface{}) (interface{}, error) {
+				return s.GetPunishments(ctx, in.(*PlayerRequest))
+			}),
+		unary("PutPunishment", func() interface{} { return new(profile.Punishment) },
+			func(s ProfilesServer, ctx context.Context, in interface{}) (interface{}, error) {
+				return s.PutPunishment(ctx, in.(*profile.Punishment))
+			}),
+		unary("PutPunishments", func() interface{} { return new(PunishmentMap) },
+			func(s ProfilesServer, ctx context.Context, in interface{}) (interface{}, error) {
+				return s.PutPunishments(ctx, in.(*PunishmentMap))
+			}),
+		unary("QueryPunishments", func() interface{} { return new(profile.PunishmentQuery) },
+			func(s ProfilesServer, ctx context.Context, in interface{}) (interface{}, error) {
+				return s.QueryPunishments(ctx, in.(*profile.PunishmentQuery))
+			}),
+	},
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "Watch",
+		ServerStreams: true,
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			in := new(WatchRequest)
+			if err := stream.RecvMsg(in); err != nil {
+				return err
+			}
+			return srv.(ProfilesServer).Watch(in, watchServer{stream})
+		},
+	}},
+}
+
+// RegisterProfilesServer registers the service implemented by srv on s.
+func RegisterProfilesServer(s *grpc.Server, srv ProfilesServer) {
+	s.RegisterService(&ServiceDesc, srv)
+}
+
+// Client calls the service over a connection.
+type Client struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewClient returns a client that calls the service over cc.
+// The X-Caller metadata names the caller in profile histories, like the header of the HTTP API.
+func NewClient(cc grpc.ClientConnInterface) *Client {
+	return &Client{cc: cc}
+}
+
+func (c *Client) invoke(ctx context.Context, method string, in, out interface{}, opts []grpc.CallOption) error {
+	opts = append([]grpc.CallOption{grpc.CallContentSubtype(CodecName)}, opts...)
+	return c.cc.Invoke(ctx, "/"+ServiceName+"/"+method, in, out, opts...)
+}
+
+// GetProfile reads a profile. It fails with NotFound if there is none.
+func (c *Client) GetProfile(ctx context.Context, id string, opts ...grpc.CallOption) (*ProfileWithHash, error) {
+	out := new(ProfileWithHash)
+	return out, c.invoke(ctx, "GetProfile", &PlayerRequest{ID: id}, out, opts)
+}
+
+// GetProfiles reads many profiles at once.
+func (c *Client) GetProfiles(ctx context.Context, ids []string, opts ...grpc.CallOption) (*ProfilesReply, error) {
+	out := new(ProfilesReply)
+	return out, c.invoke(ctx, "GetProfiles", &ProfilesRequest{IDs: ids}, out, opts)
+}
+
+// CreateProfile stores a new profile.
+func (c *Client) CreateProfile(ctx context.Context, p profile.Profile, opts ...grpc.CallOption) (*ProfileWithHash, error) {
+	out := new(ProfileWithHash)
+	return out, c.invoke(ctx, "CreateProfile", &p, out, opts)
+}
+
+// UpdateProfile replaces a profile, given the hash of the state it replaces.
+func (c *Client) UpdateProfile(ctx context.Context, p ProfileWithHash, opts ...grpc.CallOption) (*ProfileWithHash, error) {
+	out := new(ProfileWithHash)
+	return out, c.invoke(ctx, "UpdateProfile", &p, out, opts)
+}
+
+// ListProfiles returns a page of profiles.
+func (c *Client) ListProfiles(ctx context.Context, o profile.ListOptions, opts ...grpc.CallOption) (*ProfileList, error) {
+	out := new(ProfileList)
+	return out, c.invoke(ctx, "ListProfiles", &o, out, opts)
+}
+
+// TopProfiles returns the richest players.
+func (c *Client) TopProfiles(ctx context.Context, limit int, opts ...grpc.CallOption) ([]profile.Ranking, error) {
+	out := new(Leaderboard)
+	err := c.invoke(ctx, "TopProfiles", &LeaderboardRequest{Limit: limit}, out, opts)
+	return out.Rankings, err
+}
+
+// GetStanding returns a player's rank, with around players above and below them.
+func (c *Client) GetStanding(ctx context.Context, id string, around int, opts ...grpc.CallOption) (*profile.Standing, error) {
+	out := new(profile.Standing)
+	return out, c.invoke(ctx, "GetStanding", &StandingRequest{ID: id, Around: around}, out, opts)
+}
+
+// GetPunishments returns a player's current punishments by type.
+func (c *Client) GetPunishments(ctx context.Context, id string, opts ...grpc.CallOption) (map[string]profile.Punishment, error) {
+	out := new(PunishmentMap)
+	err := c.invoke(ctx, "GetPunishments", &PlayerRequest{ID: id}, out, opts)
+	return out.Punishments, err
+}
+
+// PutPunishment stores a punishment.
+func (c *Client) PutPunishment(ctx context.Context, p profile.Punishment, opts ...grpc.CallOption) error {
+	return c.invoke(ctx, "PutPunishment", &p, new(Empty), opts)
+}
+
+// PutPunishments stores several punishments of a player at once.
+func (c *Client) PutPunishments(ctx context.Context, id string, ps map[string]profile.Punishment, opts ...grpc.CallOption) error {
+	return c.invoke(ctx, "PutPunishments", &PunishmentMap{PlayerID: id, Punishments: ps}, new(Empty), opts)
+}
+
+// QueryPunishments searches punishments across all players, newest first.
+func (c *Client) QueryPunishments(ctx context.Context, q profile.PunishmentQuery, opts ...grpc.CallOption) ([]profile.Punishment, error) {
+	out := new(PunishmentList)
+	err := c.invoke(ctx, "QueryPunishments", &q, out, opts)
+	return out.Punishments, err
+}
+
+// Watch opens a stream of changes. Cancel ctx to close it.
+func (c *Client) Watch(ctx context.Context, in WatchRequest, opts ...grpc.CallOption) (*WatchStream, error) {
+	opts = append([]grpc.CallOption{grpc.CallContentSubtype(CodecName)}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ServiceDesc.Streams[0], "/"+ServiceName+"/Watch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(&in); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return &WatchStream{stream}, nil
+}
+
+// WatchStream is the client side of a Watch stream.
+type WatchStream struct {
+	grpc.ClientStream
+}
+
+// Recv waits for the next change.
+func (s *WatchStream) Recv() (*profile.Event, error) {
+	e := new(profile.Event)
+	if err := s.ClientStream.RecvMsg(e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/alanfran/gameprofile/profile"
 	"github.com/gin-gonic/gin"
@@ -21,12 +23,14 @@ func (a *App) GetPunishments(c *gin.Context) {
 	c.JSON(http.StatusOK, ps)
 }
 
+// PostPunishments issues a punishment. Punishments that an escalation rule fires for are stored as the rule says,
+// and the answer names the rule. The unversioned path answers 204 No Content without a body, as it always has.
 func (a *App) PostPunishments(c *gin.Context) {
 	steamid := c.Param("steamid")
 
 	var p profile.Punishment
 
-	err := c.Bind(&p)
+	err := bindJSON(c, &p)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "Bad request. Make sure your JSON is correct.",
@@ -41,22 +45,36 @@ func (a *App) PostPunishments(c *gin.Context) {
 		return
 	}
 
-	err = a.profiles.PutPunishment(p)
+	results, err := a.profiles.BulkWrite([]profile.BulkOp{{Punishment: &p}}, true, caller(c))
+	if err == nil {
+		err = results[0].Err
+	}
+	if verr, ok := err.(*profile.ValidationError); ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Invalid punishment.",
+			"problems": verr.Problems,
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err,
+			"error": "Error storing the punishment. Please try again later.",
 		})
 		return
 	}
 
-	c.JSON(http.StatusNoContent, nil)
+	if legacy(c) {
+		c.String(http.StatusNoContent, "")
+		return
+	}
+	c.JSON(http.StatusCreated, PunishmentResult{Punishment: *results[0].Punishment, Escalation: results[0].Escalation})
 }
 
 func (a *App) PutPunishments(c *gin.Context) {
 	steamid := c.Param("steamid")
 
 	var ps map[string]profile.Punishment
-	err := c.Bind(&ps)
+	err := bindJSON(c, &ps)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "Error processing your request. Please make sure your JSON is well-formatted.",
@@ -71,14 +89,98 @@ func (a *App) PutPunishments(c *gin.Context) {
 			})
 			return
 		}
-		err = a.profiles.PutPunishment(v)
+	}
+
+	err = a.putPunishments(ps, caller(c))
+	if verr, ok := err.(*profile.ValidationError); ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Invalid punishment.",
+			"problems": verr.Problems,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Error storing punishments. Please try again later.",
+		})
+		return
+	}
+
+	c.String(http.StatusNoContent, "")
+}
+
+// putPunishments stores several punishments in one transaction, so that either all of them or none are stored.
+// If one of them is invalid, its *profile.ValidationError is returned.
+func (a *App) putPunishments(ps map[string]profile.Punishment, by string) error {
+	var ops []profile.BulkOp
+	for _, v := range ps {
+		v := v
+		ops = append(ops, profile.BulkOp{Punishment: &v})
+	}
+
+	results, err := a.profiles.BulkWrite(ops, true, by)
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		if _, ok := r.Err.(*profile.ValidationError); ok {
+			return r.Err
+		}
+		if r.Err != nil && r.Err != profile.ErrBulkRolledBack {
+			err = r.Err
+		}
+	}
+	return err
+}
+
+// QueryPunishments searches punishments across all players, newest first.
+// Query parameters: player, by, type, status ("active" or "expired"), reason (case-insensitive substring),
+// since and until (RFC 3339 times bounding the punishment date) and limit.
+func (a *App) QueryPunishments(c *gin.Context) {
+	q := profile.PunishmentQuery{
+		PlayerID: c.Query("player"),
+		By:       c.Query("by"),
+		Type:     c.Query("type"),
+		Status:   c.Query("status"),
+		Reason:   c.Query("reason"),
+	}
+
+	var err error
+	for param, t := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		if v := c.Query(param); v != "" {
+			*t, err = time.Parse(time.RFC3339, v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "The " + param + " parameter must be an RFC 3339 time.",
+				})
+				return
+			}
+		}
+	}
+
+	if l := c.Query("limit"); l != "" {
+		q.Limit, err = strconv.Atoi(l)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": "Error storing punishments. Please try again later.",
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "The limit must be a number.",
 			})
 			return
 		}
 	}
 
-	c.String(http.StatusNoContent, "")
+	ps, err := a.profiles.QueryPunishments(q)
+	if err == profile.ErrInvalidStatus {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Error searching punishments. Please try again later.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ps)
 }
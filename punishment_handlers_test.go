@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/alanfran/gameprofile/profile"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Escalating punishments", func() {
+	var app *App
+
+	BeforeEach(func() {
+		app = NewApp(profile.NewMockStore())
+		app.Escalation = profile.EscalationPolicy{Rules: []profile.EscalationRule{
+			{Name: "week_ban", Type: "warning", Counted: []string{"warning", "ban"}, Count: 4, EscalateTo: "ban", Duration: "168h"},
+			{Name: "day_ban", Type: "warning", Count: 3, Within: "720h", EscalateTo: "ban", Duration: "24h"},
+		}}
+		Expect(app.profiles.PutPunishmentType(profile.PunishmentType{Name: "warning", Scope: profile.ScopeServer})).To(Succeed())
+	})
+
+	warning := profile.Punishment{PlayerID: "some_user", By: "some_admin", Type: "warning", Reason: "rdm", Server: "server_1"}
+
+	request := func(method, url string, v interface{}) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(v)
+		req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Set("Content-Type", "application/json")
+
+		resp := httptest.NewRecorder()
+		app.engine.ServeHTTP(resp, req)
+		return resp
+	}
+
+	warn := func(date time.Time) PunishmentResult {
+		w := warning
+		w.Date = date
+		resp := request("POST", "/v1/some_user/punishments", w)
+		Expect(resp.Code).To(Equal(http.StatusCreated), resp.Body.String())
+
+		var res PunishmentResult
+		Expect(json.Unmarshal(resp.Body.Bytes(), &res)).To(Succeed())
+		return res
+	}
+
+	It("gives three warnings, then a day's ban, then a week's, and says which rule fired", func() {
+		date := time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)
+		for i := 0; i < 3; i++ {
+			res := warn(date)
+			Expect(res.Escalation).To(BeNil())
+			Expect(res.Punishment.Type).To(Equal("warning"))
+			Expect(res.Punishment.ID).ToNot(BeZero())
+		}
+
+		res := warn(date.Add(time.Hour))
+		Expect(res.Escalation).To(Equal(&profile.Escalation{Rule: "day_ban", From: "warning", Prior: 3}))
+		Expect(res.Punishment.Type).To(Equal("ban"))
+		Expect(res.Punishment.Server).To(BeEmpty())
+		Expect(res.Punishment.Expires).To(Equal(date.Add(25 * time.Hour)))
+
+		res = warn(date.Add(2 * time.Hour))
+		Expect(res.Escalation.Rule).To(Equal("week_ban"))
+		Expect(res.Punishment.Expires).To(Equal(date.Add(170 * time.Hour)))
+
+		ps, err := app.profiles.GetPunishments("some_user")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ps["ban"].Expires).To(Equal(date.Add(170 * time.Hour)))
+	})
+
+	It("escalates punishments issued through every API, dated when they are stored", func() {
+		for i := 0; i < 3; i++ {
+			p, err := app.profiles.PutPunishment(warning)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Type).To(Equal("warning"))
+			Expect(p.Date).To(BeTemporally("~", time.Now(), time.Minute))
+		}
+
+		resp := request("POST", "/v1/bulk", BulkRequest{Writes: []profile.BulkOp{{Punishment: &warning}}})
+		Expect(resp.Code).To(Equal(http.StatusOK), resp.Body.String())
+		var bulk BulkResponse
+		Expect(json.Unmarshal(resp.Body.Bytes(), &bulk)).To(Succeed())
+		Expect(bulk.Results[0].Escalation).To(Equal(&profile.Escalation{Rule: "day_ban", From: "warning", Prior: 3}))
+
+		resp = request("PUT", "/v1/some_user/punishments", map[string]profile.Punishment{"warning": warning})
+		Expect(resp.Code).To(Equal(http.StatusNoContent), resp.Body.String())
+
+		ps, err := app.profiles.GetPunishments("some_user")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ps["ban"].Expires).To(BeTemporally("~", time.Now().Add(168*time.Hour), time.Minute))
+	})
+
+	It("escalates punishments issued at the same time one after the other", func() {
+		policy := app.Escalation
+		app = NewApp(slowQueries{profile.NewMockStore()})
+		app.Escalation = policy
+		Expect(app.profiles.PutPunishmentType(profile.PunishmentType{Name: "warning", Scope: profile.ScopeServer})).To(Succeed())
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				_, err := app.profiles.PutPunishment(warning)
+				Expect(err).ToNot(HaveOccurred())
+			}()
+		}
+		wg.Wait()
+
+		ps, err := app.profiles.QueryPunishments(profile.PunishmentQuery{PlayerID: "some_user", Type: "warning"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ps).To(HaveLen(3))
+	})
+
+	It("counts the punishments of a bulk request toward each other", func() {
+		for player, atomic := range map[string]bool{"user_a": true, "user_b": false} {
+			writes := make([]profile.BulkOp, 4)
+			for i := range writes {
+				w := warning
+				w.PlayerID = player
+				writes[i] = profile.BulkOp{Punishment: &w}
+			}
+			resp := request("POST", "/v1/bulk", BulkRequest{Atomic: atomic, Writes: writes})
+			Expect(resp.Code).To(Equal(http.StatusOK), resp.Body.String())
+
+			var bulk BulkResponse
+			Expect(json.Unmarshal(resp.Body.Bytes(), &bulk)).To(Succeed())
+			Expect(bulk.Results).To(HaveLen(4))
+			for _, r := range bulk.Results[:3] {
+				Expect(r.Escalation).To(BeNil(), player)
+			}
+			Expect(bulk.Results[3].Escalation).To(Equal(&profile.Escalation{Rule: "day_ban", From: "warning", Prior: 3}), player)
+		}
+	})
+
+	It("answers 204 No Content on the unversioned path", func() {
+		resp := request("POST", "/some_user/punishments", warning)
+		Expect(resp.Code).To(Equal(http.StatusNoContent))
+		Expect(resp.Body.String()).To(BeEmpty())
+	})
+})
+
+// slowQueries is a store that takes a while to search punishments, so that punishments issued at the same time
+// overlap unless they are escalated one after the other.
+type slowQueries struct {
+	profile.Storer
+}
+
+func (s slowQueries) QueryPunishments(q profile.PunishmentQuery) ([]profile.Punishment, error) {
+	ps, err := s.Storer.QueryPunishments(q)
+	time.Sleep(10 * time.Millisecond)
+	return ps, err
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/alanfran/gameprofile/profile"
+	"github.com/gin-gonic/gin"
+)
+
+// GetPunishmentTypes returns the registry of punishment types, ordered by name.
+func (a *App) GetPunishmentTypes(c *gin.Context) {
+	ts, err := a.profiles.GetPunishmentTypes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "An error occurred while reading the punishment types. Please try again later.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ts)
+}
+
+// GetPunishmentType returns a single punishment type.
+func (a *App) GetPunishmentType(c *gin.Context) {
+	t, err := a.profiles.GetPunishmentType(c.Param("name"))
+	if err == profile.ErrPunishmentTypeNotFound {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "An error occurred while reading the punishment types. Please try again later.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, t)
+}
+
+// PutPunishmentType registers a punishment type or changes its scope and default duration.
+// Changes apply to punishments given afterwards.
+func (a *App) PutPunishmentType(c *gin.Context) {
+	var t profile.PunishmentType
+	err := bindJSON(c, &t)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "There was an error processing your request. Please make sure your JSON is well-formed.",
+		})
+		return
+	}
+
+	if t.Name != c.Param("name") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "The name in the request body does not match the one in the URL.",
+		})
+		return
+	}
+
+	err = a.profiles.PutPunishmentType(t)
+	if verr, ok := err.(*profile.ValidationError); ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "The punishment type is invalid.",
+			"problems": verr.Problems,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "An error occurred while storing the punishment type. Please try again later.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, t)
+}
+
+// DelPunishmentType removes a punishment type from the registry. Built-in types, and types that punishments are
+// still stored with, cannot be removed.
+func (a *App) DelPunishmentType(c *gin.Context) {
+	err := a.profiles.DelPunishmentType(c.Param("name"))
+	switch err {
+	case nil:
+		c.Status(http.StatusNoContent)
+	case profile.ErrPunishmentTypeNotFound:
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+	case profile.ErrPunishmentTypeInUse, profile.ErrBuiltinPunishmentType:
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "An error occurred while deleting the punishment type. Please try again later.",
+		})
+	}
+}
+
+// GetStatus returns the punishments of a player that are in force on a server, by type.
+// Query parameters: server, which defaults to the server that signed the request, and gamemode.
+// Punishments scoped to another server or game mode are left out.
+func (a *App) GetStatus(c *gin.Context) {
+	st := PlayerStatus{
+		PlayerID: c.Param("steamid"),
+		Server:   c.DefaultQuery("server", c.GetString(signedServerKey)),
+		GameMode: c.Query("gamemode"),
+	}
+
+	ps, err := a.profiles.GetPunishments(st.PlayerID)
+	if err != nil && err != profile.ErrNoPunishments {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Error reading punishments. Please try again later.",
+		})
+		return
+	}
+
+	st.Punishments = profile.Applicable(ps, st.Server, st.GameMode, time.Now())
+	c.JSON(http.StatusOK, st)
+}
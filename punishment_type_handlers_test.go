@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	"github.com/alanfran/gameprofile/profile"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Punishment types", func() {
+	var app *App
+
+	BeforeEach(func() {
+		app = NewApp(profile.NewMockStore())
+		app.ServerKeys = map[string]string{"5ed9c4c6b0a1": "server_1"}
+	})
+
+	request := func(method, url string, v interface{}) *httptest.ResponseRecorder {
+		var body []byte
+		if v != nil {
+			body, _ = json.Marshal(v)
+		}
+		req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Set("Content-Type", "application/json")
+
+		resp := httptest.NewRecorder()
+		app.engine.ServeHTTP(resp, req)
+		return resp
+	}
+
+	status := func(resp *httptest.ResponseRecorder) PlayerStatus {
+		Expect(resp.Code).To(Equal(http.StatusOK), resp.Body.String())
+		var st PlayerStatus
+		Expect(json.Unmarshal(resp.Body.Bytes(), &st)).To(Succeed())
+		return st
+	}
+
+	It("lists the built-in types", func() {
+		resp := request("GET", "/v1/punishment-types", nil)
+		Expect(resp.Code).To(Equal(http.StatusOK))
+
+		var ts []profile.PunishmentType
+		Expect(json.Unmarshal(resp.Body.Bytes(), &ts)).To(Succeed())
+		Expect(ts).To(ConsistOf(profile.BuiltinPunishmentTypes))
+	})
+
+	It("registers custom types and rejects invalid ones", func() {
+		t := profile.PunishmentType{Name: "spawn_ban", Scope: profile.ScopeGameMode, DefaultDuration: "24h"}
+		Expect(request("PUT", "/v1/punishment-types/spawn_ban", t).Code).To(Equal(http.StatusOK))
+
+		resp := request("GET", "/v1/punishment-types/spawn_ban", nil)
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(resp.Body.String()).To(MatchJSON(`{"Name": "spawn_ban", "Scope": "gamemode", "DefaultDuration": "24h"}`))
+
+		resp = request("PUT", "/v1/punishment-types/Spawn-Ban", profile.PunishmentType{Name: "Spawn-Ban", Scope: "planet", DefaultDuration: "soon"})
+		Expect(resp.Code).To(Equal(http.StatusBadRequest))
+		var body struct{ Problems []string }
+		Expect(json.Unmarshal(resp.Body.Bytes(), &body)).To(Succeed())
+		Expect(body.Problems).To(HaveLen(3))
+
+		Expect(request("GET", "/v1/punishment-types/nothing", nil).Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("rejects punishments of unknown types, or outside the scope of their type", func() {
+		resp := request("POST", "/v1/some_user/punishments", profile.Punishment{PlayerID: "some_user", By: "some_admin", Type: "spin"})
+		Expect(resp.Code).To(Equal(http.StatusBadRequest))
+		Expect(resp.Body.String()).To(ContainSubstring(`\"spin\" is not registered`))
+
+		resp = request("POST", "/v1/some_user/punishments", profile.Punishment{PlayerID: "some_user", By: "some_admin", Type: "ban", Server: "server_1"})
+		Expect(resp.Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("gives punishments without an expiry date the default duration of their type", func() {
+		date := time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)
+		resp := request("POST", "/v1/some_user/punishments", profile.Punishment{PlayerID: "some_user", By: "some_admin", Type: "Chat_Gag", Date: date})
+		Expect(resp.Code).To(Equal(http.StatusCreated), resp.Body.String())
+
+		ps, err := app.profiles.GetPunishments("some_user")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ps[profile.TypeChatGag].Expires).To(Equal(date.Add(time.Hour)))
+	})
+
+	It("only deletes custom types nobody is punished with", func() {
+		Expect(request("DELETE", "/v1/punishment-types/ban", nil).Code).To(Equal(http.StatusConflict))
+
+		Expect(app.profiles.PutPunishmentType(profile.PunishmentType{Name: "spawn_ban", Scope: profile.ScopeGlobal})).To(Succeed())
+		p, err := app.profiles.PutPunishment(profile.Punishment{PlayerID: "some_user", By: "some_admin", Type: "spawn_ban"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(request("DELETE", "/v1/punishment-types/spawn_ban", nil).Code).To(Equal(http.StatusConflict))
+
+		Expect(app.profiles.DelPunishment(p.ID)).To(Succeed())
+		Expect(request("DELETE", "/v1/punishment-types/spawn_ban", nil).Code).To(Equal(http.StatusNoContent))
+		Expect(request("DELETE", "/v1/punishment-types/spawn_ban", nil).Code).To(Equal(http.StatusNotFound))
+	})
+
+	Context("/:steamid/status", func() {
+		BeforeEach(func() {
+			Expect(app.profiles.PutPunishmentType(profile.PunishmentType{Name: "build_ban", Scope: profile.ScopeGameMode})).To(Succeed())
+			Expect(app.profiles.PutPunishmentType(profile.PunishmentType{Name: "local_ban", Scope: profile.ScopeServer})).To(Succeed())
+
+			for _, p := range []profile.Punishment{
+				{PlayerID: "some_user", By: "some_admin", Type: "build_ban", GameMode: "sandbox"},
+				{PlayerID: "some_user", By: "some_admin", Type: "local_ban", Server: "server_1"},
+				{PlayerID: "some_user", By: "some_admin", Type: "voice_mute", Expires: time.Now().Add(-time.Minute)},
+			} {
+				_, err := app.profiles.PutPunishment(p)
+				Expect(err).ToNot(HaveOccurred())
+			}
+		})
+
+		It("resolves the active punishments in force on the server that asks", func() {
+			ts := strconv.FormatInt(time.Now().Unix(), 10)
+			req, err := http.NewRequest("GET", "/v1/some_user/status?gamemode=sandbox", http.NoBody)
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Set(ServerHeader, "server_1")
+			req.Header.Set(profile.TimestampHeader, ts)
+			req.Header.Set(profile.SignatureHeader, SignRequest("5ed9c4c6b0a1", ts, "", "GET", "/v1/some_user/status?gamemode=sandbox", nil))
+
+			resp := httptest.NewRecorder()
+			app.engine.ServeHTTP(resp, req)
+
+			st := status(resp)
+			Expect(st.Server).To(Equal("server_1"))
+			Expect(st.Punishments).To(HaveLen(2))
+			Expect(st.Punishments).To(HaveKey("build_ban"))
+			Expect(st.Punishments).To(HaveKey("local_ban"))
+		})
+
+		It("leaves out punishments scoped elsewhere", func() {
+			st := status(request("GET", "/v1/some_user/status?server=server_2&gamemode=darkrp", nil))
+			Expect(st.Punishments).To(BeEmpty())
+		})
+
+		It("answers with no punishments for players that have none", func() {
+			st := status(request("GET", "/v1/another_user/status", nil))
+			Expect(st.PlayerID).To(Equal("another_user"))
+			Expect(st.Punishments).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alanfran/gameprofile/profile"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// Topics that game servers can subscribe to on the push channel.
+const (
+	TopicPunishments = "punishments"
+	TopicCoins       = "coins"
+	TopicInventory   = "inventory"
+)
+
+// Types of messages sent over the push channel.
+const (
+	PushAuth          = "auth"
+	PushAuthenticated = "authenticated"
+	PushSubscribe     = "subscribe"
+	PushUnsubscribe   = "unsubscribe"
+	PushSubscribed    = "subscribed"
+	PushEvent         = "event"
+	PushGap           = "gap"
+	PushPing          = "ping"
+	PushPong          = "pong"
+	PushError         = "error"
+)
+
+// Timeouts of the push channel. The service pings every pushPingPeriod and drops connections that do not answer
+// within pushPongWait, or that cannot take a message within pushWriteWait.
+const (
+	pushWriteWait  = 10 * time.Second
+	pushPongWait   = 60 * time.Second
+	pushPingPeriod = pushPongWait * 9 / 10
+	pushQueueSize  = 16
+)
+
+// PushMessage is a JSON message sent over the push channel in either direction.
+// Clients send subscribe and unsubscribe messages with Topics, and may send pings. Clients that did not send a key
+// when connecting must send it in an auth message with Token first.
+// The service answers with subscribed, pong and error messages, and sends an event message for every change
+// to a subscribed topic. A gap message means that some events could not be replayed after reconnecting.
+type PushMessage struct {
+	Type   string
+	Topics []string       `json:",omitempty"`
+	Topic  string         `json:",omitempty"`
+	Event  *profile.Event `json:",omitempty"`
+	Error  string         `json:",omitempty"`
+	Token  string         `json:",omitempty"`
+}
+
+var pushUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// Game servers are not browsers, and are authenticated with their key.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// serverName returns the name of the game server whose key is in the request's Authorization header.
+// Keys are never read from the URL, which ends up in logs.
+func (a *App) serverName(c *gin.Context) (string, bool) {
+	key := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if key == "" {
+		return "", false
+	}
+
+	name, ok := a.ServerKeys[key]
+	return name, ok
+}
+
+// requireServer rejects requests that are not made by a game server, either with a key from the server key file
+// or signed with one. It guards the streams that send every change.
+func (a *App) requireServer(c *gin.Context) {
+	if _, ok := a.serverName(c); !ok && c.GetString(signedServerKey) == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "Please supply a valid server key.",
+		})
+		return
+	}
+	c.Next()
+}
+
+// requirePushServer is requireServer for the push channel. Servers that cannot set headers may connect without
+// any credentials, and send their key in the first message instead.
+func (a *App) requirePushServer(c *gin.Context) {
+	if c.GetHeader("Authorization") == "" && c.GetString(signedServerKey) == "" {
+		c.Next()
+		return
+	}
+	a.requireServer(c)
+}
+
+// eventTopics returns the topics an event belongs to.
+func eventTopics(e profile.Event) []string {
+	switch e.Type {
+	case profile.EventPunishmentPut, profile.EventPunishmentDel:
+		return []string{TopicPunishments}
+	case profile.EventProfilePut:
+		var old profile.Profile
+		if e.OldProfile != nil {
+			old = *e.OldProfile
+		}
+
+		var topics []string
+		if e.OldProfile == nil || old.Coins != e.Profile.Coins {
+			topics = append(topics, TopicCoins)
+		}
+		if len(old.Inventory)+len(e.Profile.Inventory) > 0 && !reflect.DeepEqual(old.Inventory, e.Profile.Inventory) {
+			topics = append(topics, TopicInventory)
+		}
+		return topics
+	}
+	return nil
+}
+
+func validTopic(t string) bool {
+	return t == TopicPunishments || t == TopicCoins || t == TopicInventory
+}
+
+// GetPush upgrades the request to a WebSocket that pushes changes to game servers.
+// Servers authenticate with a key from the service's server key file, in the Authorization header or in an auth
+// message before any other, then subscribe to topics.
+// Events are pushed from the moment the server connected, or after the ID given in the last_event_id query parameter
+// when it reconnects.
+func (a *App) GetPush(c *gin.Context) {
+	after := a.events.LastID()
+	if last := c.Query("last_event_id"); last != "" {
+		var err error
+		after, err = strconv.ParseInt(last, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "The last event ID must be a number.",
+			})
+			return
+		}
+	}
+
+	conn, err := pushUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already responded.
+		return
+	}
+	_, authenticated := a.serverName(c)
+	authenticated = authenticated || c.GetString(signedServerKey) != ""
+
+	requests := make(chan PushMessage, pushQueueSize)
+	go readPush(conn, requests)
+	a.writePush(conn, after, requests, c.GetBool(int64StringsKey), authenticated)
+}
+
+// readPush reads client messages into requests until the connection fails, then closes requests.
+func readPush(conn *websocket.Conn, requests chan<- PushMessage) {
+	defer close(requests)
+
+	conn.SetReadLimit(4096)
+	conn.SetReadDeadline(time.Now().Add(pushPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pushPongWait))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		// Any message shows that the client is alive.
+		conn.SetReadDeadline(time.Now().Add(pushPongWait))
+
+		var m PushMessage
+		err = json.Unmarshal(data, &m)
+		if err != nil {
+			m = PushMessage{Type: PushError, Error: "Messages must be JSON objects."}
+		}
+
+		select {
+		case requests <- m:
+		default:
+			// The client sends requests faster than they can be answered.
+			return
+		}
+	}
+}
+
+// writePush is the only writer of a push connection. It answers client requests, forwards events on subscribed
+// topics and pings the client, until the connection fails or the subscription is dropped for falling behind.
+// The bus is subscribed to with the first subscribe request, so that no events after after are missed.
+// With int64Strings set, the integers of messages are sent as strings. Until the client is authenticated, the only
+// request answered is an auth message, and the connection is closed after any other.
+func (a *App) writePush(conn *websocket.Conn, after int64, requests <-chan PushMessage, int64Strings, authenticated bool) {
+	defer conn.Close()
+
+	var sub *profile.Subscription
+	var events <-chan profile.Event
+	defer func() {
+		if sub != nil {
+			sub.Close()
+		}
+	}()
+
+	ping := time.NewTicker(pushPingPeriod)
+	defer ping.Stop()
+
+	topics := map[string]bool{}
+	send := func(m PushMessage) bool {
+		j, err := json.Marshal(m)
+		if err == nil && int64Strings {
+			j, err = int64sToStrings(j, reflect.TypeOf(m))
+		}
+		if err != nil {
+			return false
+		}
+		conn.SetWriteDeadline(time.Now().Add(pushWriteWait))
+		return conn.WriteMessage(websocket.TextMessage, j) == nil
+	}
+
+	for {
+		select {
+		case m, ok := <-requests:
+			if !ok {
+				return
+			}
+			if !authenticated {
+				var answer PushMessage
+				answer, authenticated = a.authenticatePush(m)
+				if !send(answer) {
+					return
+				}
+				if !authenticated {
+					conn.WriteControl(websocket.CloseMessage,
+						websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "not authenticated"),
+						time.Now().Add(pushWriteWait))
+					return
+				}
+				continue
+			}
+			answer := answerPush(m, topics)
+			if !send(answer) {
+				return
+			}
+
+			if sub == nil && answer.Type == PushSubscribed {
+				sub = a.events.Subscribe(profile.EventFilter{}, after)
+				events = sub.C
+				if sub.Gap && !send(PushMessage{Type: PushGap}) {
+					return
+				}
+			}
+
+		case e, ok := <-events:
+			if !ok {
+				send(PushMessage{Type: PushError, Error: "Too far behind. Please reconnect with last_event_id."})
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too far behind"),
+					time.Now().Add(pushWriteWait))
+				return
+			}
+
+			for _, t := range eventTopics(e) {
+				if topics[t] {
+					e := e
+					if !send(PushMessage{Type: PushEvent, Topic: t, Event: &e}) {
+						return
+					}
+					break
+				}
+			}
+
+		case <-ping.C:
+			// Clients that have not authenticated are dropped when their read deadline passes.
+			if !authenticated {
+				continue
+			}
+			err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(pushWriteWait))
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// authenticatePush checks the first message of a client that connected without a key.
+func (a *App) authenticatePush(m PushMessage) (PushMessage, bool) {
+	if m.Type != PushAuth {
+		return PushMessage{Type: PushError, Error: "Please authenticate with a server key first."}, false
+	}
+	if _, ok := a.ServerKeys[m.Token]; !ok || m.Token == "" {
+		return PushMessage{Type: PushError, Error: "Please supply a valid server key."}, false
+	}
+	return PushMessage{Type: PushAuthenticated}, true
+}
+
+// answerPush handles a client message, updating the subscribed topics, and returns the answer.
+func answerPush(m PushMessage, topics map[string]bool) PushMessage {
+	switch m.Type {
+	case PushPing:
+		return PushMessage{Type: PushPong}
+
+	case PushSubscribe, PushUnsubscribe:
+		for _, t := range m.Topics {
+			if !validTopic(t) {
+				return PushMessage{Type: PushError, Error: "Unknown topic " + strconv.Quote(t) + "."}
+			}
+		}
+		for _, t := range m.Topics {
+			topics[t] = m.Type == PushSubscribe
+		}
+
+		subscribed := []string{}
+		for _, t := range []string{TopicPunishments, TopicCoins, TopicInventory} {
+			if topics[t] {
+				subscribed = append(subscribed, t)
+			}
+		}
+		return PushMessage{Type: PushSubscribed, Topics: subscribed}
+
+	case PushError:
+		return m
+	}
+
+	return PushMessage{Type: PushError, Error: "Unknown message type " + strconv.Quote(m.Type) + "."}
+}
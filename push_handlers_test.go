@@ -0,0 +1,166 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/alanfran/gameprofile/profile"
+	"github.com/gorilla/websocket"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// pushClient is a game server connected to the push channel.
+type pushClient struct {
+	conn *websocket.Conn
+}
+
+func (c *pushClient) send(m PushMessage) {
+	Expect(c.conn.WriteJSON(m)).To(Succeed())
+}
+
+func (c *pushClient) receive() PushMessage {
+	var m PushMessage
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	Expect(c.conn.ReadJSON(&m)).To(Succeed())
+	return m
+}
+
+func (c *pushClient) subscribe(topics ...string) {
+	c.send(PushMessage{Type: PushSubscribe, Topics: topics})
+	m := c.receive()
+	Expect(m.Type).To(Equal(PushSubscribed))
+}
+
+var _ = Describe("Push channel", func() {
+	var app *App
+	var server *httptest.Server
+	var url string
+
+	BeforeEach(func() {
+		app = NewApp(profile.NewMockStore())
+		app.ServerKeys = map[string]string{"secret": "server_1"}
+		server = httptest.NewServer(app.engine)
+		url = "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/push"
+	})
+
+	AfterEach(func() {
+		server.CloseClientConnections()
+		server.Close()
+	})
+
+	connect := func(query string) *pushClient {
+		header := http.Header{"Authorization": {"Bearer secret"}}
+		conn, _, err := websocket.DefaultDialer.Dial(url+query, header)
+		Expect(err).ToNot(HaveOccurred())
+		return &pushClient{conn: conn}
+	}
+
+	It("rejects servers without a valid key", func() {
+		_, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Authorization": {"Bearer wrong"}})
+		Expect(err).To(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("accepts the key in the first message, and not in the URL", func() {
+		conn, _, err := websocket.DefaultDialer.Dial(url+"?token=secret", nil)
+		Expect(err).ToNot(HaveOccurred())
+		c := &pushClient{conn: conn}
+		defer conn.Close()
+
+		c.send(PushMessage{Type: PushSubscribe, Topics: []string{TopicCoins}})
+		Expect(c.receive().Error).To(ContainSubstring("authenticate"))
+		_, _, err = conn.ReadMessage()
+		Expect(websocket.IsCloseError(err, websocket.ClosePolicyViolation)).To(BeTrue())
+
+		conn, _, err = websocket.DefaultDialer.Dial(url, nil)
+		Expect(err).ToNot(HaveOccurred())
+		c = &pushClient{conn: conn}
+		defer conn.Close()
+
+		c.send(PushMessage{Type: PushAuth, Token: "secret"})
+		Expect(c.receive().Type).To(Equal(PushAuthenticated))
+		c.subscribe(TopicCoins)
+	})
+
+	It("pushes events on subscribed topics only", func() {
+		c := connect("")
+		defer c.conn.Close()
+		c.subscribe(TopicPunishments)
+
+		Expect(app.profiles.PutProfile(profile.Profile{ID: "some_user", Coins: 5})).To(Succeed())
+		_, err := app.profiles.PutPunishment(profile.Punishment{PlayerID: "some_user", By: "some_admin", Type: "ban"})
+		Expect(err).ToNot(HaveOccurred())
+
+		m := c.receive()
+		Expect(m.Type).To(Equal(PushEvent))
+		Expect(m.Topic).To(Equal(TopicPunishments))
+		Expect(m.Event.Punishment.Type).To(Equal("ban"))
+	})
+
+	It("tells coin changes from inventory grants", func() {
+		Expect(app.profiles.PutItem(profile.Item{Name: "hat", Slot: "head"})).To(Succeed())
+		Expect(app.profiles.PutProfile(profile.Profile{ID: "some_user", Coins: 5})).To(Succeed())
+
+		c := connect("")
+		defer c.conn.Close()
+		c.subscribe(TopicInventory)
+
+		Expect(app.profiles.PutProfile(profile.Profile{ID: "some_user", Coins: 10})).To(Succeed())
+		_, _, err := app.profiles.ChangeInventory(profile.InventoryEvent{PlayerID: "some_user", Kind: profile.InventoryGrant, Item: "hat"})
+		Expect(err).ToNot(HaveOccurred())
+
+		m := c.receive()
+		Expect(m.Topic).To(Equal(TopicInventory))
+		Expect(m.Event.Profile.Inventory).To(HaveKey("hat"))
+	})
+
+	It("answers pings and reports bad requests", func() {
+		c := connect("")
+		defer c.conn.Close()
+
+		c.send(PushMessage{Type: PushPing})
+		Expect(c.receive().Type).To(Equal(PushPong))
+
+		c.send(PushMessage{Type: PushSubscribe, Topics: []string{"weather"}})
+		Expect(c.receive().Type).To(Equal(PushError))
+
+		Expect(c.conn.WriteMessage(websocket.TextMessage, []byte("hello"))).To(Succeed())
+		Expect(c.receive().Type).To(Equal(PushError))
+	})
+
+	It("resumes from the last event ID", func() {
+		for _, coins := range []int64{1, 2, 3} {
+			Expect(app.profiles.PutProfile(profile.Profile{ID: "some_user", Coins: coins})).To(Succeed())
+		}
+
+		c := connect("?last_event_id=1")
+		defer c.conn.Close()
+		c.subscribe(TopicCoins)
+
+		Expect(c.receive().Event.ID).To(Equal(int64(2)))
+		Expect(c.receive().Event.ID).To(Equal(int64(3)))
+	})
+
+	It("disconnects servers that fall too far behind", func() {
+		c := connect("")
+		defer c.conn.Close()
+		c.subscribe(TopicCoins)
+
+		// Nothing is read while large events pile up, until the socket buffers and then the subscription's queue are full.
+		big := profile.Profile{ID: strings.Repeat("x", 32*1024)}
+		for i := 0; i < 1000; i++ {
+			app.events.Publish(profile.Event{Type: profile.EventProfilePut, Profile: &big})
+		}
+
+		var err error
+		for err == nil {
+			var m PushMessage
+			c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			err = c.conn.ReadJSON(&m)
+		}
+		Expect(websocket.IsCloseError(err, websocket.CloseTryAgainLater)).To(BeTrue())
+	})
+})
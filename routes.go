@@ -1,18 +1,198 @@
 package main
 
 import (
+	"net/http"
+	"strings"
+
+	"github.com/alanfran/gameprofile/profile"
 	"github.com/gin-gonic/gin"
 )
 
+// APIPrefix is the path every route of the current API version is served under.
+const APIPrefix = "/v1"
+
+// route is an endpoint of the API. The OpenAPI document is generated from the same table the routes are registered
+// from, so that every route is described.
+type route struct {
+	Method  string
+	Path    string
+	Handler gin.HandlerFunc
+	Summary string
+	// Query lists the query parameters the handler reads.
+	Query []string
+	// Body and Response are values of the types the handler reads and writes as JSON, if any.
+	// Consumes and Produces name the content type of bodies that are not JSON.
+	Body     interface{}
+	Consumes string
+	Status   int
+	Response interface{}
+	Produces string
+	// Auth checks the caller before the handler runs. Routes without one are open to everyone.
+	Auth gin.HandlerFunc
+	// Legacy routes were served before the API was versioned, and are still served without APIPrefix.
+	Legacy bool
+}
+
+// routes returns every endpoint of the API, relative to APIPrefix.
+func (a *App) routes() []route {
+	rs := []route{
+		{Method: "GET", Path: "/profiles", Handler: a.ListProfiles, Summary: "List profiles a page at a time",
+			Query: []string{"cursor", "limit", "sort", "order"}, Response: ProfileList{}},
+		{Method: "POST", Path: "/profiles/batch", Handler: a.PostProfileBatch, Summary: "Read many profiles at once",
+			Body: ProfileBatch{}, Response: ProfileBatchResult{}},
+		{Method: "POST", Path: "/bulk", Handler: a.PostBulk, Summary: "Store many profiles and punishments",
+			Body: BulkRequest{}, Response: BulkResponse{}},
+		{Method: "GET", Path: "/:steamid", Handler: a.GetProfile, Summary: "Read a profile",
+			Response: ProfileWithHash{}, Legacy: true},
+		{Method: "POST", Path: "/", Handler: a.PostProfile, Summary: "Create a profile",
+			Body: profile.Profile{}, Status: http.StatusCreated, Response: ProfileWithHash{}, Legacy: true},
+		{Method: "PUT", Path: "/:steamid", Handler: a.PutProfile, Summary: "Update a profile, given the hash of its current state",
+			Body: ProfileWithHash{}, Response: ProfileWithHash{}, Legacy: true},
+
+		{Method: "GET", Path: "/:steamid/history", Handler: a.GetHistory, Summary: "List the versions of a profile",
+			Response: []profile.ProfileVersion{}},
+
+		{Method: "GET", Path: "/leaderboard", Handler: a.GetLeaderboard, Summary: "List the richest players",
+			Query: []string{"limit"}, Response: []profile.Ranking{}},
+		{Method: "GET", Path: "/:steamid/rank", Handler: a.GetStanding, Summary: "Read a player's rank on the leaderboard",
+			Query: []string{"around"}, Response: profile.Standing{}},
+
+		{Method: "GET", Path: "/items", Handler: a.GetItems, Summary: "List the item catalog",
+			Response: []profile.Item{}},
+		{Method: "GET", Path: "/items/:name", Handler: a.GetItem, Summary: "Read a catalog item",
+			Response: profile.Item{}},
+		{Method: "PUT", Path: "/items/:name", Handler: a.PutItem, Summary: "Create or replace a catalog item",
+			Body: profile.Item{}, Response: profile.Item{}},
+		{Method: "DELETE", Path: "/items/:name", Handler: a.DelItem, Summary: "Remove an item nobody owns from the catalog",
+			Status: http.StatusNoContent},
+
+		{Method: "GET", Path: "/:steamid/purchases", Handler: a.GetPurchases, Summary: "List a player's receipts",
+			Response: []profile.Receipt{}},
+		{Method: "POST", Path: "/:steamid/purchases", Handler: a.PostPurchase, Summary: "Buy an item",
+			Body: Purchase{}, Status: http.StatusCreated, Response: PurchaseResult{}},
+		{Method: "POST", Path: "/:steamid/purchases/:id/refund", Handler: a.PostRefund, Summary: "Refund a purchase",
+			Response: PurchaseResult{}},
+
+		{Method: "POST", Path: "/:steamid/inventory", Handler: a.PostInventoryItem, Summary: "Grant an item",
+			Body: InventoryChange{}, Status: http.StatusCreated, Response: InventoryResult{}},
+		{Method: "PUT", Path: "/:steamid/inventory/:item", Handler: a.PutInventoryItem, Summary: "Change an item's settings",
+			Body: InventoryChange{}, Response: InventoryResult{}},
+		{Method: "DELETE", Path: "/:steamid/inventory/:item", Handler: a.DelInventoryItem, Summary: "Take an item away",
+			Query: []string{"by"}, Response: InventoryResult{}},
+		{Method: "POST", Path: "/:steamid/inventory/:item/sell", Handler: a.SellInventoryItem, Summary: "Sell an item back to the shop",
+			Body: InventoryChange{}, Response: InventoryResult{}},
+
+		{Method: "GET", Path: "/events", Handler: a.GetEvents, Summary: "Stream changes as server-sent events",
+			Query: []string{"steamid", "type", "last_event_id"}, Produces: "text/event-stream", Auth: a.requireServer},
+		{Method: "GET", Path: "/push", Handler: a.GetPush, Summary: "Open the push channel for game servers",
+			Query: []string{"last_event_id"}, Status: http.StatusSwitchingProtocols, Auth: a.requirePushServer},
+
+		{Method: "GET", Path: "/punishments", Handler: a.QueryPunishments, Summary: "Search punishments",
+			Query: []string{"player", "by", "type", "status", "reason", "since", "until", "limit"}, Response: []profile.Punishment{}},
+		{Method: "GET", Path: "/:steamid/punishments", Handler: a.GetPunishments, Summary: "Read a player's current punishments by type and scope",
+			Response: map[string]profile.Punishment{}, Legacy: true},
+		{Method: "GET", Path: "/:steamid/status", Handler: a.GetStatus, Summary: "Read the punishments of a player in force on a server",
+			Query: []string{"server", "gamemode"}, Response: PlayerStatus{}},
+		{Method: "POST", Path: "/:steamid/punishments", Handler: a.PostPunishments, Summary: "Punish a player, escalating by policy",
+			Body: profile.Punishment{}, Status: http.StatusCreated, Response: PunishmentResult{}, Legacy: true},
+		{Method: "PUT", Path: "/:steamid/punishments", Handler: a.PutPunishments, Summary: "Store several punishments of a player",
+			Body: map[string]profile.Punishment{}, Status: http.StatusNoContent, Legacy: true},
+
+		{Method: "GET", Path: "/punishment-types", Handler: a.GetPunishmentTypes, Summary: "List the punishment types",
+			Response: []profile.PunishmentType{}},
+		{Method: "GET", Path: "/punishment-types/:name", Handler: a.GetPunishmentType, Summary: "Read a punishment type",
+			Response: profile.PunishmentType{}},
+		{Method: "PUT", Path: "/punishment-types/:name", Handler: a.PutPunishmentType, Summary: "Register or change a punishment type",
+			Body: profile.PunishmentType{}, Response: profile.PunishmentType{}},
+		{Method: "DELETE", Path: "/punishment-types/:name", Handler: a.DelPunishmentType, Summary: "Remove an unused custom punishment type",
+			Status: http.StatusNoContent},
+
+		{Method: "GET", Path: "/appeals", Handler: a.GetAppeals, Summary: "List appeals by status",
+			Query: []string{"status", "player", "punishment", "limit"}, Response: []profile.Appeal{}},
+		{Method: "POST", Path: "/appeals", Handler: a.PostAppeal, Summary: "Appeal a punishment",
+			Body: AppealRequest{}, Status: http.StatusCreated, Response: profile.Appeal{}},
+		{Method: "GET", Path: "/appeals/:id", Handler: a.GetAppeal, Summary: "Read an appeal and its history",
+			Response: profile.Appeal{}},
+		{Method: "POST", Path: "/appeals/:id/events", Handler: a.PostAppealEvent, Summary: "Comment on an appeal, or accept or reject it",
+			Body: profile.AppealEvent{}, Response: AppealResult{}},
+
+		{Method: "GET", Path: "/admin/export", Handler: a.GetExport, Summary: "Export every record as a JSON Lines archive",
+			Produces: "application/x-ndjson"},
+		{Method: "POST", Path: "/admin/import", Handler: a.PostImport, Summary: "Import a JSON Lines archive",
+			Query: []string{"overwrite"}, Consumes: "application/x-ndjson", Response: profile.ImportStats{}},
+		{Method: "GET", Path: "/admin/backup", Handler: a.GetBackup, Summary: "Download a snapshot of the database",
+			Produces: "application/octet-stream"},
+		{Method: "GET", Path: "/admin/inventory/:steamid", Handler: a.GetInventoryEvents, Summary: "Read a player's inventory log",
+			Query: []string{"item"}, Response: []profile.InventoryEvent{}},
+		{Method: "POST", Path: "/admin/history/:steamid/restore", Handler: a.PostRestoreVersion, Summary: "Restore an earlier version of a profile",
+			Body: Restore{}, Response: ProfileWithHash{}},
+
+		{Method: "GET", Path: "/admin/webhooks", Handler: a.GetWebhooks, Summary: "List webhooks",
+			Response: []profile.Webhook{}},
+		{Method: "POST", Path: "/admin/webhooks", Handler: a.PostWebhook, Summary: "Create a webhook",
+			Body: profile.Webhook{}, Status: http.StatusCreated, Response: profile.Webhook{}},
+		{Method: "GET", Path: "/admin/webhooks/:id", Handler: a.GetWebhook, Summary: "Read a webhook",
+			Response: profile.Webhook{}},
+		{Method: "PUT", Path: "/admin/webhooks/:id", Handler: a.PutWebhook, Summary: "Replace a webhook",
+			Body: profile.Webhook{}, Response: profile.Webhook{}},
+		{Method: "DELETE", Path: "/admin/webhooks/:id", Handler: a.DelWebhook, Summary: "Delete a webhook",
+			Status: http.StatusNoContent},
+		{Method: "GET", Path: "/admin/webhooks/:id/deliveries", Handler: a.GetWebhookDeliveries, Summary: "Read a webhook's delivery log",
+			Query: []string{"status", "limit"}, Response: []profile.Delivery{}},
+		{Method: "GET", Path: "/admin/deliveries", Handler: a.GetDeliveries, Summary: "Read the delivery log of every webhook",
+			Query: []string{"status", "limit"}, Response: []profile.Delivery{}},
+		{Method: "POST", Path: "/admin/deliveries/:id/redeliver", Handler: a.PostRedeliver, Summary: "Send a delivery again",
+			Status: http.StatusAccepted, Response: profile.Delivery{}},
+	}
+
+	for i := range rs {
+		if strings.HasPrefix(rs[i].Path, "/admin/") {
+			rs[i].Auth = a.requireAdmin
+		}
+	}
+	return rs
+}
+
 func (a *App) initRoutes() {
 	r := gin.Default()
+	r.Use(a.msgpackResponses(), a.signatures(), a.msgpackRequests(), a.int64Format())
 	a.engine = r
 
-	r.GET("/:steamid", a.GetProfile)
-	r.POST("/", a.PostProfile)
-	r.PUT("/:steamid", a.PutProfile)
+	v1 := r.Group(APIPrefix)
+	v1.GET("/openapi.json", a.GetOpenAPI)
+
+	// The paths from before the API was versioned keep working, but point clients to their successors.
+	// Routes added since are only served under APIPrefix.
+	legacy := r.Group("/", deprecated)
+
+	idempotency := a.idempotency()
+	for _, rt := range a.routes() {
+		handlers := []gin.HandlerFunc{idempotency, rt.Handler}
+		if rt.Auth != nil {
+			handlers = append([]gin.HandlerFunc{rt.Auth}, handlers...)
+		}
+		if rt.Response != nil {
+			handlers = append([]gin.HandlerFunc{respondsWith(rt.Response)}, handlers...)
+		}
+		v1.Handle(rt.Method, rt.Path, handlers...)
+		if rt.Legacy {
+			legacy.Handle(rt.Method, rt.Path, handlers...)
+		}
+	}
+}
+
+// legacyKey is the context key set on requests to the unversioned paths.
+const legacyKey = "gameprofile.legacy"
+
+// legacy reports whether a request came in on an unversioned path, whose answers must not change.
+func legacy(c *gin.Context) bool {
+	return c.GetBool(legacyKey)
+}
 
-	r.GET("/:steamid/punishments", a.GetPunishments)
-	r.POST("/:steamid/punishments", a.PostPunishments)
-	r.PUT("/:steamid/punishments", a.PutPunishments)
+// deprecated marks responses on unversioned paths as deprecated, with a link to the same path under APIPrefix.
+func deprecated(c *gin.Context) {
+	c.Set(legacyKey, true)
+	c.Header("Deprecation", "true")
+	c.Header("Link", "<"+APIPrefix+c.Request.URL.Path+`>; rel="successor-version"`)
+	c.Next()
 }
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alanfran/gameprofile/profile"
+	"github.com/gin-gonic/gin"
+)
+
+// shopErrorStatus maps errors of purchases, refunds and inventory changes to response codes.
+func shopErrorStatus(err error) int {
+	switch err {
+	case profile.ErrProfileNotFound, profile.ErrItemNotFound, profile.ErrReceiptNotFound:
+		return http.StatusNotFound
+	case profile.ErrNotEnoughCoins, profile.ErrAlreadyOwned, profile.ErrNotOwned, profile.ErrAlreadyRefunded:
+		return http.StatusConflict
+	}
+	if _, ok := err.(*profile.ValidationError); ok {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// shopError responds with the status for err. Internal errors are not shown to the client.
+func shopError(c *gin.Context, err error) {
+	status := shopErrorStatus(err)
+	if status == http.StatusInternalServerError {
+		c.JSON(status, gin.H{
+			"error": "An error occurred while processing your request. Please try again later.",
+		})
+		return
+	}
+
+	c.JSON(status, gin.H{
+		"error": err.Error(),
+	})
+}
+
+// GetPurchases returns a player's purchase history, newest first.
+func (a *App) GetPurchases(c *gin.Context) {
+	rs, err := a.profiles.GetReceipts(c.Param("steamid"))
+	if err != nil {
+		shopError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, rs)
+}
+
+// PostPurchase buys a catalog item for a player at its catalog price.
+func (a *App) PostPurchase(c *gin.Context) {
+	var req Purchase
+	err := bindJSON(c, &req)
+	if err != nil || req.Item == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Please supply the name of the Item to purchase.",
+		})
+		return
+	}
+
+	r, p, err := a.profiles.Purchase(c.Param("steamid"), req.Item, time.Now())
+	if err != nil {
+		shopError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, PurchaseResult{
+		Receipt: r,
+		Profile: NewProfileWithHash(p),
+	})
+}
+
+// PostRefund refunds one of a player's purchases.
+func (a *App) PostRefund(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid receipt ID.",
+		})
+		return
+	}
+
+	// Make sure the receipt belongs to the player in the URL before refunding it.
+	r, err := a.profiles.GetReceipt(id)
+	if err == nil && r.PlayerID != c.Param("steamid") {
+		err = profile.ErrReceiptNotFound
+	}
+	if err != nil {
+		shopError(c, err)
+		return
+	}
+
+	r, p, err := a.profiles.Refund(id, time.Now())
+	if err != nil {
+		shopError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, PurchaseResult{
+		Receipt: r,
+		Profile: NewProfileWithHash(p),
+	})
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alanfran/gameprofile/profile"
+	"github.com/gin-gonic/gin"
+)
+
+// ServerHeader names the game server that signed a request with its key.
+const ServerHeader = "X-Gameprofile-Server"
+
+// NonceHeader holds a value that is unique to a signed request, so that requests that are otherwise the same can be
+// sent within a second of each other. It is covered by the signature.
+const NonceHeader = "X-Gameprofile-Nonce"
+
+// nonceForm is the form of nonces: they cannot hold the dots and spaces that separate the parts of a signed message.
+var nonceForm = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// signatureTolerance is how far the timestamp of a signed request may be from the service's clock.
+const signatureTolerance = 5 * time.Minute
+
+// signedServerKey is the context key of the name of the server that signed a request.
+const signedServerKey = "gameprofile.server"
+
+// SignRequest returns the signature of a request made by a game server, in the format of profile.Sign.
+// The signed message is the method, a space, the path with its query string, a newline and the body, so that
+// a signature cannot be replayed against another route. A nonce, if any, follows the timestamp after a dot.
+func SignRequest(key, timestamp, nonce, method, uri string, body []byte) string {
+	if nonce != "" {
+		timestamp += "." + nonce
+	}
+	msg := append([]byte(method+" "+uri+"\n"), body...)
+	return profile.Sign(key, timestamp, msg)
+}
+
+// replayCache remembers the signatures accepted while their timestamp is within signatureTolerance,
+// so that every signed request is accepted once.
+type replayCache struct {
+	mu    sync.Mutex
+	seen  map[string]time.Time
+	prune time.Time
+}
+
+func newReplayCache() *replayCache {
+	return &replayCache{seen: map[string]time.Time{}}
+}
+
+// add records a signature until it expires, and reports false if it was recorded already.
+func (r *replayCache) add(signature string, expires, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if now.After(r.prune) {
+		for s, e := range r.seen {
+			if now.After(e) {
+				delete(r.seen, s)
+			}
+		}
+		r.prune = now.Add(time.Minute)
+	}
+
+	if _, ok := r.seen[signature]; ok {
+		return false
+	}
+	r.seen[signature] = expires
+	return true
+}
+
+// signatureRequired reports whether an unsigned request is refused. Writes must be signed when RequireSignatures is
+// set, and reads when RequireSignedReads is set. Requests with an admin key are let through, and so are reads with a
+// server key, since they are authenticated already.
+func (a *App) signatureRequired(c *gin.Context) bool {
+	if _, ok := a.adminName(c); ok {
+		return false
+	}
+
+	switch c.Request.Method {
+	case "OPTIONS":
+		return false
+	case "GET", "HEAD":
+		_, ok := a.serverName(c)
+		return a.RequireSignedReads && !ok
+	}
+	return a.RequireSignatures
+}
+
+// keyOf returns the key of the named game server.
+func (a *App) keyOf(server string) (string, bool) {
+	for key, name := range a.ServerKeys {
+		if name == server {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// signatures checks requests signed by game servers with their key, in the ServerHeader, profile.TimestampHeader,
+// profile.SignatureHeader and optional NonceHeader headers. Requests with a bad signature are rejected, and so are
+// signatures that were already used. The server that signed a request is recorded as its caller.
+// See signatureRequired for the requests that must be signed.
+func (a *App) signatures() gin.HandlerFunc {
+	replays := newReplayCache()
+
+	return func(c *gin.Context) {
+		signature := c.GetHeader(profile.SignatureHeader)
+		if signature == "" {
+			if a.signatureRequired(c) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+					"error": "Please sign your request with a server key.",
+				})
+				return
+			}
+			c.Next()
+			return
+		}
+
+		server := c.GetHeader(ServerHeader)
+		timestamp := c.GetHeader(profile.TimestampHeader)
+		key, ok := a.keyOf(server)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Unknown server.",
+			})
+			return
+		}
+
+		nonce := c.GetHeader(NonceHeader)
+		if nonce != "" && !nonceForm.MatchString(nonce) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Nonces must be at most 64 letters, digits, dashes and underscores.",
+			})
+			return
+		}
+
+		sec, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil || math.Abs(time.Since(time.Unix(sec, 0)).Seconds()) > signatureTolerance.Seconds() {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "The timestamp of the signature is missing or too far off. Please check the server's clock.",
+			})
+			return
+		}
+
+		body, err := ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "There was an error reading your request.",
+			})
+			return
+		}
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		expected := SignRequest(key, timestamp, nonce, c.Request.Method, c.Request.URL.RequestURI(), body)
+		if !hmac.Equal([]byte(signature), []byte(expected)) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid signature.",
+			})
+			return
+		}
+
+		if !replays.add(server+" "+signature, time.Unix(sec, 0).Add(signatureTolerance), time.Now()) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "This signed request was already received. Please sign every request anew, with a nonce if the same request may be sent twice within a second.",
+			})
+			return
+		}
+
+		c.Set(signedServerKey, server)
+		c.Next()
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	"github.com/alanfran/gameprofile/profile"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Signed requests", func() {
+	var app *App
+
+	BeforeEach(func() {
+		app = NewApp(profile.NewMockStore())
+		app.ServerKeys = map[string]string{"secret": "server_1"}
+		app.AdminKeys = map[string]string{"admin_secret": "some_admin"}
+		Expect(app.profiles.PutProfile(profile.Profile{ID: "some_user"})).To(Succeed())
+	})
+
+	// signed returns a request signed by server_1, with nonce unless it is empty.
+	signed := func(method, url, nonce string, body []byte) *http.Request {
+		req, err := http.NewRequest(method, url, bytes.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(ServerHeader, "server_1")
+		req.Header.Set(profile.TimestampHeader, ts)
+		if nonce != "" {
+			req.Header.Set(NonceHeader, nonce)
+		}
+		req.Header.Set(profile.SignatureHeader, SignRequest("secret", ts, nonce, method, url, body))
+		return req
+	}
+
+	serve := func(req *http.Request) int {
+		resp := httptest.NewRecorder()
+		app.engine.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	It("accepts every signature once", func() {
+		req := signed("GET", "/v1/some_user", "", nil)
+		Expect(serve(req)).To(Equal(http.StatusOK))
+		Expect(serve(req)).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("accepts the same request again with another nonce", func() {
+		Expect(serve(signed("GET", "/v1/some_user", "a", nil))).To(Equal(http.StatusOK))
+		Expect(serve(signed("GET", "/v1/some_user", "b", nil))).To(Equal(http.StatusOK))
+		Expect(serve(signed("GET", "/v1/some_user", "a", nil))).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("rejects a nonce that was not signed", func() {
+		req := signed("GET", "/v1/some_user", "", nil)
+		req.Header.Set(NonceHeader, "a")
+		Expect(serve(req)).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("rejects malformed nonces", func() {
+		Expect(serve(signed("GET", "/v1/some_user", "a.b", nil))).To(Equal(http.StatusUnauthorized))
+	})
+
+	Context("with RequireSignedReads", func() {
+		BeforeEach(func() {
+			app.RequireSignedReads = true
+		})
+
+		It("rejects unsigned reads", func() {
+			req, _ := http.NewRequest("GET", "/v1/some_user", nil)
+			Expect(serve(req)).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("answers signed reads", func() {
+			Expect(serve(signed("GET", "/v1/some_user", "a", nil))).To(Equal(http.StatusOK))
+		})
+
+		It("answers reads made with a server or admin key", func() {
+			for _, key := range []string{"secret", "admin_secret"} {
+				req, _ := http.NewRequest("GET", "/v1/some_user", nil)
+				req.Header.Set("Authorization", "Bearer "+key)
+				Expect(serve(req)).To(Equal(http.StatusOK), key)
+			}
+		})
+
+		It("leaves writes unsigned unless RequireSignatures is set", func() {
+			req, _ := http.NewRequest("POST", "/v1/", bytes.NewBufferString(`{"ID":"another_user"}`))
+			req.Header.Set("Content-Type", "application/json")
+			Expect(serve(req)).To(Equal(http.StatusCreated))
+		})
+	})
+
+	Context("with RequireSignatures", func() {
+		BeforeEach(func() {
+			app.RequireSignatures = true
+		})
+
+		It("lets admins write without signing", func() {
+			req, _ := http.NewRequest("POST", "/v1/", bytes.NewBufferString(`{"ID":"another_user"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer admin_secret")
+			Expect(serve(req)).To(Equal(http.StatusCreated))
+		})
+	})
+})
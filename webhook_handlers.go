@@ -0,0 +1,233 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/alanfran/gameprofile/profile"
+	"github.com/gin-gonic/gin"
+)
+
+// idParam parses the :id parameter, answering 400 Bad Request if it is not a number.
+func idParam(c *gin.Context, what string) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid " + what + " ID.",
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+// redactWebhook hides the secret of a webhook before it is sent back. Secrets are write-only, since anyone who can
+// read one can forge deliveries.
+func redactWebhook(w profile.Webhook) profile.Webhook {
+	w.Secret = ""
+	return w
+}
+
+// webhookError answers a failed webhook write.
+func webhookError(c *gin.Context, err error) {
+	if verr, ok := err.(*profile.ValidationError); ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Invalid webhook.",
+			"problems": verr.Problems,
+		})
+		return
+	}
+	if err == profile.ErrWebhookNotFound {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": "An error occurred while saving the webhook. Please try again later.",
+	})
+}
+
+// GetWebhooks lists every webhook subscription.
+func (a *App) GetWebhooks(c *gin.Context) {
+	hooks, err := a.profiles.GetWebhooks()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "An error occurred while reading the webhooks. Please try again later.",
+		})
+		return
+	}
+
+	for i := range hooks {
+		hooks[i] = redactWebhook(hooks[i])
+	}
+	c.JSON(http.StatusOK, hooks)
+}
+
+// GetWebhook returns a single webhook subscription.
+func (a *App) GetWebhook(c *gin.Context) {
+	id, ok := idParam(c, "webhook")
+	if !ok {
+		return
+	}
+
+	w, err := a.profiles.GetWebhook(id)
+	if err == profile.ErrWebhookNotFound {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "An error occurred while reading the webhook. Please try again later.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, redactWebhook(w))
+}
+
+// PostWebhook creates a webhook subscription and returns it with its ID.
+func (a *App) PostWebhook(c *gin.Context) {
+	var w profile.Webhook
+	err := bindJSON(c, &w)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "There was an error processing your request. Please make sure your JSON is well-formed.",
+		})
+		return
+	}
+
+	w.ID = 0
+	w, err = a.profiles.PutWebhook(w)
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, redactWebhook(w))
+}
+
+// PutWebhook replaces a webhook subscription. Without a Secret, the webhook keeps the one it has, so that a webhook
+// that was read can be written back.
+func (a *App) PutWebhook(c *gin.Context) {
+	id, ok := idParam(c, "webhook")
+	if !ok {
+		return
+	}
+
+	var w profile.Webhook
+	err := bindJSON(c, &w)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "There was an error processing your request. Please make sure your JSON is well-formed.",
+		})
+		return
+	}
+
+	w.ID = id
+	if w.Secret == "" {
+		old, err := a.profiles.GetWebhook(id)
+		if err != nil && err != profile.ErrWebhookNotFound {
+			webhookError(c, err)
+			return
+		}
+		w.Secret = old.Secret
+	}
+
+	w, err = a.profiles.PutWebhook(w)
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, redactWebhook(w))
+}
+
+// DelWebhook removes a webhook subscription. Its deliveries stay in the log.
+func (a *App) DelWebhook(c *gin.Context) {
+	id, ok := idParam(c, "webhook")
+	if !ok {
+		return
+	}
+
+	err := a.profiles.DelWebhook(id)
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+
+	c.String(http.StatusNoContent, "")
+}
+
+// GetWebhookDeliveries returns the delivery log of a single webhook. See GetDeliveries for the query parameters.
+func (a *App) GetWebhookDeliveries(c *gin.Context) {
+	id, ok := idParam(c, "webhook")
+	if !ok {
+		return
+	}
+
+	a.queryDeliveries(c, profile.DeliveryQuery{WebhookID: id})
+}
+
+// GetDeliveries returns the delivery log of every webhook, newest first.
+// Query parameters: status ("pending", "delivered" or "dead", the dead-letter list) and limit.
+func (a *App) GetDeliveries(c *gin.Context) {
+	a.queryDeliveries(c, profile.DeliveryQuery{})
+}
+
+func (a *App) queryDeliveries(c *gin.Context, q profile.DeliveryQuery) {
+	q.Status = c.Query("status")
+
+	var err error
+	if l := c.Query("limit"); l != "" {
+		q.Limit, err = strconv.Atoi(l)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "The limit must be a number.",
+			})
+			return
+		}
+	}
+
+	ds, err := a.profiles.QueryDeliveries(q)
+	if err == profile.ErrInvalidDeliveryStatus {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "An error occurred while reading the delivery log. Please try again later.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ds)
+}
+
+// PostRedeliver sends a delivery again from its first attempt, typically to replay a dead letter
+// once the receiver is fixed.
+func (a *App) PostRedeliver(c *gin.Context) {
+	id, ok := idParam(c, "delivery")
+	if !ok {
+		return
+	}
+
+	d, err := a.webhooks.Redeliver(id)
+	if err == profile.ErrDeliveryNotFound {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "An error occurred while scheduling the delivery. Please try again later.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, d)
+}
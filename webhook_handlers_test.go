@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/alanfran/gameprofile/profile"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Webhooks", func() {
+	var app *App
+	var stop chan struct{}
+	var receiver *httptest.Server
+	var mu sync.Mutex
+	var received [][]byte
+	var failing bool
+
+	BeforeEach(func() {
+		app = NewApp(profile.NewMockStore())
+		app.AdminKeys = map[string]string{"admin_secret": "some_admin"}
+		app.webhooks.Backoff = 10 * time.Millisecond
+		app.webhooks.MaxAttempts = 2
+
+		received = nil
+		failing = false
+		receiver = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			mu.Lock()
+			defer mu.Unlock()
+			Expect(r.Header.Get(profile.SignatureHeader)).To(Equal(profile.Sign("secret", r.Header.Get(profile.TimestampHeader), body)))
+			received = append(received, body)
+			if failing {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}))
+
+		stop = make(chan struct{})
+		go app.webhooks.Run(stop)
+	})
+
+	AfterEach(func() {
+		close(stop)
+		receiver.Close()
+	})
+
+	request := func(method, url string, v interface{}) *httptest.ResponseRecorder {
+		var body []byte
+		if v != nil {
+			body, _ = json.Marshal(v)
+		}
+		req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer admin_secret")
+
+		resp := httptest.NewRecorder()
+		app.engine.ServeHTTP(resp, req)
+		return resp
+	}
+
+	createWebhook := func(w profile.Webhook) profile.Webhook {
+		resp := request("POST", "/v1/admin/webhooks", w)
+		Expect(resp.Code).To(Equal(http.StatusCreated))
+		Expect(json.Unmarshal(resp.Body.Bytes(), &w)).To(Succeed())
+		return w
+	}
+
+	deliveries := func(url string) func() []profile.Delivery {
+		return func() []profile.Delivery {
+			resp := request("GET", url, nil)
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			var ds []profile.Delivery
+			Expect(json.Unmarshal(resp.Body.Bytes(), &ds)).To(Succeed())
+			return ds
+		}
+	}
+
+	It("manages webhook subscriptions", func() {
+		w := createWebhook(profile.Webhook{URL: receiver.URL, Secret: "secret", Events: []string{profile.EventPunishmentPut}})
+		Expect(w.ID).ToNot(BeZero())
+		w.Secret = ""
+
+		w.PunishmentTypes = []string{"ban"}
+		resp := request("PUT", "/v1/admin/webhooks/1", w)
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(resp.Body.String()).ToNot(ContainSubstring("secret"))
+
+		resp = request("GET", "/v1/admin/webhooks/1", nil)
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		var got profile.Webhook
+		Expect(json.Unmarshal(resp.Body.Bytes(), &got)).To(Succeed())
+		Expect(got).To(Equal(w))
+
+		resp = request("GET", "/v1/admin/webhooks", nil)
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(resp.Body.String()).ToNot(ContainSubstring("secret"))
+
+		stored, err := app.profiles.GetWebhook(1)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stored.Secret).To(Equal("secret"))
+
+		resp = request("DELETE", "/v1/admin/webhooks/1", nil)
+		Expect(resp.Code).To(Equal(http.StatusNoContent))
+		resp = request("GET", "/v1/admin/webhooks/1", nil)
+		Expect(resp.Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("returns 400 Bad Request for an invalid webhook", func() {
+		resp := request("POST", "/v1/admin/webhooks", profile.Webhook{URL: "not a url", Events: []string{"profile.get"}})
+		Expect(resp.Code).To(Equal(http.StatusBadRequest))
+
+		var body struct{ Problems []string }
+		Expect(json.Unmarshal(resp.Body.Bytes(), &body)).To(Succeed())
+		Expect(body.Problems).To(HaveLen(3))
+	})
+
+	It("delivers bans and large coin changes to a receiver", func() {
+		createWebhook(profile.Webhook{URL: receiver.URL, Secret: "secret", PunishmentTypes: []string{"ban"}, MinCoinDelta: 1000})
+
+		Expect(app.profiles.PutProfile(profile.Profile{ID: "some_user", Coins: 10})).To(Succeed())
+		Expect(app.profiles.PutProfile(profile.Profile{ID: "some_user", Coins: 5000})).To(Succeed())
+		_, err := app.profiles.PutPunishment(profile.Punishment{PlayerID: "some_user", By: "some_admin", Type: profile.TypeChatGag})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = app.profiles.PutPunishment(profile.Punishment{PlayerID: "some_user", By: "some_admin", Type: "ban"})
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(deliveries("/v1/admin/webhooks/1/deliveries?status=delivered")).Should(HaveLen(2))
+
+		mu.Lock()
+		defer mu.Unlock()
+		Expect(received).To(HaveLen(2))
+		// Deliveries are sent concurrently, so they may arrive in any order.
+		var coins []int64
+		var types []string
+		for _, body := range received {
+			var e profile.Event
+			Expect(json.Unmarshal(body, &e)).To(Succeed())
+			if e.Profile != nil {
+				coins = append(coins, e.Profile.Coins)
+			}
+			if e.Punishment != nil {
+				types = append(types, e.Punishment.Type)
+			}
+		}
+		Expect(coins).To(Equal([]int64{5000}))
+		Expect(types).To(Equal([]string{"ban"}))
+	})
+
+	It("lists dead letters and redelivers them", func() {
+		failing = true
+		createWebhook(profile.Webhook{URL: receiver.URL, Secret: "secret"})
+		_, err := app.profiles.PutPunishment(profile.Punishment{PlayerID: "some_user", By: "some_admin", Type: "ban"})
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(deliveries("/v1/admin/deliveries?status=dead")).Should(HaveLen(1))
+
+		mu.Lock()
+		failing = false
+		mu.Unlock()
+
+		resp := request("POST", "/v1/admin/deliveries/1/redeliver", nil)
+		Expect(resp.Code).To(Equal(http.StatusAccepted))
+		Eventually(deliveries("/v1/admin/deliveries?status=delivered")).Should(HaveLen(1))
+		Expect(deliveries("/v1/admin/deliveries?status=dead")()).To(BeEmpty())
+
+		resp = request("POST", "/v1/admin/deliveries/2/redeliver", nil)
+		Expect(resp.Code).To(Equal(http.StatusNotFound))
+		resp = request("GET", "/v1/admin/deliveries?status=lost", nil)
+		Expect(resp.Code).To(Equal(http.StatusBadRequest))
+	})
+})